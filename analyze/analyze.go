@@ -0,0 +1,263 @@
+// Package analyze 在语法树上静态检查 OGNL 注入载荷
+//
+// 分析器按深度优先顺序访问每个节点，对每个节点执行所有规则；
+// 规则命中时报告一条 Finding，包括规则 ID、严重程度、说明以及节点在源码中的范围。
+//
+// 检查之前先用 optimize.Deobfuscate 还原拼接、编码等方式隐藏的常量，规则看到的是还原后的语法树，
+// 因此 "java.l" + "ang.Run" + "time" 与 "java.lang.Runtime" 得到同样的结果；
+// 还原出的节点保留被替换表达式的源码范围，每处还原另外报告一条 obfuscation 结果。
+// 除此之外分析不求值；需要知道变量来源的规则 (如 sandbox-exclusions 和 runtime-exec) 使用 dataflow 包的定义-使用关系。
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/optimize"
+)
+
+// Severity 严重程度
+type Severity int
+
+const (
+	Info Severity = iota
+	Low
+	Medium
+	High
+	Critical
+)
+
+var severityNames = [...]string{
+	Info:     "info",
+	Low:      "low",
+	Medium:   "medium",
+	High:     "high",
+	Critical: "critical",
+}
+
+func (s Severity) String() string {
+	if s >= 0 && int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// ParseSeverity 按名称解析严重程度
+func ParseSeverity(name string) (Severity, error) {
+	for s, n := range severityNames {
+		if n == name {
+			return Severity(s), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown severity %q", name)
+}
+
+// Finding 一条检查结果
+type Finding struct {
+	Rule     string
+	Severity Severity
+	Message  string
+	// Span 命中的源码范围，手工构造的语法树为零值
+	Span ast.Span
+	// Node 命中的节点
+	Node ast.Expression
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s [%s] %s: %s", f.Span, f.Severity, f.Rule, f.Message)
+}
+
+// Rule 检查规则
+type Rule struct {
+	ID          string
+	Severity    Severity
+	Description string
+	// Check 检查一个节点，每次命中调用一次 report
+	Check func(node ast.Expression, report func(span ast.Span, message string))
+	// CheckTree 检查整棵语法树，用于需要祖先节点等上下文的规则，每次命中调用一次 report
+	// Check 和 CheckTree 可以只设置其中一个
+	CheckTree func(root ast.Expression, report func(node ast.Expression, span ast.Span, message string))
+}
+
+// Analyzer 使用一组规则检查语法树，可以被多个 goroutine 同时使用
+type Analyzer struct {
+	rules []Rule
+}
+
+// New 使用给定规则创建分析器，不传规则时使用 DefaultRules
+func New(rules ...Rule) *Analyzer {
+	if len(rules) == 0 {
+		rules = DefaultRules()
+	}
+	return &Analyzer{rules: rules}
+}
+
+// Rules 返回分析器使用的规则
+func (a *Analyzer) Rules() []Rule {
+	return a.rules
+}
+
+// Analyze 还原语法树中混淆的常量后检查，结果按源码位置排序
+func (a *Analyzer) Analyze(expr ast.Expression) []Finding {
+	findings, _ := a.AnalyzeContext(context.Background(), expr)
+	return findings
+}
+
+// AnalyzeContext 与 Analyze 相同，ctx 结束时停止检查，返回已经得到的结果和 ctx.Err()
+// 还原和逐个节点的检查定期查看 ctx，CheckTree 规则在两条规则之间查看
+func (a *Analyzer) AnalyzeContext(ctx context.Context, expr ast.Expression) ([]Finding, error) {
+	revealed, rewrites, err := optimize.DeobfuscateContext(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	visited := 0
+	ast.Inspect(revealed, func(node ast.Expression) bool {
+		if visited++; visited%checkInterval == 0 && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			return false
+		}
+		for _, rule := range a.rules {
+			if rule.Check == nil {
+				continue
+			}
+			rule.Check(node, func(span ast.Span, message string) {
+				findings = append(findings, Finding{
+					Rule:     rule.ID,
+					Severity: rule.Severity,
+					Message:  message,
+					Span:     span,
+					Node:     node,
+				})
+			})
+		}
+		return true
+	})
+	for _, rule := range a.rules {
+		if rule.CheckTree == nil {
+			continue
+		}
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+		rule.CheckTree(revealed, func(node ast.Expression, span ast.Span, message string) {
+			findings = append(findings, Finding{
+				Rule:     rule.ID,
+				Severity: rule.Severity,
+				Message:  message,
+				Span:     span,
+				Node:     node,
+			})
+		})
+	}
+	findings = append(findings, obfuscationFindings(rewrites)...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Span.Start < findings[j].Span.Start
+	})
+	return findings, err
+}
+
+// checkInterval 逐个节点检查时每访问多少个节点查看一次 ctx
+const checkInterval = 256
+
+// obfuscationFindings 为每处还原出的常量报告一条结果，嵌套在另一处还原之内的只报告最外层
+func obfuscationFindings(rewrites []optimize.Rewrite) []Finding {
+	var revealed []optimize.Rewrite
+	for _, r := range rewrites {
+		if !r.Origin.IsValid() {
+			continue
+		}
+		switch r.Kind {
+		case optimize.RevealConstant:
+		case optimize.FoldConstant:
+			// 数值折叠不是混淆，只有拼出的字符串才报告
+			if _, ok := stringLiteral(r.Node); !ok {
+				continue
+			}
+		default:
+			continue
+		}
+		revealed = append(revealed, r)
+	}
+
+	var findings []Finding
+	for i, r := range revealed {
+		outer := true
+		for j, other := range revealed {
+			if i != j && other.Origin.Start <= r.Origin.Start && r.Origin.End <= other.Origin.End && other.Origin != r.Origin {
+				outer = false
+				break
+			}
+		}
+		// 同一范围多次还原时只保留最后一次，它的结果最完整
+		for _, other := range revealed[i+1:] {
+			if other.Origin == r.Origin {
+				outer = false
+			}
+		}
+		if !outer {
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:     "obfuscation",
+			Severity: Low,
+			Message:  fmt.Sprintf("expression builds the constant %s at runtime", abbreviate(r.Node.String())),
+			Span:     r.Origin,
+			Node:     r.Node,
+		})
+	}
+	return findings
+}
+
+// maxQuoted 消息中引用的源码的最大长度
+const maxQuoted = 200
+
+// abbreviate 截断过长的源码，注明原长度
+func abbreviate(s string) string {
+	if len(s) <= maxQuoted {
+		return s
+	}
+	n := maxQuoted
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return fmt.Sprintf("%s... (%d bytes)", s[:n], len(s))
+}
+
+var defaultAnalyzer = New()
+
+// Analyze 使用默认规则检查语法树
+func Analyze(expr ast.Expression) []Finding {
+	return defaultAnalyzer.Analyze(expr)
+}
+
+// AnalyzeString 解析表达式并使用默认规则检查
+func AnalyzeString(input string) ([]Finding, error) {
+	expr, err := ast.New(ast.NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		return nil, err
+	}
+	return Analyze(expr), nil
+}
+
+// MaxSeverity 返回结果中最高的严重程度，没有结果时返回 Info 和 false
+func MaxSeverity(findings []Finding) (Severity, bool) {
+	if len(findings) == 0 {
+		return Info, false
+	}
+	max := findings[0].Severity
+	for _, f := range findings[1:] {
+		if f.Severity > max {
+			max = f.Severity
+		}
+	}
+	return max, true
+}
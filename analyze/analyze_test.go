@@ -0,0 +1,219 @@
+package analyze
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// summarize 把检查结果格式化为 "规则 源码片段"，便于比较
+func summarize(input string, findings []Finding) string {
+	var lines []string
+	for _, f := range findings {
+		lines = append(lines, fmt.Sprintf("%s %s", f.Rule, f.Span.Text(input)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"#_memberAccess['allowStaticMethodAccess'] = true", []string{"member-access #_memberAccess"}},
+		{"#context['_memberAccess']", []string{"context-access #context", "member-access '_memberAccess'"}},
+		{"#attr['struts.valueStack'].context", []string{"context-access #attr"}},
+		{"#dm = @ognl.OgnlContext@DEFAULT_MEMBER_ACCESS", []string{"default-member-access @ognl.OgnlContext@DEFAULT_MEMBER_ACCESS"}},
+		{"@java.lang.Runtime@getRuntime().exec('id')", []string{
+			"dangerous-class @java.lang.Runtime@getRuntime()",
+			"runtime-exec @java.lang.Runtime@getRuntime().exec('id')",
+		}},
+		{"@Runtime@getRuntime().exec(#cmd).getInputStream()", []string{
+			"dangerous-class @Runtime@getRuntime()",
+			"runtime-exec @Runtime@getRuntime().exec(#cmd)",
+		}},
+		{"#rt=@java.lang.Runtime@getRuntime(),#rt.exec('id')", []string{
+			"dangerous-class @java.lang.Runtime@getRuntime()",
+			"runtime-exec exec('id')",
+		}},
+		{"(#a=@Runtime@getRuntime()).(#b=#a).(#b.exec('id'))", []string{
+			"dangerous-class @Runtime@getRuntime()",
+			"runtime-exec exec('id')",
+		}},
+		{"#r = @java.lang.Runtime@getRuntime()", []string{"dangerous-class @java.lang.Runtime@getRuntime()"}},
+		{"new java.lang.ProcessBuilder({'id'}).start()", []string{"process-builder new java.lang.ProcessBuilder({'id'})"}},
+		{"#this.getClass().getClassLoader().loadClass('x')", []string{"classloader getClass().getClassLoader()"}},
+		{"#c=#this.getClass(),#c.getClassLoader().loadClass('x')", []string{"classloader getClassLoader()"}},
+		{"#p=new java.lang.ProcessBuilder({'id'}),#q=#p,#q.start()", []string{
+			"process-builder new java.lang.ProcessBuilder({'id'})",
+			"process-builder start()",
+		}},
+		{"#ognlUtil.getExcludedPackageNames().clear()", []string{"sandbox-exclusions getExcludedPackageNames().clear()"}},
+		{"(#e=#ognlUtil.getExcludedClasses()).(#e.clear())", []string{"sandbox-exclusions clear()"}},
+		{"#list.clear()", nil},
+		{"@java.lang.Thread@currentThread().class.classLoader", []string{"classloader class.classLoader"}},
+		{"@java.lang.Class@forName('java.lang.Runtime').getDeclaredMethod('exec', #s)", []string{
+			"reflection @java.lang.Class@forName('java.lang.Runtime')",
+			"dangerous-class 'java.lang.Runtime'",
+			"reflection getDeclaredMethod('exec', #s)",
+		}},
+		{"@com.opensymphony.xwork2.ActionContext@CONTAINER", []string{"container-access @com.opensymphony.xwork2.ActionContext@CONTAINER"}},
+		{"user.name + ' ' + #request.id", nil},
+		{"#runtime.exec('id')", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			findings, err := AnalyzeString(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := summarize(tt.input, findings), strings.Join(tt.expected, "\n"); got != want {
+				t.Errorf("findings:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// TestAnalyzeObfuscated 混淆写法的类名和变量名在还原后同样命中规则，结果的范围指向原始写法
+func TestAnalyzeObfuscated(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"@java.lang.Class@forName(\"java.l\" + \"ang.Run\" + \"time\")", []string{
+			"reflection @java.lang.Class@forName(\"java.l\" + \"ang.Run\" + \"time\")",
+			"dangerous-class \"java.l\" + \"ang.Run\" + \"time\"",
+			"obfuscation \"java.l\" + \"ang.Run\" + \"time\"",
+		}},
+		{"@Class@forName(new java.lang.String(new byte[]{106,97,118,97,46,108,97,110,103,46,82,117,110,116,105,109,101}))", []string{
+			"reflection @Class@forName(new java.lang.String(new byte[]{106,97,118,97,46,108,97,110,103,46,82,117,110,116,105,109,101}))",
+			"dangerous-class new java.lang.String(new byte[]{106,97,118,97,46,108,97,110,103,46,82,117,110,116,105,109,101})",
+			"obfuscation new java.lang.String(new byte[]{106,97,118,97,46,108,97,110,103,46,82,117,110,116,105,109,101})",
+		}},
+		{"(#a='java.lang.').(#b=#a.concat('Process' + @java.lang.Character@toString(66) + 'uilder')).(#c=@Class@forName(#b))", []string{
+			"dangerous-class #a.concat('Process' + @java.lang.Character@toString(66) + 'uilder')",
+			"obfuscation #a.concat('Process' + @java.lang.Character@toString(66) + 'uilder')",
+			"reflection @Class@forName(#b)",
+			"dangerous-class #b",
+		}},
+		{`#a="java.lang.Run",#a=#a+"time",@java.lang.Class@forName(#a)`, []string{
+			`dangerous-class #a+"time"`,
+			`obfuscation #a+"time"`,
+			"reflection @java.lang.Class@forName(#a)",
+			"dangerous-class #a",
+		}},
+		{"#context['\\u005fmemberAccess']", []string{"context-access #context", "member-access '\\u005fmemberAccess'"}},
+		{"#m = '_member' + 'Access', #context[#m]", []string{
+			"member-access '_member' + 'Access'",
+			"obfuscation '_member' + 'Access'",
+			"context-access #context",
+			"member-access #m",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			findings, err := AnalyzeString(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := summarize(tt.input, findings), strings.Join(tt.expected, "\n"); got != want {
+				t.Errorf("findings:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// TestAnalyzeStrutsPayload 检查 main.go 中的 Struts 沙箱绕过载荷
+func TestAnalyzeStrutsPayload(t *testing.T) {
+	input := "(#context=#attr['struts.valueStack'].context).(#container=#context['com.opensymphony.xwork2.ActionContext.container'])." +
+		"(#ognlUtil=#container.getInstance(@com.opensymphony.xwork2.ognl.OgnlUtil@class))." +
+		"(#ognlUtil.setExcludedClasses('')).(#ognlUtil.setExcludedPackageNames(''))"
+	findings, err := AnalyzeString(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"context-access #context",
+		"context-access #attr",
+		"context-access #context",
+		"container-access 'com.opensymphony.xwork2.ActionContext.container'",
+		"sandbox-exclusions setExcludedClasses('')",
+		"sandbox-exclusions setExcludedPackageNames('')",
+	}
+	if got, want := summarize(input, findings), strings.Join(expected, "\n"); got != want {
+		t.Errorf("findings:\n%s\nwant:\n%s", got, want)
+	}
+	for _, f := range findings {
+		if f.Rule == "sandbox-exclusions" && !strings.Contains(f.Message, "on #ognlUtil (#container.getInstance(@com.opensymphony.xwork2.ognl.OgnlUtil@class))") {
+			t.Errorf("message %q does not name the receiver", f.Message)
+		}
+	}
+	if max, ok := MaxSeverity(findings); !ok || max != Critical {
+		t.Errorf("MaxSeverity = %v, %v", max, ok)
+	}
+}
+
+func TestAnalyzerCustomRules(t *testing.T) {
+	a := New(Rule{
+		ID:       "eval",
+		Severity: Low,
+		Check: func(node ast.Expression, report func(ast.Span, string)) {
+			if _, ok := node.(*ast.EvalExpression); ok {
+				report(node.Span(), "dynamic evaluation")
+			}
+		},
+	})
+	input := "#s = 'a', #s(1)"
+	expr, err := ast.New(ast.NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings := a.Analyze(expr)
+	if len(findings) != 1 || findings[0].Span.Text(input) != "#s(1)" || findings[0].Severity != Low {
+		t.Errorf("findings = %v", findings)
+	}
+
+	if s, err := ParseSeverity("high"); err != nil || s != High {
+		t.Errorf("ParseSeverity(high) = %v, %v", s, err)
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Error("expected error for unknown severity")
+	}
+}
+
+// TestAnalyzeLongConstant 还原出的长常量在消息中被截断
+func TestAnalyzeLongConstant(t *testing.T) {
+	input := "#a = '" + strings.Repeat("x", 1000) + "' + 'y', #a"
+	findings, err := AnalyzeString(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) == 0 {
+		t.Fatal("no findings")
+	}
+	for _, f := range findings {
+		if len(f.Message) > 2*maxQuoted || !strings.Contains(f.Message, "(1003 bytes)") {
+			t.Errorf("message %q", f.Message)
+		}
+	}
+}
+
+// TestAnalyzeContext ctx 结束后停止检查并返回 ctx.Err()
+func TestAnalyzeContext(t *testing.T) {
+	expr, err := ast.New(ast.NewLexer("@java.lang.Runtime@getRuntime().exec('id')")).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if findings, err := New().AnalyzeContext(ctx, expr); err != nil || len(findings) != 2 {
+		t.Errorf("AnalyzeContext = %v, %v", findings, err)
+	}
+	cancel()
+	if _, err := New().AnalyzeContext(ctx, expr); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled: %v", err)
+	}
+}
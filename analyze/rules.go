@@ -0,0 +1,380 @@
+package analyze
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/dataflow"
+)
+
+// =============================================================================
+// 内置规则
+// =============================================================================
+
+// DefaultRules 返回内置规则，覆盖 Struts 沙箱绕过和命令执行载荷中常见的写法
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			ID:          "member-access",
+			Severity:    Critical,
+			Description: "访问控制 OGNL 沙箱的 _memberAccess",
+			Check:       checkMemberAccess,
+		},
+		{
+			ID:          "default-member-access",
+			Severity:    Critical,
+			Description: "引用 @ognl.OgnlContext@DEFAULT_MEMBER_ACCESS 替换沙箱",
+			Check:       checkDefaultMemberAccess,
+		},
+		{
+			ID:          "sandbox-exclusions",
+			Severity:    Critical,
+			Description: "调用 OgnlUtil 修改或清空排除的类和包，OgnlUtil 和排除列表可以经过变量传递",
+			CheckTree:   checkSandboxExclusions,
+		},
+		{
+			ID:          "runtime-exec",
+			Severity:    Critical,
+			Description: "通过 Runtime.getRuntime().exec 执行命令，Runtime 对象可以经过变量传递",
+			CheckTree:   checkRuntimeExec,
+		},
+		{
+			ID:          "process-builder",
+			Severity:    Critical,
+			Description: "构造 java.lang.ProcessBuilder 启动进程，ProcessBuilder 对象可以经过变量传递",
+			Check:       checkProcessBuilder,
+			CheckTree:   checkProcessStart,
+		},
+		{
+			ID:          "container-access",
+			Severity:    High,
+			Description: "从上下文中取出 XWork 容器 (ActionContext.container)",
+			Check:       checkContainerAccess,
+		},
+		{
+			ID:          "classloader",
+			Severity:    High,
+			Description: "通过 getClass().getClassLoader() 取得类加载器，Class 对象可以经过变量传递",
+			CheckTree:   checkClassLoader,
+		},
+		{
+			ID:          "reflection",
+			Severity:    High,
+			Description: "通过 forName/getDeclaredMethod 等反射调用",
+			Check:       checkReflection,
+		},
+		{
+			ID:          "dangerous-class",
+			Severity:    High,
+			Description: "以字符串写出 java.lang.Runtime 等可以执行命令或加载代码的类名，或者取得 Runtime 对象",
+			Check:       checkDangerousClass,
+		},
+		{
+			ID:          "context-access",
+			Severity:    Medium,
+			Description: "访问 OGNL 上下文 #context 或 Struts 的 #attr",
+			Check:       checkContextAccess,
+		},
+	}
+}
+
+const containerKey = "com.opensymphony.xwork2.ActionContext.container"
+
+var (
+	exclusionSetters = map[string]bool{
+		"setExcludedClasses":             true,
+		"setExcludedPackageNames":        true,
+		"setExcludedPackageNamePatterns": true,
+		"setExcludedClassNamePatterns":   true,
+	}
+	// exclusionGetters 返回排除列表本身的方法，对结果调用 clear() 同样清空排除列表
+	exclusionGetters = map[string]bool{
+		"getExcludedClasses":             true,
+		"getExcludedPackageNames":        true,
+		"getExcludedPackageNamePatterns": true,
+		"getExcludedClassNamePatterns":   true,
+	}
+	reflectionMethods = map[string]bool{
+		"forName":                 true,
+		"getDeclaredMethod":       true,
+		"getDeclaredMethods":      true,
+		"getDeclaredField":        true,
+		"getDeclaredFields":       true,
+		"getDeclaredConstructor":  true,
+		"getDeclaredConstructors": true,
+		"setAccessible":           true,
+	}
+	// dangerousClasses 可以执行命令、脚本或加载任意代码的类
+	dangerousClasses = map[string]bool{
+		"java.lang.Runtime":                true,
+		"java.lang.ProcessBuilder":         true,
+		"java.lang.ClassLoader":            true,
+		"java.net.URLClassLoader":          true,
+		"javax.script.ScriptEngineManager": true,
+	}
+	contextVariables = map[string]bool{
+		"context": true,
+		"attr":    true,
+	}
+)
+
+func checkMemberAccess(node ast.Expression, report func(ast.Span, string)) {
+	switch n := node.(type) {
+	case *ast.VariableExpression:
+		if n.Name == "_memberAccess" {
+			report(n.Span(), "access to #_memberAccess, which controls the OGNL sandbox")
+		}
+	case *ast.Identifier:
+		if n.Value == "_memberAccess" {
+			report(n.Span(), "access to the _memberAccess property, which controls the OGNL sandbox")
+		}
+	case *ast.Literal:
+		if s, ok := n.Value.(string); ok && s == "_memberAccess" {
+			report(n.Span(), "lookup of _memberAccess, which controls the OGNL sandbox")
+		}
+	}
+}
+
+func checkDefaultMemberAccess(node ast.Expression, report func(ast.Span, string)) {
+	if n, ok := node.(*ast.StaticFieldExpression); ok && isClass(ast.ClassOf(n), "ognl.OgnlContext") && n.Field == "DEFAULT_MEMBER_ACCESS" {
+		report(n.Span(), "reference to @ognl.OgnlContext@DEFAULT_MEMBER_ACCESS, used to replace the sandbox")
+	}
+}
+
+// checkSandboxExclusions 报告对排除列表的修改，接收者是变量时在消息中写出变量的值，
+// 如 #ognlUtil 来自 #container.getInstance(@com.opensymphony.xwork2.ognl.OgnlUtil@class)；
+// 排除列表也可以取出后清空，如 #ognlUtil.getExcludedClasses().clear()，列表可以先保存在变量中
+func checkSandboxExclusions(root ast.Expression, report func(ast.Expression, ast.Span, string)) {
+	graph := dataflow.Analyze(root)
+	receivers := chainReceivers(root)
+	ast.Inspect(root, func(node ast.Expression) bool {
+		n, ok := node.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+		receiver := receiverOf(n, receivers)
+		if n.Method == "clear" && len(n.Arguments) == 0 {
+			if getter, ok := receiver.(*ast.CallExpression); ok && exclusionGetters[getter.Method] {
+				report(n, spanOf(getter, n), fmt.Sprintf("call to %s().clear(), which clears the sandbox exclusion list", getter.Method))
+				return true
+			}
+			if v, ok := receiver.(*ast.VariableExpression); ok {
+				if getter, ok := lastStep(graph.Resolve(v)).(*ast.CallExpression); ok && exclusionGetters[getter.Method] {
+					report(n, n.Span(), fmt.Sprintf("call to clear on %s, which holds the sandbox exclusion list returned by %s()", v, getter.Method))
+				}
+			}
+			return true
+		}
+		if !exclusionSetters[n.Method] {
+			return true
+		}
+		if v, ok := receiver.(*ast.VariableExpression); ok {
+			if value, ok := graph.Value(v); ok {
+				report(n, n.Span(), fmt.Sprintf("call to %s on %s (%s), which clears the sandbox exclusion list", n.Method, v, value))
+				return true
+			}
+		}
+		report(n, n.Span(), fmt.Sprintf("call to %s, which clears the sandbox exclusion list", n.Method))
+		return true
+	})
+}
+
+// checkRuntimeExec 报告在 Runtime 对象上调用 exec，Runtime 对象可以直接取得，也可以来自变量，
+// 如 #rt=@java.lang.Runtime@getRuntime(),#rt.exec('id')
+func checkRuntimeExec(root ast.Expression, report func(ast.Expression, ast.Span, string)) {
+	graph := dataflow.Analyze(root)
+	receivers := chainReceivers(root)
+	ast.Inspect(root, func(node ast.Expression) bool {
+		n, ok := node.(*ast.CallExpression)
+		if !ok || n.Method != "exec" {
+			return true
+		}
+		receiver := receiverOf(n, receivers)
+		if isGetRuntime(receiver) {
+			report(n, spanOf(receiver, n), "command execution through Runtime.getRuntime().exec")
+			return true
+		}
+		if v, ok := receiver.(*ast.VariableExpression); ok && isGetRuntime(graph.Resolve(v)) {
+			report(n, n.Span(), fmt.Sprintf("command execution through exec on %s, which holds Runtime.getRuntime()", v))
+		}
+		return true
+	})
+}
+
+// isGetRuntime 报告节点是否为 @java.lang.Runtime@getRuntime()
+func isGetRuntime(node ast.Expression) bool {
+	sm, ok := node.(*ast.StaticMethodExpression)
+	return ok && isClass(ast.ClassOf(sm), "java.lang.Runtime") && sm.Method == "getRuntime"
+}
+
+func checkProcessBuilder(node ast.Expression, report func(ast.Span, string)) {
+	if isNewProcessBuilder(node) {
+		report(node.Span(), "construction of java.lang.ProcessBuilder")
+	}
+}
+
+// checkProcessStart 报告在保存 ProcessBuilder 的变量上调用 start，如 #p=new java.lang.ProcessBuilder({'id'}),#p.start()
+// 直接在构造出的对象上调用 start 时构造本身已经报告过
+func checkProcessStart(root ast.Expression, report func(ast.Expression, ast.Span, string)) {
+	graph := dataflow.Analyze(root)
+	receivers := chainReceivers(root)
+	ast.Inspect(root, func(node ast.Expression) bool {
+		n, ok := node.(*ast.CallExpression)
+		if !ok || n.Method != "start" {
+			return true
+		}
+		if v, ok := receiverOf(n, receivers).(*ast.VariableExpression); ok && isNewProcessBuilder(lastStep(graph.Resolve(v))) {
+			report(n, n.Span(), fmt.Sprintf("process started through start on %s, which holds a java.lang.ProcessBuilder", v))
+		}
+		return true
+	})
+}
+
+// isNewProcessBuilder 报告节点是否构造 java.lang.ProcessBuilder
+func isNewProcessBuilder(node ast.Expression) bool {
+	n, ok := node.(*ast.ConstructorExpression)
+	return ok && !n.IsArray && isClass(ast.ClassOf(n), "java.lang.ProcessBuilder")
+}
+
+func checkContainerAccess(node ast.Expression, report func(ast.Span, string)) {
+	switch n := node.(type) {
+	case *ast.Literal:
+		if s, ok := n.Value.(string); ok && s == containerKey {
+			report(n.Span(), "lookup of the XWork container through "+containerKey)
+		}
+	case *ast.StaticFieldExpression:
+		if isClass(ast.ClassOf(n), "com.opensymphony.xwork2.ActionContext") && n.Field == "CONTAINER" {
+			report(n.Span(), "reference to ActionContext.CONTAINER")
+		}
+	}
+}
+
+// checkClassLoader 报告在 Class 对象上取得类加载器，Class 对象可以直接取得，也可以来自变量，
+// 如 #c=#this.getClass(),#c.getClassLoader()
+func checkClassLoader(root ast.Expression, report func(ast.Expression, ast.Span, string)) {
+	graph := dataflow.Analyze(root)
+	receivers := chainReceivers(root)
+	ast.Inspect(root, func(node ast.Expression) bool {
+		if !isClassLoaderStep(node) {
+			return true
+		}
+		receiver := receivers[node]
+		if call, ok := node.(*ast.CallExpression); ok && call.Object != nil {
+			receiver = call.Object
+		}
+		if isClassStep(receiver) {
+			report(node, spanOf(receiver, node), "class loader obtained through getClass().getClassLoader()")
+			return true
+		}
+		if v, ok := receiver.(*ast.VariableExpression); ok && isClassStep(lastStep(graph.Resolve(v))) {
+			report(node, node.Span(), fmt.Sprintf("class loader obtained from %s, which holds a Class object", v))
+		}
+		return true
+	})
+}
+
+// isClassStep 链中取得 Class 对象的一步：getClass()、.class 或 @X@class
+func isClassStep(node ast.Expression) bool {
+	switch n := node.(type) {
+	case *ast.CallExpression:
+		return n.Method == "getClass" && len(n.Arguments) == 0
+	case *ast.Identifier:
+		return n.Value == "class"
+	case *ast.StaticFieldExpression:
+		return n.Field == "class"
+	}
+	return false
+}
+
+func isClassLoaderStep(node ast.Expression) bool {
+	switch n := node.(type) {
+	case *ast.CallExpression:
+		return n.Method == "getClassLoader" && len(n.Arguments) == 0
+	case *ast.Identifier:
+		return n.Value == "classLoader"
+	}
+	return false
+}
+
+func checkReflection(node ast.Expression, report func(ast.Span, string)) {
+	switch n := node.(type) {
+	case *ast.CallExpression:
+		if reflectionMethods[n.Method] {
+			report(n.Span(), fmt.Sprintf("reflective call to %s", n.Method))
+		}
+	case *ast.StaticMethodExpression:
+		if reflectionMethods[n.Method] {
+			report(n.Span(), fmt.Sprintf("reflective call to @%s@%s", n.ClassName, n.Method))
+		}
+	}
+}
+
+func checkDangerousClass(node ast.Expression, report func(ast.Span, string)) {
+	if isGetRuntime(node) {
+		report(node.Span(), "call to Runtime.getRuntime(), which returns the object used to execute commands")
+		return
+	}
+	if s, ok := stringLiteral(node); ok && dangerousClasses[s] {
+		report(node.Span(), fmt.Sprintf("string names the class %s", s))
+	}
+}
+
+func checkContextAccess(node ast.Expression, report func(ast.Span, string)) {
+	if n, ok := node.(*ast.VariableExpression); ok && contextVariables[n.Name] {
+		report(n.Span(), fmt.Sprintf("access to #%s", n.Name))
+	}
+}
+
+// isClass 报告类名是否指向 fqcn，java.lang 下的类可以省略包名
+func isClass(name, fqcn string) bool {
+	if name == fqcn {
+		return true
+	}
+	simple, ok := strings.CutPrefix(fqcn, "java.lang.")
+	return ok && name == simple
+}
+
+// stringLiteral 返回字符串字面量的值
+func stringLiteral(node ast.Expression) (string, bool) {
+	if lit, ok := node.(*ast.Literal); ok {
+		s, ok := lit.Value.(string)
+		return s, ok
+	}
+	return "", false
+}
+
+// chainReceivers 返回链中每一步的接收者，即链中的前一步
+func chainReceivers(root ast.Expression) map[ast.Expression]ast.Expression {
+	receivers := map[ast.Expression]ast.Expression{}
+	ast.Inspect(root, func(node ast.Expression) bool {
+		if chain, ok := node.(*ast.ChainExpression); ok {
+			for i := 1; i < len(chain.Children); i++ {
+				receivers[chain.Children[i]] = chain.Children[i-1]
+			}
+		}
+		return true
+	})
+	return receivers
+}
+
+// receiverOf 返回方法调用的接收者，没有接收者时返回 nil
+func receiverOf(n *ast.CallExpression, receivers map[ast.Expression]ast.Expression) ast.Expression {
+	if n.Object != nil {
+		return n.Object
+	}
+	return receivers[n]
+}
+
+// lastStep 返回链的最后一步，不是链时返回节点本身
+func lastStep(node ast.Expression) ast.Expression {
+	if chain, ok := node.(*ast.ChainExpression); ok && len(chain.Children) > 0 {
+		return chain.Children[len(chain.Children)-1]
+	}
+	return node
+}
+
+// spanOf 从 first 开始到 last 结束的源码范围
+func spanOf(first, last ast.Expression) ast.Span {
+	return ast.Span{Start: first.Span().Start, End: last.Span().End}
+}
@@ -18,6 +18,8 @@ type Node interface {
 // Expression 表达式节点接口
 type Expression interface {
 	Node
+	Span() Span
+	SetSpan(span Span)
 	expressionNode()
 }
 
@@ -31,11 +33,56 @@ type Statement interface {
 // 表达式节点实现
 // =============================================================================
 
+// Span 节点在源码中的字节范围 [Start, End)
+type Span struct {
+	Start int
+	End   int
+}
+
+// IsValid 报告范围是否已设置
+func (s Span) IsValid() bool {
+	return s.End > s.Start
+}
+
+// Text 返回范围在源码中对应的文本，范围无效或越界时返回空串
+func (s Span) Text(input string) string {
+	if !s.IsValid() || s.Start < 0 || s.End > len(input) {
+		return ""
+	}
+	return input[s.Start:s.End]
+}
+
+// Position 返回范围起点在源码中的行号和列号（均从 1 开始，列按字节计）
+func (s Span) Position(input string) (line, column int) {
+	line, column = 1, 1
+	for i := 0; i < s.Start && i < len(input); i++ {
+		if input[i] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%d:%d", s.Start, s.End)
+}
+
 // BaseExpression 基础表达式结构
-type BaseExpression struct{}
+type BaseExpression struct {
+	span Span
+}
 
 func (be *BaseExpression) expressionNode() {}
 
+// Span 返回节点在源码中的范围，手工构造的节点返回零值
+func (be *BaseExpression) Span() Span { return be.span }
+
+// SetSpan 设置节点在源码中的范围
+func (be *BaseExpression) SetSpan(span Span) { be.span = span }
+
 // SequenceExpression 序列表达式 (逗号分隔)
 type SequenceExpression struct {
 	BaseExpression
@@ -116,6 +163,9 @@ type BinaryExpression struct {
 	Left     Expression
 	Operator TokenType
 	Right    Expression
+	// Spelling 运算符在源码中的写法，如 eq 或 ==；手工构造的节点为空
+	Spelling string
+	spelled  bool // String 使用 Spelling 而不是规范写法，见 spelledString
 }
 
 func (be *BinaryExpression) String() string {
@@ -215,6 +265,9 @@ func (be *BinaryExpression) isLeftAssociative() bool {
 }
 
 func (be *BinaryExpression) operatorString() string {
+	if be.spelled && be.Spelling != "" {
+		return be.Spelling
+	}
 	switch be.Operator {
 	case OR:
 		return "||"
@@ -319,6 +372,9 @@ type UnaryExpression struct {
 	BaseExpression
 	Operator TokenType
 	Operand  Expression
+	// Spelling 运算符在源码中的写法，如 not 或 !；手工构造的节点为空
+	Spelling string
+	spelled  bool // String 使用 Spelling 而不是规范写法，见 spelledString
 }
 
 func (ue *UnaryExpression) String() string {
@@ -333,6 +389,13 @@ func (ue *UnaryExpression) String() string {
 }
 
 func (ue *UnaryExpression) operatorString() string {
+	if ue.spelled && ue.Spelling != "" {
+		if isLetter(ue.Spelling[0]) {
+			// not x
+			return ue.Spelling + " "
+		}
+		return ue.Spelling
+	}
 	switch ue.Operator {
 	case MINUS:
 		return "-"
@@ -368,6 +431,7 @@ type InstanceofExpression struct {
 	Operand    Expression
 	TargetType string
 	TypeNode   Expression // 类型节点(ASTConst),用于AST树结构
+	Resolved   string     // ClassResolver 解析出的规范类名，未解析时为空
 }
 
 func (ie *InstanceofExpression) String() string {
@@ -487,6 +551,8 @@ type StaticMethodExpression struct {
 	ClassName string
 	Method    string
 	Arguments []Expression
+	Shorthand bool   // @@method() 简写，ClassName 为 ShorthandClass
+	Resolved  string // ClassResolver 解析出的规范类名，未解析时为空
 }
 
 func (sme *StaticMethodExpression) String() string {
@@ -504,6 +570,7 @@ type StaticFieldExpression struct {
 	BaseExpression
 	ClassName string
 	Field     string
+	Resolved  string // ClassResolver 解析出的规范类名，未解析时为空
 }
 
 func (sfe *StaticFieldExpression) String() string {
@@ -518,6 +585,7 @@ type ConstructorExpression struct {
 	ClassName string
 	Arguments []Expression
 	IsArray   bool
+	Resolved  string // ClassResolver 解析出的规范类名 (数组为元素类型)，未解析时为空
 }
 
 func (ce *ConstructorExpression) String() string {
@@ -816,6 +884,7 @@ type MapExpression struct {
 	BaseExpression
 	Pairs     []Expression // 改为 Expression 列表，每个元素是 KeyValueExpression
 	ClassName string       // 可选的类型名，用于 #@ClassName@{...} 语法
+	Resolved  string       // ClassResolver 解析出的规范类名，未解析或没有类型名时为空
 }
 
 // KeyValueExpression 键值对表达式 (对应 Java 的 ASTKeyValue)
@@ -876,3 +945,28 @@ func (dse *DynamicSubscriptExpression) String() string {
 }
 
 func (dse *DynamicSubscriptExpression) Type() string { return "ASTDynamicSubscript" }
+
+// DynamicSubscriptOf 判断下标表达式是否为动态下标 [^], [|], [$], [*]
+// 链中的动态下标被解析为 IndexExpression，索引是未加引号的符号字面量，
+// 与字符串下标 ["^"] 的区别在于 Raw 不带引号
+func DynamicSubscriptOf(ie *IndexExpression) (DynamicSubscriptType, bool) {
+	lit, ok := ie.Index.(*Literal)
+	if !ok {
+		return 0, false
+	}
+	symbol, ok := lit.Value.(string)
+	if !ok || lit.Raw != symbol {
+		return 0, false
+	}
+	switch symbol {
+	case "^":
+		return FIRST, true
+	case "|":
+		return MID, true
+	case "$":
+		return LAST, true
+	case "*":
+		return ALL, true
+	}
+	return 0, false
+}
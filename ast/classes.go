@@ -0,0 +1,216 @@
+package ast
+
+import (
+	"strings"
+)
+
+// =============================================================================
+// 类名解析 - 把源码中的类名规范化为全限定的二进制名
+// =============================================================================
+
+// ShorthandClass @@method() 简写在语法树中记录的类名，与 OGNL 一致为 java.lang.Math
+const ShorthandClass = "java.lang.Math"
+
+// ClassResolver 把源码中的类名解析为规范的二进制名：包名用 . 分隔，内部类用 $ 分隔，
+// 如 java.util.Map$Entry。可以被多个 goroutine 同时使用，使用期间不能修改字段
+//
+// 解析顺序：
+//  1. 类名本身，. 和 $ 可以混用 (java.util.Map.Entry 与 java.util.Map$Entry 相同)
+//  2. 按顺序加上 Imports 中的隐式导入 (Runtime 得到 java.lang.Runtime)
+//  3. 都不在 Known 中时按命名约定猜测：第一个大写开头的段是顶层类，之后的段是内部类；
+//     没有包名的类名加上第一个导入的包
+type ClassResolver struct {
+	// Imports 隐式导入，包名 (java.util) 导入包中的所有类，类名 (java.util.List) 只导入该类
+	Imports []string
+	// Known 已知的类，写作二进制名
+	Known map[string]bool
+	// Shorthand @@ 简写代表的类，空字符串表示 ShorthandClass
+	Shorthand string
+}
+
+// NewClassResolver 返回隐式导入 java.lang 和 java.util、已知载荷中常见的 JDK 和 Struts 类的解析器，
+// known 中的类名追加到已知的类中
+func NewClassResolver(known ...string) *ClassResolver {
+	r := &ClassResolver{Imports: []string{"java.lang", "java.util"}, Known: map[string]bool{}}
+	for _, name := range defaultKnownClasses {
+		r.Known[name] = true
+	}
+	for _, name := range known {
+		r.Known[name] = true
+	}
+	return r
+}
+
+var defaultKnownClasses = []string{
+	"java.lang.Object", "java.lang.String", "java.lang.Math", "java.lang.System", "java.lang.Runtime",
+	"java.lang.Process", "java.lang.ProcessBuilder", "java.lang.Thread", "java.lang.Class", "java.lang.ClassLoader",
+	"java.lang.Integer", "java.lang.Long", "java.lang.Short", "java.lang.Byte", "java.lang.Double", "java.lang.Float",
+	"java.lang.Boolean", "java.lang.Character", "java.lang.StringBuilder", "java.lang.StringBuffer",
+	"java.lang.reflect.Method", "java.lang.reflect.Field", "java.lang.reflect.Constructor", "java.lang.reflect.Array",
+	"java.util.Map", "java.util.Map$Entry", "java.util.HashMap", "java.util.LinkedHashMap", "java.util.List",
+	"java.util.ArrayList", "java.util.LinkedList", "java.util.Set", "java.util.HashSet", "java.util.Arrays",
+	"java.util.Collections", "java.util.Scanner", "java.util.Date", "java.util.Base64",
+	"java.io.File", "java.io.InputStream", "java.io.BufferedReader", "java.io.InputStreamReader",
+	"java.net.URL", "java.net.URLClassLoader", "javax.script.ScriptEngineManager", "javax.naming.InitialContext",
+	"ognl.OgnlContext", "ognl.OgnlRuntime", "ognl.DefaultMemberAccess", "ognl.MemberAccess",
+	"com.opensymphony.xwork2.ActionContext", "com.opensymphony.xwork2.ognl.OgnlUtil",
+	"com.opensymphony.xwork2.inject.Container", "com.opensymphony.xwork2.util.ValueStack",
+	"org.apache.struts2.ServletActionContext",
+}
+
+// primitiveTypes instanceof 和数组构造中可以出现的基本类型
+var primitiveTypes = map[string]bool{
+	"boolean": true, "byte": true, "char": true, "short": true, "int": true, "long": true, "float": true, "double": true,
+}
+
+var defaultClassResolver = NewClassResolver()
+
+// ResolveClasses 使用 NewClassResolver() 解析语法树中的类名，见 ClassResolver.ResolveTree
+func ResolveClasses(expr Expression) []Expression {
+	return defaultClassResolver.ResolveTree(expr)
+}
+
+// Resolve 返回类名的规范形式，以及它是否是已知的类 (或基本类型)
+// 无法确定时按命名约定返回最可能的名字
+func (r *ClassResolver) Resolve(name string) (string, bool) {
+	segs := strings.FieldsFunc(name, func(c rune) bool { return c == '.' || c == '$' })
+	for i, seg := range segs {
+		segs[i] = strings.TrimSpace(seg)
+		if segs[i] == "" {
+			return strings.TrimSpace(name), false
+		}
+	}
+	if len(segs) == 0 {
+		return "", false
+	}
+	if len(segs) == 1 && primitiveTypes[segs[0]] {
+		return segs[0], true
+	}
+	// 从最长的包名开始尝试每一种包名与类名的划分
+	for i := len(segs) - 1; i >= 0; i-- {
+		if c := binaryName(segs[:i], segs[i:]); r.Known[c] {
+			return c, true
+		}
+	}
+	for _, imp := range r.Imports {
+		if pkg, class, ok := cutLast(imp); ok && class == segs[0] && isUpper(class) {
+			// 单个类的导入
+			return binaryName(strings.Split(pkg, "."), segs), true
+		}
+		if c := binaryName(strings.Split(imp, "."), segs); r.Known[c] {
+			return c, true
+		}
+	}
+	for i, seg := range segs {
+		if !isUpper(seg) {
+			continue
+		}
+		if i == 0 {
+			if pkg := r.firstPackage(); pkg != "" {
+				return binaryName(strings.Split(pkg, "."), segs), false
+			}
+		}
+		return binaryName(segs[:i], segs[i:]), false
+	}
+	// 不符合命名约定的类名保留原来的分隔符
+	return strings.Join(strings.Fields(name), ""), false
+}
+
+// ResolveTree 在语法树中静态方法、静态字段、构造函数、instanceof 和带类型的 Map 上原地记录 Resolved，
+// 返回类名不是已知类的节点
+func (r *ClassResolver) ResolveTree(expr Expression) []Expression {
+	var unknown []Expression
+	Inspect(expr, func(node Expression) bool {
+		if name, dst := classRef(node); dst != nil {
+			c, ok := r.Resolve(r.nameOf(node, name))
+			*dst = c
+			if !ok {
+				unknown = append(unknown, node)
+			}
+		}
+		return true
+	})
+	return unknown
+}
+
+// canonical 返回节点引用的类的规范名，已记录 Resolved 时直接使用
+func (r *ClassResolver) canonical(node Expression) string {
+	name, dst := classRef(node)
+	if dst == nil {
+		return ""
+	}
+	if *dst != "" {
+		return *dst
+	}
+	c, _ := r.Resolve(r.nameOf(node, name))
+	return c
+}
+
+// nameOf 返回需要解析的类名，@@ 简写使用 Shorthand
+func (r *ClassResolver) nameOf(node Expression, name string) string {
+	if n, ok := node.(*StaticMethodExpression); ok && n.Shorthand && r.Shorthand != "" {
+		return r.Shorthand
+	}
+	return name
+}
+
+// ClassOf 返回节点引用的类：已解析时为 Resolved，否则为源码中的类名；不引用类的节点返回空字符串
+func ClassOf(node Expression) string {
+	name, dst := classRef(node)
+	if dst != nil && *dst != "" {
+		return *dst
+	}
+	return name
+}
+
+// classRef 返回节点中源码写出的类名和 Resolved 字段，不引用类的节点 (包括不带类型的 Map) 返回 nil
+func classRef(node Expression) (string, *string) {
+	switch n := node.(type) {
+	case *StaticMethodExpression:
+		return n.ClassName, &n.Resolved
+	case *StaticFieldExpression:
+		return n.ClassName, &n.Resolved
+	case *ConstructorExpression:
+		return n.ClassName, &n.Resolved
+	case *InstanceofExpression:
+		return n.TargetType, &n.Resolved
+	case *MapExpression:
+		if n.ClassName != "" {
+			return n.ClassName, &n.Resolved
+		}
+	}
+	return "", nil
+}
+
+// firstPackage 返回第一个导入整个包的隐式导入
+func (r *ClassResolver) firstPackage() string {
+	for _, imp := range r.Imports {
+		if _, class, ok := cutLast(imp); !ok || !isUpper(class) {
+			return imp
+		}
+	}
+	return ""
+}
+
+// binaryName 用包名和类名的各段拼出二进制名
+func binaryName(pkg, class []string) string {
+	name := strings.Join(class, "$")
+	if len(pkg) == 0 {
+		return name
+	}
+	return strings.Join(pkg, ".") + "." + name
+}
+
+// cutLast 在最后一个 . 处切分
+func cutLast(name string) (string, string, bool) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return "", name, false
+	}
+	return name[:i], name[i+1:], true
+}
+
+// isUpper 报告名字是否以大写字母开头，按命名约定这是类名而不是包名
+func isUpper(name string) bool {
+	return name != "" && 'A' <= name[0] && name[0] <= 'Z'
+}
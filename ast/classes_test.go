@@ -0,0 +1,105 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestClassResolverResolve 测试隐式导入、内部类分隔符、已知的类和命名约定
+func TestClassResolverResolve(t *testing.T) {
+	r := NewClassResolver("com.example.Outer$Inner")
+	r.Imports = append(r.Imports, "com.example.Outer")
+	tests := []struct {
+		name     string
+		expected string
+		known    bool
+	}{
+		{"Runtime", "java.lang.Runtime", true},
+		{"java.lang.Runtime", "java.lang.Runtime", true},
+		{"java.lang . Runtime", "java.lang.Runtime", true},
+		{"HashMap", "java.util.HashMap", true},
+		{"Map.Entry", "java.util.Map$Entry", true},
+		{"java.util.Map.Entry", "java.util.Map$Entry", true},
+		{"java.util.Map$Entry", "java.util.Map$Entry", true},
+		{"Outer.Inner", "com.example.Outer$Inner", true},
+		{"com.example.Outer.Inner", "com.example.Outer$Inner", true},
+		{"int", "int", true},
+		{"Foo", "java.lang.Foo", false},
+		{"Foo.Bar", "java.lang.Foo$Bar", false},
+		{"org.acme.Widget.Part", "org.acme.Widget$Part", false},
+		{"org.acme.widget", "org.acme.widget", false},
+	}
+	for _, tt := range tests {
+		got, known := r.Resolve(tt.name)
+		if got != tt.expected || known != tt.known {
+			t.Errorf("Resolve(%q) = %q, %v, want %q, %v", tt.name, got, known, tt.expected, tt.known)
+		}
+	}
+}
+
+// TestResolveTree 解析结果记录在节点上，@@ 简写可以改为其他类
+func TestResolveTree(t *testing.T) {
+	input := "@Runtime@getRuntime(), @@abs(-1), @System@out, new ArrayList(), #a instanceof Map.Entry, #@LinkedHashMap@{}, @Foo@bar()"
+	expr, err := New(NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewClassResolver()
+	r.Shorthand = "java.lang.StrictMath"
+	unknown := r.ResolveTree(expr)
+	var got []string
+	Inspect(expr, func(node Expression) bool {
+		if c := ClassOf(node); c != "" {
+			got = append(got, c)
+		}
+		return true
+	})
+	expected := []string{
+		"java.lang.Runtime", "java.lang.StrictMath", "java.lang.System", "java.util.ArrayList",
+		"java.util.Map$Entry", "java.util.LinkedHashMap", "java.lang.Foo",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+	var names []string
+	for _, n := range unknown {
+		names = append(names, n.String())
+	}
+	if want := "@java.lang.Math@abs(-1), @Foo@bar()"; strings.Join(names, ", ") != want {
+		t.Errorf("unknown = %s, want %s", strings.Join(names, ", "), want)
+	}
+	// 源码中的写法保持不变
+	if s := expr.String(); !strings.Contains(s, "@Runtime@getRuntime()") || !strings.Contains(s, "@java.lang.Math@abs") {
+		t.Errorf("String() = %s", s)
+	}
+}
+
+// TestMatchClasses 设置 Classes 后类名按规范名比较
+func TestMatchClasses(t *testing.T) {
+	tests := []struct {
+		pattern, input string
+		expected       []string
+	}{
+		{"@java.lang.Runtime@getRuntime()", "@Runtime@getRuntime() + @java.lang.Runtime@getRuntime()", []string{
+			"@Runtime@getRuntime()", "@java.lang.Runtime@getRuntime()",
+		}},
+		{"@$C@$M()", "@ProcessBuilder@start()", []string{"@ProcessBuilder@start() $C=java.lang.ProcessBuilder $M=start"}},
+		{"new java.util.Map.Entry()", "new Map$Entry()", []string{"new Map$Entry()"}},
+		{"$X instanceof String", "#a instanceof java.lang.String", []string{"#a instanceof java.lang.String $X=#a"}},
+	}
+	for _, tt := range tests {
+		expr, err := New(NewLexer(tt.input)).ParseTopLevelExpression()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := ParsePattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Classes = NewClassResolver()
+		got := describe(tt.input, p.Find(expr))
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s in %s:\n%s\nwant:\n%s", tt.pattern, tt.input, strings.Join(got, "\n"), strings.Join(tt.expected, "\n"))
+		}
+	}
+}
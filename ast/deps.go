@@ -0,0 +1,271 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// =============================================================================
+// 依赖 - 表达式读写的属性路径
+// =============================================================================
+
+// Path 规范化的属性访问路径，如 user.address.city 或 orders[*].total
+//
+// 下标为字符串常量时写作属性 (user['name'] 即 user.name)，为整数常量时保留 ([0])，
+// 动态下标和其他下标 (包括 orders[#i]、user['na' + 'me'] 这样求值才能知道的下标) 写作 [*]
+// 并设置 DynamicSubscript；方法调用写作 name()。路径隐含其前缀：读取 user.address.city
+// 也读取了 user 和 user.address
+type Path struct {
+	// Root 路径的起点：空字符串表示根对象，"#name" 表示上下文变量，lambda 函数体中为 "#this"
+	Root  string
+	Steps []string
+	// Call 路径经过方法调用，方法可能读写路径之外的状态
+	Call bool
+	// Projection 路径经过投影或选择，[*] 表示集合中的每个元素
+	Projection bool
+	// DynamicSubscript 路径经过 [^] [|] [$] [*] 动态下标或不是字符串和整数常量的下标，
+	// 对应的一步写作 [*]，实际访问的元素或属性要到求值时才能确定
+	DynamicSubscript bool
+	// Span 第一次出现的源码范围，手工构造的语法树为零值
+	Span Span
+}
+
+func (p Path) String() string {
+	var sb strings.Builder
+	sb.WriteString(p.Root)
+	for _, step := range p.Steps {
+		if sb.Len() > 0 && !strings.HasPrefix(step, "[") {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(step)
+	}
+	return sb.String()
+}
+
+// with 返回追加一步之后的路径，不修改 p
+func (p *Path) with(step string) *Path {
+	if p == nil {
+		return nil
+	}
+	out := *p
+	out.Steps = append(p.Steps[:len(p.Steps):len(p.Steps)], step)
+	return &out
+}
+
+// hasPrefix 报告 prefix 是否是 p 的前缀 (包括相等)
+func (p Path) hasPrefix(prefix *Path) bool {
+	if p.Root != prefix.Root || len(p.Steps) < len(prefix.Steps) {
+		return false
+	}
+	for i, step := range prefix.Steps {
+		if p.Steps[i] != step {
+			return false
+		}
+	}
+	return true
+}
+
+// DependencySet 表达式静态可知的读写集合，各列表按第一次出现的顺序排列 (Variables 和 Statics 按名称排序)
+type DependencySet struct {
+	// Reads 读取的路径，同一路径只出现一次，标志为各次出现的并集
+	Reads []Path
+	// Writes 赋值的路径，赋值目标中下标和参数读取的路径记入 Reads
+	Writes []Path
+	// Variables 读写的上下文变量名，不含 #
+	Variables []string
+	// Statics 访问的静态成员，方法写作 @class@name()，字段写作 @class@name
+	Statics []string
+}
+
+// Dependencies 返回表达式读写的属性路径、上下文变量和静态成员
+//
+// 与 OGNL 的求值规则一致，方法参数和下标相对根对象求值，投影和选择的表达式相对集合中的元素求值；
+// 投影和选择之后的步骤不再延伸路径。起点不是属性的链 (如 @Class@method().x 或 (a + b).x) 不产生路径。
+// 方法调用可能读写任意状态，路径上的 Call 标志提醒调用者结果只是近似。
+func Dependencies(expr Expression) *DependencySet {
+	w := &depWalker{
+		deps:      &DependencySet{},
+		reads:     map[string]int{},
+		writes:    map[string]int{},
+		variables: map[string]bool{},
+		statics:   map[string]bool{},
+	}
+	w.walk(expr, w.root())
+	for name := range w.variables {
+		w.deps.Variables = append(w.deps.Variables, name)
+	}
+	for name := range w.statics {
+		w.deps.Statics = append(w.deps.Statics, name)
+	}
+	sort.Strings(w.deps.Variables)
+	sort.Strings(w.deps.Statics)
+	return w.deps
+}
+
+type depWalker struct {
+	deps          *DependencySet
+	reads, writes map[string]int // 路径字符串 -> 在 Reads / Writes 中的下标
+	variables     map[string]bool
+	statics       map[string]bool
+}
+
+func (w *depWalker) root() *Path {
+	return &Path{}
+}
+
+// record 记录一条路径，起点本身 (如 #this) 不记录
+func (w *depWalker) record(p *Path, span Span, write bool) {
+	if p == nil || p.Root == "" && len(p.Steps) == 0 || p.Root == "#this" && len(p.Steps) == 0 {
+		return
+	}
+	list, index := &w.deps.Reads, w.reads
+	if write {
+		list, index = &w.deps.Writes, w.writes
+	}
+	key := p.String()
+	if i, ok := index[key]; ok {
+		q := &(*list)[i]
+		q.Call = q.Call || p.Call
+		q.Projection = q.Projection || p.Projection
+		q.DynamicSubscript = q.DynamicSubscript || p.DynamicSubscript
+		return
+	}
+	out := *p
+	out.Span = span
+	index[key] = len(*list)
+	*list = append(*list, out)
+}
+
+// walk 收集节点中的依赖，base 是相对路径的起点，nil 表示起点未知 (相对路径不记录)
+func (w *depWalker) walk(node Expression, base *Path) {
+	switch n := node.(type) {
+	case nil:
+		return
+	case *ChainExpression:
+		w.chain(n.Children, base, false)
+	case *Identifier, *CallExpression, *IndexExpression, *ProjectionExpression, *SelectionExpression,
+		*VariableExpression, *ThisExpression, *RootExpression:
+		w.chain([]Expression{n}, base, false)
+	case *AssignmentExpression:
+		w.walk(n.Right, base)
+		if c, ok := n.Left.(*ChainExpression); ok {
+			w.chain(c.Children, base, true)
+		} else {
+			w.chain([]Expression{n.Left}, base, true)
+		}
+	case *StaticMethodExpression:
+		w.statics[fmt.Sprintf("@%s@%s()", n.ClassName, n.Method)] = true
+		for _, arg := range n.Arguments {
+			w.walk(arg, w.root())
+		}
+	case *StaticFieldExpression:
+		w.statics[fmt.Sprintf("@%s@%s", n.ClassName, n.Field)] = true
+	case *LambdaExpression:
+		w.walk(n.Body, &Path{Root: "#this"})
+	case *LambdaLiteral:
+		w.walk(n.Body, &Path{Root: "#this"})
+	default:
+		for _, child := range Children(node) {
+			w.walk(child, base)
+		}
+	}
+}
+
+// chain 沿链的各步延伸路径，链结束时记录为读取或赋值
+func (w *depWalker) chain(steps []Expression, base *Path, write bool) {
+	var cur *Path
+	rest := steps
+	switch n := steps[0].(type) {
+	case *Identifier, *CallExpression, *IndexExpression, *ProjectionExpression, *SelectionExpression:
+		cur = base
+	case *ThisExpression:
+		cur, rest = base, steps[1:]
+	case *RootExpression:
+		cur, rest = w.root(), steps[1:]
+	case *VariableExpression:
+		w.variables[n.Name] = true
+		cur, rest = &Path{Root: "#" + n.Name}, steps[1:]
+	default:
+		w.walk(n, base)
+		rest = steps[1:]
+	}
+	for _, step := range rest {
+		switch n := step.(type) {
+		case *Identifier:
+			cur = cur.with(n.Value)
+		case *CallExpression:
+			for _, arg := range n.Arguments {
+				w.walk(arg, w.root())
+			}
+			cur = cur.with(n.Method + "()")
+			if cur != nil {
+				cur.Call = true
+			}
+		case *IndexExpression:
+			cur = w.index(cur, n)
+		case *DynamicSubscriptExpression:
+			cur = cur.with("[*]")
+			if cur != nil {
+				cur.DynamicSubscript = true
+			}
+		case *ProjectionExpression:
+			w.collection(cur, n.Expression)
+			cur = nil
+		case *SelectionExpression:
+			w.collection(cur, n.Expression)
+			cur = nil
+		default:
+			// 其他节点 (如 a.(b + c)) 相对当前对象求值，之后的步骤不再是路径
+			w.walk(n, cur)
+			cur = nil
+		}
+	}
+	w.record(cur, spanOf(steps), write)
+}
+
+// index 处理下标步骤
+func (w *depWalker) index(cur *Path, n *IndexExpression) *Path {
+	if _, ok := DynamicSubscriptOf(n); ok {
+		cur = cur.with("[*]")
+		if cur != nil {
+			cur.DynamicSubscript = true
+		}
+		return cur
+	}
+	if lit, ok := n.Index.(*Literal); ok {
+		switch v := lit.Value.(type) {
+		case string:
+			return cur.with(v)
+		case rune:
+			return cur.with(string(v))
+		case int, int64:
+			return cur.with(fmt.Sprintf("[%d]", v))
+		}
+	}
+	w.walk(n.Index, w.root())
+	cur = cur.with("[*]")
+	if cur != nil {
+		cur.DynamicSubscript = true
+	}
+	return cur
+}
+
+// collection 处理投影或选择：表达式相对 cur 的每个元素求值
+// 表达式没有读取元素的属性时记录 cur[*] 本身
+func (w *depWalker) collection(cur *Path, body Expression) {
+	elem := cur.with("[*]")
+	if elem != nil {
+		elem.Projection = true
+	}
+	w.walk(body, elem)
+	if elem == nil {
+		return
+	}
+	for _, p := range w.deps.Reads {
+		if p.hasPrefix(elem) {
+			return
+		}
+	}
+	w.record(elem, body.Span(), false)
+}
@@ -0,0 +1,93 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+)
+
+// describePaths 把路径格式化为 "路径 标志"，标志 c/p/d 分别表示 Call、Projection、DynamicSubscript
+func describePaths(paths []Path) string {
+	var out []string
+	for _, p := range paths {
+		s := p.String()
+		flags := ""
+		if p.Call {
+			flags += "c"
+		}
+		if p.Projection {
+			flags += "p"
+		}
+		if p.DynamicSubscript {
+			flags += "d"
+		}
+		if flags != "" {
+			s += " " + flags
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, ", ")
+}
+
+func TestDependencies(t *testing.T) {
+	tests := []struct {
+		input  string
+		reads  string
+		writes string
+	}{
+		{"user.address.city", "user.address.city", ""},
+		{"user['name'] + user.tags[0]", "user.name, user.tags[0]", ""},
+		{"orders[index].total", "index, orders[*].total d", ""},
+		{"orders[#i].total", "#i, orders[*].total d", ""},
+		{"user['na' + 'me']", "user[*] d", ""},
+		{"items[^].name", "items[*].name d", ""},
+		{"orders.{total}", "orders[*].total p", ""},
+		// 选择表达式中的属性相对元素求值，参数相对根对象求值
+		{"orders.{? #this.total > limit}.size()", "orders[*].total p, orders[*].limit p", ""},
+		{"orders.{? #this.total > max(limit)}", "orders[*].total p, limit, orders[*].max() cp", ""},
+		{"orders.{? true}", "orders[*] p", ""},
+		{"user.getAddress().city", "user.getAddress().city c", ""},
+		{"user.format(locale)", "locale, user.format() c", ""},
+		{"#this.name == #root.name", "name", ""},
+		{"user.name = first + ' ' + last", "first, last", "user.name"},
+		{"#u = user, #u.name = 'x'", "user", "#u, #u.name"},
+		{"#f = :[#this.size() * factor], #f(items)", "#this.size() c, #this.factor, #f, items", "#f"},
+		{"@java.lang.Math@max(a, b) + @Integer@MAX_VALUE.hashCode()", "a, b", ""},
+		{"(a + b).c", "a, b", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, err := New(NewLexer(tt.input)).ParseTopLevelExpression()
+			if err != nil {
+				t.Fatal(err)
+			}
+			deps := Dependencies(expr)
+			if got := describePaths(deps.Reads); got != tt.reads {
+				t.Errorf("Reads = %s, want %s", got, tt.reads)
+			}
+			if got := describePaths(deps.Writes); got != tt.writes {
+				t.Errorf("Writes = %s, want %s", got, tt.writes)
+			}
+		})
+	}
+}
+
+func TestDependenciesMembers(t *testing.T) {
+	input := "#ctx = #context, @java.lang.Math@max(#a, @java.lang.Integer@MAX_VALUE), #ctx['x']"
+	expr, err := New(NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps := Dependencies(expr)
+	if got := strings.Join(deps.Variables, ", "); got != "a, context, ctx" {
+		t.Errorf("Variables = %s", got)
+	}
+	if got := strings.Join(deps.Statics, ", "); got != "@java.lang.Integer@MAX_VALUE, @java.lang.Math@max()" {
+		t.Errorf("Statics = %s", got)
+	}
+	if got := describePaths(deps.Reads); got != "#context, #a, #ctx.x" {
+		t.Errorf("Reads = %s", got)
+	}
+	if p := deps.Reads[2]; p.Span.Text(input) != "#ctx['x']" {
+		t.Errorf("Span = %q", p.Span.Text(input))
+	}
+}
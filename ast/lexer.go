@@ -3,6 +3,7 @@ package ast
 import (
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // Lexer 词法分析器
@@ -84,6 +85,12 @@ func (l *Lexer) readString() string {
 				result = append(result, '\'')
 			case '"':
 				result = append(result, '"')
+			case 'u':
+				if r, ok := l.readUnicodeEscape(); ok {
+					result = utf8.AppendRune(result, r)
+				} else {
+					result = append(result, l.ch)
+				}
 			case '0', '1', '2', '3', '4', '5', '6', '7':
 				// 八进制转义序列
 				octal := string(l.ch)
@@ -111,6 +118,26 @@ func (l *Lexer) readString() string {
 	// 此时 l.ch 应该是结束的 " 或 0
 	return string(result)
 } // readCharLiteral 读取字符字面量（支持转义字符）
+// readUnicodeEscape 读取 \u 之后的 4 位十六进制码点，与 Java 一样允许写多个 u
+// 调用时当前字符是 u；成功时停在最后一个十六进制数字上，格式不对时不移动
+func (l *Lexer) readUnicodeEscape() (rune, bool) {
+	i := l.readPosition
+	for i < len(l.input) && l.input[i] == 'u' {
+		i++
+	}
+	if i+4 > len(l.input) {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(l.input[i:i+4], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	for l.readPosition < i+4 {
+		l.readChar()
+	}
+	return rune(v), true
+}
+
 // readCharLiteral 读取单引号字符或字符串字面量
 // 如果内容只有一个字符，返回字符；否则返回字符串
 func (l *Lexer) readCharLiteral() string {
@@ -139,6 +166,12 @@ func (l *Lexer) readCharLiteral() string {
 				result.WriteByte('\'')
 			case '"':
 				result.WriteByte('"')
+			case 'u':
+				if r, ok := l.readUnicodeEscape(); ok {
+					result.WriteRune(r)
+				} else {
+					result.WriteByte(l.ch)
+				}
 			case '0', '1', '2', '3', '4', '5', '6', '7':
 				// 八进制转义序列
 				octal := string(l.ch)
@@ -187,9 +220,21 @@ func (l *Lexer) readBackCharLiteral() string {
 
 // NextToken 扫描输入并返回下一个token
 func (l *Lexer) NextToken() Token {
-	var tok Token
-
 	l.skipWhitespace()
+	start := min(l.position, len(l.input))
+	tok := l.scanToken()
+	// 记录 token 在输入中的字节范围，"not" 向后查看 "in" 时跳过的空白不计入
+	end := min(l.position, len(l.input))
+	for end > start && strings.IndexByte(" \t\r\n", l.input[end-1]) >= 0 {
+		end--
+	}
+	tok.Position, tok.End = start, end
+	return tok
+}
+
+// scanToken 从当前字符开始识别一个 token
+func (l *Lexer) scanToken() Token {
+	var tok Token
 
 	switch l.ch {
 	case 0:
@@ -321,9 +366,9 @@ func (l *Lexer) NextToken() Token {
 		tok.Column = l.column
 
 		// 根据内容长度判断是字符还是字符串
-		// 单个字符（包括转义字符）→ CHAR_LITERAL
+		// 单个字符（包括转义字符和 \u 转义的非 ASCII 字符）→ CHAR_LITERAL
 		// 多个字符或空字符串 → STR_LITERAL (视为字符串)
-		if len(value) == 1 {
+		if len(value) == 1 || utf8.RuneCountInString(value) == 1 && utf8.ValidString(value) {
 			tok.Type = CHAR_LITERAL
 			tok.Value = value
 		} else {
@@ -366,6 +411,7 @@ func (l *Lexer) NextToken() Token {
 					}
 					// 不是 "in"，需要回退到读取nextValue之前的位置
 					l.position = savedPos
+					l.readPosition = savedPos + 1
 					l.ch = savedCh
 					l.line = savedLine
 					l.column = savedCol
@@ -0,0 +1,516 @@
+package ast
+
+import (
+	"reflect"
+	"strings"
+)
+
+// =============================================================================
+// 结构匹配
+// =============================================================================
+
+// 元变量在模式源码中被替换为这些前缀开头的标识符，再交给解析器
+const (
+	metavarPrefix  = "__mv_"
+	ellipsisPrefix = "__mvs_"
+)
+
+// Binding 元变量绑定的内容
+type Binding struct {
+	// Node 绑定的表达式；类名、方法名、变量名等名字为 nil；
+	// 绑定链的前几步 (如 a.b.c.exec(x) 中的 a.b.c) 时为新构造的 ChainExpression
+	Node Expression
+	// Nodes $...NAME 绑定的零个或多个表达式
+	Nodes []Expression
+	// Text 绑定的文本，同名元变量的多次出现按 Text 比较
+	Text string
+	// Span 绑定内容在源码中的范围；名字为所在节点的范围
+	Span Span
+}
+
+// MatchResult 模式的一次匹配
+type MatchResult struct {
+	// Node 匹配的节点，与链的前几步匹配时为新构造的 ChainExpression
+	Node     Expression
+	Span     Span
+	Bindings map[string]Binding
+}
+
+// Pattern 编译后的结构查询模式，可以被多个 goroutine 同时使用
+//
+// 模式是带元变量的 OGNL 表达式：$NAME 匹配任意一个表达式，写在类名、方法名、字段名、
+// #变量名、instanceof 类型的位置时匹配该名字；$...NAME 和匿名的 $... 匹配参数、元素、
+// 序列或链中的零个或多个节点。同名元变量必须匹配相同的文本 ($X + $X 匹配 a + a 而不匹配 a + b)。
+//
+// 链模式开头的元变量可以匹配目标链开头的多步，因此 $X.exec($Y) 匹配 a.b.c.exec(x)，$X 绑定 a.b.c。
+// ($X)($Y) 被解析为链 (属性之后的一步)，它同样匹配求值表达式，如 ('#a=1')(x)。
+type Pattern struct {
+	// Source 模式源码
+	Source string
+	// IgnoreSpelling 忽略运算符的写法，eq 与 ==、and 与 && 等视为相同；默认要求写法也相同
+	IgnoreSpelling bool
+	// Classes 非 nil 时类名按解析后的规范名比较 (@Runtime@ 与 @java.lang.Runtime@ 相同)，
+	// 类名位置的元变量绑定规范名；默认按源码中的写法比较
+	Classes *ClassResolver
+	expr    Expression
+}
+
+// ParsePattern 解析模式
+func ParsePattern(source string) (*Pattern, error) {
+	expr, err := New(NewLexer(substituteMetavars(source))).ParseTopLevelExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &Pattern{Source: source, expr: expr}, nil
+}
+
+// Match 解析模式并返回它在语法树中的所有匹配
+func Match(pattern string, expr Expression) ([]MatchResult, error) {
+	p, err := ParsePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return p.Find(expr), nil
+}
+
+func (p *Pattern) String() string { return p.Source }
+
+// Find 返回模式在语法树中的所有匹配，按先序排列，每个节点最多一次
+// 以元变量开头的链模式还会与更长的链的前几步匹配，因此 $X.exec($Y) 在
+// a.b.exec(x).trim() 中匹配 a.b.exec(x)
+func (p *Pattern) Find(root Expression) []MatchResult {
+	var out []MatchResult
+	try := func(node Expression) {
+		if b, ok := p.MatchNode(node); ok {
+			out = append(out, MatchResult{Node: node, Span: node.Span(), Bindings: b})
+		}
+	}
+	_, chainPattern := p.expr.(*ChainExpression)
+	Inspect(root, func(node Expression) bool {
+		try(node)
+		if chain, ok := node.(*ChainExpression); ok && chainPattern {
+			for n := 2; n < len(chain.Children); n++ {
+				try(subChain(chain.Children[:n]))
+			}
+		}
+		return true
+	})
+	return out
+}
+
+// MatchNode 报告模式是否与节点本身匹配，返回元变量的绑定
+func (p *Pattern) MatchNode(node Expression) (map[string]Binding, bool) {
+	m := &matcher{ignoreSpelling: p.IgnoreSpelling, classes: p.Classes}
+	var out map[string]Binding
+	ok := m.match(p.expr, node, bindings{}, func(b bindings) bool {
+		out = b
+		return true
+	})
+	return out, ok
+}
+
+// Metavars 按出现顺序返回模式中的元变量名 (带 $)，不含匿名的 $...
+func (p *Pattern) Metavars() []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if n, _, ok := metavar(name); ok && n != "" && !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	Inspect(p.expr, func(node Expression) bool {
+		switch n := node.(type) {
+		case *Identifier:
+			add(n.Value)
+		case *VariableExpression:
+			add(n.Name)
+		case *CallExpression:
+			add(n.Method)
+		case *StaticMethodExpression:
+			add(n.ClassName)
+			add(n.Method)
+		case *StaticFieldExpression:
+			add(n.ClassName)
+			add(n.Field)
+		case *ConstructorExpression:
+			add(n.ClassName)
+		case *InstanceofExpression:
+			add(n.TargetType)
+		case *MapExpression:
+			add(n.ClassName)
+		}
+		return true
+	})
+	return out
+}
+
+// substituteMetavars 替换引号之外的元变量；元变量名由大写字母、数字和下划线组成，
+// 因此 [$] 和 {$ ...} 中的 $ 保持原样
+func substituteMetavars(source string) string {
+	var sb strings.Builder
+	var quote byte
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(source) {
+				sb.WriteByte(c)
+				i++
+				c = source[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '$':
+			if strings.HasPrefix(source[i+1:], "...") {
+				name := metavarName(source[i+4:])
+				sb.WriteString(ellipsisPrefix + name)
+				i += 3 + len(name)
+				continue
+			}
+			if name := metavarName(source[i+1:]); name != "" {
+				sb.WriteString(metavarPrefix + name)
+				i += len(name)
+				continue
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// metavarName 返回 s 开头的元变量名
+func metavarName(s string) string {
+	n := 0
+	for n < len(s) && (s[n] == '_' || 'A' <= s[n] && s[n] <= 'Z' || n > 0 && '0' <= s[n] && s[n] <= '9') {
+		n++
+	}
+	return s[:n]
+}
+
+// metavar 报告名字是否为元变量占位符，返回元变量名 (带 $) 以及是否为 $...
+func metavar(name string) (string, bool, bool) {
+	if rest, ok := strings.CutPrefix(name, ellipsisPrefix); ok {
+		if rest == "" {
+			return "", true, true
+		}
+		return "$..." + rest, true, true
+	}
+	if rest, ok := strings.CutPrefix(name, metavarPrefix); ok {
+		return "$" + rest, false, true
+	}
+	return "", false, false
+}
+
+// exprMetavar 报告表达式是否为元变量占位符
+func exprMetavar(e Expression) (string, bool, bool) {
+	if id, ok := e.(*Identifier); ok {
+		return metavar(id.Value)
+	}
+	return "", false, false
+}
+
+// subChain 用链的前几步构造一个新的链，单独一步时返回该步本身
+func subChain(children []Expression) Expression {
+	if len(children) == 1 {
+		return children[0]
+	}
+	c := &ChainExpression{Children: children}
+	c.SetSpan(spanOf(children))
+	return c
+}
+
+// spanOf 返回一组相邻节点覆盖的范围
+func spanOf(nodes []Expression) Span {
+	if len(nodes) == 0 {
+		return Span{}
+	}
+	first, last := nodes[0].Span(), nodes[len(nodes)-1].Span()
+	if !first.IsValid() || !last.IsValid() {
+		return Span{}
+	}
+	return Span{Start: first.Start, End: last.End}
+}
+
+// =============================================================================
+// 匹配
+// =============================================================================
+
+// matcher 匹配时的选项
+type matcher struct {
+	ignoreSpelling bool
+	classes        *ClassResolver
+}
+
+// bindings 元变量名到绑定的映射，扩展时复制，回溯时不需要撤销
+type bindings = map[string]Binding
+
+// bind 绑定元变量后调用 k；已绑定的元变量要求文本相同
+func bind(b bindings, name string, v Binding, k func(bindings) bool) bool {
+	if name == "" {
+		return k(b)
+	}
+	if old, ok := b[name]; ok {
+		return old.Text == v.Text && k(b)
+	}
+	nb := make(bindings, len(b)+1)
+	for n, old := range b {
+		nb[n] = old
+	}
+	nb[name] = v
+	return k(nb)
+}
+
+// matchName 匹配类名、方法名等名字，名字可以是元变量
+func (m *matcher) matchName(p, t string, span Span, b bindings, k func(bindings) bool) bool {
+	if name, _, ok := metavar(p); ok {
+		return bind(b, name, Binding{Text: t, Span: span}, k)
+	}
+	return p == t && k(b)
+}
+
+// matchClass 匹配节点引用的类，设置了 classes 时按规范名比较
+func (m *matcher) matchClass(p, t Expression, b bindings, k func(bindings) bool) bool {
+	pn, _ := classRef(p)
+	tn, _ := classRef(t)
+	if m.classes == nil {
+		return m.matchName(pn, tn, t.Span(), b, k)
+	}
+	if name, _, ok := metavar(pn); ok {
+		return bind(b, name, Binding{Text: m.classes.canonical(t), Span: t.Span()}, k)
+	}
+	return m.classes.canonical(p) == m.classes.canonical(t) && k(b)
+}
+
+// matchOptional 匹配可能缺失的子节点，模式和目标都缺失时匹配
+func (m *matcher) matchOptional(p, t Expression, b bindings, k func(bindings) bool) bool {
+	if p == nil || t == nil {
+		return p == nil && t == nil && k(b)
+	}
+	return m.match(p, t, b, k)
+}
+
+// match 以续延方式匹配：匹配成功时用扩展后的绑定调用 k，k 返回 false 时回溯尝试其他匹配方式
+func (m *matcher) match(p, t Expression, b bindings, k func(bindings) bool) bool {
+	if name, _, ok := exprMetavar(p); ok {
+		return bind(b, name, Binding{Node: t, Text: t.String(), Span: t.Span()}, k)
+	}
+	switch p := p.(type) {
+	case *ChainExpression:
+		if e, ok := t.(*EvalExpression); ok {
+			return m.matchEval(p, e, b, k)
+		}
+		t, ok := t.(*ChainExpression)
+		return ok && m.matchChain(p.Children, t.Children, true, b, k)
+	case *SequenceExpression:
+		t, ok := t.(*SequenceExpression)
+		return ok && m.matchList(p.Expressions, t.Expressions, b, k)
+	case *AssignmentExpression:
+		t, ok := t.(*AssignmentExpression)
+		return ok && m.match(p.Left, t.Left, b, func(b bindings) bool {
+			return m.matchOptional(p.Right, t.Right, b, k)
+		})
+	case *ConditionalExpression:
+		t, ok := t.(*ConditionalExpression)
+		return ok && m.match(p.Test, t.Test, b, func(b bindings) bool {
+			return m.matchOptional(p.Consequent, t.Consequent, b, func(b bindings) bool {
+				return m.matchOptional(p.Alternative, t.Alternative, b, k)
+			})
+		})
+	case *BinaryExpression:
+		t, ok := t.(*BinaryExpression)
+		return ok && p.Operator == t.Operator && m.sameSpelling(p.Spelling, t.Spelling) && m.match(p.Left, t.Left, b, func(b bindings) bool {
+			return m.match(p.Right, t.Right, b, k)
+		})
+	case *UnaryExpression:
+		t, ok := t.(*UnaryExpression)
+		return ok && p.Operator == t.Operator && m.sameSpelling(p.Spelling, t.Spelling) && m.match(p.Operand, t.Operand, b, k)
+	case *InstanceofExpression:
+		t, ok := t.(*InstanceofExpression)
+		return ok && m.match(p.Operand, t.Operand, b, func(b bindings) bool {
+			return m.matchClass(p, t, b, k)
+		})
+	case *LambdaExpression:
+		t, ok := t.(*LambdaExpression)
+		return ok && m.match(p.Body, t.Body, b, k)
+	case *LambdaLiteral:
+		t, ok := t.(*LambdaLiteral)
+		return ok && m.match(p.Body, t.Body, b, k)
+	case *IndexExpression:
+		t, ok := t.(*IndexExpression)
+		return ok && m.matchOptional(p.Object, t.Object, b, func(b bindings) bool {
+			return m.match(p.Index, t.Index, b, k)
+		})
+	case *CallExpression:
+		t, ok := t.(*CallExpression)
+		return ok && m.matchOptional(p.Object, t.Object, b, func(b bindings) bool {
+			return m.matchName(p.Method, t.Method, t.Span(), b, func(b bindings) bool {
+				return m.matchList(p.Arguments, t.Arguments, b, k)
+			})
+		})
+	case *StaticMethodExpression:
+		t, ok := t.(*StaticMethodExpression)
+		return ok && m.matchClass(p, t, b, func(b bindings) bool {
+			return m.matchName(p.Method, t.Method, t.Span(), b, func(b bindings) bool {
+				return m.matchList(p.Arguments, t.Arguments, b, k)
+			})
+		})
+	case *StaticFieldExpression:
+		t, ok := t.(*StaticFieldExpression)
+		return ok && m.matchClass(p, t, b, func(b bindings) bool {
+			return m.matchName(p.Field, t.Field, t.Span(), b, k)
+		})
+	case *ConstructorExpression:
+		t, ok := t.(*ConstructorExpression)
+		return ok && p.IsArray == t.IsArray && m.matchClass(p, t, b, func(b bindings) bool {
+			return m.matchList(p.Arguments, t.Arguments, b, k)
+		})
+	case *ProjectionExpression:
+		t, ok := t.(*ProjectionExpression)
+		return ok && m.matchOptional(p.Object, t.Object, b, func(b bindings) bool {
+			return m.match(p.Expression, t.Expression, b, k)
+		})
+	case *SelectionExpression:
+		t, ok := t.(*SelectionExpression)
+		return ok && p.SelectType == t.SelectType && m.matchOptional(p.Object, t.Object, b, func(b bindings) bool {
+			return m.match(p.Expression, t.Expression, b, k)
+		})
+	case *EvalExpression:
+		t, ok := t.(*EvalExpression)
+		return ok && m.match(p.Target, t.Target, b, func(b bindings) bool {
+			return m.match(p.Argument, t.Argument, b, k)
+		})
+	case *Identifier:
+		t, ok := t.(*Identifier)
+		return ok && p.Value == t.Value && k(b)
+	case *Literal:
+		t, ok := t.(*Literal)
+		return ok && sameLiteral(p, t) && k(b)
+	case *ThisExpression:
+		_, ok := t.(*ThisExpression)
+		return ok && k(b)
+	case *RootExpression:
+		_, ok := t.(*RootExpression)
+		return ok && k(b)
+	case *VariableExpression:
+		t, ok := t.(*VariableExpression)
+		return ok && m.matchName(p.Name, t.Name, t.Span(), b, k)
+	case *ArrayExpression:
+		t, ok := t.(*ArrayExpression)
+		return ok && m.matchList(p.Elements, t.Elements, b, k)
+	case *MapExpression:
+		t, ok := t.(*MapExpression)
+		return ok && m.matchClass(p, t, b, func(b bindings) bool {
+			return m.matchList(p.Pairs, t.Pairs, b, k)
+		})
+	case *KeyValueExpression:
+		t, ok := t.(*KeyValueExpression)
+		return ok && m.match(p.Key, t.Key, b, func(b bindings) bool {
+			return m.matchOptional(p.Value, t.Value, b, k)
+		})
+	case *DynamicSubscriptExpression:
+		t, ok := t.(*DynamicSubscriptExpression)
+		return ok && p.SubscriptType == t.SubscriptType && m.matchOptional(p.Object, t.Object, b, k)
+	}
+	return false
+}
+
+// matchEval 用 ($X)($Y) 形式的链模式匹配求值表达式：目标是元变量时模式无法写成 EvalExpression
+func (m *matcher) matchEval(p *ChainExpression, t *EvalExpression, b bindings, k func(bindings) bool) bool {
+	if len(p.Children) != 2 {
+		return false
+	}
+	if _, ellipsis, ok := exprMetavar(p.Children[0]); !ok || ellipsis {
+		return false
+	}
+	call, ok := p.Children[1].(*CallExpression)
+	if !ok || call.Object != nil || call.Method != "" || len(call.Arguments) != 1 {
+		return false
+	}
+	return m.match(p.Children[0], t.Target, b, func(b bindings) bool {
+		return m.match(call.Arguments[0], t.Argument, b, k)
+	})
+}
+
+// sameSpelling 比较运算符的写法，任一方没有记录写法时视为相同
+func (m *matcher) sameSpelling(p, t string) bool {
+	return m.ignoreSpelling || p == "" || t == "" || p == t
+}
+
+// sameLiteral 按类型和值比较字面量，'id' 和 "id" 相同
+func sameLiteral(p, t *Literal) bool {
+	if s, ok := p.Value.(string); ok {
+		ts, ok := t.Value.(string)
+		return ok && s == ts
+	}
+	return reflect.TypeOf(p.Value) == reflect.TypeOf(t.Value) && p.String() == t.String()
+}
+
+// matchList 匹配参数、元素等列表，$... 匹配零个或多个元素
+func (m *matcher) matchList(ps, ts []Expression, b bindings, k func(bindings) bool) bool {
+	if len(ps) == 0 {
+		return len(ts) == 0 && k(b)
+	}
+	if name, ellipsis, ok := exprMetavar(ps[0]); ok && ellipsis {
+		for n := 0; n <= len(ts); n++ {
+			if bind(b, name, listBinding(ts[:n]), func(b bindings) bool {
+				return m.matchList(ps[1:], ts[n:], b, k)
+			}) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(ts) == 0 {
+		return false
+	}
+	return m.match(ps[0], ts[0], b, func(b bindings) bool {
+		return m.matchList(ps[1:], ts[1:], b, k)
+	})
+}
+
+// matchChain 匹配链的各步；链模式开头的元变量可以匹配目标链开头的一步或多步
+func (m *matcher) matchChain(ps, ts []Expression, first bool, b bindings, k func(bindings) bool) bool {
+	if len(ps) == 0 {
+		return len(ts) == 0 && k(b)
+	}
+	name, ellipsis, ok := exprMetavar(ps[0])
+	switch {
+	case ok && ellipsis:
+		for n := 0; n <= len(ts); n++ {
+			if bind(b, name, listBinding(ts[:n]), func(b bindings) bool {
+				return m.matchChain(ps[1:], ts[n:], false, b, k)
+			}) {
+				return true
+			}
+		}
+		return false
+	case ok && first && len(ps) > 1:
+		for n := 1; n < len(ts); n++ {
+			prefix := subChain(ts[:n])
+			if bind(b, name, Binding{Node: prefix, Text: prefix.String(), Span: prefix.Span()}, func(b bindings) bool {
+				return m.matchChain(ps[1:], ts[n:], false, b, k)
+			}) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(ts) == 0 {
+		return false
+	}
+	return m.match(ps[0], ts[0], b, func(b bindings) bool {
+		return m.matchChain(ps[1:], ts[1:], false, b, k)
+	})
+}
+
+// listBinding $... 绑定的一组节点，Text 为逗号分隔的各节点
+func listBinding(nodes []Expression) Binding {
+	texts := make([]string, len(nodes))
+	for i, n := range nodes {
+		texts[i] = n.String()
+	}
+	return Binding{Nodes: nodes, Text: strings.Join(texts, ", "), Span: spanOf(nodes)}
+}
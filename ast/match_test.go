@@ -0,0 +1,135 @@
+package ast
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// describe 返回 "匹配的源码 $A=... $B=..." 形式的匹配，绑定按名字排序
+func describe(input string, results []MatchResult) []string {
+	var out []string
+	for _, m := range results {
+		s := m.Span.Text(input)
+		var names []string
+		for name := range m.Bindings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s += " " + name + "=" + m.Bindings[name].Text
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// TestMatch 测试元变量、$...、链的前几步和同名元变量的一致性
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, input string
+		expected       []string
+	}{
+		{"$X.exec($Y)", "a.b.c.exec(x)", []string{"a.b.c.exec(x) $X=a.b.c $Y=x"}},
+		{"$X.exec($Y)", "@java.lang.Runtime@getRuntime().exec('id').waitFor()", []string{
+			`@java.lang.Runtime@getRuntime().exec('id') $X=@java.lang.Runtime@getRuntime() $Y="id"`,
+		}},
+		{"#$V = $E", "#a = 1, #b = #a + 1", []string{"#a = 1 $E=1 $V=a", "#b = #a + 1 $E=#a + 1 $V=b"}},
+		{"@$C@$M($...ARGS)", "@java.lang.Math@max(1, 2)", []string{"@java.lang.Math@max(1, 2) $...ARGS=1, 2 $C=java.lang.Math $M=max"}},
+		{"foo($..., 'x')", "foo('x') + foo(1, 2, 'x') + foo('x', 1)", []string{"foo('x')", "foo(1, 2, 'x')"}},
+		{"$X + $X", "a + a + (b + c)", []string{"a + a $X=a"}},
+		{"new java.io.File($P)", "new java.io.File(#p).delete()", []string{"new java.io.File(#p) $P=#p"}},
+		{"$X['secret']", `#session["secret"]`, []string{`#session["secret"] $X=#session`}},
+		{"#this.$M()", "#this.toString()", []string{"#this.toString() $M=toString"}},
+		{"$X.$...STEPS.getClassLoader()", "a.getClass().getClassLoader()", []string{
+			"a.getClass().getClassLoader() $...STEPS=getClass() $X=a",
+		}},
+		{"@java.lang.Runtime@$F", "@java.lang.Runtime@getRuntime()", nil},
+		{"{$...}", "{1, 2}.size() + {}.size()", []string{"{1, 2}", "{}"}},
+	}
+	for _, tt := range tests {
+		expr, err := New(NewLexer(tt.input)).ParseTopLevelExpression()
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := Match(tt.pattern, expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.pattern, err)
+		}
+		got := describe(tt.input, results)
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s in %s:\n%s\nwant:\n%s", tt.pattern, tt.input, strings.Join(got, "\n"), strings.Join(tt.expected, "\n"))
+		}
+	}
+}
+
+// TestMatchEval ($X)($Y) 被解析为链，也匹配求值表达式
+func TestMatchEval(t *testing.T) {
+	expr, err := New(NewLexer("('#a=1')(x)(y) + (#p)('meh')")).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := Match("($S)($A)", expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range results {
+		if _, ok := m.Node.(*EvalExpression); ok {
+			got = append(got, m.Bindings["$S"].Text+" "+m.Bindings["$A"].Text)
+		}
+	}
+	expected := []string{`"#a=1" x`, "#p \"meh\""}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got %q, want %q", got, expected)
+	}
+}
+
+// TestMatchSpelling 默认区分 eq 与 ==，IgnoreSpelling 时不区分
+func TestMatchSpelling(t *testing.T) {
+	input := "a eq b and c == d && !e"
+	expr, err := New(NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pattern  string
+		ignore   bool
+		expected string
+	}{
+		{"$A eq $B", false, "a eq b"},
+		{"$A == $B", false, "c == d"},
+		{"$A == $B", true, "a eq b|c == d"},
+		{"not $A", false, ""},
+		{"not $A", true, "!e"},
+		{"$A && $B", false, "a eq b and c == d && !e"},
+		{"$A and $B", false, "a eq b and c == d"},
+	}
+	for _, tt := range tests {
+		p, err := ParsePattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.IgnoreSpelling = tt.ignore
+		var got []string
+		for _, m := range p.Find(expr) {
+			got = append(got, m.Span.Text(input))
+		}
+		if strings.Join(got, "|") != tt.expected {
+			t.Errorf("%s (ignore %v): %q, want %q", tt.pattern, tt.ignore, strings.Join(got, "|"), tt.expected)
+		}
+	}
+}
+
+func TestPatternMetavars(t *testing.T) {
+	p, err := ParsePattern(`@$C@$M($...ARGS, $X, $...) + #$V.foo($X, '$NOT')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(p.Metavars(), " "); got != "$C $M $...ARGS $X $V" {
+		t.Errorf("metavars %s", got)
+	}
+	if _, err := ParsePattern("$X.("); err == nil {
+		t.Error("expected a syntax error")
+	}
+}
@@ -3,6 +3,7 @@ package ast
 import (
 	"fmt"
 	"strconv"
+	"unicode/utf8"
 )
 
 const (
@@ -18,6 +19,7 @@ type Parser struct {
 	errors         []string
 	position       int
 	iterationCount int // 解析迭代计数器
+	lastEnd        int // 最后一个已消费 token 的结束偏移
 }
 
 // New 创建新的解析器
@@ -51,11 +53,29 @@ func (p *Parser) PeekToken() Token {
 
 // nextToken 前进到下一个token
 func (p *Parser) nextToken() {
+	p.lastEnd = p.current.End
 	p.current = p.peek
 	p.peek = p.lexer.NextToken()
 	p.position++
 }
 
+// mark 记录节点覆盖的源码范围：从 start 到最后一个已消费 token 的结尾
+// 已经带有范围的节点（例如括号内的表达式）保持不变
+func (p *Parser) mark(start int, expr Expression) Expression {
+	if expr != nil && !expr.Span().IsValid() {
+		expr.SetSpan(Span{Start: start, End: p.lastEnd})
+	}
+	return expr
+}
+
+// startOf 返回已解析节点的起始偏移，节点缺失时使用 fallback
+func startOf(expr Expression, fallback int) int {
+	if expr != nil && expr.Span().IsValid() {
+		return expr.Span().Start
+	}
+	return fallback
+}
+
 // currentTokenIs 检查当前token类型
 func (p *Parser) currentTokenIs(t TokenType) bool {
 	return p.current.Type == t
@@ -126,6 +146,7 @@ func (p *Parser) ParseTopLevelExpression() (Expression, error) {
 
 // parseExpression 解析表达式序列 (对应expression)
 func (p *Parser) parseExpression() Expression {
+	start := p.current.Position
 	expr := p.parseAssignmentExpression()
 
 	if p.current.Type != COMMA {
@@ -140,17 +161,18 @@ func (p *Parser) parseExpression() Expression {
 		exprs = append(exprs, p.parseAssignmentExpression())
 	}
 
-	return &SequenceExpression{Expressions: exprs}
+	return p.mark(start, &SequenceExpression{Expressions: exprs})
 }
 
 // parseAssignmentExpression 解析赋值表达式 (对应assignmentExpression)
 func (p *Parser) parseAssignmentExpression() Expression {
+	start := p.current.Position
 	expr := p.parseConditionalTestExpression()
 
 	if p.current.Type == ASSIGN {
 		p.nextToken() // move to right side
 		right := p.parseAssignmentExpression()
-		return &AssignmentExpression{Left: expr, Right: right}
+		return p.mark(start, &AssignmentExpression{Left: expr, Right: right})
 	}
 
 	return expr
@@ -158,6 +180,7 @@ func (p *Parser) parseAssignmentExpression() Expression {
 
 // parseConditionalTestExpression 解析条件表达式 (对应conditionalTestExpression)
 func (p *Parser) parseConditionalTestExpression() Expression {
+	start := p.current.Position
 	expr := p.parseLogicalOrExpression()
 
 	if p.current.Type == QUESTION {
@@ -171,11 +194,11 @@ func (p *Parser) parseConditionalTestExpression() Expression {
 		p.nextToken() // move to alternative
 		alternative := p.parseConditionalTestExpression()
 
-		return &ConditionalExpression{
+		return p.mark(start, &ConditionalExpression{
 			Test:        expr,
 			Consequent:  consequent,
 			Alternative: alternative,
-		}
+		})
 	}
 
 	return expr
@@ -184,13 +207,14 @@ func (p *Parser) parseConditionalTestExpression() Expression {
 // parseLogicalOrExpression 解析逻辑或表达式 (对应logicalOrExpression)
 // parseLogicalOrExpression 解析逻辑或表达式 (对应logicalOrExpression)
 func (p *Parser) parseLogicalOrExpression() Expression {
+	start := p.current.Position
 	left := p.parseLogicalAndExpression()
 
 	for p.current.Type == OR {
-		operator := p.current.Type
+		operator, spelling := p.current.Type, p.current.Value
 		p.nextToken() // move to right operand
 		right := p.parseLogicalAndExpression()
-		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+		left = p.mark(start, &BinaryExpression{Left: left, Operator: operator, Right: right, Spelling: spelling})
 	}
 
 	return left
@@ -198,13 +222,14 @@ func (p *Parser) parseLogicalOrExpression() Expression {
 
 // parseLogicalAndExpression 解析逻辑与表达式 (对应logicalAndExpression)
 func (p *Parser) parseLogicalAndExpression() Expression {
+	start := p.current.Position
 	left := p.parseInclusiveOrExpression()
 
 	for p.current.Type == AND {
-		operator := p.current.Type
+		operator, spelling := p.current.Type, p.current.Value
 		p.nextToken() // move to right operand
 		right := p.parseInclusiveOrExpression()
-		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+		left = p.mark(start, &BinaryExpression{Left: left, Operator: operator, Right: right, Spelling: spelling})
 	}
 
 	return left
@@ -212,13 +237,14 @@ func (p *Parser) parseLogicalAndExpression() Expression {
 
 // parseInclusiveOrExpression 解析按位或表达式 (对应inclusiveOrExpression)
 func (p *Parser) parseInclusiveOrExpression() Expression {
+	start := p.current.Position
 	left := p.parseExclusiveOrExpression()
 
 	for p.current.Type == BIT_OR {
-		operator := p.current.Type
+		operator, spelling := p.current.Type, p.current.Value
 		p.nextToken() // move to right operand
 		right := p.parseExclusiveOrExpression()
-		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+		left = p.mark(start, &BinaryExpression{Left: left, Operator: operator, Right: right, Spelling: spelling})
 	}
 
 	return left
@@ -226,13 +252,14 @@ func (p *Parser) parseInclusiveOrExpression() Expression {
 
 // parseExclusiveOrExpression 解析异或表达式 (对应exclusiveOrExpression)
 func (p *Parser) parseExclusiveOrExpression() Expression {
+	start := p.current.Position
 	left := p.parseAndExpression()
 
 	for p.current.Type == XOR {
-		operator := p.current.Type
+		operator, spelling := p.current.Type, p.current.Value
 		p.nextToken() // move to right operand
 		right := p.parseAndExpression()
-		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+		left = p.mark(start, &BinaryExpression{Left: left, Operator: operator, Right: right, Spelling: spelling})
 	}
 
 	return left
@@ -240,13 +267,14 @@ func (p *Parser) parseExclusiveOrExpression() Expression {
 
 // parseAndExpression 解析按位与表达式 (对应andExpression)
 func (p *Parser) parseAndExpression() Expression {
+	start := p.current.Position
 	left := p.parseEqualityExpression()
 
 	for p.current.Type == BIT_AND {
-		operator := p.current.Type
+		operator, spelling := p.current.Type, p.current.Value
 		p.nextToken() // move to right operand
 		right := p.parseEqualityExpression()
-		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+		left = p.mark(start, &BinaryExpression{Left: left, Operator: operator, Right: right, Spelling: spelling})
 	}
 
 	return left
@@ -254,13 +282,14 @@ func (p *Parser) parseAndExpression() Expression {
 
 // parseEqualityExpression 解析相等性表达式 (对应equalityExpression)
 func (p *Parser) parseEqualityExpression() Expression {
+	start := p.current.Position
 	left := p.parseRelationalExpression()
 
 	for p.current.Type == EQ || p.current.Type == NOT_EQ {
-		operator := p.current.Type
+		operator, spelling := p.current.Type, p.current.Value
 		p.nextToken() // move to right operand
 		right := p.parseRelationalExpression()
-		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+		left = p.mark(start, &BinaryExpression{Left: left, Operator: operator, Right: right, Spelling: spelling})
 	}
 
 	return left
@@ -268,20 +297,21 @@ func (p *Parser) parseEqualityExpression() Expression {
 
 // parseRelationalExpression 解析关系表达式 (对应relationalExpression)
 func (p *Parser) parseRelationalExpression() Expression {
+	start := p.current.Position
 	left := p.parseShiftExpression()
 
 	for p.isRelationalOperator(p.current.Type) {
-		operator := p.current.Type
+		operator, spelling := p.current.Type, p.current.Value
 		p.nextToken() // consume operator
 
 		// 处理 "not in" 情况
 		if operator == NOT && p.peekTokenIs(IN) {
 			p.nextToken() // consume "in"
-			operator = NOT_IN
+			operator, spelling = NOT_IN, "not in"
 		}
 
 		right := p.parseShiftExpression()
-		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+		left = p.mark(start, &BinaryExpression{Left: left, Operator: operator, Right: right, Spelling: spelling})
 	}
 
 	return left
@@ -296,13 +326,14 @@ func (p *Parser) isRelationalOperator(t TokenType) bool {
 
 // parseShiftExpression 解析位移表达式 (对应shiftExpression)
 func (p *Parser) parseShiftExpression() Expression {
+	start := p.current.Position
 	left := p.parseAdditiveExpression()
 
 	for p.isShiftOperator(p.current.Type) {
-		operator := p.current.Type
+		operator, spelling := p.current.Type, p.current.Value
 		p.nextToken() // move to right operand
 		right := p.parseAdditiveExpression()
-		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+		left = p.mark(start, &BinaryExpression{Left: left, Operator: operator, Right: right, Spelling: spelling})
 	}
 
 	return left
@@ -315,13 +346,14 @@ func (p *Parser) isShiftOperator(t TokenType) bool {
 
 // parseAdditiveExpression 解析加减表达式 (对应additiveExpression)
 func (p *Parser) parseAdditiveExpression() Expression {
+	start := p.current.Position
 	left := p.parseMultiplicativeExpression()
 
 	for p.current.Type == PLUS || p.current.Type == MINUS {
-		operator := p.current.Type
+		operator, spelling := p.current.Type, p.current.Value
 		p.nextToken() // move to right operand
 		right := p.parseMultiplicativeExpression()
-		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+		left = p.mark(start, &BinaryExpression{Left: left, Operator: operator, Right: right, Spelling: spelling})
 	}
 
 	return left
@@ -329,13 +361,14 @@ func (p *Parser) parseAdditiveExpression() Expression {
 
 // parseMultiplicativeExpression 解析乘除表达式 (对应multiplicativeExpression)
 func (p *Parser) parseMultiplicativeExpression() Expression {
+	start := p.current.Position
 	left := p.parseUnaryExpression()
 
 	for p.isMultiplicativeOperator(p.current.Type) {
-		operator := p.current.Type
+		operator, spelling := p.current.Type, p.current.Value
 		p.nextToken() // move to right operand
 		right := p.parseUnaryExpression()
-		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+		left = p.mark(start, &BinaryExpression{Left: left, Operator: operator, Right: right, Spelling: spelling})
 	}
 
 	return left
@@ -348,16 +381,17 @@ func (p *Parser) isMultiplicativeOperator(t TokenType) bool {
 
 // parseUnaryExpression 解析一元表达式 (对应unaryExpression)
 func (p *Parser) parseUnaryExpression() Expression {
+	start := p.current.Position
 	switch p.current.Type {
 	case PLUS:
 		// 在 OGNL 中，+号作为正号前缀时直接忽略，返回操作数本身
 		p.nextToken() // move to operand
 		return p.parseUnaryExpression()
 	case MINUS, BIT_NOT, NOT:
-		operator := p.current.Type
+		operator, spelling := p.current.Type, p.current.Value
 		p.nextToken() // move to operand
 		operand := p.parseUnaryExpression()
-		return &UnaryExpression{Operator: operator, Operand: operand}
+		return p.mark(start, &UnaryExpression{Operator: operator, Operand: operand, Spelling: spelling})
 	default:
 		expr := p.parseNavigationChain()
 
@@ -370,6 +404,7 @@ func (p *Parser) parseUnaryExpression() Expression {
 			}
 
 			// 构建类型名
+			typeStart := p.current.Position
 			className := p.current.Value
 			for p.peekTokenIs(DOT) {
 				p.nextToken() // consume dot
@@ -381,11 +416,11 @@ func (p *Parser) parseUnaryExpression() Expression {
 
 			p.nextToken() // move past the type name
 
-			return &InstanceofExpression{
+			return p.mark(start, &InstanceofExpression{
 				Operand:    expr,
 				TargetType: className,
-				TypeNode:   &Literal{Value: className, Raw: fmt.Sprintf("\"%s\"", className)},
-			}
+				TypeNode:   p.mark(typeStart, &Literal{Value: className, Raw: fmt.Sprintf("\"%s\"", className)}),
+			})
 		}
 
 		return expr
@@ -402,6 +437,7 @@ func (p *Parser) parseNavigationChain() Expression {
 func (p *Parser) parseNavigationChainContinue(left Expression) Expression {
 	// 收集所有链式操作的子节点
 	var children []Expression
+	chainStart := startOf(left, p.current.Position)
 
 	// 如果 left 本身就是 ChainExpression，扁平化它的子节点
 	if chain, ok := left.(*ChainExpression); ok {
@@ -417,6 +453,7 @@ navigationLoop:
 			return nil
 		}
 
+		start := p.current.Position
 		switch p.current.Type {
 		case DOT:
 			// DOT 已经是当前 token，解析右侧的属性或方法
@@ -438,7 +475,7 @@ navigationLoop:
 			// LBRACK 是当前 token，current = [
 			p.nextToken() // 移动到索引表达式的第一个 token
 
-			// 检查是否是动态下标 [^], [|], [$]
+			// 检查是否是动态下标 [^], [|], [$], [*]
 			if p.isDynamicSubscript() {
 				// 创建字符字面量作为索引
 				var symbol string
@@ -449,14 +486,17 @@ navigationLoop:
 					symbol = "|"
 				case DOLLAR:
 					symbol = "$"
+				case MULTIPLY:
+					symbol = "*"
 				}
 				indexLiteral := &Literal{Value: symbol, Raw: symbol}
-				p.nextToken() // consume ^, |, or $
+				indexLiteral.SetSpan(Span{Start: p.current.Position, End: p.current.End})
+				p.nextToken() // consume ^, |, $ or *
 				p.nextToken() // consume ]
 
 				// 创建普通的 IndexExpression，索引是字符字面量
 				indexExpr := &IndexExpression{Object: nil, Index: indexLiteral}
-				children = append(children, indexExpr)
+				children = append(children, p.mark(start, indexExpr))
 			} else {
 				// 解析索引表达式
 				index := p.parseExpression()
@@ -470,7 +510,7 @@ navigationLoop:
 
 				// 创建 IndexExpression，不设置 Object（将由 ChainExpression 管理）
 				indexExpr := &IndexExpression{Object: nil, Index: index}
-				children = append(children, indexExpr)
+				children = append(children, p.mark(start, indexExpr))
 			}
 		case DYNAMIC_SUBSCRIPT:
 			// DYNAMIC_SUBSCRIPT 已经是当前 token
@@ -480,7 +520,7 @@ navigationLoop:
 				Object:        nil, // 不设置 Object
 				SubscriptType: subscriptType,
 			}
-			children = append(children, dynamicExpr)
+			children = append(children, p.mark(start, dynamicExpr))
 		case LPAREN:
 			// 处理 (arg) 的情况
 			// 根据前一个节点的类型判断是 ASTEval 还是 ASTMethod
@@ -511,7 +551,7 @@ navigationLoop:
 					Argument: argument,
 				}
 				// 重置 children，将 evalExpr 作为新的起点
-				children = []Expression{evalExpr}
+				children = []Expression{p.mark(chainStart, evalExpr)}
 			} else {
 				// 创建方法调用表达式
 				var arguments []Expression
@@ -523,7 +563,7 @@ navigationLoop:
 					Method:    "",
 					Arguments: arguments,
 				}
-				children = append(children, callExpr)
+				children = append(children, p.mark(start, callExpr))
 			}
 		}
 	}
@@ -534,9 +574,9 @@ navigationLoop:
 	}
 
 	// 创建 ChainExpression 包含所有子节点
-	return &ChainExpression{
+	return p.mark(chainStart, &ChainExpression{
 		Children: children,
-	}
+	})
 }
 
 // parseChainRightSide 解析链式表达式的右侧（不包装在 ChainExpression 中）
@@ -557,6 +597,7 @@ func (p *Parser) parseChainRightSide() Expression {
 		return expr
 	case IDENT:
 		p.nextToken() // move to identifier
+		start := p.current.Position
 		methodName := p.current.Value
 
 		if p.peekTokenIs(LPAREN) {
@@ -571,11 +612,11 @@ func (p *Parser) parseChainRightSide() Expression {
 			}
 
 			// 创建方法调用表达式，不设置 Object（将由 ChainExpression 管理）
-			return &CallExpression{
+			return p.mark(start, &CallExpression{
 				Object:    nil,
 				Method:    methodName,
 				Arguments: arguments,
-			}
+			})
 		} else {
 			// 属性访问
 			identValue := p.current.Value
@@ -584,7 +625,8 @@ func (p *Parser) parseChainRightSide() Expression {
 				NameNode: &Literal{Value: identValue, Raw: fmt.Sprintf("%q", identValue)},
 			}
 			p.nextToken() // consume the identifier
-			return property
+			p.mark(start, property.NameNode)
+			return p.mark(start, property)
 		}
 	case LBRACE:
 		// 支持链式投影/选择表达式，如 name.{? foo } 或 name.{ foo }
@@ -595,6 +637,7 @@ func (p *Parser) parseChainRightSide() Expression {
 		// 支持链式静态引用表达式，如 Thread.@Class@method(...)
 		// 当前 token 是 DOT, peek 是 AT
 		p.nextToken() // move to AT (current = AT)
+		start := p.current.Position
 		p.nextToken() // move past AT to class name (current = class name)
 
 		if p.current.Type != IDENT {
@@ -647,18 +690,18 @@ func (p *Parser) parseChainRightSide() Expression {
 			if p.current.Type == RPAREN {
 				p.nextToken() // consume RPAREN，移动到下一个 token
 			}
-			return &StaticMethodExpression{
+			return p.mark(start, &StaticMethodExpression{
 				ClassName: className,
 				Method:    memberName,
 				Arguments: arguments,
-			}
+			})
 		} else {
 			// 静态字段访问
 			p.nextToken() // consume the field name (move past it)
-			return &StaticFieldExpression{
+			return p.mark(start, &StaticFieldExpression{
 				ClassName: className,
 				Field:     memberName,
-			}
+			})
 		}
 	default:
 		p.currentError("expected identifier, {, or @ after .")
@@ -735,11 +778,11 @@ func (p *Parser) parseDynamicSubscriptType(value string) DynamicSubscriptType {
 	}
 }
 
-// isDynamicSubscript 检查当前是否是动态下标 [^], [|], [$]
+// isDynamicSubscript 检查当前是否是动态下标 [^], [|], [$], [*]
 func (p *Parser) isDynamicSubscript() bool {
-	// current 应该是 ^, |, $ 之一，且 peek 应该是 ]
-	return (p.current.Type == XOR || p.current.Type == BIT_OR || p.current.Type == DOLLAR) &&
-		p.peekTokenIs(RBRACK)
+	// current 应该是 ^, |, $, * 之一，且 peek 应该是 ]
+	return (p.current.Type == XOR || p.current.Type == BIT_OR || p.current.Type == DOLLAR ||
+		p.current.Type == MULTIPLY) && p.peekTokenIs(RBRACK)
 }
 
 // parseDynamicSubscriptFromTokens 从当前 token 解析动态下标类型
@@ -761,6 +804,7 @@ func (p *Parser) parseDynamicSubscriptFromTokens() DynamicSubscriptType {
 
 // parseMethodCall 解析方法调用
 func (p *Parser) parseMethodCall(object Expression) Expression {
+	start := p.current.Position
 	methodName := p.current.Value
 	p.nextToken() // consume method name
 
@@ -778,11 +822,11 @@ func (p *Parser) parseMethodCall(object Expression) Expression {
 		p.nextToken() // consume RPAREN
 	}
 
-	return &CallExpression{
+	return p.mark(start, &CallExpression{
 		Object:    object,
 		Method:    methodName,
 		Arguments: arguments,
-	}
+	})
 }
 
 // parseArgumentList 解析参数列表 (调用时 current 应该在 LPAREN 后的第一个 token)
@@ -813,6 +857,7 @@ func (p *Parser) parseArgumentList() []Expression {
 	return args
 } // parseProjectionOrSelection 解析投影或选择表达式
 func (p *Parser) parseProjectionOrSelection(object Expression) Expression {
+	start := p.current.Position
 	p.nextToken() // consume {
 
 	if p.currentTokenIs(QUESTION) {
@@ -824,11 +869,11 @@ func (p *Parser) parseProjectionOrSelection(object Expression) Expression {
 			return nil
 		}
 		p.nextToken() // consume }
-		return &SelectionExpression{
+		return p.mark(start, &SelectionExpression{
 			Object:     object,
 			Expression: expr,
 			SelectType: "all",
-		}
+		})
 	} else if p.currentTokenIs(XOR) {
 		// 选择表达式 {^ expr} - 选择第一个匹配的元素
 		p.nextToken() // move to expression
@@ -838,11 +883,11 @@ func (p *Parser) parseProjectionOrSelection(object Expression) Expression {
 			return nil
 		}
 		p.nextToken() // consume }
-		return &SelectionExpression{
+		return p.mark(start, &SelectionExpression{
 			Object:     object,
 			Expression: expr,
 			SelectType: "first",
-		}
+		})
 	} else if p.currentTokenIs(DOLLAR) {
 		// 选择表达式 {$ expr} - 选择最后一个匹配的元素
 		p.nextToken() // move to expression
@@ -852,11 +897,11 @@ func (p *Parser) parseProjectionOrSelection(object Expression) Expression {
 			return nil
 		}
 		p.nextToken() // consume }
-		return &SelectionExpression{
+		return p.mark(start, &SelectionExpression{
 			Object:     object,
 			Expression: expr,
 			SelectType: "last",
-		}
+		})
 	} else {
 		// 投影表达式 {expr}
 		expr := p.parseAssignmentExpression() // Use parseAssignmentExpression to avoid comma-sequence handling
@@ -865,15 +910,18 @@ func (p *Parser) parseProjectionOrSelection(object Expression) Expression {
 			return nil
 		}
 		p.nextToken() // consume }
-		return &ProjectionExpression{
+		return p.mark(start, &ProjectionExpression{
 			Object:     object,
 			Expression: expr,
-		}
+		})
 	}
 }
 
 // parsePrimaryExpression 解析主表达式 (对应primaryExpression)
-func (p *Parser) parsePrimaryExpression() Expression {
+func (p *Parser) parsePrimaryExpression() (result Expression) {
+	start := p.current.Position
+	defer func() { result = p.mark(start, result) }()
+
 	switch p.current.Type {
 	case IDENT:
 		identValue := p.current.Value
@@ -900,7 +948,7 @@ func (p *Parser) parsePrimaryExpression() Expression {
 		// 否则是普通的标识符
 		return &Identifier{
 			Value:    identValue,
-			NameNode: &Literal{Value: identValue, Raw: fmt.Sprintf("%q", identValue)},
+			NameNode: p.mark(start, &Literal{Value: identValue, Raw: fmt.Sprintf("%q", identValue)}),
 		}
 	case INT_LITERAL:
 		literal := p.parseIntegerLiteral()
@@ -1043,6 +1091,9 @@ func (p *Parser) parseCharLiteral() Expression {
 	if len(value) == 1 {
 		return &Literal{Value: rune(value[0]), Raw: raw}
 	}
+	if r, size := utf8.DecodeRuneInString(value); size == len(value) && r != utf8.RuneError {
+		return &Literal{Value: r, Raw: raw}
+	}
 	// 处理转义字符
 	return &Literal{Value: value, Raw: raw}
 }
@@ -1191,31 +1242,33 @@ func (p *Parser) parseTypedMapConstruction() Expression {
 // parseMapLiteral 解析Map字面量
 func (p *Parser) parseMapLiteral(firstKey Expression) Expression {
 	pairs := []Expression{}
+	keyStart := startOf(firstKey, p.lastEnd)
 
 	// 处理第一个键值对
 	// parseAssignmentExpression 返回后，current 可能是 : , 或 }
 	if p.current.Type == COLON {
 		p.nextToken() // 移动到值
 		value := p.parseAssignmentExpression()
-		pairs = append(pairs, &KeyValueExpression{Key: firstKey, Value: value})
+		pairs = append(pairs, p.mark(keyStart, &KeyValueExpression{Key: firstKey, Value: value}))
 	} else {
 		// 没有冒号，说明只有键，值为 nil
-		pairs = append(pairs, &KeyValueExpression{Key: firstKey, Value: nil})
+		pairs = append(pairs, p.mark(keyStart, &KeyValueExpression{Key: firstKey, Value: nil}))
 	}
 
 	// 处理后续键值对
 	// parseAssignmentExpression 返回后，current 指向表达式之后的 token（可能是 , 或 }）
 	for p.current.Type == COMMA {
 		p.nextToken() // 移动到键
+		keyStart = p.current.Position
 		key := p.parseAssignmentExpression()
 
 		// parseAssignmentExpression 返回后，current 应该是 : , 或 }
 		if p.current.Type == COLON {
 			p.nextToken() // 移动到值
 			value := p.parseAssignmentExpression()
-			pairs = append(pairs, &KeyValueExpression{Key: key, Value: value})
+			pairs = append(pairs, p.mark(keyStart, &KeyValueExpression{Key: key, Value: value}))
 		} else {
-			pairs = append(pairs, &KeyValueExpression{Key: key, Value: nil})
+			pairs = append(pairs, p.mark(keyStart, &KeyValueExpression{Key: key, Value: nil}))
 		}
 	}
 
@@ -1298,6 +1351,7 @@ func (p *Parser) parseConstructorCall() Expression {
 				return nil
 			}
 			// 现在 current = LBRACE
+			arrayStart := p.current.Position
 
 			elements := []Expression{}
 			// 检查是否是空数组
@@ -1325,7 +1379,7 @@ func (p *Parser) parseConstructorCall() Expression {
 			p.nextToken() // consume RBRACE
 
 			// 创建 ArrayExpression 包装元素列表
-			arrayExpr := &ArrayExpression{Elements: elements}
+			arrayExpr := p.mark(arrayStart, &ArrayExpression{Elements: elements})
 
 			return &ConstructorExpression{
 				ClassName: className,
@@ -1363,14 +1417,15 @@ func (p *Parser) parseConstructorCall() Expression {
 
 // parseStaticReference 解析静态引用 (@package.Class@member)
 func (p *Parser) parseStaticReference() Expression {
+	start := p.current.Position
 	// 当前 token 是 @，移动到下一个 token
 	p.nextToken()
 
 	// 检查是否是 @@ 简写语法 (等价于 @java.lang.Math@)
 	var className string
 	if p.current.Type == AT {
-		// @@ 简写，默认使用 java.lang.Math
-		className = "java.lang.Math"
+		// @@ 简写，类名记为 ShorthandClass，ClassResolver 可以把它解析为其他类
+		className = ShorthandClass
 		p.nextToken() // consume 第二个 @，移动到方法名
 
 		// 期望方法名
@@ -1398,8 +1453,9 @@ func (p *Parser) parseStaticReference() Expression {
 			ClassName: className,
 			Method:    memberName,
 			Arguments: arguments,
+			Shorthand: true,
 		}
-		return p.parseNavigationChainContinue(result)
+		return p.parseNavigationChainContinue(p.mark(start, result))
 	}
 
 	// 标准 @ClassName@ 语法
@@ -1455,7 +1511,7 @@ func (p *Parser) parseStaticReference() Expression {
 		}
 
 		// 关键修复：继续处理可能的链式调用
-		return p.parseNavigationChainContinue(result)
+		return p.parseNavigationChainContinue(p.mark(start, result))
 	} else {
 		// 静态字段访问
 		result := &StaticFieldExpression{
@@ -1465,7 +1521,7 @@ func (p *Parser) parseStaticReference() Expression {
 		p.nextToken() // consume the field name (move past it)
 
 		// 关键修复：继续处理可能的链式调用
-		return p.parseNavigationChainContinue(result)
+		return p.parseNavigationChainContinue(p.mark(start, result))
 	}
 }
 
@@ -1476,6 +1532,7 @@ func (p *Parser) parseStaticReference() Expression {
 // 如果 Lambda 后紧跟 (arg)，则解析为 ASTEval 表达式
 // 注意：根据Java OGNL的实现，Lambda表达式被包装在ASTConst节点中
 func (p *Parser) parseLambdaExpression() Expression {
+	start := p.current.Position
 	// current 是 COLON
 	if !p.expectPeek(LBRACK) {
 		return nil
@@ -1499,9 +1556,9 @@ func (p *Parser) parseLambdaExpression() Expression {
 
 	// 根据Java OGNL的实现，Lambda表达式应该包装在ASTConst中
 	// 在Go中，我们使用LambdaLiteral来表示这个ASTConst节点
-	lambdaConst := &LambdaLiteral{
+	lambdaConst := p.mark(start, &LambdaLiteral{
 		Body: body,
-	}
+	})
 
 	// 检查是否紧跟 (，如果是则解析为 ASTEval 表达式
 	if p.current.Type == LPAREN {
@@ -1526,7 +1583,7 @@ func (p *Parser) parseLambdaExpression() Expression {
 		}
 
 		// 继续处理可能的链式调用，如 :[33](20).longValue()
-		return p.parseNavigationChainContinue(evalExpr)
+		return p.parseNavigationChainContinue(p.mark(start, evalExpr))
 	}
 
 	// 如果没有紧跟 (，继续处理可能的链式调用
@@ -0,0 +1,361 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// =============================================================================
+// 改写
+// =============================================================================
+
+// RewriteRule 改写规则：把匹配 Before 的节点替换为 After，After 中的元变量替换为 Before 中的绑定
+type RewriteRule struct {
+	Name   string
+	Before *Pattern
+	After  *Pattern
+}
+
+// ParseRewriteRule 解析改写规则
+// After 只能使用 Before 中出现的元变量，$...NAME 只能作为参数、元素或链的一步出现
+func ParseRewriteRule(name, before, after string) (*RewriteRule, error) {
+	b, err := ParsePattern(before)
+	if err != nil {
+		return nil, fmt.Errorf("rewrite %s: before: %w", name, err)
+	}
+	a, err := ParsePattern(after)
+	if err != nil {
+		return nil, fmt.Errorf("rewrite %s: after: %w", name, err)
+	}
+	bound := map[string]bool{}
+	for _, v := range b.Metavars() {
+		bound[v] = true
+	}
+	for _, v := range a.Metavars() {
+		if !bound[v] {
+			return nil, fmt.Errorf("rewrite %s: %s is not bound by %q", name, v, before)
+		}
+	}
+	if err := checkSplices(a.expr); err != nil {
+		return nil, fmt.Errorf("rewrite %s: after: %w", name, err)
+	}
+	return &RewriteRule{Name: name, Before: b, After: a}, nil
+}
+
+// checkSplices 检查 $... 只出现在列表中
+func checkSplices(tmpl Expression) error {
+	var err error
+	Inspect(tmpl, func(node Expression) bool {
+		inList := map[Expression]bool{}
+		for _, l := range lists(node) {
+			for _, e := range l {
+				inList[e] = true
+			}
+		}
+		for _, child := range Children(node) {
+			if name, ellipsis, ok := exprMetavar(child); ok && ellipsis && (name == "" || !inList[child]) {
+				if name == "" {
+					name = "$..."
+				}
+				err = fmt.Errorf("%s can only be used as an argument, element or chain step with a name", name)
+			}
+		}
+		return err == nil
+	})
+	return err
+}
+
+// lists 返回节点中可以展开 $... 的列表
+func lists(node Expression) [][]Expression {
+	switch n := node.(type) {
+	case *SequenceExpression:
+		return [][]Expression{n.Expressions}
+	case *ChainExpression:
+		return [][]Expression{n.Children}
+	case *CallExpression:
+		return [][]Expression{n.Arguments}
+	case *StaticMethodExpression:
+		return [][]Expression{n.Arguments}
+	case *ConstructorExpression:
+		return [][]Expression{n.Arguments}
+	case *ArrayExpression:
+		return [][]Expression{n.Elements}
+	case *MapExpression:
+		return [][]Expression{n.Pairs}
+	}
+	return nil
+}
+
+// Change 改写记录中的一条
+type Change struct {
+	Rule string
+	// Pass 发生改写的轮次，从 1 开始
+	Pass int
+	// Origin 被替换节点的源码范围，改写产生的节点和手工构造的节点为零值
+	Origin Span
+	// Before 被替换节点的字符串形式，运算符保留源码中的写法 (eq、and、not ...)
+	Before string
+	// Node 替换它的节点
+	Node Expression
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("pass %d %s %s: %s => %s", c.Pass, c.Rule, c.Origin, c.Before, c.Node)
+}
+
+var (
+	// ErrRewriteCycle 改写的结果与之前某一轮的结果相同，规则相互抵消
+	ErrRewriteCycle = errors.New("rewrite cycle")
+	// ErrRewriteLimit 达到最大轮数时仍有改写发生，或者改写产生的节点超过上限
+	ErrRewriteLimit = errors.New("rewrite did not converge")
+)
+
+const (
+	// DefaultMaxPasses Rewriter 默认的最大轮数
+	DefaultMaxPasses = 32
+	// DefaultMaxNodes Rewriter 默认的改写产生的节点总数上限
+	DefaultMaxNodes = 1 << 18
+)
+
+// Rewriter 反复应用一组改写规则直到语法树不再变化，可以被多个 goroutine 同时使用
+type Rewriter struct {
+	rules []*RewriteRule
+	// MaxPasses 最大轮数，0 表示 DefaultMaxPasses
+	MaxPasses int
+	// MaxNodes 所有轮次中替换节点的总节点数上限，0 表示 DefaultMaxNodes
+	// 会使语法树增长的规则 (如 $X => ($X + 1)) 每一轮都让树成倍变大，轮数的上限不足以限制内存
+	MaxNodes int
+}
+
+// NewRewriter 创建使用给定规则的 Rewriter
+func NewRewriter(rules ...*RewriteRule) *Rewriter {
+	return &Rewriter{rules: rules}
+}
+
+// Rewrite 返回改写后的新语法树和按发生顺序排列的改写记录，输入树保持不变
+//
+// 每一轮自底向上访问所有节点，对每个节点按顺序尝试规则，第一个匹配的规则替换该节点；
+// 以元变量开头的链模式还会替换链的前几步。没有改写发生时结束。
+// 某一轮的结果与之前的结果相同时返回 ErrRewriteCycle，超过 MaxPasses 轮或者替换节点的总节点数超过 MaxNodes
+// 时返回 ErrRewriteLimit，出错时仍返回停止时的结果和全部改写记录。
+func (r *Rewriter) Rewrite(expr Expression) (Expression, []Change, error) {
+	max := r.MaxPasses
+	if max <= 0 {
+		max = DefaultMaxPasses
+	}
+	maxNodes := r.MaxNodes
+	if maxNodes <= 0 {
+		maxNodes = DefaultMaxNodes
+	}
+	var changes []Change
+	var limitErr error
+	nodes := 0
+	seen := map[string]int{fingerprint(expr): 0}
+	for pass := 1; ; pass++ {
+		if pass > max {
+			return expr, changes, fmt.Errorf("%w after %d passes", ErrRewriteLimit, max)
+		}
+		n := len(changes)
+		expr = Transform(expr, func(node Expression) Expression {
+			if limitErr != nil {
+				return node
+			}
+			for _, rule := range r.rules {
+				if out, repl, before, ok := rule.apply(node); ok {
+					if nodes += countNodes(repl, maxNodes-nodes); nodes > maxNodes {
+						limitErr = fmt.Errorf("%w: rewrites produced more than %d nodes", ErrRewriteLimit, maxNodes)
+						return node
+					}
+					changes = append(changes, Change{Rule: rule.Name, Pass: pass, Origin: repl.Span(), Before: before, Node: repl})
+					return out
+				}
+			}
+			return node
+		})
+		if limitErr != nil {
+			return expr, changes, limitErr
+		}
+		if len(changes) == n {
+			return expr, changes, nil
+		}
+		fp := fingerprint(expr)
+		if prev, ok := seen[fp]; ok {
+			return expr, changes, fmt.Errorf("%w: pass %d reproduces the result of pass %d", ErrRewriteCycle, pass, prev)
+		}
+		seen[fp] = pass
+	}
+}
+
+// countNodes 返回语法树的节点数，超过 max 之后不再继续计数
+func countNodes(expr Expression, max int) int {
+	n := 0
+	Inspect(expr, func(Expression) bool {
+		n++
+		return n <= max
+	})
+	return n
+}
+
+// apply 尝试把规则应用到节点本身或链的前几步，返回替换后的节点、替换的部分和被替换部分的字符串形式
+// 替换的部分使用被替换部分的源码范围；结果与原节点相同时视为没有改写
+func (rule *RewriteRule) apply(node Expression) (Expression, Expression, string, bool) {
+	if b, ok := rule.Before.MatchNode(node); ok {
+		repl := instantiate(rule.After.expr, b)
+		repl.SetSpan(node.Span())
+		return repl, repl, spelledString(node), fingerprint(repl) != fingerprint(node)
+	}
+	chain, ok := node.(*ChainExpression)
+	if _, chainPattern := rule.Before.expr.(*ChainExpression); !ok || !chainPattern {
+		return nil, nil, "", false
+	}
+	for n := len(chain.Children) - 1; n >= 2; n-- {
+		prefix := subChain(chain.Children[:n])
+		b, ok := rule.Before.MatchNode(prefix)
+		if !ok {
+			continue
+		}
+		repl := instantiate(rule.After.expr, b)
+		repl.SetSpan(prefix.Span())
+		if fingerprint(repl) == fingerprint(prefix) {
+			return nil, nil, "", false
+		}
+		c := *chain
+		c.Children = append(steps(repl), chain.Children[n:]...)
+		return &c, repl, spelledString(prefix), true
+	}
+	return nil, nil, "", false
+}
+
+// spelledString 返回保留运算符写法的字符串形式：String 总是使用规范写法，
+// 只改变写法的规则 ($A eq $B => $A == $B) 的改写记录会显示为 a == b => a == b
+func spelledString(node Expression) string {
+	return Transform(node, func(n Expression) Expression {
+		switch n := n.(type) {
+		case *BinaryExpression:
+			n.spelled = true
+		case *UnaryExpression:
+			n.spelled = true
+		}
+		return n
+	}).String()
+}
+
+// steps 返回替换链的前几步的节点展开后的各步，来自模板的步骤使用该节点的源码范围
+func steps(repl Expression) []Expression {
+	c, ok := repl.(*ChainExpression)
+	if !ok {
+		return []Expression{repl}
+	}
+	out := append([]Expression(nil), c.Children...)
+	for _, step := range out {
+		if !step.Span().IsValid() {
+			step.SetSpan(repl.Span())
+		}
+	}
+	return out
+}
+
+// splice $...NAME 在模板中的替换结果，由包含它的列表展开
+type splice struct {
+	BaseExpression
+	nodes []Expression
+}
+
+func (s *splice) String() string { return listBinding(s.nodes).Text }
+func (s *splice) Type() string   { return "splice" }
+
+// instantiate 用绑定替换模板中的元变量，返回新的语法树
+// 来自模板的节点没有源码范围，来自绑定的节点是保留源码范围的副本
+func instantiate(tmpl Expression, b map[string]Binding) Expression {
+	substituted := map[Expression]bool{}
+	name := func(s string) string {
+		if v, _, ok := metavar(s); ok {
+			return b[v].Text
+		}
+		return s
+	}
+	expand := func(list []Expression, chain bool) []Expression {
+		var out []Expression
+		for _, e := range list {
+			switch e := e.(type) {
+			case *splice:
+				for _, n := range e.nodes {
+					out = append(out, Clone(n))
+				}
+			case *ChainExpression:
+				if chain && substituted[e] {
+					out = append(out, e.Children...)
+					continue
+				}
+				out = append(out, e)
+			default:
+				out = append(out, e)
+			}
+		}
+		return out
+	}
+	return Transform(tmpl, func(node Expression) Expression {
+		if v, ellipsis, ok := exprMetavar(node); ok {
+			bound := b[v]
+			var repl Expression
+			switch {
+			case ellipsis:
+				return &splice{nodes: bound.Nodes}
+			case bound.Node != nil:
+				repl = Clone(bound.Node)
+			default:
+				repl = &Identifier{Value: bound.Text}
+			}
+			substituted[repl] = true
+			return repl
+		}
+		node.SetSpan(Span{})
+		switch n := node.(type) {
+		case *SequenceExpression:
+			n.Expressions = expand(n.Expressions, false)
+		case *ChainExpression:
+			n.Children = expand(n.Children, true)
+			if len(n.Children) == 1 {
+				return n.Children[0]
+			}
+		case *CallExpression:
+			n.Method = name(n.Method)
+			n.Arguments = expand(n.Arguments, false)
+		case *StaticMethodExpression:
+			n.ClassName, n.Method = name(n.ClassName), name(n.Method)
+			n.Arguments = expand(n.Arguments, false)
+		case *StaticFieldExpression:
+			n.ClassName, n.Field = name(n.ClassName), name(n.Field)
+		case *ConstructorExpression:
+			n.ClassName = name(n.ClassName)
+			n.Arguments = expand(n.Arguments, false)
+		case *VariableExpression:
+			n.Name = name(n.Name)
+		case *InstanceofExpression:
+			n.TargetType = name(n.TargetType)
+		case *ArrayExpression:
+			n.Elements = expand(n.Elements, false)
+		case *MapExpression:
+			n.ClassName = name(n.ClassName)
+			n.Pairs = expand(n.Pairs, false)
+		}
+		return node
+	})
+}
+
+// fingerprint 语法树的比较键：字符串形式加上各运算符的写法 (String 不区分 eq 与 ==)
+func fingerprint(expr Expression) string {
+	var sb strings.Builder
+	sb.WriteString(expr.String())
+	Inspect(expr, func(node Expression) bool {
+		switch n := node.(type) {
+		case *BinaryExpression:
+			sb.WriteString("\x00" + n.Spelling)
+		case *UnaryExpression:
+			sb.WriteString("\x00" + n.Spelling)
+		}
+		return true
+	})
+	return sb.String()
+}
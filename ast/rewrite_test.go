@@ -0,0 +1,147 @@
+package ast
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func mustRule(t *testing.T, name, before, after string) *RewriteRule {
+	t.Helper()
+	r, err := ParseRewriteRule(name, before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRewrite(t *testing.T) {
+	rules := []*RewriteRule{
+		mustRule(t, "static-forname", "$X.getClass().forName($Y)", "@java.lang.Class@forName($Y)"),
+		mustRule(t, "eq", "$A eq $B", "$A == $B"),
+		mustRule(t, "context-get", "#context.get($K)", "#context[$K]"),
+		mustRule(t, "double-string", "$X.toString().toString()", "$X.toString()"),
+		mustRule(t, "legacy-call", "legacy($...ARGS)", "modern(#ctx, $...ARGS)"),
+	}
+	tests := []struct {
+		input, expected string
+		changes         []string
+	}{
+		{
+			"#a.getClass().forName('java.lang.Runtime').getMethods()",
+			`@java.lang.Class@forName("java.lang.Runtime").getMethods()`,
+			[]string{`pass 1 static-forname 0:42: #a.getClass().forName("java.lang.Runtime") => @java.lang.Class@forName("java.lang.Runtime")`},
+		},
+		{
+			"a eq b and #context.get('k') eq 1",
+			`(a == b) && (#context['k'] == 1)`,
+			[]string{
+				"pass 1 eq 0:6: a eq b => a == b",
+				`pass 1 context-get 11:28: #context.get('k') => #context['k']`,
+				`pass 1 eq 11:33: #context['k'] eq 1 => #context['k'] == 1`,
+			},
+		},
+		{
+			"x.toString().toString().toString().toString().length()",
+			"x.toString().length()",
+			[]string{
+				"pass 1 double-string 0:45: x.toString().toString().toString().toString() => x.toString().toString().toString()",
+				"pass 2 double-string 0:45: x.toString().toString().toString() => x.toString().toString()",
+				"pass 3 double-string 0:45: x.toString().toString() => x.toString()",
+			},
+		},
+		{
+			"legacy() + legacy(1, 'a')",
+			`modern(#ctx) + modern(#ctx, 1, 'a')`,
+			[]string{`pass 1 legacy-call 0:8: legacy() => modern(#ctx)`, `pass 1 legacy-call 11:25: legacy(1, 'a') => modern(#ctx, 1, 'a')`},
+		},
+		{"a == b", "a == b", nil},
+	}
+	rw := NewRewriter(rules...)
+	for _, tt := range tests {
+		expr, err := New(NewLexer(tt.input)).ParseTopLevelExpression()
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := expr.String()
+		out, changes, err := rw.Rewrite(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("%s => %s, want %s", tt.input, out, tt.expected)
+		}
+		var got []string
+		for _, c := range changes {
+			got = append(got, c.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.changes, "\n") {
+			t.Errorf("%s changes:\n%s\nwant:\n%s", tt.input, strings.Join(got, "\n"), strings.Join(tt.changes, "\n"))
+		}
+		if expr.String() != before {
+			t.Errorf("input tree modified: %s", expr)
+		}
+	}
+}
+
+// TestRewriteSpelling eq 改写为 == 之后不再匹配，第二轮没有改写
+func TestRewriteSpelling(t *testing.T) {
+	expr, _ := New(NewLexer("a eq b")).ParseTopLevelExpression()
+	out, changes, err := NewRewriter(mustRule(t, "eq", "$A eq $B", "$A == $B")).Rewrite(expr)
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("changes %v, err %v", changes, err)
+	}
+	if got := changes[0].String(); got != "pass 1 eq 0:6: a eq b => a == b" {
+		t.Errorf("change %q", got)
+	}
+	if b := out.(*BinaryExpression); b.Spelling != "==" || b.Span() != (Span{Start: 0, End: 6}) {
+		t.Errorf("spelling %q, span %v", b.Spelling, b.Span())
+	}
+	// 来自绑定的节点保留源码范围
+	if right := out.(*BinaryExpression).Right; right.Span() != (Span{Start: 5, End: 6}) {
+		t.Errorf("right span %v", right.Span())
+	}
+}
+
+func TestRewriteErrors(t *testing.T) {
+	expr, _ := New(NewLexer("a + b")).ParseTopLevelExpression()
+	out, changes, err := NewRewriter(mustRule(t, "swap", "$A + $B", "$B + $A")).Rewrite(expr)
+	if !errors.Is(err, ErrRewriteCycle) || len(changes) != 2 || out.String() != "a + b" {
+		t.Errorf("swap: %v, %d changes, %s", err, len(changes), out)
+	}
+	if err != nil && err.Error() != "rewrite cycle: pass 2 reproduces the result of pass 0" {
+		t.Errorf("error %q", err)
+	}
+
+	rw := NewRewriter(mustRule(t, "grow", "$X.trim()", "$X.trim().trim()"))
+	rw.MaxPasses = 3
+	expr, _ = New(NewLexer("s.trim()")).ParseTopLevelExpression()
+	out, changes, err = rw.Rewrite(expr)
+	if !errors.Is(err, ErrRewriteLimit) || len(changes) != 3 {
+		t.Errorf("grow: %v, %d changes, %s", err, len(changes), out)
+	}
+
+	for _, tt := range []struct{ before, after, err string }{
+		{"$A + $B", "$C", "$C is not bound"},
+		{"f($...A)", "g($...)", "$... can only be used"},
+		{"f($...A)", "$...A + 1", "$...A can only be used"},
+		{"f(", "g()", "before:"},
+		{"f()", "g(", "after:"},
+	} {
+		if _, err := ParseRewriteRule("r", tt.before, tt.after); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s => %s: error %v, want %q", tt.before, tt.after, err, tt.err)
+		}
+	}
+
+	// 每一轮都使语法树成倍增长的规则在节点数达到上限时停止
+	expr, _ = New(NewLexer("a + b * c")).ParseTopLevelExpression()
+	out, changes, err = NewRewriter(mustRule(t, "wrap", "$X", "($X + 1)")).Rewrite(expr)
+	if !errors.Is(err, ErrRewriteLimit) || len(changes) == 0 || countNodes(out, 4*DefaultMaxNodes) > 2*DefaultMaxNodes {
+		t.Errorf("wrap: %v, %d changes", err, len(changes))
+	}
+	rw = NewRewriter(mustRule(t, "wrap", "$X", "($X + 1)"))
+	rw.MaxNodes = 10
+	if _, _, err = rw.Rewrite(expr); err == nil || err.Error() != "rewrite did not converge: rewrites produced more than 10 nodes" {
+		t.Errorf("error %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package ast
+
+import (
+	"testing"
+)
+
+// TestSpans 测试解析得到的节点记录了在源码中的范围
+func TestSpans(t *testing.T) {
+	input := "a + b * (c - 1), #x = not foo.{? #this > 2}[0]"
+	expr, err := New(NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seq := expr.(*SequenceExpression)
+	sum := seq.Expressions[0].(*BinaryExpression)
+	assign := seq.Expressions[1].(*AssignmentExpression)
+	not := assign.Right.(*UnaryExpression)
+	chain := not.Operand.(*ChainExpression)
+	for _, tt := range []struct {
+		node     Expression
+		expected string
+	}{
+		{seq, input},
+		{sum, "a + b * (c - 1)"},
+		{sum.Right, "b * (c - 1)"},
+		{sum.Right.(*BinaryExpression).Right, "c - 1"},
+		{assign, "#x = not foo.{? #this > 2}[0]"},
+		{assign.Left, "#x"},
+		{not, "not foo.{? #this > 2}[0]"},
+		{chain, "foo.{? #this > 2}[0]"},
+		{chain.Children[0], "foo"},
+		{chain.Children[1], "{? #this > 2}"},
+		{chain.Children[2], "[0]"},
+	} {
+		if got := tt.node.Span().Text(input); got != tt.expected {
+			t.Errorf("span of %s = %q, want %q", tt.node, got, tt.expected)
+		}
+	}
+
+	if line, col := (Span{Start: 7, End: 8}).Position("a\n  b + c"); line != 2 || col != 6 {
+		t.Errorf("Position = %d:%d, want 2:6", line, col)
+	}
+}
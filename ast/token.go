@@ -93,7 +93,8 @@ type Token struct {
 	Literal  interface{} // 存储解析后的字面量值
 	Line     int
 	Column   int
-	Position int
+	Position int // 起始字节偏移
+	End      int // 结束字节偏移（不含）
 }
 
 // TokenTypeNames Token类型名称映射
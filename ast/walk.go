@@ -0,0 +1,221 @@
+package ast
+
+// =============================================================================
+// 遍历
+// =============================================================================
+
+// Children 按源码顺序返回节点的直接子表达式，省略缺失的子节点
+// Identifier.NameNode 和 InstanceofExpression.TypeNode 只是名字的另一种表示，不作为子节点返回
+func Children(node Expression) []Expression {
+	var out []Expression
+	add := func(nodes ...Expression) {
+		for _, n := range nodes {
+			if n != nil {
+				out = append(out, n)
+			}
+		}
+	}
+	switch n := node.(type) {
+	case *SequenceExpression:
+		add(n.Expressions...)
+	case *AssignmentExpression:
+		add(n.Left, n.Right)
+	case *ConditionalExpression:
+		add(n.Test, n.Consequent, n.Alternative)
+	case *BinaryExpression:
+		add(n.Left, n.Right)
+	case *UnaryExpression:
+		add(n.Operand)
+	case *InstanceofExpression:
+		add(n.Operand)
+	case *LambdaExpression:
+		add(n.Body)
+	case *LambdaLiteral:
+		add(n.Body)
+	case *ChainExpression:
+		add(n.Object, n.Property)
+		add(n.Children...)
+	case *IndexExpression:
+		add(n.Object, n.Index)
+	case *CallExpression:
+		add(n.Object)
+		add(n.Arguments...)
+	case *StaticMethodExpression:
+		add(n.Arguments...)
+	case *ConstructorExpression:
+		add(n.Arguments...)
+	case *ProjectionExpression:
+		add(n.Object, n.Expression)
+	case *SelectionExpression:
+		add(n.Object, n.Expression)
+	case *EvalExpression:
+		add(n.Target, n.Argument)
+	case *ArrayExpression:
+		add(n.Elements...)
+	case *MapExpression:
+		add(n.Pairs...)
+	case *KeyValueExpression:
+		add(n.Key, n.Value)
+	case *DynamicSubscriptExpression:
+		add(n.Object)
+	}
+	return out
+}
+
+// Inspect 深度优先遍历语法树，先访问节点再访问子节点；fn 返回 false 时跳过该节点的子节点
+func Inspect(node Expression, fn func(Expression) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+	for _, child := range Children(node) {
+		Inspect(child, fn)
+	}
+}
+
+// Transform 自底向上复制语法树：先复制并变换子节点，再对复制出的节点调用 fn，返回 fn 的结果
+// 输入树保持不变；复制的节点保留原来的源码范围。fn 可以原样返回节点，也可以返回替换它的新节点
+func Transform(node Expression, fn func(Expression) Expression) Expression {
+	return transform(node, nil, fn)
+}
+
+// Substitute 自顶向下复制语法树：对原树中的节点调用 fn，fn 返回非 nil 时用返回值替换该节点，
+// 不再访问它的子节点；返回 nil 时复制该节点并继续处理子节点
+// 与 Transform 不同，fn 看到的是输入树中的节点本身，可以按节点身份查找额外的信息
+func Substitute(node Expression, fn func(Expression) Expression) Expression {
+	return transform(node, fn, func(n Expression) Expression { return n })
+}
+
+// transform 复制语法树，pre 在复制之前作用于原节点，post 在复制之后作用于新节点
+func transform(node Expression, pre, post func(Expression) Expression) Expression {
+	if node == nil {
+		return nil
+	}
+	if pre != nil {
+		if r := pre(node); r != nil {
+			return r
+		}
+	}
+	t := func(n Expression) Expression { return transform(n, pre, post) }
+	list := func(nodes []Expression) []Expression {
+		if nodes == nil {
+			return nil
+		}
+		out := make([]Expression, len(nodes))
+		for i, n := range nodes {
+			out[i] = t(n)
+		}
+		return out
+	}
+
+	var c Expression
+	switch n := node.(type) {
+	case *SequenceExpression:
+		cp := *n
+		cp.Expressions = list(n.Expressions)
+		c = &cp
+	case *AssignmentExpression:
+		cp := *n
+		cp.Left, cp.Right = t(n.Left), t(n.Right)
+		c = &cp
+	case *ConditionalExpression:
+		cp := *n
+		cp.Test, cp.Consequent, cp.Alternative = t(n.Test), t(n.Consequent), t(n.Alternative)
+		c = &cp
+	case *BinaryExpression:
+		cp := *n
+		cp.Left, cp.Right = t(n.Left), t(n.Right)
+		c = &cp
+	case *UnaryExpression:
+		cp := *n
+		cp.Operand = t(n.Operand)
+		c = &cp
+	case *InstanceofExpression:
+		cp := *n
+		cp.Operand, cp.TypeNode = t(n.Operand), t(n.TypeNode)
+		c = &cp
+	case *LambdaExpression:
+		cp := *n
+		cp.Body = t(n.Body)
+		c = &cp
+	case *LambdaLiteral:
+		cp := *n
+		cp.Body = t(n.Body)
+		c = &cp
+	case *ChainExpression:
+		cp := *n
+		cp.Object, cp.Property, cp.Children = t(n.Object), t(n.Property), list(n.Children)
+		c = &cp
+	case *IndexExpression:
+		cp := *n
+		cp.Object, cp.Index = t(n.Object), t(n.Index)
+		c = &cp
+	case *CallExpression:
+		cp := *n
+		cp.Object, cp.Arguments = t(n.Object), list(n.Arguments)
+		c = &cp
+	case *StaticMethodExpression:
+		cp := *n
+		cp.Arguments = list(n.Arguments)
+		c = &cp
+	case *StaticFieldExpression:
+		cp := *n
+		c = &cp
+	case *ConstructorExpression:
+		cp := *n
+		cp.Arguments = list(n.Arguments)
+		c = &cp
+	case *ProjectionExpression:
+		cp := *n
+		cp.Object, cp.Expression = t(n.Object), t(n.Expression)
+		c = &cp
+	case *SelectionExpression:
+		cp := *n
+		cp.Object, cp.Expression = t(n.Object), t(n.Expression)
+		c = &cp
+	case *EvalExpression:
+		cp := *n
+		cp.Target, cp.Argument = t(n.Target), t(n.Argument)
+		c = &cp
+	case *Identifier:
+		cp := *n
+		cp.NameNode = t(n.NameNode)
+		c = &cp
+	case *Literal:
+		cp := *n
+		c = &cp
+	case *ThisExpression:
+		cp := *n
+		c = &cp
+	case *RootExpression:
+		cp := *n
+		c = &cp
+	case *VariableExpression:
+		cp := *n
+		c = &cp
+	case *ArrayExpression:
+		cp := *n
+		cp.Elements = list(n.Elements)
+		c = &cp
+	case *MapExpression:
+		cp := *n
+		cp.Pairs = list(n.Pairs)
+		c = &cp
+	case *KeyValueExpression:
+		cp := *n
+		cp.Key, cp.Value = t(n.Key), t(n.Value)
+		c = &cp
+	case *DynamicSubscriptExpression:
+		cp := *n
+		cp.Object = t(n.Object)
+		c = &cp
+	default:
+		// 未知的节点类型无法复制，原样交给 fn
+		c = node
+	}
+	return post(c)
+}
+
+// Clone 深度复制语法树
+func Clone(node Expression) Expression {
+	return Transform(node, func(n Expression) Expression { return n })
+}
@@ -0,0 +1,76 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestInspect 测试深度优先遍历的顺序和跳过子节点
+func TestInspect(t *testing.T) {
+	expr, err := New(NewLexer("a.b(1, #x) + {2, :[#this]}")).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var visited []string
+	Inspect(expr, func(node Expression) bool {
+		visited = append(visited, node.Type())
+		_, isLambda := node.(*LambdaLiteral)
+		return !isLambda
+	})
+	expected := "ASTAdd ASTChain ASTProperty ASTMethod ASTConst ASTVarRef ASTList ASTConst ASTConst"
+	if got := strings.Join(visited, " "); got != expected {
+		t.Errorf("visited %s, want %s", got, expected)
+	}
+}
+
+// TestTransform 测试自底向上替换节点，输入树保持不变
+func TestTransform(t *testing.T) {
+	input := "a.b(1, #x) + {2, :[#x]}"
+	expr, err := New(NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := expr.String()
+	got := Transform(expr, func(node Expression) Expression {
+		if v, ok := node.(*VariableExpression); ok && v.Name == "x" {
+			lit := &Literal{Value: int64(3), Raw: "3"}
+			lit.SetSpan(v.Span())
+			return lit
+		}
+		return node
+	})
+	if got.String() != "a.b(1, 3) + { 2, :[3] }" {
+		t.Errorf("Transform = %s", got)
+	}
+	if expr.String() != before {
+		t.Errorf("input tree was modified: %s -> %s", before, expr)
+	}
+	if clone := Clone(expr); clone == expr || clone.String() != before || clone.Span().Text(input) != input {
+		t.Errorf("Clone = %s", clone)
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	input := "#x + #y.f(#x)"
+	expr, err := New(NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := expr.(*BinaryExpression).Left
+	got := Substitute(expr, func(node Expression) Expression {
+		// fn 看到的是输入树中的节点，只替换第一个 #x
+		if node == first {
+			return &Literal{Value: int64(1), Raw: "1"}
+		}
+		if chain, ok := node.(*ChainExpression); ok {
+			return &VariableExpression{Name: "z" + chain.Children[0].(*VariableExpression).Name}
+		}
+		return nil
+	})
+	if got.String() != "1 + #zy" {
+		t.Errorf("Substitute = %s", got)
+	}
+	if expr.String() != "#x + #y.f(#x)" {
+		t.Errorf("input tree was modified: %s", expr)
+	}
+}
@@ -0,0 +1,320 @@
+// Package cve 按已知漏洞家族的结构特征给载荷分类
+//
+// 目录 (Catalog) 中的每个家族对应一类公开的 OGNL 注入漏洞 (S2-045、CVE-2022-26134 等)，
+// 由若干带权重的特征 (Signature) 描述。特征是 rules 包的规则，用 ast.Pattern 匹配语法树的结构，
+// 而不是用正则匹配载荷文本，因此不受空白、引号、括号写法和 # 之类编码的影响：
+//
+//	{
+//	  "threshold": 3,
+//	  "families": [{
+//	    "id": "S2-045",
+//	    "aliases": ["S2-046"],
+//	    "cves": ["CVE-2017-5638"],
+//	    "product": "Apache Struts 2.3.5 - 2.3.31, 2.5 - 2.5.10",
+//	    "signatures": [
+//	      {"weight": 3, "rule": {
+//	        "id": "member-access-switch",
+//	        "severity": "critical",
+//	        "message": "replaces _memberAccess directly when it is reachable",
+//	        "pattern": "#_memberAccess ? (#_memberAccess = $DM) : $ELSE"
+//	      }}
+//	    ]
+//	  }]
+//	}
+//
+// 家族的得分是匹配的特征的权重之和，置信度是得分占家族所有特征权重的比例。
+// Classify 在表达式、去混淆后的表达式和作为 (x)(y) 求值目标的字符串 (S2-005 的写法) 中匹配特征，
+// 得分最高且不低于 threshold 的家族是分类结果。
+//
+// 内置目录没有 S2-052：它是 XStream 反序列化漏洞，载荷是 XML 而不是 OGNL。
+// S2-046 与 S2-045、S2-062 与 S2-061 的载荷相同，作为别名记录在同一个家族中。
+package cve
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/optimize"
+	"github.com/weaweawe01/ParserOgnl/rules"
+)
+
+// maxEvalDepth 字符串中的表达式最多展开的层数
+const maxEvalDepth = 3
+
+// Catalog 漏洞家族的目录，加载后可以被多个 goroutine 同时使用
+type Catalog struct {
+	// Threshold 分类结果要求的最低得分
+	Threshold int
+	Families  []*Family
+}
+
+// Family 一类漏洞
+type Family struct {
+	// ID 家族名，如 S2-045
+	ID string
+	// Aliases 载荷相同的其他公告，如 S2-046
+	Aliases []string
+	CVEs    []string
+	// Product 受影响的产品和版本
+	Product     string
+	Description string
+	Signatures  []*Signature
+}
+
+// Signature 家族的一个结构特征
+type Signature struct {
+	Weight int
+	Rule   *rules.Rule
+}
+
+// Evidence 一个匹配的特征
+type Evidence struct {
+	Signature *Signature
+	Match     ast.MatchResult
+	// Message 特征规则的说明，元变量已替换
+	Message string
+}
+
+// Candidate 一个有特征匹配的家族
+type Candidate struct {
+	Family *Family
+	// Score 匹配的特征的权重之和，每个特征只计一次
+	Score int
+	// Confidence 得分占家族所有特征权重的比例
+	Confidence float64
+	Evidence   []Evidence
+}
+
+// Result 分类结果
+type Result struct {
+	// Family 最可能的家族，没有家族的得分达到阈值时为 nil
+	Family     *Family
+	Confidence float64
+	// Candidates 所有有特征匹配的家族，按得分从高到低排列
+	Candidates []Candidate
+}
+
+// Is 报告 name 是否是家族的 ID、别名或 CVE 编号
+func (f *Family) Is(name string) bool {
+	if name == f.ID {
+		return true
+	}
+	for _, a := range f.Aliases {
+		if a == name {
+			return true
+		}
+	}
+	for _, c := range f.CVEs {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Family) String() string {
+	return f.ID
+}
+
+// weight 家族所有特征的权重之和
+func (f *Family) weight() int {
+	total := 0
+	for _, s := range f.Signatures {
+		total += s.Weight
+	}
+	return total
+}
+
+// =============================================================================
+// 加载
+// =============================================================================
+
+type catalogSpec struct {
+	Threshold int          `json:"threshold"`
+	Families  []familySpec `json:"families"`
+}
+
+type familySpec struct {
+	ID          string          `json:"id"`
+	Aliases     []string        `json:"aliases"`
+	CVEs        []string        `json:"cves"`
+	Product     string          `json:"product"`
+	Description string          `json:"description"`
+	Signatures  []signatureSpec `json:"signatures"`
+}
+
+type signatureSpec struct {
+	Weight int             `json:"weight"`
+	Rule   json.RawMessage `json:"rule"`
+}
+
+// Parse 解析 {"threshold": n, "families": [...]} 形式的目录文件
+func Parse(data []byte) (*Catalog, error) {
+	var spec catalogSpec
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&spec); err != nil {
+		return nil, err
+	}
+	c := &Catalog{Threshold: spec.Threshold}
+	seen := map[string]bool{}
+	for i, fs := range spec.Families {
+		if fs.ID == "" {
+			return nil, fmt.Errorf("family #%d: missing id", i)
+		}
+		if seen[fs.ID] {
+			return nil, fmt.Errorf("family %s: duplicate id", fs.ID)
+		}
+		seen[fs.ID] = true
+		if len(fs.Signatures) == 0 {
+			return nil, fmt.Errorf("family %s: no signatures", fs.ID)
+		}
+		f := &Family{
+			ID:          fs.ID,
+			Aliases:     fs.Aliases,
+			CVEs:        fs.CVEs,
+			Product:     fs.Product,
+			Description: fs.Description,
+		}
+		for j, ss := range fs.Signatures {
+			if ss.Weight <= 0 {
+				return nil, fmt.Errorf("family %s: signature #%d: weight must be positive", fs.ID, j)
+			}
+			if len(ss.Rule) == 0 {
+				return nil, fmt.Errorf("family %s: signature #%d: missing rule", fs.ID, j)
+			}
+			// 借用 rules 的文件格式编译单条规则
+			compiled, err := rules.Parse([]byte(`{"rules": [` + string(ss.Rule) + `]}`))
+			if err != nil {
+				return nil, fmt.Errorf("family %s: signature #%d: %w", fs.ID, j, err)
+			}
+			f.Signatures = append(f.Signatures, &Signature{Weight: ss.Weight, Rule: compiled[0]})
+		}
+		c.Families = append(c.Families, f)
+	}
+	return c, nil
+}
+
+// ParseFile 读取并解析目录文件
+func ParseFile(name string) (*Catalog, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return c, nil
+}
+
+//go:embed catalog.json
+var catalogJSON []byte
+
+var builtin = func() *Catalog {
+	c, err := Parse(catalogJSON)
+	if err != nil {
+		panic("cve: catalog.json: " + err.Error())
+	}
+	return c
+}()
+
+// Builtin 返回随包发布的目录，调用者不能修改它
+func Builtin() *Catalog {
+	return builtin
+}
+
+// Lookup 按 ID、别名或 CVE 编号查找家族，找不到时返回 nil
+func (c *Catalog) Lookup(name string) *Family {
+	for _, f := range c.Families {
+		if f.Is(name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// =============================================================================
+// 分类
+// =============================================================================
+
+// Classify 用内置目录给表达式分类
+func Classify(expr ast.Expression) *Result {
+	return builtin.Classify(expr)
+}
+
+// Classify 给表达式分类，不修改 expr
+func (c *Catalog) Classify(expr ast.Expression) *Result {
+	trees := views(expr, 0)
+	result := &Result{}
+	for _, f := range c.Families {
+		cand := Candidate{Family: f}
+		for _, s := range f.Signatures {
+			for _, tree := range trees {
+				if ms := s.Rule.Find(tree); len(ms) > 0 {
+					cand.Score += s.Weight
+					cand.Evidence = append(cand.Evidence, Evidence{Signature: s, Match: ms[0], Message: s.Rule.Format(ms[0])})
+					break
+				}
+			}
+		}
+		if cand.Score == 0 {
+			continue
+		}
+		cand.Confidence = float64(cand.Score) / float64(f.weight())
+		result.Candidates = append(result.Candidates, cand)
+	}
+	// 稳定排序保留目录中的顺序
+	sort.SliceStable(result.Candidates, func(i, j int) bool {
+		a, b := result.Candidates[i], result.Candidates[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Confidence > b.Confidence
+	})
+	if len(result.Candidates) > 0 && result.Candidates[0].Score >= c.Threshold {
+		result.Family = result.Candidates[0].Family
+		result.Confidence = result.Candidates[0].Confidence
+	}
+	return result
+}
+
+// views 返回匹配特征的语法树：表达式本身、去混淆后的表达式 (有改写时)，
+// 以及作为求值目标的字符串常量解析出的表达式，递归展开
+func views(expr ast.Expression, depth int) []ast.Expression {
+	out := []ast.Expression{expr}
+	if clean, rewrites := optimize.Deobfuscate(expr); len(rewrites) > 0 {
+		out = append(out, clean)
+	}
+	if depth >= maxEvalDepth {
+		return out
+	}
+	seen := map[string]bool{}
+	for _, tree := range append([]ast.Expression(nil), out...) {
+		ast.Inspect(tree, func(n ast.Expression) bool {
+			e, ok := n.(*ast.EvalExpression)
+			if !ok {
+				return true
+			}
+			lit, ok := e.Target.(*ast.Literal)
+			if !ok {
+				return true
+			}
+			source, ok := lit.Value.(string)
+			if !ok || seen[source] {
+				return true
+			}
+			seen[source] = true
+			if inner, err := ast.New(ast.NewLexer(source)).ParseTopLevelExpression(); err == nil {
+				out = append(out, views(inner, depth+1)...)
+			}
+			return true
+		})
+	}
+	return out
+}
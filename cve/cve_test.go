@@ -0,0 +1,117 @@
+package cve
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+func parse(t *testing.T, input string) ast.Expression {
+	t.Helper()
+	expr, err := ast.New(ast.NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatalf("%s: %v", input, err)
+	}
+	return expr
+}
+
+// TestLookup 按 ID、别名和 CVE 编号查找家族
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name, expected string
+	}{
+		{"S2-045", "S2-045"},
+		{"S2-046", "S2-045"},
+		{"CVE-2017-5638", "S2-045"},
+		{"S2-062", "S2-061"},
+		{"CVE-2021-31805", "S2-061"},
+		{"CVE-2022-26134", "CVE-2022-26134"},
+	}
+	for _, tt := range tests {
+		f := Builtin().Lookup(tt.name)
+		if f == nil || f.ID != tt.expected {
+			t.Errorf("Lookup(%q) = %v, want %s", tt.name, f, tt.expected)
+		}
+	}
+	if f := Builtin().Lookup("S2-052"); f != nil {
+		t.Errorf("Lookup(S2-052) = %s, want nil", f)
+	}
+}
+
+// TestClassify 测试得分、置信度、候选的顺序和证据
+func TestClassify(t *testing.T) {
+	// S2-016 的载荷同时带有 S2-005 的特征 (关闭 denyMethodExecution)
+	input := "#context['xwork.MethodAccessor.denyMethodExecution'] = false, " +
+		"#f = #_memberAccess.getClass().getDeclaredField('allowStaticMethodAccess'), #f.setAccessible(true), #f.set(#_memberAccess, true)"
+	r := Classify(parse(t, input))
+	if r.Family == nil || r.Family.ID != "S2-016" || r.Confidence != 1 {
+		t.Fatalf("family = %v, confidence = %v", r.Family, r.Confidence)
+	}
+	var got []string
+	for _, c := range r.Candidates {
+		got = append(got, c.Family.ID)
+	}
+	if strings.Join(got, " ") != "S2-016 S2-005" {
+		t.Errorf("candidates = %v", got)
+	}
+	var evidence []string
+	for _, e := range r.Candidates[0].Evidence {
+		evidence = append(evidence, e.Signature.Rule.ID+": "+e.Message)
+	}
+	expected := []string{
+		"reflective-static-access: reaches allowStaticMethodAccess through reflection",
+		"field-set-on-member-access: sets the field #f on _memberAccess",
+		"deny-method-execution-false: turns off xwork.MethodAccessor.denyMethodExecution",
+	}
+	if strings.Join(evidence, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("evidence:\n%s\nwant:\n%s", strings.Join(evidence, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+// TestClassifyViews 特征也在去混淆后的表达式和字符串中的表达式中匹配
+func TestClassifyViews(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		// 参数名中的表达式
+		{`('#_memberAccess.excludeProperties=@java.util.Collections@EMPTY_SET')(a)(b)`, "S2-005"},
+		// 拼接出的键，去混淆后匹配
+		{"#request['struts.' + 'valueStack'].context", "S2-057"},
+		{"#application['org.apache.' + 'tomcat.InstanceManager'].newInstance('org.apache.commons.collections.BeanMap')", "S2-061"},
+		// 低于阈值
+		{"#response.setHeader('Cache-Control', 'no-cache')", ""},
+	}
+	for _, tt := range tests {
+		r := Classify(parse(t, tt.input))
+		got := ""
+		if r.Family != nil {
+			got = r.Family.ID
+		}
+		if got != tt.expected {
+			t.Errorf("%s: family = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestParseErrors 测试目录文件中的错误
+func TestParseErrors(t *testing.T) {
+	const rule = `{"id": "r", "severity": "high", "message": "m", "pattern": "#a"}`
+	tests := []struct {
+		input, expected string
+	}{
+		{`{"families": [{"signatures": []}]}`, "family #0: missing id"},
+		{`{"families": [{"id": "x"}]}`, "family x: no signatures"},
+		{`{"families": [{"id": "x", "signatures": [{"weight": 0, "rule": ` + rule + `}]}]}`, "family x: signature #0: weight must be positive"},
+		{`{"families": [{"id": "x", "signatures": [{"weight": 1}]}]}`, "family x: signature #0: missing rule"},
+		{`{"families": [{"id": "x", "signatures": [{"weight": 1, "rule": {"id": "r"}}]}]}`, "family x: signature #0: rule r:"},
+		{`{"families": [{"id": "x", "signatures": [{"weight": 1, "rule": ` + rule + `}]}, {"id": "x"}]}`, "family x: duplicate id"},
+		{`{"families": [], "minimum": 1}`, "unknown field"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: error %v, want %q", tt.input, err, tt.expected)
+		}
+	}
+}
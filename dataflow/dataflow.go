@@ -0,0 +1,303 @@
+// Package dataflow 分析 OGNL 表达式中 #var 变量的定义和使用
+//
+// 沙箱绕过载荷通常是序列 (a, b, c) 或 (#a=...).(#b=#a.x)... 形式的链，通过上下文变量传递中间值。
+// Analyze 按 OGNL 的求值顺序遍历语法树，为每次对变量的赋值建立定义 (Def)，为每次读取建立使用 (Use)，
+// 并求出到达每次使用的定义，由此可以：
+//   - 得到变量在某次使用时的值对应的语法树 (Graph.Value)，或者把表达式中的变量全部代入 (Graph.Resolve)
+//   - 找出从未读取的赋值 (Graph.Unused) 和读取之前没有赋值的变量 (Graph.Undefined)
+//
+// 求值顺序与 OGNL 一致：赋值先求右边再定义变量；条件表达式的两个分支、&& 和 || 的右边、
+// 投影和选择的表达式可能不执行，其中的定义是有条件的，之后的使用会同时看到分支前后的定义；
+// lambda 的函数体在调用时才执行，调用时间未知，因此在整个表达式之后分析，
+// 函数体中的使用看到创建 lambda 时和表达式结束时的定义。
+package dataflow
+
+import (
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// Predefined Struts 和 OGNL 预先放入上下文的变量，读取它们不算未定义，对它们的赋值也不算无用
+var Predefined = map[string]bool{
+	"context":       true,
+	"_memberAccess": true,
+	"root":          true,
+	"this":          true,
+	"attr":          true,
+	"request":       true,
+	"session":       true,
+	"application":   true,
+	"parameters":    true,
+	"action":        true,
+}
+
+// Def 一次对变量的赋值
+type Def struct {
+	Name string
+	// Node 赋值表达式
+	Node *ast.AssignmentExpression
+	// Value 赋给变量的值，连续赋值 #a = #b = x 中 #a 和 #b 的值都是 x
+	Value ast.Expression
+	// Conditional 赋值位于可能不执行的分支、投影、选择或 lambda 中
+	Conditional bool
+	// Uses 这次赋值到达的使用，按求值顺序排列
+	Uses []*Use
+}
+
+// Span 赋值表达式的源码范围
+func (d *Def) Span() ast.Span {
+	return d.Node.Span()
+}
+
+// Use 一次对变量的读取
+type Use struct {
+	Name string
+	Node *ast.VariableExpression
+	// Defs 到达这次读取的赋值
+	Defs []*Def
+	// MaybeUndefined 至少有一条执行路径在读取之前没有给变量赋值
+	MaybeUndefined bool
+}
+
+// Span 变量引用的源码范围
+func (u *Use) Span() ast.Span {
+	return u.Node.Span()
+}
+
+// Graph 一个表达式的定义-使用关系
+type Graph struct {
+	// Defs 所有赋值，按求值顺序排列，lambda 函数体中的赋值排在最后
+	Defs []*Def
+	// Uses 所有读取，顺序同 Defs
+	Uses []*Use
+	uses map[*ast.VariableExpression]*Use
+}
+
+// Analyze 分析表达式中变量的定义和使用
+func Analyze(expr ast.Expression) *Graph {
+	w := &walker{g: &Graph{uses: map[*ast.VariableExpression]*Use{}}}
+	final := w.walk(expr, state{})
+	// 函数体中还可能创建新的 lambda，因此按下标遍历
+	for i := 0; i < len(w.lambdas); i++ {
+		l := w.lambdas[i]
+		w.conditional++
+		w.walk(l.body, union(l.state, final))
+		w.conditional--
+	}
+	return w.g
+}
+
+// Use 返回变量引用对应的读取，node 不是所分析的语法树中的节点时返回 nil
+func (g *Graph) Use(node *ast.VariableExpression) *Use {
+	return g.uses[node]
+}
+
+// Unused 返回从未被读取的赋值，不包括对 Predefined 中变量的赋值
+func (g *Graph) Unused() []*Def {
+	var out []*Def
+	for _, d := range g.Defs {
+		if len(d.Uses) == 0 && !Predefined[d.Name] {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Undefined 返回读取之前在任何路径上都没有赋值的变量，不包括 Predefined 中的变量
+func (g *Graph) Undefined() []*Use {
+	var out []*Use
+	for _, u := range g.Uses {
+		if len(u.Defs) == 0 && !Predefined[u.Name] {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// Value 返回变量在这次读取时的值，只有唯一的赋值到达且每条路径都经过该赋值时才能确定
+func (g *Graph) Value(node *ast.VariableExpression) (ast.Expression, bool) {
+	u := g.uses[node]
+	if u == nil || len(u.Defs) != 1 || u.MaybeUndefined {
+		return nil, false
+	}
+	return u.Defs[0].Value, true
+}
+
+// Resolve 返回把 node 中值能够确定的变量引用代入其值后的新语法树，代入的值中的变量同样代入
+// node 必须是所分析的语法树或其中的子树，输入树保持不变；代入的节点保留赋值处的源码范围
+func (g *Graph) Resolve(node ast.Expression) ast.Expression {
+	return g.resolve(node, map[*Def]bool{})
+}
+
+func (g *Graph) resolve(node ast.Expression, visiting map[*Def]bool) ast.Expression {
+	return ast.Substitute(node, func(n ast.Expression) ast.Expression {
+		v, ok := n.(*ast.VariableExpression)
+		if !ok {
+			return nil
+		}
+		if _, ok := g.Value(v); !ok {
+			return nil
+		}
+		// lambda 中的递归引用会回到正在代入的赋值
+		d := g.uses[v].Defs[0]
+		if visiting[d] {
+			return nil
+		}
+		visiting[d] = true
+		defer delete(visiting, d)
+		return g.resolve(d.Value, visiting)
+	})
+}
+
+// =============================================================================
+// 遍历
+// =============================================================================
+
+// state 每个变量在当前位置可能的值来自哪些赋值，nil 表示某条路径上没有赋值；
+// 不在 map 中的变量在所有路径上都没有赋值。state 创建后不再修改
+type state map[string][]*Def
+
+// with 返回把变量定义为 d 之后的状态
+func (s state) with(name string, d *Def) state {
+	out := make(state, len(s)+1)
+	for k, v := range s {
+		out[k] = v
+	}
+	out[name] = []*Def{d}
+	return out
+}
+
+// merge 合并两条路径汇合后的状态
+func merge(a, b state) state {
+	out := state{}
+	for name, defs := range a {
+		if _, ok := b[name]; !ok {
+			defs = append(defs[:len(defs):len(defs)], nil)
+		}
+		out[name] = defs
+	}
+	for name, defs := range b {
+		if _, ok := a[name]; !ok {
+			out[name] = append(defs[:len(defs):len(defs)], nil)
+			continue
+		}
+		out[name] = unionDefs(out[name], defs)
+	}
+	return out
+}
+
+// union 合并状态，只在一边有定义的变量不视为未定义
+func union(a, b state) state {
+	out := state{}
+	for name, defs := range a {
+		out[name] = defs
+	}
+	for name, defs := range b {
+		out[name] = unionDefs(out[name], defs)
+	}
+	return out
+}
+
+func unionDefs(a, b []*Def) []*Def {
+	out := append([]*Def(nil), a...)
+	for _, d := range b {
+		found := false
+		for _, e := range out {
+			if e == d {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+type lambda struct {
+	body  ast.Expression
+	state state
+}
+
+type walker struct {
+	g *Graph
+	// conditional 大于 0 时位于可能不执行的代码中
+	conditional int
+	lambdas     []lambda
+}
+
+// walk 按求值顺序分析节点，返回求值之后的状态
+func (w *walker) walk(node ast.Expression, s state) state {
+	switch n := node.(type) {
+	case nil:
+		return s
+	case *ast.VariableExpression:
+		w.use(n, s)
+		return s
+	case *ast.AssignmentExpression:
+		s = w.walk(n.Right, s)
+		v, ok := n.Left.(*ast.VariableExpression)
+		if !ok {
+			return w.walk(n.Left, s)
+		}
+		value := n.Right
+		for {
+			a, ok := value.(*ast.AssignmentExpression)
+			if !ok {
+				break
+			}
+			value = a.Right
+		}
+		d := &Def{Name: v.Name, Node: n, Value: value, Conditional: w.conditional > 0}
+		w.g.Defs = append(w.g.Defs, d)
+		return s.with(v.Name, d)
+	case *ast.ConditionalExpression:
+		s = w.walk(n.Test, s)
+		w.conditional++
+		defer func() { w.conditional-- }()
+		return merge(w.walk(n.Consequent, s), w.walk(n.Alternative, s))
+	case *ast.BinaryExpression:
+		if n.Operator != ast.AND && n.Operator != ast.OR {
+			break
+		}
+		s = w.walk(n.Left, s)
+		return w.optional(n.Right, s)
+	case *ast.ProjectionExpression:
+		return w.optional(n.Expression, w.walk(n.Object, s))
+	case *ast.SelectionExpression:
+		return w.optional(n.Expression, w.walk(n.Object, s))
+	case *ast.LambdaExpression:
+		w.lambdas = append(w.lambdas, lambda{body: n.Body, state: s})
+		return s
+	case *ast.LambdaLiteral:
+		w.lambdas = append(w.lambdas, lambda{body: n.Body, state: s})
+		return s
+	}
+	for _, child := range ast.Children(node) {
+		s = w.walk(child, s)
+	}
+	return s
+}
+
+// optional 分析可能不执行 (或执行多次) 的节点，返回汇合后的状态
+func (w *walker) optional(node ast.Expression, s state) state {
+	w.conditional++
+	defer func() { w.conditional-- }()
+	return merge(s, w.walk(node, s))
+}
+
+func (w *walker) use(node *ast.VariableExpression, s state) {
+	u := &Use{Name: node.Name, Node: node}
+	defs, ok := s[node.Name]
+	u.MaybeUndefined = !ok
+	for _, d := range defs {
+		if d == nil {
+			u.MaybeUndefined = true
+			continue
+		}
+		u.Defs = append(u.Defs, d)
+		d.Uses = append(d.Uses, u)
+	}
+	w.g.Uses = append(w.g.Uses, u)
+	w.g.uses[node] = u
+}
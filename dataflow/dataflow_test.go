@@ -0,0 +1,117 @@
+package dataflow
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+func parse(t *testing.T, input string) ast.Expression {
+	t.Helper()
+	expr, err := ast.New(ast.NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expr
+}
+
+// describe 把每次读取格式化为 "变量@位置 <- 赋值位置..."，可能未定义时加上 "?"
+func describe(g *Graph) string {
+	var lines []string
+	for _, u := range g.Uses {
+		line := fmt.Sprintf("#%s@%d <-", u.Name, u.Span().Start)
+		for _, d := range u.Defs {
+			line += fmt.Sprintf(" %d", d.Span().Start)
+		}
+		if u.MaybeUndefined {
+			line += " ?"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"#a = 1, #a + 1", []string{"#a@8 <- 0"}},
+		// 赋值先求右边，右边读到的是之前的定义
+		{"#a = 1, #a = #a + 1, #a", []string{"#a@13 <- 0", "#a@21 <- 8"}},
+		{"(#a='x').(#b=#a.length()).(#b)", []string{"#a@13 <- 1", "#b@27 <- 10"}},
+		{"#b, #b = 1", []string{"#b@0 <- ?"}},
+		{"#c ? (#a = 1) : (#a = 2), #a", []string{"#c@0 <- ?", "#a@26 <- 6 17"}},
+		{"#c ? (#a = 1) : 0, #a", []string{"#c@0 <- ?", "#a@19 <- 6 ?"}},
+		{"#a = 1, #c && (#a = 2), #a", []string{"#c@8 <- ?", "#a@24 <- 0 15"}},
+		{"#a = 0, {1, 2}.{#a = #this}, #a", []string{"#a@29 <- 0 16"}},
+		// lambda 的函数体在最后分析，能看到之后的赋值，包括对自身的递归引用
+		{"#f = :[#this < 2 ? 1 : #this * #f(#this - 1)], #f(5)", []string{"#f@47 <- 0", "#f@31 <- 0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			g := Analyze(parse(t, tt.input))
+			if got, want := describe(g), strings.Join(tt.expected, "\n"); got != want {
+				t.Errorf("uses:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestUnusedAndUndefined(t *testing.T) {
+	input := "#a = 1, #b = #a, #_memberAccess = #dm, #context['x'], #c = #missing"
+	g := Analyze(parse(t, input))
+	var unused, undefined []string
+	for _, d := range g.Unused() {
+		unused = append(unused, d.Span().Text(input))
+	}
+	for _, u := range g.Undefined() {
+		undefined = append(undefined, u.Span().Text(input))
+	}
+	if got, want := strings.Join(unused, ", "), "#b = #a, #c = #missing"; got != want {
+		t.Errorf("Unused = %s, want %s", got, want)
+	}
+	if got, want := strings.Join(undefined, ", "), "#dm, #missing"; got != want {
+		t.Errorf("Undefined = %s, want %s", got, want)
+	}
+}
+
+// TestResolve 沙箱绕过载荷中 #ognlUtil 的值一直追溯到 #attr
+func TestResolve(t *testing.T) {
+	input := "(#context=#attr['struts.valueStack'].context).(#container=#context['com.opensymphony.xwork2.ActionContext.container'])." +
+		"(#ognlUtil=#container.getInstance(@com.opensymphony.xwork2.ognl.OgnlUtil@class))." +
+		"(#ognlUtil.setExcludedClasses(''))"
+	expr := parse(t, input)
+	g := Analyze(expr)
+	var receiver *ast.VariableExpression
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		if v, ok := node.(*ast.VariableExpression); ok && v.Name == "ognlUtil" {
+			if u := g.Use(v); u != nil {
+				receiver = v
+			}
+		}
+		return true
+	})
+	if receiver == nil {
+		t.Fatal("no use of #ognlUtil")
+	}
+	value, ok := g.Value(receiver)
+	if !ok || value.String() != "#container.getInstance(@com.opensymphony.xwork2.ognl.OgnlUtil@class)" {
+		t.Errorf("Value = %v, %v", value, ok)
+	}
+	resolved := g.Resolve(receiver).String()
+	if want := "#attr[\"struts.valueStack\"].context[\"com.opensymphony.xwork2.ActionContext.container\"].getInstance(@com.opensymphony.xwork2.ognl.OgnlUtil@class)"; resolved != want {
+		t.Errorf("Resolve = %s\nwant %s", resolved, want)
+	}
+	if receiver.String() != "#ognlUtil" {
+		t.Errorf("input modified: %s", receiver)
+	}
+
+	// 值不确定的变量保持原样
+	expr = parse(t, "#c ? (#a = 1) : (#a = 2), #a + 1")
+	if got, want := Analyze(expr).Resolve(expr).String(), expr.String(); got != want {
+		t.Errorf("Resolve = %s", got)
+	}
+}
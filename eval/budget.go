@@ -0,0 +1,141 @@
+package eval
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// EvalBudget 一次求值可以使用的资源上限，字段为 0 表示不限制
+// 在上下文中通过 SetBudget 设置，GetValue / SetValue 在每次求值时重新计数
+type EvalBudget struct {
+	MaxSteps          int // 最多访问的 AST 节点数 (包括 lambda 体和投影中重复访问的节点)
+	MaxCollectionSize int // 列表和 map 字面量、new int[n]、投影、选择、[*] 创建的集合的最大长度
+	MaxStringLength   int // 字符串拼接和方法调用返回的字符串的最大长度
+	MaxCallDepth      int // lambda 最大调用深度，与 Context.MaxCallDepth 取较小值
+}
+
+// BudgetLimit 超出的是哪一项预算
+type BudgetLimit string
+
+const (
+	LimitSteps          BudgetLimit = "steps"
+	LimitCollectionSize BudgetLimit = "collection size"
+	LimitStringLength   BudgetLimit = "string length"
+	LimitCallDepth      BudgetLimit = "call depth"
+	LimitDeadline       BudgetLimit = "deadline"
+)
+
+// BudgetError 求值超出预算
+// 超时和取消时 Err 是 context 的错误，可以用 errors.Is(err, context.DeadlineExceeded) 判断
+type BudgetError struct {
+	Limit BudgetLimit
+	Max   int   // 超出的上限，deadline 时为 0
+	Err   error // 底层原因，可以为 nil
+}
+
+func (e *BudgetError) Error() string {
+	if e.Limit == LimitDeadline {
+		return fmt.Sprintf("evaluation budget exceeded: %s: %v", e.Limit, e.Err)
+	}
+	return fmt.Sprintf("evaluation budget exceeded: %s > %d", e.Limit, e.Max)
+}
+
+func (e *BudgetError) Unwrap() error { return e.Err }
+
+// PanicError 反射调用的 Go 方法或函数发生了 panic
+type PanicError struct {
+	Value any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap panic 的值是 error 时返回它
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// deadlineCheckInterval 每访问多少个节点检查一次 context 是否结束
+const deadlineCheckInterval = 64
+
+// step 记录一次节点访问，超出步数或 context 已结束时返回错误
+func (e *evaluator) step() error {
+	e.steps++
+	if max := e.ctx.budget.MaxSteps; max > 0 && e.steps > max {
+		return &BudgetError{Limit: LimitSteps, Max: max}
+	}
+	if e.steps%deadlineCheckInterval == 1 {
+		return e.checkDeadline()
+	}
+	return nil
+}
+
+func (e *evaluator) checkDeadline() error {
+	if err := e.goCtx.Err(); err != nil {
+		return &BudgetError{Limit: LimitDeadline, Err: err}
+	}
+	return nil
+}
+
+// checkCollection 检查将要创建的集合长度
+func (e *evaluator) checkCollection(n int) error {
+	if max := e.ctx.budget.MaxCollectionSize; max > 0 && n > max {
+		return &BudgetError{Limit: LimitCollectionSize, Max: max}
+	}
+	return nil
+}
+
+// checkString 检查字符串结果的长度
+func (e *evaluator) checkString(v any) error {
+	max := e.ctx.budget.MaxStringLength
+	if max <= 0 {
+		return nil
+	}
+	if s, ok := v.(string); ok && len(s) > max {
+		return &BudgetError{Limit: LimitStringLength, Max: max}
+	}
+	return nil
+}
+
+// checkResult 检查方法调用的结果：字符串长度和集合长度
+func (e *evaluator) checkResult(v any) error {
+	if err := e.checkString(v); err != nil {
+		return err
+	}
+	switch kindOf(v) {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return e.checkCollection(reflect.ValueOf(v).Len())
+	}
+	return nil
+}
+
+// maxCallDepth 上下文和预算中较小的 lambda 调用深度上限
+func (e *evaluator) maxCallDepth() int {
+	max := e.ctx.MaxCallDepth()
+	if b := e.ctx.budget.MaxCallDepth; b > 0 && b < max {
+		return b
+	}
+	return max
+}
+
+// callSafely 调用反射得到的函数，把 panic 转换为 PanicError
+func callSafely(fn reflect.Value, args []reflect.Value, spread bool) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r}
+		}
+	}()
+	if spread {
+		return fn.CallSlice(args), nil
+	}
+	return fn.Call(args), nil
+}
+
+// recoverPanic 在求值入口处把遗漏的 panic 转换为错误
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r}
+	}
+}
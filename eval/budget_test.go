@@ -0,0 +1,131 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"testing"
+	"time"
+)
+
+// Bomb 方法会 panic 的测试模型
+type Bomb struct{}
+
+func (Bomb) Explode() string { panic("boom") }
+func (Bomb) GetFuse() int    { panic(errors.New("fuse error")) }
+func (Bomb) Index(i int) int { return []int{1}[i] }
+func (Bomb) Naturals() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for i := 0; ; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
+
+func budgetContext(b EvalBudget) *Context {
+	ctx := NewContext(Bomb{})
+	ctx.SetBudget(b)
+	return ctx
+}
+
+func expectBudgetError(t *testing.T, err error, limit BudgetLimit) *BudgetError {
+	t.Helper()
+	var budgetErr *BudgetError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("expected BudgetError(%s), got %v", limit, err)
+	}
+	if budgetErr.Limit != limit {
+		t.Fatalf("expected limit %s, got %s (%v)", limit, budgetErr.Limit, err)
+	}
+	return budgetErr
+}
+
+func TestBudgetLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		budget EvalBudget
+		limit  BudgetLimit
+	}{
+		{"steps", "#f = :[#this <= 0 ? 0 : #f(#this - 1)], #f(100)", EvalBudget{MaxSteps: 50}, LimitSteps},
+		{"list literal", "{1, 2, 3}", EvalBudget{MaxCollectionSize: 2}, LimitCollectionSize},
+		{"map literal", "#{1 : 1, 2 : 2, 3 : 3}", EvalBudget{MaxCollectionSize: 2}, LimitCollectionSize},
+		{"new array", "new int[1000000000]", EvalBudget{MaxCollectionSize: 1000}, LimitCollectionSize},
+		{"array initializer", "new int[]{1, 2, 3}", EvalBudget{MaxCollectionSize: 2}, LimitCollectionSize},
+		{"projection", "naturals().{#this}", EvalBudget{MaxCollectionSize: 10}, LimitCollectionSize},
+		{"selection", "{1, 2, 3}.{? true}", EvalBudget{MaxCollectionSize: 2}, LimitCollectionSize},
+		{"infinite [*]", "naturals()[*]", EvalBudget{MaxCollectionSize: 10}, LimitCollectionSize},
+		{"infinite selection", "naturals().{? false}", EvalBudget{MaxSteps: 1000}, LimitSteps},
+		{"method result", "\"abc\".toCharArray()", EvalBudget{MaxCollectionSize: 2}, LimitCollectionSize},
+		{"concatenation", "#s = \"aaaa\", #s + #s + #s", EvalBudget{MaxStringLength: 10}, LimitStringLength},
+		{"string method", "\"ab\".concat(\"cd\")", EvalBudget{MaxStringLength: 3}, LimitStringLength},
+		{"call depth", "#f = :[#f(#this)], #f(1)", EvalBudget{MaxCallDepth: 5}, LimitCallDepth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := getValue(t, tt.input, budgetContext(tt.budget))
+			expectBudgetError(t, err, tt.limit)
+		})
+	}
+
+	// 未超出预算时正常求值
+	v, err := getValue(t, "{1, 2}.{#this + \"x\"}", budgetContext(EvalBudget{
+		MaxSteps: 100, MaxCollectionSize: 2, MaxStringLength: 2,
+	}))
+	if err != nil || StringValue(v) != "[1x, 2x]" {
+		t.Errorf("got %v, %v", v, err)
+	}
+}
+
+func TestBudgetCallDepthError(t *testing.T) {
+	_, err := getValue(t, "#f = :[#f(#this)], #f(1)", budgetContext(EvalBudget{MaxCallDepth: 5}))
+	var depthErr *CallDepthError
+	if !errors.As(err, &depthErr) || depthErr.Max != 5 {
+		t.Errorf("budget call depth should wrap CallDepthError, got %v", err)
+	}
+}
+
+func TestBudgetDeadline(t *testing.T) {
+	expr := parse(t, "naturals().{? false}")
+
+	goCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := GetValueContext(goCtx, expr, NewContext(Bomb{}))
+	expectBudgetError(t, err, LimitDeadline)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("deadline error should wrap context.DeadlineExceeded, got %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = SetValueContext(canceled, parse(t, "#x"), NewContext(nil), 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	ctx := NewContext(Bomb{})
+	var panicErr *PanicError
+
+	_, err := getValue(t, "explode()", ctx)
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+		t.Errorf("expected PanicError from method, got %v", err)
+	}
+	var evalErr *EvalError
+	if !errors.As(err, &evalErr) || evalErr.Node.Type() != "ASTMethod" {
+		t.Errorf("panic should be reported at the method node, got %v", err)
+	}
+
+	_, err = getValue(t, "fuse", ctx)
+	if !errors.As(err, &panicErr) || panicErr.Unwrap() == nil || panicErr.Unwrap().Error() != "fuse error" {
+		t.Errorf("expected PanicError wrapping the panic value from getter, got %v", err)
+	}
+
+	_, err = getValue(t, "index(5)", ctx)
+	if !errors.As(err, &panicErr) {
+		t.Errorf("expected PanicError from runtime error, got %v", err)
+	}
+}
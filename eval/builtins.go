@@ -0,0 +1,378 @@
+package eval
+
+// 内置的 java.lang 类和 Java 风格的方法
+//
+// 只包含没有副作用的常用方法 (字符串、数值、集合的读取和转换)，
+// 不提供 Runtime、ProcessBuilder、反射、类加载等危险的类。
+// 字符串的下标按 Unicode 码点计算，而不是 Java 的 UTF-16 代码单元。
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// builtinRegistry 默认的注册表，Context 没有指定注册表时使用，只读
+var builtinRegistry = newBuiltinRegistry()
+
+func newBuiltinRegistry() *Registry {
+	r := newEmptyRegistry()
+	r.AddClass(NewClass("java.lang.Object", nil))
+	r.AddClass(stringClass())
+	r.AddClass(mathClass())
+	r.AddClass(integerClass())
+	r.AddClass(longClass())
+	r.AddClass(doubleClass())
+	r.AddClass(booleanClass())
+	r.AddClass(characterClass())
+	r.AddClass(NewClass("java.util.HashMap", reflect.TypeOf(map[any]any(nil))).
+		AddConstructor(func() map[any]any { return map[any]any{} }))
+	r.AddClass(NewClass("java.util.LinkedHashMap", reflect.TypeOf(map[any]any(nil))).
+		AddConstructor(func() map[any]any { return map[any]any{} }))
+	addStringMethods(r)
+	addObjectMethods(r)
+	addCollectionMethods(r)
+	return r
+}
+
+// =============================================================================
+// java.lang 类
+// =============================================================================
+
+func stringClass() *Class {
+	return NewClass("java.lang.String", stringType).
+		AddConstructor(func() string { return "" }).
+		AddConstructor(func(s string) string { return s }).
+		AddConstructor(func(chars []Char) string { return charsToString(chars) }).
+		AddConstructor(func(b []int8) string { return bytesToString(b) }).
+		AddMethod("valueOf", func(v any) string { return StringValue(v) }).
+		AddMethod("valueOf", func(chars []Char) string { return charsToString(chars) })
+}
+
+func mathClass() *Class {
+	return NewClass("java.lang.Math", nil).
+		AddField("PI", math.Pi).
+		AddField("E", math.E).
+		AddMethod("abs", func(v int32) int32 {
+			if v < 0 {
+				return -v
+			}
+			return v
+		}).
+		AddMethod("abs", func(v int64) int64 {
+			if v < 0 {
+				return -v
+			}
+			return v
+		}).
+		AddMethod("abs", func(v float64) float64 { return math.Abs(v) }).
+		AddMethod("max", func(a, b int32) int32 { return max(a, b) }).
+		AddMethod("max", func(a, b int64) int64 { return max(a, b) }).
+		AddMethod("max", func(a, b float64) float64 { return math.Max(a, b) }).
+		AddMethod("min", func(a, b int32) int32 { return min(a, b) }).
+		AddMethod("min", func(a, b int64) int64 { return min(a, b) }).
+		AddMethod("min", func(a, b float64) float64 { return math.Min(a, b) }).
+		AddMethod("pow", math.Pow).
+		AddMethod("sqrt", math.Sqrt).
+		AddMethod("floor", math.Floor).
+		AddMethod("ceil", math.Ceil).
+		AddMethod("round", func(v float64) int64 { return int64(math.Floor(v + 0.5)) }).
+		AddMethod("random", rand.Float64)
+}
+
+func integerClass() *Class {
+	parse := func(s string, radix int32) (int32, error) {
+		i, err := strconv.ParseInt(s, int(radix), 32)
+		if err != nil {
+			return 0, fmt.Errorf("for input string: %q", s)
+		}
+		return int32(i), nil
+	}
+	return NewClass("java.lang.Integer", reflect.TypeOf(int32(0))).
+		AddField("MAX_VALUE", int32(math.MaxInt32)).
+		AddField("MIN_VALUE", int32(math.MinInt32)).
+		AddConstructor(func(v int32) int32 { return v }).
+		AddConstructor(func(s string) (int32, error) { return parse(s, 10) }).
+		AddMethod("valueOf", func(v int32) int32 { return v }).
+		AddMethod("valueOf", func(s string) (int32, error) { return parse(s, 10) }).
+		AddMethod("parseInt", func(s string) (int32, error) { return parse(s, 10) }).
+		AddMethod("parseInt", parse).
+		AddMethod("toString", func(v int32) string { return strconv.FormatInt(int64(v), 10) }).
+		AddMethod("toHexString", func(v int32) string { return strconv.FormatUint(uint64(uint32(v)), 16) }).
+		AddMethod("toBinaryString", func(v int32) string { return strconv.FormatUint(uint64(uint32(v)), 2) })
+}
+
+func longClass() *Class {
+	parse := func(s string) (int64, error) {
+		i, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSuffix(s, "L"), "l"), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("for input string: %q", s)
+		}
+		return i, nil
+	}
+	return NewClass("java.lang.Long", reflect.TypeOf(int64(0))).
+		AddField("MAX_VALUE", int64(math.MaxInt64)).
+		AddField("MIN_VALUE", int64(math.MinInt64)).
+		AddConstructor(func(v int64) int64 { return v }).
+		AddConstructor(parse).
+		AddMethod("valueOf", func(v int64) int64 { return v }).
+		AddMethod("valueOf", parse).
+		AddMethod("parseLong", parse).
+		AddMethod("toString", func(v int64) string { return strconv.FormatInt(v, 10) })
+}
+
+func doubleClass() *Class {
+	parse := func(s string) (float64, error) {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return 0, fmt.Errorf("for input string: %q", s)
+		}
+		return f, nil
+	}
+	return NewClass("java.lang.Double", reflect.TypeOf(float64(0))).
+		AddConstructor(func(v float64) float64 { return v }).
+		AddConstructor(parse).
+		AddMethod("valueOf", func(v float64) float64 { return v }).
+		AddMethod("valueOf", parse).
+		AddMethod("parseDouble", parse).
+		AddMethod("toString", func(v float64) string { return StringValue(v) })
+}
+
+func booleanClass() *Class {
+	parse := func(s string) bool { return strings.EqualFold(s, "true") }
+	return NewClass("java.lang.Boolean", reflect.TypeOf(false)).
+		AddField("TRUE", true).
+		AddField("FALSE", false).
+		AddConstructor(func(v bool) bool { return v }).
+		AddConstructor(parse).
+		AddMethod("valueOf", func(v bool) bool { return v }).
+		AddMethod("valueOf", parse).
+		AddMethod("parseBoolean", parse).
+		AddMethod("toString", func(v bool) string { return strconv.FormatBool(v) })
+}
+
+func characterClass() *Class {
+	return NewClass("java.lang.Character", charType).
+		AddConstructor(func(c Char) Char { return c }).
+		AddMethod("valueOf", func(c Char) Char { return c }).
+		AddMethod("toString", func(c Char) string { return string(rune(c)) }).
+		AddMethod("toString", func(codePoint int32) string { return string(rune(codePoint)) }).
+		AddMethod("toChars", func(codePoint int32) []Char { return []Char{Char(codePoint)} }).
+		AddMethod("isDigit", func(c Char) bool { return unicode.IsDigit(rune(c)) }).
+		AddMethod("isLetter", func(c Char) bool { return unicode.IsLetter(rune(c)) }).
+		AddMethod("isLetterOrDigit", func(c Char) bool {
+			return unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+		}).
+		AddMethod("isWhitespace", func(c Char) bool { return unicode.IsSpace(rune(c)) }).
+		AddMethod("toUpperCase", func(c Char) Char { return Char(unicode.ToUpper(rune(c))) }).
+		AddMethod("toLowerCase", func(c Char) Char { return Char(unicode.ToLower(rune(c))) })
+}
+
+func charsToString(chars []Char) string {
+	var sb strings.Builder
+	for _, c := range chars {
+		sb.WriteRune(rune(c))
+	}
+	return sb.String()
+}
+
+// bytesToString 按 UTF-8 解码 Java 的 byte[] (有符号字节)
+func bytesToString(b []int8) string {
+	buf := make([]byte, len(b))
+	for i, v := range b {
+		buf[i] = byte(v)
+	}
+	return string(buf)
+}
+
+// =============================================================================
+// java.lang.String 的实例方法
+// =============================================================================
+
+func addStringMethods(r *Registry) {
+	add := func(name string, fn any) { r.AddKindMethod(reflect.String, name, fn) }
+	add("length", func(s string) int32 { return int32(len([]rune(s))) })
+	add("isEmpty", func(s string) bool { return s == "" })
+	add("charAt", func(s string, i int32) (Char, error) {
+		runes := []rune(s)
+		if i < 0 || int(i) >= len(runes) {
+			return 0, fmt.Errorf("string index out of range: %d", i)
+		}
+		return Char(runes[i]), nil
+	})
+	add("substring", func(s string, begin int32) (string, error) {
+		return substring(s, begin, int32(len([]rune(s))))
+	})
+	add("substring", substring)
+	add("indexOf", func(s, sub string) int32 { return runeIndex(s, strings.Index(s, sub)) })
+	add("lastIndexOf", func(s, sub string) int32 { return runeIndex(s, strings.LastIndex(s, sub)) })
+	add("contains", strings.Contains)
+	add("startsWith", strings.HasPrefix)
+	add("endsWith", strings.HasSuffix)
+	add("equals", func(s string, other any) bool { o, ok := other.(string); return ok && s == o })
+	add("equalsIgnoreCase", strings.EqualFold)
+	add("compareTo", func(s, other string) int32 { return int32(strings.Compare(s, other)) })
+	add("toUpperCase", strings.ToUpper)
+	add("toLowerCase", strings.ToLower)
+	add("trim", func(s string) string { return strings.Trim(s, " \t\n\r\f\v\x00") })
+	add("concat", func(s, other string) string { return s + other })
+	add("replace", strings.ReplaceAll)
+	add("split", func(s, sep string) ([]string, error) {
+		re, err := regexp.Compile(sep)
+		if err != nil {
+			return nil, err
+		}
+		parts := re.Split(s, -1)
+		// 与 Java 一致，去掉末尾的空字符串
+		for len(parts) > 0 && parts[len(parts)-1] == "" {
+			parts = parts[:len(parts)-1]
+		}
+		return parts, nil
+	})
+	add("matches", func(s, pattern string) (bool, error) {
+		return regexp.MatchString("^(?:"+pattern+")$", s)
+	})
+	add("toCharArray", func(s string) []Char {
+		runes := []rune(s)
+		chars := make([]Char, len(runes))
+		for i, c := range runes {
+			chars[i] = Char(c)
+		}
+		return chars
+	})
+	add("getBytes", func(s string) []int8 {
+		b := make([]int8, len(s))
+		for i := 0; i < len(s); i++ {
+			b[i] = int8(s[i])
+		}
+		return b
+	})
+	add("hashCode", func(s string) int32 {
+		var h int32
+		for _, c := range s {
+			h = 31*h + int32(c)
+		}
+		return h
+	})
+	add("intern", func(s string) string { return s })
+	add("toString", func(s string) string { return s })
+}
+
+func substring(s string, begin, end int32) (string, error) {
+	runes := []rune(s)
+	if begin < 0 || end > int32(len(runes)) || begin > end {
+		return "", fmt.Errorf("begin %d, end %d, length %d", begin, end, len(runes))
+	}
+	return string(runes[begin:end]), nil
+}
+
+// runeIndex 把字节下标换算为码点下标，-1 保持不变
+func runeIndex(s string, i int) int32 {
+	if i < 0 {
+		return -1
+	}
+	return int32(len([]rune(s[:i])))
+}
+
+// =============================================================================
+// java.lang.Object / Number / Boolean / Character 的实例方法
+// =============================================================================
+
+func addObjectMethods(r *Registry) {
+	r.AddKindMethod(reflect.Interface, "toString", func(v any) string { return StringValue(v) })
+	r.AddKindMethod(reflect.Interface, "equals", func(v, other any) bool { return Equal(v, other) })
+
+	number := func(name string, fn any) { r.AddKindMethod(numberKind, name, fn) }
+	number("intValue", func(v any) (int32, error) { i, err := longValue(v); return int32(i), err })
+	number("longValue", func(v any) (int64, error) { return longValue(v) })
+	number("shortValue", func(v any) (int16, error) { i, err := longValue(v); return int16(i), err })
+	number("byteValue", func(v any) (int8, error) { i, err := longValue(v); return int8(i), err })
+	number("doubleValue", func(v any) (float64, error) { return doubleValue(v) })
+	number("floatValue", func(v any) (float32, error) { f, err := doubleValue(v); return float32(f), err })
+	number("compareTo", func(v, other any) (int32, error) { c, err := Compare(v, other); return int32(c), err })
+
+	r.AddKindMethod(reflect.Bool, "booleanValue", func(b bool) bool { return b })
+	r.AddMethod(charType, "charValue", func(c Char) Char { return c })
+}
+
+// =============================================================================
+// java.util.List / Map 的实例方法
+// =============================================================================
+
+func addCollectionMethods(r *Registry) {
+	for _, kind := range []reflect.Kind{reflect.Slice, reflect.Array} {
+		add := func(name string, fn any) { r.AddKindMethod(kind, name, fn) }
+		add("size", func(list any) int32 { return int32(reflect.ValueOf(list).Len()) })
+		add("isEmpty", func(list any) bool { return reflect.ValueOf(list).Len() == 0 })
+		add("get", func(list any, i int32) (any, error) { return GetIndex(list, i) })
+		add("contains", func(list, v any) (bool, error) { return In(v, list) })
+		add("indexOf", func(list, v any) int32 {
+			idx := int32(-1)
+			i := int32(0)
+			iterate(list, func(elem any) bool {
+				if Equal(elem, v) {
+					idx = i
+					return false
+				}
+				i++
+				return true
+			})
+			return idx
+		})
+		add("toArray", func(list any) []any {
+			var out []any
+			iterate(list, func(elem any) bool { out = append(out, elem); return true })
+			return out
+		})
+	}
+
+	add := func(name string, fn any) { r.AddKindMethod(reflect.Map, name, fn) }
+	add("size", func(m any) int32 { return int32(reflect.ValueOf(m).Len()) })
+	add("isEmpty", func(m any) bool { return reflect.ValueOf(m).Len() == 0 })
+	add("get", func(m, key any) (any, error) { return GetIndex(m, key) })
+	add("containsKey", func(m, key any) bool {
+		mv := reflect.ValueOf(m)
+		k, err := ConvertValue(key, mv.Type().Key())
+		return err == nil && mv.MapIndex(k).IsValid()
+	})
+	add("containsValue", func(m, v any) bool {
+		found := false
+		iterate(m, func(elem any) bool { found = Equal(elem, v); return !found })
+		return found
+	})
+	add("keySet", func(m any) []any {
+		keys := sortedMapKeys(reflect.ValueOf(m))
+		out := make([]any, len(keys))
+		for i, k := range keys {
+			out[i] = k.Interface()
+		}
+		return out
+	})
+	add("values", func(m any) []any {
+		var out []any
+		iterate(m, func(elem any) bool { out = append(out, elem); return true })
+		return out
+	})
+	add("put", func(m, key, value any) (any, error) {
+		old, _ := GetIndex(m, key)
+		return old, setMapIndex(reflect.ValueOf(m), key, value)
+	})
+	add("remove", func(m, key any) (any, error) {
+		mv := reflect.ValueOf(m)
+		k, err := ConvertValue(key, mv.Type().Key())
+		if err != nil {
+			return nil, err
+		}
+		old := mv.MapIndex(k)
+		mv.SetMapIndex(k, reflect.Value{})
+		if !old.IsValid() {
+			return nil, nil
+		}
+		return old.Interface(), nil
+	})
+}
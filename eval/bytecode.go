@@ -0,0 +1,725 @@
+package eval
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// =============================================================================
+// 字节码 - 基于栈的虚拟机指令集，可以序列化后缓存 (见 bytecode_encoding.go)
+// =============================================================================
+//
+// 每个函数是一段指令序列，执行时有一个操作数栈和一个当前对象 (#this) 寄存器。
+// 入口函数之外，lambda 体、投影和选择的表达式各自编译为独立的函数，
+// 执行时以元素或 lambda 参数为 #this 进入新的栈帧。
+//
+// 操作数 A、B、C 的含义由操作码决定，名称 (属性名、变量名、类名、运算符) 是 Names 的下标，
+// 常量是 Consts 的下标，跳转目标是指令下标，函数是 Functions 的下标。
+
+// Opcode 操作码
+type Opcode uint8
+
+const (
+	OpConst            Opcode = iota // 压入 Consts[A]
+	OpPop                            // 弹出栈顶
+	OpThis                           // 压入当前对象
+	OpRoot                           // 压入根对象
+	OpEnter                          // 弹出值作为当前对象，保存原来的当前对象
+	OpEnterRoot                      // 以根对象为当前对象，保存原来的当前对象
+	OpLeave                          // 恢复 OpEnter / OpEnterRoot 保存的当前对象
+	OpLoadVar                        // 压入变量 #Names[A]
+	OpStoreVar                       // 把栈顶写入变量 #Names[A]，不弹出
+	OpStoreRoot                      // 把栈顶设为根对象，不弹出
+	OpGetProp                        // obj → obj.Names[A]
+	OpSetProp                        // value obj → value，写入 obj.Names[A]
+	OpGetIndex                       // obj index → obj[index]
+	OpSetIndex                       // value obj index → value
+	OpGetIndexed                     // obj index → obj.Names[A][index]，优先使用索引属性
+	OpSetIndexed                     // value obj index → value，优先使用索引属性的 setter
+	OpDynIndex                       // obj → obj[^|$*]，A 是 ast.DynamicSubscriptType
+	OpSetDynIndex                    // value obj → value
+	OpCall                           // recv arg1..argB → recv.Names[A](args)
+	OpCallStatic                     // arg1..argC → @Names[A]@Names[B](args)
+	OpNew                            // arg1..argB → new Names[A](args)
+	OpNewArray                       // size → new Names[A][size]
+	OpNewArrayInit                   // elem1..elemB → new Names[A][]{elems}
+	OpStaticField                    // → @Names[A]@Names[B]
+	OpBinary                         // left right → left Names[A] right
+	OpUnary                          // v → Names[A] v
+	OpInstanceof                     // v → v instanceof Names[A]
+	OpJump                           // 跳转到 A
+	OpJumpIfFalse                    // 弹出条件，为假时跳转到 A (?:)
+	OpJumpIfFalseOrPop               // 栈顶为假时保留并跳转到 A，否则弹出 (&&)
+	OpJumpIfTrueOrPop                // 栈顶为真时保留并跳转到 A，否则弹出 (||)
+	OpList                           // v1..vA → {v1, ..., vA}
+	OpMap                            // k1 v1..kA vA → #{k1 : v1, ...}
+	OpLambda                         // → :[Functions[A]]
+	OpEval                           // target arg → target(arg)
+	OpProject                        // source → source.{Functions[A]}
+	OpSelect                         // source → source.{? Functions[A]}，Names[B] 为 all/first/last
+
+	numOpcodes
+)
+
+var opcodeNames = [numOpcodes]string{
+	OpConst:            "CONST",
+	OpPop:              "POP",
+	OpThis:             "THIS",
+	OpRoot:             "ROOT",
+	OpEnter:            "ENTER",
+	OpEnterRoot:        "ENTER_ROOT",
+	OpLeave:            "LEAVE",
+	OpLoadVar:          "LOAD_VAR",
+	OpStoreVar:         "STORE_VAR",
+	OpStoreRoot:        "STORE_ROOT",
+	OpGetProp:          "GET_PROP",
+	OpSetProp:          "SET_PROP",
+	OpGetIndex:         "GET_INDEX",
+	OpSetIndex:         "SET_INDEX",
+	OpGetIndexed:       "GET_INDEXED",
+	OpSetIndexed:       "SET_INDEXED",
+	OpDynIndex:         "DYN_INDEX",
+	OpSetDynIndex:      "SET_DYN_INDEX",
+	OpCall:             "CALL",
+	OpCallStatic:       "CALL_STATIC",
+	OpNew:              "NEW",
+	OpNewArray:         "NEW_ARRAY",
+	OpNewArrayInit:     "NEW_ARRAY_INIT",
+	OpStaticField:      "STATIC_FIELD",
+	OpBinary:           "BINARY",
+	OpUnary:            "UNARY",
+	OpInstanceof:       "INSTANCEOF",
+	OpJump:             "JUMP",
+	OpJumpIfFalse:      "JUMP_IF_FALSE",
+	OpJumpIfFalseOrPop: "JUMP_IF_FALSE_OR_POP",
+	OpJumpIfTrueOrPop:  "JUMP_IF_TRUE_OR_POP",
+	OpList:             "LIST",
+	OpMap:              "MAP",
+	OpLambda:           "LAMBDA",
+	OpEval:             "EVAL",
+	OpProject:          "PROJECT",
+	OpSelect:           "SELECT",
+}
+
+func (op Opcode) String() string {
+	if op < numOpcodes {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("OP(%d)", uint8(op))
+}
+
+// Instr 一条指令
+type Instr struct {
+	Op      Opcode
+	A, B, C int32
+}
+
+// FunctionKind 函数的用途
+type FunctionKind uint8
+
+const (
+	FuncMain       FunctionKind = iota // 入口
+	FuncLambda                         // lambda 体 :[...]
+	FuncProjection                     // 投影表达式 .{...}
+	FuncSelection                      // 选择条件 .{? ...}
+)
+
+var functionKindNames = [...]string{"main", "lambda", "projection", "selection"}
+
+func (k FunctionKind) String() string {
+	if int(k) < len(functionKindNames) {
+		return functionKindNames[k]
+	}
+	return fmt.Sprintf("kind(%d)", uint8(k))
+}
+
+// Function 一段指令序列
+type Function struct {
+	Kind    FunctionKind
+	Source  string // 函数体的表达式文本
+	Code    []Instr
+	Sources []int32 // 每条指令对应的表达式文本 (Names 的下标)，用于错误信息和反汇编
+
+	prog  *Bytecode
+	body  ast.Expression // lambda 体的语法树，作为 Lambda.Body
+	links []instrLink    // 链接时为每条指令准备的缓存和解析结果，见 link
+}
+
+// Bytecode 编译后的字节码程序，Functions[0] 是入口
+// 与 Program 一样不可变，可以被多个 goroutine 同时执行
+type Bytecode struct {
+	Source    string
+	Names     []string
+	Consts    []any
+	Functions []*Function
+}
+
+// CompileBytecode 把表达式编译为字节码
+func CompileBytecode(expr ast.Expression) (*Bytecode, error) {
+	if expr == nil {
+		return nil, fmt.Errorf("missing expression")
+	}
+	c := &bytecodeCompiler{
+		prog:   &Bytecode{Source: expr.String()},
+		names:  map[string]int32{},
+		consts: map[string]int32{},
+	}
+	if _, err := c.function(FuncMain, expr); err != nil {
+		return nil, err
+	}
+	if err := c.prog.link(); err != nil {
+		return nil, err
+	}
+	return c.prog, nil
+}
+
+// =============================================================================
+// 代码生成
+// =============================================================================
+
+type bytecodeCompiler struct {
+	prog   *Bytecode
+	names  map[string]int32
+	consts map[string]int32
+	fn     *Function // 正在生成的函数
+	src    int32     // 正在生成的节点的表达式文本
+}
+
+func (c *bytecodeCompiler) name(s string) int32 {
+	if i, ok := c.names[s]; ok {
+		return i
+	}
+	i := int32(len(c.prog.Names))
+	c.prog.Names = append(c.prog.Names, s)
+	c.names[s] = i
+	return i
+}
+
+// constant 相同类型和写法的常量只保存一份 (按类型和文本去重，-0.0 与 0.0 不会合并)
+func (c *bytecodeCompiler) constant(v any) int32 {
+	key := fmt.Sprintf("%T %#v", v, v)
+	switch b := v.(type) {
+	case *big.Int:
+		key = "big.Int " + b.String()
+	case *big.Float:
+		key = fmt.Sprintf("big.Float %d %s", b.Prec(), b.Text('g', -1))
+	}
+	if i, ok := c.consts[key]; ok {
+		return i
+	}
+	i := int32(len(c.prog.Consts))
+	c.prog.Consts = append(c.prog.Consts, v)
+	c.consts[key] = i
+	return i
+}
+
+// emit 追加一条指令，返回它的下标
+func (c *bytecodeCompiler) emit(op Opcode, operands ...int32) int {
+	in := Instr{Op: op}
+	for i, v := range operands {
+		switch i {
+		case 0:
+			in.A = v
+		case 1:
+			in.B = v
+		case 2:
+			in.C = v
+		}
+	}
+	c.fn.Code = append(c.fn.Code, in)
+	c.fn.Sources = append(c.fn.Sources, c.src)
+	return len(c.fn.Code) - 1
+}
+
+// patch 把跳转指令的目标设为下一条指令
+func (c *bytecodeCompiler) patch(pc int) {
+	c.fn.Code[pc].A = int32(len(c.fn.Code))
+}
+
+// function 把 body 编译为新的函数，返回函数下标
+func (c *bytecodeCompiler) function(kind FunctionKind, body ast.Expression) (int32, error) {
+	if body == nil {
+		return 0, fmt.Errorf("missing expression")
+	}
+	fn := &Function{Kind: kind, Source: body.String(), body: body}
+	index := int32(len(c.prog.Functions))
+	c.prog.Functions = append(c.prog.Functions, fn)
+	prevFn, prevSrc := c.fn, c.src
+	c.fn = fn
+	defer func() { c.fn, c.src = prevFn, prevSrc }()
+	return index, c.compile(body)
+}
+
+// compile 生成对当前对象求值 node 并把结果压栈的指令
+func (c *bytecodeCompiler) compile(node ast.Expression) error {
+	if node == nil {
+		return fmt.Errorf("missing expression")
+	}
+	prevSrc := c.src
+	c.src = c.name(node.String())
+	defer func() { c.src = prevSrc }()
+
+	if v, ok := constantValue(node); ok {
+		c.emit(OpConst, c.constant(v))
+		return nil
+	}
+	switch n := node.(type) {
+	case *ast.Identifier:
+		c.emit(OpThis)
+		c.emit(OpGetProp, c.name(n.Value))
+	case *ast.ThisExpression:
+		c.emit(OpThis)
+	case *ast.RootExpression:
+		c.emit(OpRoot)
+	case *ast.VariableExpression:
+		c.emit(OpLoadVar, c.name(n.Name))
+	case *ast.ChainExpression:
+		return c.compileChain(n.Children)
+	case *ast.IndexExpression:
+		if err := c.compileObject(n.Object); err != nil {
+			return err
+		}
+		return c.applyIndex(n)
+	case *ast.DynamicSubscriptExpression:
+		if err := c.compileObject(n.Object); err != nil {
+			return err
+		}
+		return c.applyTo(n)
+	case *ast.ProjectionExpression:
+		if err := c.compileObject(n.Object); err != nil {
+			return err
+		}
+		return c.applyTo(n)
+	case *ast.SelectionExpression:
+		if err := c.compileObject(n.Object); err != nil {
+			return err
+		}
+		return c.applyTo(n)
+	case *ast.BinaryExpression:
+		return c.compileBinary(n)
+	case *ast.UnaryExpression:
+		if err := c.compile(n.Operand); err != nil {
+			return err
+		}
+		c.emit(OpUnary, c.name(ast.TokenTypeNames[n.Operator]))
+	case *ast.ConditionalExpression:
+		if err := c.compile(n.Test); err != nil {
+			return err
+		}
+		toElse := c.emit(OpJumpIfFalse)
+		if err := c.compile(n.Consequent); err != nil {
+			return err
+		}
+		toEnd := c.emit(OpJump)
+		c.patch(toElse)
+		if err := c.compile(n.Alternative); err != nil {
+			return err
+		}
+		c.patch(toEnd)
+	case *ast.AssignmentExpression:
+		if err := c.compile(n.Right); err != nil {
+			return err
+		}
+		return c.compileAssign(n.Left)
+	case *ast.SequenceExpression:
+		for i, expr := range n.Expressions {
+			if i > 0 {
+				c.emit(OpPop)
+			}
+			if err := c.compile(expr); err != nil {
+				return err
+			}
+		}
+		if len(n.Expressions) == 0 {
+			c.emit(OpConst, c.constant(nil))
+		}
+	case *ast.ArrayExpression:
+		for _, elem := range n.Elements {
+			if err := c.compile(elem); err != nil {
+				return err
+			}
+		}
+		c.emit(OpList, int32(len(n.Elements)))
+	case *ast.MapExpression:
+		for _, pair := range n.Pairs {
+			kv, ok := pair.(*ast.KeyValueExpression)
+			if !ok {
+				return fmt.Errorf("unexpected %s in map literal", pair.Type())
+			}
+			if err := c.compile(kv.Key); err != nil {
+				return err
+			}
+			if kv.Value == nil {
+				c.emit(OpConst, c.constant(nil))
+			} else if err := c.compile(kv.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(OpMap, int32(len(n.Pairs)))
+	case *ast.InstanceofExpression:
+		if err := c.compile(n.Operand); err != nil {
+			return err
+		}
+		c.emit(OpInstanceof, c.name(n.TargetType))
+	case *ast.CallExpression:
+		return c.compileCall(n)
+	case *ast.StaticMethodExpression:
+		if err := c.compileArgs(n.Arguments); err != nil {
+			return err
+		}
+		c.emit(OpCallStatic, c.name(n.ClassName), c.name(n.Method), int32(len(n.Arguments)))
+	case *ast.StaticFieldExpression:
+		c.emit(OpStaticField, c.name(n.ClassName), c.name(n.Field))
+	case *ast.ConstructorExpression:
+		return c.compileConstructor(n)
+	case *ast.LambdaLiteral:
+		return c.compileLambda(n.Body)
+	case *ast.LambdaExpression:
+		return c.compileLambda(n.Body)
+	case *ast.EvalExpression:
+		if err := c.compile(n.Target); err != nil {
+			return err
+		}
+		return c.compileEvalArgument(n.Argument)
+	default:
+		return fmt.Errorf("%s is not supported by the evaluator", node.Type())
+	}
+	return nil
+}
+
+// compileObject 节点作用的对象，省略时是当前对象
+func (c *bytecodeCompiler) compileObject(object ast.Expression) error {
+	if object == nil {
+		c.emit(OpThis)
+		return nil
+	}
+	return c.compile(object)
+}
+
+// compileOnRoot 以根对象为当前对象求值 (方法参数和下标)，常量不需要切换当前对象
+func (c *bytecodeCompiler) compileOnRoot(node ast.Expression) error {
+	if _, ok := constantValue(node); ok {
+		return c.compile(node)
+	}
+	c.emit(OpEnterRoot)
+	if err := c.compile(node); err != nil {
+		return err
+	}
+	c.emit(OpLeave)
+	return nil
+}
+
+func (c *bytecodeCompiler) compileArgs(args []ast.Expression) error {
+	for _, arg := range args {
+		if err := c.compileOnRoot(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileChain 依次把链中的节点作用于栈顶的值
+func (c *bytecodeCompiler) compileChain(children []ast.Expression) error {
+	if len(children) == 0 {
+		c.emit(OpThis)
+		return nil
+	}
+	// 链首的属性和下标作用于当前对象，其他节点直接求值
+	start := 0
+	switch children[0].(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+		c.emit(OpThis)
+	default:
+		if err := c.compile(children[0]); err != nil {
+			return err
+		}
+		start = 1
+	}
+	for i := start; i < len(children); i++ {
+		child := children[i]
+		prevSrc := c.src
+		c.src = c.name(child.String())
+		var err error
+		switch n := child.(type) {
+		case *ast.Identifier:
+			if idx, ok := indexedNext(children, i); ok {
+				// 属性后紧跟下标时，优先尝试索引属性 getValues(int) / getAttribute(String)
+				err = c.compileOnRoot(idx.Index)
+				c.emit(OpGetIndexed, c.name(n.Value))
+				i++
+				break
+			}
+			c.emit(OpGetProp, c.name(n.Value))
+		case *ast.IndexExpression:
+			if n.Object == nil {
+				err = c.applyIndex(n)
+				break
+			}
+			err = c.applyGeneric(child)
+		default:
+			if appliesToTop(child) {
+				err = c.applyTo(child)
+				break
+			}
+			err = c.applyGeneric(child)
+		}
+		c.src = prevSrc
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexedNext 链中 children[i] 之后是否紧跟可能由索引属性处理的下标
+func indexedNext(children []ast.Expression, i int) (*ast.IndexExpression, bool) {
+	if i+1 >= len(children) {
+		return nil, false
+	}
+	idx, ok := children[i+1].(*ast.IndexExpression)
+	if !ok || idx.Object != nil || isDynamicSubscript(idx) {
+		return nil, false
+	}
+	return idx, true
+}
+
+// applyGeneric 以栈顶的值为当前对象对节点求值
+func (c *bytecodeCompiler) applyGeneric(node ast.Expression) error {
+	c.emit(OpEnter)
+	if err := c.compile(node); err != nil {
+		return err
+	}
+	c.emit(OpLeave)
+	return nil
+}
+
+// applyIndex 对栈顶的对象取下标，下标在根对象上求值
+func (c *bytecodeCompiler) applyIndex(n *ast.IndexExpression) error {
+	if sub, ok := ast.DynamicSubscriptOf(n); ok {
+		c.emit(OpDynIndex, int32(sub))
+		return nil
+	}
+	if err := c.compileOnRoot(n.Index); err != nil {
+		return err
+	}
+	c.emit(OpGetIndex)
+	return nil
+}
+
+// compileBinary && 和 || 短路求值并返回操作数本身
+func (c *bytecodeCompiler) compileBinary(n *ast.BinaryExpression) error {
+	if err := c.compile(n.Left); err != nil {
+		return err
+	}
+	var jump Opcode
+	switch n.Operator {
+	case ast.AND:
+		jump = OpJumpIfFalseOrPop
+	case ast.OR:
+		jump = OpJumpIfTrueOrPop
+	default:
+		if err := c.compile(n.Right); err != nil {
+			return err
+		}
+		c.emit(OpBinary, c.name(ast.TokenTypeNames[n.Operator]))
+		return nil
+	}
+	pc := c.emit(jump)
+	if err := c.compile(n.Right); err != nil {
+		return err
+	}
+	c.patch(pc)
+	return nil
+}
+
+func (c *bytecodeCompiler) compileCall(n *ast.CallExpression) error {
+	if n.Method == "" {
+		// 链中的 (arg)，以当前对象为目标求值
+		c.emit(OpThis)
+		var argument ast.Expression
+		if len(n.Arguments) > 0 {
+			argument = n.Arguments[0]
+		}
+		return c.compileEvalArgument(argument)
+	}
+	if err := c.compileObject(n.Object); err != nil {
+		return err
+	}
+	return c.applyTo(n)
+}
+
+// appliesToTop 节点没有 Object，直接作用于链中前一个结果 (栈顶)，不需要切换当前对象
+func appliesToTop(node ast.Expression) bool {
+	switch n := node.(type) {
+	case *ast.DynamicSubscriptExpression:
+		return n.Object == nil
+	case *ast.ProjectionExpression:
+		return n.Object == nil
+	case *ast.SelectionExpression:
+		return n.Object == nil
+	case *ast.CallExpression:
+		return n.Object == nil && n.Method != ""
+	}
+	return false
+}
+
+// applyTo 生成把节点作用于栈顶对象的指令
+func (c *bytecodeCompiler) applyTo(node ast.Expression) error {
+	switch n := node.(type) {
+	case *ast.DynamicSubscriptExpression:
+		c.emit(OpDynIndex, int32(n.SubscriptType))
+	case *ast.ProjectionExpression:
+		fn, err := c.function(FuncProjection, n.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(OpProject, fn)
+	case *ast.SelectionExpression:
+		fn, err := c.function(FuncSelection, n.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(OpSelect, fn, c.name(n.SelectType))
+	case *ast.CallExpression:
+		if err := c.compileArgs(n.Arguments); err != nil {
+			return err
+		}
+		c.emit(OpCall, c.name(n.Method), int32(len(n.Arguments)))
+	}
+	return nil
+}
+
+// compileEvalArgument 目标已经在栈顶，参数在当前对象上求值
+func (c *bytecodeCompiler) compileEvalArgument(argument ast.Expression) error {
+	if argument == nil {
+		c.emit(OpConst, c.constant(nil))
+	} else if err := c.compile(argument); err != nil {
+		return err
+	}
+	c.emit(OpEval)
+	return nil
+}
+
+func (c *bytecodeCompiler) compileConstructor(n *ast.ConstructorExpression) error {
+	class := c.name(n.ClassName)
+	if !n.IsArray {
+		if err := c.compileArgs(n.Arguments); err != nil {
+			return err
+		}
+		c.emit(OpNew, class, int32(len(n.Arguments)))
+		return nil
+	}
+	if len(n.Arguments) == 0 {
+		c.emit(OpNewArrayInit, class, 0)
+		return nil
+	}
+	if init, ok := n.Arguments[0].(*ast.ArrayExpression); ok {
+		if err := c.compileArgs(init.Elements); err != nil {
+			return err
+		}
+		c.emit(OpNewArrayInit, class, int32(len(init.Elements)))
+		return nil
+	}
+	if err := c.compileOnRoot(n.Arguments[0]); err != nil {
+		return err
+	}
+	c.emit(OpNewArray, class)
+	return nil
+}
+
+func (c *bytecodeCompiler) compileLambda(body ast.Expression) error {
+	fn, err := c.function(FuncLambda, body)
+	if err != nil {
+		return err
+	}
+	c.emit(OpLambda, fn)
+	return nil
+}
+
+// compileAssign 栈顶是要写入的值，生成把它写入 target 的指令，值保留在栈顶
+func (c *bytecodeCompiler) compileAssign(target ast.Expression) error {
+	switch t := target.(type) {
+	case *ast.VariableExpression:
+		c.emit(OpStoreVar, c.name(t.Name))
+	case *ast.RootExpression:
+		c.emit(OpStoreRoot)
+	case *ast.Identifier:
+		c.emit(OpThis)
+		c.emit(OpSetProp, c.name(t.Value))
+	case *ast.IndexExpression:
+		if err := c.compileObject(t.Object); err != nil {
+			return err
+		}
+		return c.assignIndex(t)
+	case *ast.ChainExpression:
+		return c.compileAssignChain(t.Children)
+	case nil:
+		return fmt.Errorf("missing assignment target")
+	default:
+		return fmt.Errorf("cannot assign to %s", target.Type())
+	}
+	return nil
+}
+
+// assignIndex 栈上是值和对象，写入对象的下标
+func (c *bytecodeCompiler) assignIndex(n *ast.IndexExpression) error {
+	if sub, ok := ast.DynamicSubscriptOf(n); ok {
+		if sub == ast.ALL {
+			return fmt.Errorf("cannot assign to dynamic subscript %s", subscriptSymbol(sub))
+		}
+		c.emit(OpSetDynIndex, int32(sub))
+		return nil
+	}
+	if err := c.compileOnRoot(n.Index); err != nil {
+		return err
+	}
+	c.emit(OpSetIndex)
+	return nil
+}
+
+// compileAssignChain 对链中除最后一个节点外的部分求值，再把值写入最后一个节点
+func (c *bytecodeCompiler) compileAssignChain(children []ast.Expression) error {
+	if len(children) == 0 {
+		return fmt.Errorf("cannot assign to empty chain")
+	}
+	last := len(children) - 1
+
+	// foo.values[2] = v 优先使用索引属性的 setter，否则先读取 values 再写下标
+	if idx, ok := children[last].(*ast.IndexExpression); ok && idx.Object == nil && last > 0 {
+		if id, ok := children[last-1].(*ast.Identifier); ok {
+			if err := c.compileChain(children[:last-1]); err != nil {
+				return err
+			}
+			if isDynamicSubscript(idx) {
+				c.emit(OpGetProp, c.name(id.Value))
+				return c.assignIndex(idx)
+			}
+			if err := c.compileOnRoot(idx.Index); err != nil {
+				return err
+			}
+			c.emit(OpSetIndexed, c.name(id.Value))
+			return nil
+		}
+	}
+
+	if err := c.compileChain(children[:last]); err != nil {
+		return err
+	}
+	switch t := children[last].(type) {
+	case *ast.Identifier:
+		c.emit(OpSetProp, c.name(t.Value))
+		return nil
+	case *ast.IndexExpression:
+		if t.Object == nil {
+			return c.assignIndex(t)
+		}
+	}
+	c.emit(OpEnter)
+	if err := c.compileAssign(children[last]); err != nil {
+		return err
+	}
+	c.emit(OpLeave)
+	return nil
+}
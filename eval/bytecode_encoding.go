@@ -0,0 +1,414 @@
+package eval
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// =============================================================================
+// 字节码的序列化格式和反汇编
+// =============================================================================
+//
+// 格式：魔数 "OGNLBC"、版本号，随后依次是源表达式、名称表、常量表和函数表。
+// 整数使用 varint 编码，字符串是长度加 UTF-8 字节，运算符按名称保存，
+// 因此 ast.TokenType 的数值变化不会使缓存的字节码失效。
+
+const (
+	bytecodeMagic   = "OGNLBC"
+	bytecodeVersion = 1
+)
+
+// 常量的类型标记
+const (
+	constNil byte = iota
+	constFalse
+	constTrue
+	constString
+	constChar
+	constInt32
+	constInt64
+	constFloat32
+	constFloat64
+	constBigInt
+	constBigFloat
+)
+
+// ErrInvalidBytecode 反序列化的数据不是有效的字节码
+var ErrInvalidBytecode = errors.New("invalid bytecode")
+
+// MarshalBinary 把字节码编码为可以缓存到磁盘的格式
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	buf := append([]byte(bytecodeMagic), bytecodeVersion)
+	buf = appendString(buf, b.Source)
+	buf = binary.AppendUvarint(buf, uint64(len(b.Names)))
+	for _, name := range b.Names {
+		buf = appendString(buf, name)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(b.Consts)))
+	for _, v := range b.Consts {
+		var err error
+		if buf, err = appendConst(buf, v); err != nil {
+			return nil, err
+		}
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(b.Functions)))
+	for _, fn := range b.Functions {
+		buf = append(buf, byte(fn.Kind))
+		buf = appendString(buf, fn.Source)
+		buf = binary.AppendUvarint(buf, uint64(len(fn.Code)))
+		for pc, in := range fn.Code {
+			buf = append(buf, byte(in.Op))
+			buf = binary.AppendVarint(buf, int64(in.A))
+			buf = binary.AppendVarint(buf, int64(in.B))
+			buf = binary.AppendVarint(buf, int64(in.C))
+			buf = binary.AppendVarint(buf, int64(fn.Sources[pc]))
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary 解码 MarshalBinary 的结果，检查所有下标和跳转目标后重新链接
+// 不检查指令序列的栈是否平衡，被篡改的指令序列在执行时返回错误
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+	if !strings.HasPrefix(string(data), bytecodeMagic) {
+		return fmt.Errorf("%w: bad magic", ErrInvalidBytecode)
+	}
+	r := &bytecodeReader{data: data[len(bytecodeMagic):]}
+	if v := r.byte(); r.err == nil && v != bytecodeVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidBytecode, v)
+	}
+	prog := &Bytecode{Source: r.string()}
+	prog.Names = make([]string, r.count())
+	for i := range prog.Names {
+		prog.Names[i] = r.string()
+	}
+	prog.Consts = make([]any, r.count())
+	for i := range prog.Consts {
+		prog.Consts[i] = r.constant()
+	}
+	prog.Functions = make([]*Function, r.count())
+	for i := range prog.Functions {
+		fn := &Function{Kind: FunctionKind(r.byte()), Source: r.string()}
+		n := r.count()
+		fn.Code = make([]Instr, n)
+		fn.Sources = make([]int32, n)
+		for pc := range fn.Code {
+			fn.Code[pc] = Instr{Op: Opcode(r.byte()), A: r.int32(), B: r.int32(), C: r.int32()}
+			fn.Sources[pc] = r.int32()
+		}
+		prog.Functions[i] = fn
+	}
+	if r.err == nil && len(r.data) > 0 {
+		r.fail("%d trailing bytes", len(r.data))
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if err := prog.validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBytecode, err)
+	}
+	if err := prog.link(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBytecode, err)
+	}
+	*b = *prog
+	for _, fn := range b.Functions {
+		fn.prog = b
+	}
+	return nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendConst(buf []byte, v any) ([]byte, error) {
+	switch c := v.(type) {
+	case nil:
+		return append(buf, constNil), nil
+	case bool:
+		if c {
+			return append(buf, constTrue), nil
+		}
+		return append(buf, constFalse), nil
+	case string:
+		return appendString(append(buf, constString), c), nil
+	case Char:
+		return binary.AppendUvarint(append(buf, constChar), uint64(c)), nil
+	case int32:
+		return binary.AppendVarint(append(buf, constInt32), int64(c)), nil
+	case int64:
+		return binary.AppendVarint(append(buf, constInt64), c), nil
+	case float32:
+		return binary.AppendUvarint(append(buf, constFloat32), uint64(math.Float32bits(c))), nil
+	case float64:
+		return binary.AppendUvarint(append(buf, constFloat64), math.Float64bits(c)), nil
+	case *big.Int:
+		data, err := c.GobEncode()
+		if err != nil {
+			return nil, err
+		}
+		return appendString(append(buf, constBigInt), string(data)), nil
+	case *big.Float:
+		data, err := c.GobEncode()
+		if err != nil {
+			return nil, err
+		}
+		return appendString(append(buf, constBigFloat), string(data)), nil
+	}
+	return nil, fmt.Errorf("cannot encode constant of type %T", v)
+}
+
+// bytecodeReader 按顺序读取字段，遇到第一个错误后停止读取
+type bytecodeReader struct {
+	data []byte
+	err  error
+}
+
+func (r *bytecodeReader) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s", ErrInvalidBytecode, fmt.Sprintf(format, args...))
+	}
+	r.data = nil
+}
+
+func (r *bytecodeReader) byte() byte {
+	if len(r.data) == 0 {
+		r.fail("unexpected end of data")
+		return 0
+	}
+	v := r.data[0]
+	r.data = r.data[1:]
+	return v
+}
+
+func (r *bytecodeReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail("bad varint")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *bytecodeReader) int32() int32 {
+	v, n := binary.Varint(r.data)
+	if n <= 0 || v < math.MinInt32 || v > math.MaxInt32 {
+		r.fail("bad operand")
+		return 0
+	}
+	r.data = r.data[n:]
+	return int32(v)
+}
+
+// count 读取元素个数，每个元素至少占一个字节，超过剩余长度的个数一定是损坏的数据
+func (r *bytecodeReader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.data)) {
+		r.fail("count %d exceeds data length", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *bytecodeReader) string() string {
+	n := r.uvarint()
+	if n > uint64(len(r.data)) {
+		r.fail("string length %d exceeds data length", n)
+		return ""
+	}
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
+
+func (r *bytecodeReader) constant() any {
+	switch tag := r.byte(); tag {
+	case constNil:
+		return nil
+	case constFalse:
+		return false
+	case constTrue:
+		return true
+	case constString:
+		return r.string()
+	case constChar:
+		return Char(r.uvarint())
+	case constInt32:
+		return r.int32()
+	case constInt64:
+		v, n := binary.Varint(r.data)
+		if n <= 0 {
+			r.fail("bad varint")
+			return nil
+		}
+		r.data = r.data[n:]
+		return v
+	case constFloat32:
+		return math.Float32frombits(uint32(r.uvarint()))
+	case constFloat64:
+		return math.Float64frombits(r.uvarint())
+	case constBigInt:
+		v := new(big.Int)
+		if err := v.GobDecode([]byte(r.string())); err != nil {
+			r.fail("bad big integer: %v", err)
+		}
+		return v
+	case constBigFloat:
+		v := new(big.Float)
+		if err := v.GobDecode([]byte(r.string())); err != nil {
+			r.fail("bad big decimal: %v", err)
+		}
+		return v
+	default:
+		if r.err == nil {
+			r.fail("unknown constant tag %d", tag)
+		}
+		return nil
+	}
+}
+
+// validate 检查操作码、操作数的下标和跳转目标，保证执行时不会越界访问表
+func (b *Bytecode) validate() error {
+	if len(b.Functions) == 0 {
+		return fmt.Errorf("no functions")
+	}
+	name := func(i int32) bool { return i >= 0 && int(i) < len(b.Names) }
+	for fi, fn := range b.Functions {
+		if int(fn.Kind) >= len(functionKindNames) {
+			return fmt.Errorf("function %d: unknown kind %d", fi, fn.Kind)
+		}
+		if fn.Kind == FuncLambda {
+			body, err := parseExpression(fn.Source)
+			if err != nil {
+				return fmt.Errorf("function %d: %v", fi, err)
+			}
+			fn.body = body
+		}
+		for pc, in := range fn.Code {
+			ok := true
+			switch in.Op {
+			case OpConst:
+				ok = in.A >= 0 && int(in.A) < len(b.Consts)
+			case OpLoadVar, OpStoreVar, OpGetProp, OpSetProp, OpGetIndexed, OpSetIndexed,
+				OpNewArray, OpBinary, OpUnary, OpInstanceof:
+				ok = name(in.A)
+			case OpCall, OpNew, OpNewArrayInit:
+				ok = name(in.A) && in.B >= 0
+			case OpCallStatic:
+				ok = name(in.A) && name(in.B) && in.C >= 0
+			case OpStaticField:
+				ok = name(in.A) && name(in.B)
+			case OpDynIndex, OpSetDynIndex:
+				ok = in.A >= int32(ast.FIRST) && in.A <= int32(ast.ALL)
+			case OpJump, OpJumpIfFalse, OpJumpIfFalseOrPop, OpJumpIfTrueOrPop:
+				ok = in.A >= 0 && int(in.A) <= len(fn.Code)
+			case OpList, OpMap:
+				ok = in.A >= 0
+			case OpLambda:
+				ok = b.function(in.A, FuncLambda)
+			case OpProject:
+				ok = b.function(in.A, FuncProjection)
+			case OpSelect:
+				ok = b.function(in.A, FuncSelection) && name(in.B)
+			case OpPop, OpThis, OpRoot, OpEnter, OpEnterRoot, OpLeave, OpStoreRoot,
+				OpGetIndex, OpSetIndex, OpEval:
+			default:
+				return fmt.Errorf("function %d: unknown opcode %d at %04d", fi, in.Op, pc)
+			}
+			if !ok || !name(fn.Sources[pc]) {
+				return fmt.Errorf("function %d: bad operand in %s at %04d", fi, in.Op, pc)
+			}
+		}
+	}
+	return nil
+}
+
+// function 判断 i 是否为指定用途的函数的下标
+func (b *Bytecode) function(i int32, kind FunctionKind) bool {
+	return i > 0 && int(i) < len(b.Functions) && b.Functions[i].Kind == kind
+}
+
+// =============================================================================
+// 反汇编
+// =============================================================================
+
+// Disassemble 以文本形式列出字节码的每个函数和指令，指令对应的表达式变化时在行尾注释
+func Disassemble(b *Bytecode) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "; %s\n", b.Source)
+	for fi, fn := range b.Functions {
+		fmt.Fprintf(&sb, "\nfunction %d (%s): %s\n", fi, fn.Kind, fn.Source)
+		prevSrc := int32(-1)
+		for pc, in := range fn.Code {
+			line := fmt.Sprintf("  %04d  %-20s %s", pc, in.Op, b.operands(in))
+			if src := fn.Sources[pc]; src != prevSrc {
+				line = fmt.Sprintf("%-56s ; %s", line, b.Names[src])
+				prevSrc = src
+			}
+			sb.WriteString(strings.TrimRight(line, " "))
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+// operands 指令操作数的可读形式
+func (b *Bytecode) operands(in Instr) string {
+	switch in.Op {
+	case OpConst:
+		return formatConst(b.Consts[in.A])
+	case OpLoadVar, OpStoreVar:
+		return "#" + b.Names[in.A]
+	case OpGetProp, OpSetProp, OpGetIndexed, OpSetIndexed, OpBinary, OpUnary, OpInstanceof, OpNewArray:
+		return b.Names[in.A]
+	case OpCall:
+		return fmt.Sprintf("%s/%d", b.Names[in.A], in.B)
+	case OpCallStatic:
+		return fmt.Sprintf("@%s@%s/%d", b.Names[in.A], b.Names[in.B], in.C)
+	case OpNew, OpNewArrayInit:
+		return fmt.Sprintf("%s/%d", b.Names[in.A], in.B)
+	case OpStaticField:
+		return fmt.Sprintf("@%s@%s", b.Names[in.A], b.Names[in.B])
+	case OpDynIndex, OpSetDynIndex:
+		return "[" + subscriptSymbol(ast.DynamicSubscriptType(in.A)) + "]"
+	case OpJump, OpJumpIfFalse, OpJumpIfFalseOrPop, OpJumpIfTrueOrPop:
+		return fmt.Sprintf("-> %04d", in.A)
+	case OpList, OpMap:
+		return strconv.Itoa(int(in.A))
+	case OpLambda, OpProject:
+		return fmt.Sprintf("function %d", in.A)
+	case OpSelect:
+		return fmt.Sprintf("function %d %s", in.A, b.Names[in.B])
+	}
+	return ""
+}
+
+// formatConst 常量按 OGNL 字面量的写法显示
+func formatConst(v any) string {
+	switch c := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(c)
+	case Char:
+		return strconv.QuoteRune(rune(c))
+	case int64:
+		return strconv.FormatInt(c, 10) + "L"
+	case float32:
+		return strconv.FormatFloat(float64(c), 'g', -1, 32) + "F"
+	case *big.Int:
+		return c.String() + "H"
+	case *big.Float:
+		return c.Text('g', -1) + "B"
+	}
+	return fmt.Sprint(v)
+}
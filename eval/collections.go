@@ -0,0 +1,237 @@
+package eval
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// Entry map 的一个键值对 (对应 Java 的 Map.Entry)
+// 对 map 做投影和选择时，每个元素是一个 Entry，可以用 #this.key / #this.value 访问
+type Entry struct {
+	Key   any
+	Value any
+}
+
+func (e Entry) GetKey() any   { return e.Key }
+func (e Entry) GetValue() any { return e.Value }
+
+func (e Entry) String() string { return StringValue(e.Key) + "=" + StringValue(e.Value) }
+
+// Elements 按 Java OGNL ElementsAccessor 的规则遍历值的元素，fn 返回 false 时停止
+// 切片和数组逐个元素；map 按键排序后逐个 Entry；iter.Seq 形式的迭代器逐个元素，
+// iter.Seq2 逐个 Entry；null 没有元素；其他值本身是唯一的元素
+func Elements(v any, fn func(elem any) bool) {
+	if v == nil {
+		return
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Array {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if !fn(rv.Index(i).Interface()) {
+				return
+			}
+		}
+		return
+	case reflect.Map:
+		for _, k := range sortedMapKeys(rv) {
+			if !fn(Entry{Key: k.Interface(), Value: rv.MapIndex(k).Interface()}) {
+				return
+			}
+		}
+		return
+	case reflect.Func:
+		if rv.IsNil() {
+			return
+		}
+		switch {
+		case rv.Type().CanSeq():
+			for elem := range rv.Seq() {
+				if !fn(elem.Interface()) {
+					return
+				}
+			}
+			return
+		case rv.Type().CanSeq2():
+			for k, elem := range rv.Seq2() {
+				if !fn(Entry{Key: k.Interface(), Value: elem.Interface()}) {
+					return
+				}
+			}
+			return
+		}
+	}
+	fn(v)
+}
+
+// isIterator 判断值是否为 iter.Seq / iter.Seq2 形式的迭代器
+func isIterator(rv reflect.Value) bool {
+	return rv.Kind() == reflect.Func && (rv.Type().CanSeq() || rv.Type().CanSeq2())
+}
+
+// Project 投影 source.{expr}：对每个元素求值，结果组成新的列表
+func Project(source any, fn func(elem any) (any, error)) ([]any, error) {
+	out := []any{}
+	var err error
+	Elements(source, func(elem any) bool {
+		var v any
+		v, err = fn(elem)
+		out = append(out, v)
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Select 选择 source.{? expr} / {^ expr} / {$ expr}，selectType 为 "all"、"first" 或 "last"
+// 与 Java OGNL 一致，first 和 last 返回最多只有一个元素的列表
+func Select(source any, selectType string, test func(elem any) (any, error)) ([]any, error) {
+	out := []any{}
+	var err error
+	Elements(source, func(elem any) bool {
+		var v any
+		v, err = test(elem)
+		if err != nil {
+			return false
+		}
+		if !BooleanValue(v) {
+			return true
+		}
+		switch selectType {
+		case "first":
+			out = append(out, elem)
+			return false
+		case "last":
+			out = append(out[:0], elem)
+		default:
+			out = append(out, elem)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// =============================================================================
+// 动态下标 - 对应 ListPropertyAccessor / ArrayPropertyAccessor 中的 DynamicSubscript
+// =============================================================================
+
+// subscriptSymbol 动态下标在错误信息中的写法
+func subscriptSymbol(sub ast.DynamicSubscriptType) string {
+	return (&ast.DynamicSubscriptExpression{SubscriptType: sub}).String()
+}
+
+// subscriptIndex 返回长度为 n 的序列中动态下标对应的位置，空序列返回 -1
+func subscriptIndex(sub ast.DynamicSubscriptType, n int) int {
+	if n == 0 {
+		return -1
+	}
+	switch sub {
+	case ast.FIRST:
+		return 0
+	case ast.MID:
+		return n / 2
+	}
+	return n - 1
+}
+
+// DynamicIndex 读取 source[^] / [|] / [$] / [*]
+// 切片、数组和迭代器取第一个、中间、最后一个元素，空集合的结果为 null；
+// map 按键排序后取对应的值；[*] 返回集合的副本
+func DynamicIndex(source any, sub ast.DynamicSubscriptType) (any, error) {
+	return dynamicIndex(source, sub, 0)
+}
+
+// dynamicIndex limit 大于 0 时限制从迭代器中读取的元素个数
+func dynamicIndex(source any, sub ast.DynamicSubscriptType, limit int) (any, error) {
+	if isNil(source) {
+		return nil, &NullSourceError{Op: "getProperty", Name: subscriptSymbol(sub)}
+	}
+	rv := receiver(reflect.ValueOf(source))
+	if rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Array {
+		rv = rv.Elem()
+	}
+	switch {
+	case rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array:
+		if sub == ast.ALL {
+			out := reflect.MakeSlice(reflect.SliceOf(rv.Type().Elem()), rv.Len(), rv.Len())
+			reflect.Copy(out, rv)
+			return out.Interface(), nil
+		}
+		if i := subscriptIndex(sub, rv.Len()); i >= 0 {
+			return rv.Index(i).Interface(), nil
+		}
+		return nil, nil
+	case rv.Kind() == reflect.Map:
+		if sub == ast.ALL {
+			out := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+			for _, k := range sortedMapKeys(rv) {
+				out.SetMapIndex(k, rv.MapIndex(k))
+			}
+			return out.Interface(), nil
+		}
+		keys := sortedMapKeys(rv)
+		if i := subscriptIndex(sub, len(keys)); i >= 0 {
+			return rv.MapIndex(keys[i]).Interface(), nil
+		}
+		return nil, nil
+	case isIterator(rv):
+		var list []any
+		Elements(source, func(elem any) bool {
+			list = append(list, elem)
+			return limit <= 0 || len(list) <= limit
+		})
+		if limit > 0 && len(list) > limit {
+			return nil, &BudgetError{Limit: LimitCollectionSize, Max: limit}
+		}
+		if sub == ast.ALL {
+			return list, nil
+		}
+		if i := subscriptIndex(sub, len(list)); i >= 0 {
+			return list[i], nil
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("dynamic subscript %s is not supported on %s", subscriptSymbol(sub), typeName(rv.Type()))
+}
+
+// SetDynamicIndex 写入 target[^] / [|] / [$]
+// 切片和数组写入对应位置的元素，map 写入按键排序后对应的键；不支持写入 [*]
+func SetDynamicIndex(target any, sub ast.DynamicSubscriptType, value any) error {
+	if isNil(target) {
+		return &NullSourceError{Op: "setProperty", Name: subscriptSymbol(sub)}
+	}
+	rv := receiver(reflect.ValueOf(target))
+	if sub == ast.ALL {
+		return fmt.Errorf("cannot assign to dynamic subscript %s", subscriptSymbol(sub))
+	}
+	seq := rv
+	if seq.Kind() == reflect.Pointer && seq.Elem().Kind() == reflect.Array {
+		seq = seq.Elem()
+	}
+	switch seq.Kind() {
+	case reflect.Slice, reflect.Array:
+		i := subscriptIndex(sub, seq.Len())
+		if i < 0 {
+			return fmt.Errorf("cannot assign to %s of empty %s", subscriptSymbol(sub), typeName(seq.Type()))
+		}
+		return SetIndex(target, i, value)
+	case reflect.Map:
+		keys := sortedMapKeys(seq)
+		i := subscriptIndex(sub, len(keys))
+		if i < 0 {
+			return fmt.Errorf("cannot assign to %s of empty %s", subscriptSymbol(sub), typeName(seq.Type()))
+		}
+		return setMapIndex(seq, keys[i].Interface(), value)
+	}
+	return fmt.Errorf("dynamic subscript %s is not supported on %s", subscriptSymbol(sub), typeName(rv.Type()))
+}
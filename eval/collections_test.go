@@ -0,0 +1,144 @@
+package eval
+
+import (
+	"errors"
+	"iter"
+	"reflect"
+	"testing"
+)
+
+func collectionsContext() *Context {
+	people := []*Bean{
+		{Name: "Ada", Count: 3},
+		{Name: "Byron", Count: 1},
+		{Name: "Grace", Count: 5},
+	}
+	var seq iter.Seq[int] = func(yield func(int) bool) {
+		for i := 1; i <= 3; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+	var pairs iter.Seq2[string, int] = func(yield func(string, int) bool) {
+		_ = yield("a", 1) && yield("b", 2)
+	}
+	return NewContext(map[string]any{
+		"people": people,
+		"list":   []int{10, 20, 30, 40},
+		"empty":  []string{},
+		"tags":   map[string]string{"lang": "go", "os": "linux", "arch": "amd64"},
+		"seq":    seq,
+		"pairs":  pairs,
+		"name":   "ognl",
+	})
+}
+
+func TestProjectionAndSelection(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"{1, 2, 3}.{#this * 2}", []any{int32(2), int32(4), int32(6)}},
+		{"people.{name}", []any{"Ada", "Byron", "Grace"}},
+		{"people.{? count > 20}.{name}", []any{"Ada", "Grace"}}, // count 来自 GetCount()，是字段的 10 倍
+		{"people.{^ count > 20}.{name}", []any{"Ada"}},          // first 返回只有一个元素的列表
+		{"people.{$ count > 20}.{name}", []any{"Grace"}},        // last
+		{"people.{? name == \"nobody\"}", []any{}},              //
+		{"people.{^ name == \"nobody\"}", []any{}},              //
+		{"tags.{key}", []any{"arch", "lang", "os"}},             // map 的元素是按键排序的 Entry
+		{"tags.{? #this.value == \"go\"}.{key}", []any{"lang"}}, //
+		{"tags.{? value.startsWith(\"l\")}.{getKey()}", []any{"os"}},
+		{"seq.{#this + 1}", []any{int64(2), int64(3), int64(4)}}, // iter.Seq，Go 的 int 按 long 运算
+		{"pairs.{key + value}", []any{"a1", "b2"}},               // iter.Seq2 的元素是 Entry
+		{"{{1, 2}, {3}}.{#this.{#this * 10}}", []any{[]any{int32(10), int32(20)}, []any{int32(30)}}},
+		{"name.{#this}", []any{"ognl"}}, // 非集合的值本身是唯一的元素
+	}
+	ctx := collectionsContext()
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := getValue(t, tt.input, ctx)
+			if err != nil {
+				t.Fatalf("GetValue(%q) error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(v, tt.expected) {
+				t.Errorf("GetValue(%q) = %#v, want %#v", tt.input, v, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDynamicSubscript(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"list[^]", 10},
+		{"list[|]", 30},
+		{"list[$]", 40},
+		{"list[*]", []int{10, 20, 30, 40}},
+		{"empty[^]", nil},
+		{"empty[$]", nil},
+		{"tags[^]", "amd64"}, // map 按键排序：arch, lang, os
+		{"tags[$]", "linux"},
+		{"seq[$]", 3},
+		{"seq[*]", []any{1, 2, 3}},
+		{"people[$].name", "Grace"},
+		{"people.{name}[^]", "Ada"},
+	}
+	ctx := collectionsContext()
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := getValue(t, tt.input, ctx)
+			if err != nil {
+				t.Fatalf("GetValue(%q) error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(v, tt.expected) {
+				t.Errorf("GetValue(%q) = %#v, want %#v", tt.input, v, tt.expected)
+			}
+		})
+	}
+
+	// [*] 返回副本，修改副本不影响原集合
+	v, _ := getValue(t, "list[*]", ctx)
+	v.([]int)[0] = -1
+	if first, _ := getValue(t, "list[^]", ctx); first != 10 {
+		t.Errorf("list[*] should return a copy, list[^] = %v", first)
+	}
+
+	if _, err := getValue(t, "name[^]", ctx); err == nil {
+		t.Error("expected error for dynamic subscript on a string")
+	}
+	// 带引号的 "^" 是普通的字符串下标
+	if v, err := getValue(t, "tags[\"lang\"]", ctx); err != nil || v != "go" {
+		t.Errorf("tags[\"lang\"] = %v, %v", v, err)
+	}
+}
+
+func TestSetDynamicSubscript(t *testing.T) {
+	ctx := collectionsContext()
+	if err := SetValue(parse(t, "list[$]"), ctx, 99); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := getValue(t, "list[3]", ctx); v != 99 {
+		t.Errorf("list[3] = %v after setting list[$]", v)
+	}
+	if err := SetValue(parse(t, "tags[^]"), ctx, "arm64"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := getValue(t, "tags.arch", ctx); v != "arm64" {
+		t.Errorf("tags.arch = %v after setting tags[^]", v)
+	}
+	if err := SetValue(parse(t, "empty[^]"), ctx, "x"); err == nil {
+		t.Error("expected error when assigning to [^] of an empty list")
+	}
+	if err := SetValue(parse(t, "list[*]"), ctx, 1); err == nil {
+		t.Error("expected error when assigning to [*]")
+	}
+
+	var nullErr *NullSourceError
+	_, err := getValue(t, "missing[^]", NewContext(map[string]any{}))
+	if !errors.As(err, &nullErr) {
+		t.Errorf("expected NullSourceError, got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// compile 解析并编译表达式，失败时终止测试
+func compile(t testing.TB, input string) *Program {
+	t.Helper()
+	p := parse(t, input)
+	prog, err := Compile(p, CompileOptions{Registry: builtinRegistry})
+	if err != nil {
+		t.Fatalf("compile %q: %v", input, err)
+	}
+	return prog
+}
+
+// compiledCases 编译前后应当得到相同结果的表达式，每个表达式在新的上下文中执行
+var compiledCases = []struct {
+	input string
+	ctx   func() *Context
+}{
+	{"1 + 2 * 3", func() *Context { return NewContext(nil) }},
+	{"\"a\" + 1 + 'b'", func() *Context { return NewContext(nil) }},
+	{"name + \" \" + title", func() *Context { return NewContext(newBean()) }},
+	{"count > 10 && enabled ? alias : secret", func() *Context { return NewContext(newBean()) }},
+	{"child.name.toUpperCase()", func() *Context { return NewContext(newBean()) }},
+	{"values[1] + attribute['k']", func() *Context { return NewContext(newBean()) }},
+	{"tags.lang", func() *Context { return NewContext(newBean()) }},
+	{"#x = count, #x * 2", func() *Context { return NewContext(newBean()) }},
+	{"title = \"Bob\", name", func() *Context { return NewContext(newBean()) }},
+	{"people.{name}", collectionsContext},
+	{"people.{? count > 2}.{name.length()}", collectionsContext},
+	{"people.{^ count < 3}[0].name", collectionsContext},
+	{"list[^] + list[$] + list.size", collectionsContext},
+	{"seq.{#this * 2}", collectionsContext},
+	{"#{'a' : 1}.a", collectionsContext},
+	{"{1, 2, 3}.{? #this > 1}", collectionsContext},
+	{"#fact = :[#this <= 1 ? 1 : #fact(#this - 1) * #this], #fact(10)", collectionsContext},
+	{"@java.lang.Math@max(list[0], 2L) + @Integer@MAX_VALUE", collectionsContext},
+	{"new String(name) instanceof String", collectionsContext},
+	{"new int[3].length", collectionsContext},
+	{"name.noSuchMethod()", collectionsContext},
+	{"missing.foo", collectionsContext},
+	{"1 / 0", collectionsContext},
+}
+
+func TestCompileMatchesInterpreter(t *testing.T) {
+	for _, tc := range compiledCases {
+		t.Run(tc.input, func(t *testing.T) {
+			want, wantErr := getValue(t, tc.input, tc.ctx())
+			got, err := compile(t, tc.input).Run(tc.ctx())
+			if fmt.Sprint(err) != fmt.Sprint(wantErr) {
+				t.Fatalf("error = %v, interpreter error = %v", err, wantErr)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Run = %#v, interpreter = %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	if _, err := Compile(nil, CompileOptions{}); err == nil {
+		t.Error("expected error for nil expression")
+	}
+
+	_, err := compile(t, "child.child.name").Run(NewContext(newBean()))
+	var nullErr *NullSourceError
+	if !errors.As(err, &nullErr) || nullErr.Name != "name" {
+		t.Errorf("expected NullSourceError, got %v", err)
+	}
+	var evalErr *EvalError
+	if !errors.As(err, &evalErr) || evalErr.Node.String() != "name" {
+		t.Errorf("error should be reported at the property node, got %v", err)
+	}
+
+	// 编译时求值失败的常量不折叠，错误在运行时报告
+	if _, err := compile(t, "1 / 0").Run(NewContext(nil)); !errors.Is(err, ErrDivideByZero) {
+		t.Errorf("expected ErrDivideByZero, got %v", err)
+	}
+}
+
+func TestCompileConstantFolding(t *testing.T) {
+	prog := compile(t, "(1 + 2) * 3 + #x")
+	ctx := NewContext(nil)
+	ctx.Set("x", 1)
+	ctx.SetBudget(EvalBudget{MaxSteps: 4}) // 求和、折叠后的常量、#x
+	v, err := prog.Run(ctx)
+	if err != nil || v != int64(10) {
+		t.Errorf("Run = %#v, %v", v, err)
+	}
+
+	// 折叠后的字符串仍然受长度限制
+	ctx = NewContext(nil)
+	ctx.SetBudget(EvalBudget{MaxStringLength: 3})
+	_, err = compile(t, "\"ab\" + \"cd\"").Run(ctx)
+	expectBudgetError(t, err, LimitStringLength)
+}
+
+func TestCompileInlineCache(t *testing.T) {
+	// 同一个属性访问点和调用点上接收者类型不断变化
+	prog := compile(t, "#x.toString() + #x.size")
+	for _, x := range []any{[]int{1}, map[string]int{"size": 7}, []string{"a", "b"}, []int{1, 2, 3}} {
+		ctx := NewContext(nil)
+		ctx.Set("x", x)
+		want, wantErr := GetValue(prog.Expression(), ctx)
+		got, err := prog.Run(ctx)
+		if err != nil || wantErr != nil || got != want {
+			t.Errorf("%T: Run = %#v, %v; interpreter = %#v, %v", x, got, err, want, wantErr)
+		}
+	}
+
+	registry := NewRegistry().AddClass(printerClass())
+	prog = compile(t, "@demo.Printer@print(#x)")
+	for _, tc := range []struct {
+		x    any
+		want string
+	}{{int64(1), "long"}, {"s", "string"}, {int64(2), "long"}, {2.5, "double"}} {
+		ctx := NewContext(nil)
+		ctx.SetRegistry(registry)
+		ctx.Set("x", tc.x)
+		if v, err := prog.Run(ctx); err != nil || v != tc.want {
+			t.Errorf("print(%#v) = %v, %v, want %v", tc.x, v, err, tc.want)
+		}
+	}
+
+	// 上下文的注册表与编译时不同时，静态字段在运行时解析
+	custom := NewRegistry().AddClass(NewClass("java.lang.Integer", nil).AddField("MAX_VALUE", "custom"))
+	ctx := NewContext(nil)
+	ctx.SetRegistry(custom)
+	if v, err := compile(t, "@Integer@MAX_VALUE").Run(ctx); err != nil || v != "custom" {
+		t.Errorf("static field with another registry = %#v, %v", v, err)
+	}
+}
+
+func TestCompileBudget(t *testing.T) {
+	for _, input := range []string{"#f = :[#f(#this)], #f(1)", "naturals().{#this}"} {
+		_, err := compile(t, input).Run(budgetContext(EvalBudget{MaxSteps: 100, MaxCallDepth: 5, MaxCollectionSize: 10}))
+		var budgetErr *BudgetError
+		if !errors.As(err, &budgetErr) {
+			t.Errorf("%s: expected BudgetError, got %v", input, err)
+		}
+	}
+
+	_, err := compile(t, "explode()").Run(NewContext(Bomb{}))
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Errorf("expected PanicError, got %v", err)
+	}
+}
+
+func TestCompileConcurrent(t *testing.T) {
+	prog := compile(t, "people.{? count > #min}.{name + \":\" + #this.getCount()}")
+	want := []any{"Ada:30", "Grace:50"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				ctx := collectionsContext()
+				ctx.Set("min", 20)
+				v, err := prog.Run(ctx)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !reflect.DeepEqual(v, want) {
+					errs <- fmt.Errorf("got %#v", v)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// =============================================================================
+// 基准测试：解释执行与编译后执行
+// =============================================================================
+
+// 编译后的程序与解释器共用属性读取和方法调用，两者的分配次数基本相同，差别只在分派和调用点缓存
+
+var benchmarkInputs = []struct {
+	name  string
+	input string
+}{
+	{"property", "child.name"},
+	{"method", "name.substring(1).toUpperCase()"},
+	{"arithmetic", "count * 2 + 1 > 10 && enabled"},
+	{"projection", "people.{? count > 1}.{name}"},
+	{"lambda", "#fact = :[#this <= 1 ? 1 : #fact(#this - 1) * #this], #fact(10)"},
+}
+
+func benchmarkContext() *Context {
+	ctx := collectionsContext()
+	bean := newBean()
+	ctx.SetRoot(map[string]any{
+		"child": bean.Child, "name": bean.Name, "count": bean.Count, "enabled": bean.Ready,
+		"people": ctx.Root().(map[string]any)["people"],
+	})
+	return ctx
+}
+
+func BenchmarkInterpreter(b *testing.B) {
+	for _, bm := range benchmarkInputs {
+		b.Run(bm.name, func(b *testing.B) {
+			expr := parse(b, bm.input)
+			ctx := benchmarkContext()
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := GetValue(expr, ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	for _, bm := range benchmarkInputs {
+		b.Run(bm.name, func(b *testing.B) {
+			prog := compile(b, bm.input)
+			ctx := benchmarkContext()
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := prog.Run(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package eval
+
+// ContextKey 保留的上下文变量名，#context 返回上下文变量表本身
+const ContextKey = "context"
+
+// Context 求值上下文 (对应 Java OGNL 的 OgnlContext)
+// 保存根对象和通过 #name 访问的上下文变量
+// Context 不是并发安全的，每次求值 (或每个 goroutine) 应使用各自的 Context
+type Context struct {
+	root         any
+	vars         map[string]any
+	registry     *Registry
+	maxCallDepth int
+	budget       EvalBudget
+}
+
+// NewContext 创建以 root 为根对象的上下文
+func NewContext(root any) *Context {
+	return &Context{
+		root: root,
+		vars: map[string]any{},
+	}
+}
+
+// Root 返回根对象 (#root)
+func (c *Context) Root() any {
+	return c.root
+}
+
+// SetRoot 设置根对象
+func (c *Context) SetRoot(root any) {
+	c.root = root
+}
+
+// Registry 返回解析类和方法使用的注册表，未设置时使用内置的注册表
+func (c *Context) Registry() *Registry {
+	if c.registry == nil {
+		return builtinRegistry
+	}
+	return c.registry
+}
+
+// SetRegistry 设置注册表，通常是在 NewRegistry() 的基础上注册了自定义类的注册表
+func (c *Context) SetRegistry(r *Registry) {
+	c.registry = r
+}
+
+// MaxCallDepth 返回最大 lambda 调用深度
+func (c *Context) MaxCallDepth() int {
+	if c.maxCallDepth <= 0 {
+		return DefaultMaxCallDepth
+	}
+	return c.maxCallDepth
+}
+
+// SetMaxCallDepth 设置最大 lambda 调用深度，超过时求值返回 CallDepthError，n <= 0 时使用默认值
+func (c *Context) SetMaxCallDepth(n int) {
+	c.maxCallDepth = n
+}
+
+// Budget 返回求值预算
+func (c *Context) Budget() EvalBudget {
+	return c.budget
+}
+
+// SetBudget 设置之后每次求值的资源预算，超出时求值返回 BudgetError
+func (c *Context) SetBudget(b EvalBudget) {
+	c.budget = b
+}
+
+// Get 读取上下文变量
+func (c *Context) Get(name string) (any, bool) {
+	v, ok := c.vars[name]
+	return v, ok
+}
+
+// Set 设置上下文变量
+func (c *Context) Set(name string, value any) {
+	c.vars[name] = value
+}
+
+// Delete 删除上下文变量
+func (c *Context) Delete(name string) {
+	delete(c.vars, name)
+}
+
+// Vars 返回上下文变量表 (与 #context 指向同一个 map)
+func (c *Context) Vars() map[string]any {
+	return c.vars
+}
+
+// variable 读取 #name，未定义的变量为 null (与 Java OGNL 一致)
+func (c *Context) variable(name string) any {
+	if v, ok := c.vars[name]; ok {
+		return v
+	}
+	if name == ContextKey {
+		return c.vars
+	}
+	return nil
+}
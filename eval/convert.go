@@ -0,0 +1,157 @@
+package eval
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+var (
+	anyType      = reflect.TypeOf((*any)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	stringType   = reflect.TypeOf("")
+	charType     = reflect.TypeOf(Char(0))
+	bigIntType   = reflect.TypeOf((*big.Int)(nil))
+	bigFloatType = reflect.TypeOf((*big.Float)(nil))
+)
+
+// ConvertValue 把值转换为目标类型 (对应 Java OGNL 的 TypeConverter / OgnlOps.convertValue)
+// null 转换为目标类型的零值；数值之间互相转换；字符串可以解析为数值和布尔值；
+// 任何值都可以转换为字符串；切片和数组逐个元素转换
+func ConvertValue(v any, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(t) {
+		return rv, nil
+	}
+	if t.Kind() == reflect.Interface {
+		if rv.Type().Implements(t) {
+			return rv.Convert(t), nil
+		}
+		return reflect.Value{}, conversionError(v, t)
+	}
+
+	switch t {
+	case charType:
+		if s, ok := stringLike(v); ok {
+			r := []rune(s)
+			if len(r) != 1 {
+				return reflect.Value{}, conversionError(v, t)
+			}
+			return reflect.ValueOf(Char(r[0])), nil
+		}
+		i, err := longValue(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(Char(i)), nil
+	case bigIntType:
+		i, err := bigIntValue(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(i), nil
+	case bigFloatType:
+		f, err := bigDecValue(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(f), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return reflect.ValueOf(BooleanValue(v)).Convert(t), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !convertibleToNumber(v) {
+			return reflect.Value{}, conversionError(v, t)
+		}
+		i, err := longValue(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(i).Convert(t), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !convertibleToNumber(v) {
+			return reflect.Value{}, conversionError(v, t)
+		}
+		i, err := longValue(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(uint64(i)).Convert(t), nil
+	case reflect.Float32, reflect.Float64:
+		if !convertibleToNumber(v) {
+			return reflect.Value{}, conversionError(v, t)
+		}
+		f, err := doubleValue(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(f).Convert(t), nil
+	case reflect.String:
+		return reflect.ValueOf(StringValue(v)).Convert(t), nil
+	case reflect.Slice, reflect.Array:
+		return convertSequence(rv, t)
+	case reflect.Pointer:
+		// 允许把值转换为指向该值的指针
+		if rv.Type().AssignableTo(t.Elem()) {
+			p := reflect.New(t.Elem())
+			p.Elem().Set(rv)
+			return p, nil
+		}
+	}
+	if rv.Type().ConvertibleTo(t) && rv.Kind() == t.Kind() {
+		return rv.Convert(t), nil
+	}
+	return reflect.Value{}, conversionError(v, t)
+}
+
+// convertibleToNumber 判断值能否参与数值转换 (数值、布尔、字符和字符串)
+func convertibleToNumber(v any) bool {
+	if numericType(v) != numNonNumeric {
+		return true
+	}
+	_, ok := stringLike(v)
+	return ok
+}
+
+// convertSequence 逐元素转换切片或数组
+func convertSequence(rv reflect.Value, t reflect.Type) (reflect.Value, error) {
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		// 单个值转换为只有一个元素的数组，与 OGNL 的行为一致
+		elem, err := ConvertValue(rv.Interface(), t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		out := newSequence(t, 1)
+		out.Index(0).Set(elem)
+		return out, nil
+	}
+	if t.Kind() == reflect.Array && rv.Len() != t.Len() {
+		return reflect.Value{}, conversionError(rv.Interface(), t)
+	}
+	out := newSequence(t, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		elem, err := ConvertValue(rv.Index(i).Interface(), t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		out.Index(i).Set(elem)
+	}
+	return out, nil
+}
+
+// newSequence 创建指定长度的切片或 (可寻址的) 数组
+func newSequence(t reflect.Type, n int) reflect.Value {
+	if t.Kind() == reflect.Array {
+		return reflect.New(t).Elem()
+	}
+	return reflect.MakeSlice(t, n, n)
+}
+
+func conversionError(v any, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %s to %s", typeName(reflect.TypeOf(v)), typeName(t))
+}
@@ -0,0 +1,62 @@
+package eval
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// NoSuchPropertyError 属性不存在 (对应 Java OGNL 的 NoSuchPropertyException)
+type NoSuchPropertyError struct {
+	Target reflect.Type
+	Name   string
+}
+
+func (e *NoSuchPropertyError) Error() string {
+	return fmt.Sprintf("no such property %q on %s", e.Name, typeName(e.Target))
+}
+
+// NullSourceError 在 null 上读取或写入属性
+type NullSourceError struct {
+	Op   string // "getProperty" 或 "setProperty"
+	Name string
+}
+
+func (e *NullSourceError) Error() string {
+	return fmt.Sprintf("source is null for %s(null, %q)", e.Op, e.Name)
+}
+
+// EvalError 求值错误，记录出错的 AST 节点
+type EvalError struct {
+	Node ast.Expression
+	Err  error
+}
+
+func (e *EvalError) Error() string {
+	if e.Node == nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s [%s]: %v", e.Node.Type(), e.Node.String(), e.Err)
+}
+
+func (e *EvalError) Unwrap() error { return e.Err }
+
+// wrapError 为错误附加节点信息，已经包装过的错误保持不变，保证报告的是最内层节点
+func wrapError(node ast.Expression, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*EvalError); ok {
+		return err
+	}
+	return &EvalError{Node: node, Err: err}
+}
+
+// typeName 返回类型的可读名称
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return "null"
+	}
+	return t.String()
+}
@@ -0,0 +1,572 @@
+// Package eval 实现 OGNL 表达式的求值 (对应 Java OGNL 的 Ognl.getValue / Ognl.setValue)
+//
+// 求值器直接遍历 ast 包生成的语法树，使用反射访问 Go 对象：
+// 属性按 JavaBean 规则映射到 Go 的字段和方法 (见 property.go)，
+// 运算符遵循 Java OgnlOps 的数值提升和比较规则 (见 ops.go)。
+package eval
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// GetValue 在上下文中对表达式求值，#root 和初始的 #this 都是上下文的根对象
+func GetValue(expr ast.Expression, ctx *Context) (any, error) {
+	return GetValueContext(context.Background(), expr, ctx)
+}
+
+// GetValueContext 与 GetValue 相同，goCtx 结束时求值返回 LimitDeadline 的 BudgetError
+// 正在执行的 Go 方法不会被打断，超时在方法返回后的下一个节点处生效
+func GetValueContext(goCtx context.Context, expr ast.Expression, ctx *Context) (result any, err error) {
+	defer recoverPanic(&err)
+	e := newEvaluator(goCtx, ctx)
+	if err := e.checkDeadline(); err != nil {
+		return nil, err
+	}
+	return e.eval(expr, ctx.Root())
+}
+
+// SetValue 把值写入表达式指向的位置，例如 foo.bar、#var、list[0]、map['key']
+func SetValue(expr ast.Expression, ctx *Context, value any) error {
+	return SetValueContext(context.Background(), expr, ctx, value)
+}
+
+// SetValueContext 与 SetValue 相同，goCtx 结束时返回 LimitDeadline 的 BudgetError
+func SetValueContext(goCtx context.Context, expr ast.Expression, ctx *Context, value any) (err error) {
+	defer recoverPanic(&err)
+	e := newEvaluator(goCtx, ctx)
+	if err := e.checkDeadline(); err != nil {
+		return err
+	}
+	return wrapError(expr, e.assign(expr, ctx.Root(), value))
+}
+
+// evaluator 一次求值的状态
+type evaluator struct {
+	ctx     *Context
+	goCtx   context.Context
+	depth   int      // 当前 lambda 调用深度
+	steps   int      // 已访问的节点数 (执行字节码时是指令数)
+	profile *Profile // 执行字节码时按操作码统计，可以为 nil
+}
+
+func newEvaluator(goCtx context.Context, ctx *Context) *evaluator {
+	return &evaluator{ctx: ctx, goCtx: goCtx}
+}
+
+// eval 对节点求值，source 是当前对象 (#this)
+func (e *evaluator) eval(node ast.Expression, source any) (any, error) {
+	if err := e.step(); err != nil {
+		return nil, wrapError(node, err)
+	}
+	v, err := e.evalNode(node, source)
+	if err != nil {
+		return nil, wrapError(node, err)
+	}
+	return v, nil
+}
+
+func (e *evaluator) evalNode(node ast.Expression, source any) (any, error) {
+	switch n := node.(type) {
+	case nil:
+		return nil, fmt.Errorf("missing expression")
+	case *ast.Literal:
+		return LiteralValue(n), nil
+	case *ast.Identifier:
+		return GetProperty(source, n.Value)
+	case *ast.ThisExpression:
+		return source, nil
+	case *ast.RootExpression:
+		return e.ctx.Root(), nil
+	case *ast.VariableExpression:
+		return e.ctx.variable(n.Name), nil
+	case *ast.ChainExpression:
+		return e.evalChain(n, source)
+	case *ast.IndexExpression:
+		target := source
+		if n.Object != nil {
+			obj, err := e.eval(n.Object, source)
+			if err != nil {
+				return nil, err
+			}
+			target = obj
+		}
+		if sub, ok := ast.DynamicSubscriptOf(n); ok {
+			return dynamicIndex(target, sub, e.ctx.budget.MaxCollectionSize)
+		}
+		index, err := e.evalIndex(n)
+		if err != nil {
+			return nil, err
+		}
+		return GetIndex(target, index)
+	case *ast.DynamicSubscriptExpression:
+		target, err := e.evalObject(n.Object, source)
+		if err != nil {
+			return nil, err
+		}
+		return dynamicIndex(target, n.SubscriptType, e.ctx.budget.MaxCollectionSize)
+	case *ast.ProjectionExpression:
+		target, err := e.evalObject(n.Object, source)
+		if err != nil {
+			return nil, err
+		}
+		return e.project(target, func(elem any) (any, error) { return e.eval(n.Expression, elem) })
+	case *ast.SelectionExpression:
+		target, err := e.evalObject(n.Object, source)
+		if err != nil {
+			return nil, err
+		}
+		return e.selectFrom(target, n.SelectType, func(elem any) (any, error) { return e.eval(n.Expression, elem) })
+	case *ast.BinaryExpression:
+		return e.evalBinary(n, source)
+	case *ast.UnaryExpression:
+		v, err := e.eval(n.Operand, source)
+		if err != nil {
+			return nil, err
+		}
+		return Unary(n.Operator, v)
+	case *ast.ConditionalExpression:
+		test, err := e.eval(n.Test, source)
+		if err != nil {
+			return nil, err
+		}
+		if BooleanValue(test) {
+			return e.eval(n.Consequent, source)
+		}
+		return e.eval(n.Alternative, source)
+	case *ast.AssignmentExpression:
+		value, err := e.eval(n.Right, source)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.assign(n.Left, source, value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	case *ast.SequenceExpression:
+		var result any
+		for _, expr := range n.Expressions {
+			v, err := e.eval(expr, source)
+			if err != nil {
+				return nil, err
+			}
+			result = v
+		}
+		return result, nil
+	case *ast.ArrayExpression:
+		if err := e.checkCollection(len(n.Elements)); err != nil {
+			return nil, err
+		}
+		list := make([]any, 0, len(n.Elements))
+		for _, elem := range n.Elements {
+			v, err := e.eval(elem, source)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case *ast.MapExpression:
+		return e.evalMap(n, source)
+	case *ast.InstanceofExpression:
+		v, err := e.eval(n.Operand, source)
+		if err != nil {
+			return nil, err
+		}
+		return InstanceOf(v, n.TargetType)
+	case *ast.CallExpression:
+		return e.evalCall(n, source)
+	case *ast.StaticMethodExpression:
+		args, err := e.evalArgs(n.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return e.result(callStatic(e.ctx.Registry(), siteCache{n}, n.ClassName, n.Method, args))
+	case *ast.StaticFieldExpression:
+		return GetStaticField(e.ctx.Registry(), n.ClassName, n.Field)
+	case *ast.ConstructorExpression:
+		return e.evalConstructor(n)
+	case *ast.LambdaLiteral:
+		return &Lambda{Body: n.Body}, nil
+	case *ast.LambdaExpression:
+		return &Lambda{Body: n.Body}, nil
+	case *ast.EvalExpression:
+		target, err := e.eval(n.Target, source)
+		if err != nil {
+			return nil, err
+		}
+		return e.evalEval(target, n.Argument, source)
+	}
+	return nil, fmt.Errorf("%s is not supported by the evaluator", node.Type())
+}
+
+// evalObject 计算节点作用的对象，链中的节点没有 Object，作用于当前对象
+func (e *evaluator) evalObject(object ast.Expression, source any) (any, error) {
+	if object == nil {
+		return source, nil
+	}
+	return e.eval(object, source)
+}
+
+// evalIndex 计算下标表达式的值
+// 与 Java OGNL 的 ASTProperty 一致，下标在根对象上求值，而不是在被索引的对象上
+func (e *evaluator) evalIndex(n *ast.IndexExpression) (any, error) {
+	return e.eval(n.Index, e.ctx.Root())
+}
+
+// evalChain 依次对链中的每个子节点求值，前一个结果作为下一个节点的 #this (对应 ASTChain)
+func (e *evaluator) evalChain(n *ast.ChainExpression, source any) (any, error) {
+	cur := source
+	for i := 0; i < len(n.Children); i++ {
+		child := n.Children[i]
+		// 属性后紧跟下标时，优先尝试索引属性 getValues(int) / getAttribute(String)
+		if id, ok := child.(*ast.Identifier); ok && i+1 < len(n.Children) {
+			if idx, ok := n.Children[i+1].(*ast.IndexExpression); ok && idx.Object == nil &&
+				!isDynamicSubscript(idx) && IndexedPropertyKind(cur, id.Value) != NotIndexed {
+				index, err := e.evalIndex(idx)
+				if err != nil {
+					return nil, err
+				}
+				v, _, err := getIndexedProperty(cur, id.Value, index)
+				if err != nil {
+					return nil, wrapError(idx, err)
+				}
+				cur = v
+				i++
+				continue
+			}
+		}
+		v, err := e.eval(child, cur)
+		if err != nil {
+			return nil, err
+		}
+		cur = v
+	}
+	return cur, nil
+}
+
+func isDynamicSubscript(idx *ast.IndexExpression) bool {
+	_, ok := ast.DynamicSubscriptOf(idx)
+	return ok
+}
+
+// evalBinary 二元运算，&& 和 || 短路求值并返回操作数本身 (与 Java OGNL 一致)
+func (e *evaluator) evalBinary(n *ast.BinaryExpression, source any) (any, error) {
+	left, err := e.eval(n.Left, source)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Operator {
+	case ast.AND:
+		if !BooleanValue(left) {
+			return left, nil
+		}
+		return e.eval(n.Right, source)
+	case ast.OR:
+		if BooleanValue(left) {
+			return left, nil
+		}
+		return e.eval(n.Right, source)
+	}
+	right, err := e.eval(n.Right, source)
+	if err != nil {
+		return nil, err
+	}
+	return e.binary(n.Operator, left, right)
+}
+
+// binary 计算非短路的二元运算，检查拼接得到的字符串长度
+func (e *evaluator) binary(op ast.TokenType, left, right any) (any, error) {
+	v, err := Binary(op, left, right)
+	if err != nil {
+		return nil, err
+	}
+	return v, e.checkString(v)
+}
+
+// project 对 target 做投影，结果列表的长度受预算限制 (迭代器可能是无限的，逐个检查)
+func (e *evaluator) project(target any, fn func(elem any) (any, error)) (any, error) {
+	count := 0
+	return Project(target, func(elem any) (any, error) {
+		count++
+		if err := e.checkCollection(count); err != nil {
+			return nil, err
+		}
+		return fn(elem)
+	})
+}
+
+// selectFrom 对 target 做选择并检查结果列表的长度
+func (e *evaluator) selectFrom(target any, selectType string, test func(elem any) (any, error)) (any, error) {
+	selected, err := Select(target, selectType, test)
+	if err != nil {
+		return nil, err
+	}
+	return selected, e.checkCollection(len(selected))
+}
+
+// evalMap 构造 Map 字面量 #{ k : v }
+func (e *evaluator) evalMap(n *ast.MapExpression, source any) (any, error) {
+	if err := e.checkCollection(len(n.Pairs)); err != nil {
+		return nil, err
+	}
+	m := make(map[any]any, len(n.Pairs))
+	for _, pair := range n.Pairs {
+		kv, ok := pair.(*ast.KeyValueExpression)
+		if !ok {
+			return nil, fmt.Errorf("unexpected %s in map literal", pair.Type())
+		}
+		key, err := e.eval(kv.Key, source)
+		if err != nil {
+			return nil, err
+		}
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, wrapError(kv.Key, fmt.Errorf("%s cannot be used as a map key", typeName(reflect.TypeOf(key))))
+		}
+		var value any
+		if kv.Value != nil {
+			value, err = e.eval(kv.Value, source)
+			if err != nil {
+				return nil, err
+			}
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// =============================================================================
+// 方法调用和构造器
+// =============================================================================
+
+// evalArgs 计算方法参数，与 Java OGNL 的 ASTMethod 一致，参数在根对象上求值
+func (e *evaluator) evalArgs(nodes []ast.Expression) ([]any, error) {
+	args := make([]any, len(nodes))
+	for i, node := range nodes {
+		v, err := e.eval(node, e.ctx.Root())
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+// evalCall 方法调用，链中的方法以前一个结果为接收者，单独的方法以当前对象为接收者
+func (e *evaluator) evalCall(n *ast.CallExpression, source any) (any, error) {
+	if n.Method == "" {
+		// 链中不可求值的节点后面紧跟 (arg)，以前一个结果为目标求值，等同于 ASTEval
+		var argument ast.Expression
+		if len(n.Arguments) > 0 {
+			argument = n.Arguments[0]
+		}
+		return e.evalEval(source, argument, source)
+	}
+	recv := source
+	if n.Object != nil {
+		obj, err := e.eval(n.Object, source)
+		if err != nil {
+			return nil, err
+		}
+		recv = obj
+	}
+	args, err := e.evalArgs(n.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	return e.result(callMethod(e.ctx.Registry(), siteCache{n}, recv, n.Method, args))
+}
+
+// result 检查方法调用和构造器的结果是否超出预算
+func (e *evaluator) result(v any, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkResult(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// evalConstructor new Foo(args)、new int[n] 和 new String[]{...}
+func (e *evaluator) evalConstructor(n *ast.ConstructorExpression) (any, error) {
+	registry := e.ctx.Registry()
+	if !n.IsArray {
+		args, err := e.evalArgs(n.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return e.result(construct(registry, siteCache{n}, n.ClassName, args))
+	}
+	if len(n.Arguments) == 0 {
+		return NewArray(registry, n.ClassName, 0, nil)
+	}
+	if init, ok := n.Arguments[0].(*ast.ArrayExpression); ok {
+		if err := e.checkCollection(len(init.Elements)); err != nil {
+			return nil, err
+		}
+		elems, err := e.evalArgs(init.Elements)
+		if err != nil {
+			return nil, err
+		}
+		return NewArray(registry, n.ClassName, 0, elems)
+	}
+	size, err := e.eval(n.Arguments[0], e.ctx.Root())
+	if err != nil {
+		return nil, err
+	}
+	return e.newSizedArray(registry, n.ClassName, size)
+}
+
+// newSizedArray new int[size]，数组长度受预算限制
+func (e *evaluator) newSizedArray(registry *Registry, className string, size any) (any, error) {
+	length, err := longValue(size)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkCollection(int(min(length, 1<<31))); err != nil {
+		return nil, err
+	}
+	return NewArray(registry, className, int(length), nil)
+}
+
+// =============================================================================
+// 赋值
+// =============================================================================
+
+// assign 把 value 写入 target 指向的位置，source 是当前对象
+func (e *evaluator) assign(target ast.Expression, source any, value any) error {
+	switch t := target.(type) {
+	case *ast.VariableExpression:
+		e.ctx.Set(t.Name, value)
+		return nil
+	case *ast.Identifier:
+		return SetProperty(source, t.Value, value)
+	case *ast.IndexExpression:
+		obj := source
+		if t.Object != nil {
+			v, err := e.eval(t.Object, source)
+			if err != nil {
+				return err
+			}
+			obj = v
+		}
+		if sub, ok := ast.DynamicSubscriptOf(t); ok {
+			return wrapError(t, SetDynamicIndex(obj, sub, value))
+		}
+		index, err := e.evalIndex(t)
+		if err != nil {
+			return err
+		}
+		return wrapError(t, SetIndex(obj, index, value))
+	case *ast.ChainExpression:
+		return e.assignChain(t, source, value)
+	case *ast.RootExpression:
+		e.ctx.SetRoot(value)
+		return nil
+	case nil:
+		return fmt.Errorf("missing assignment target")
+	}
+	return fmt.Errorf("cannot assign to %s", target.Type())
+}
+
+// assignChain 对链中除最后一个节点外的部分求值，再把值写入最后一个节点
+func (e *evaluator) assignChain(n *ast.ChainExpression, source any, value any) error {
+	children := n.Children
+	if len(children) == 0 {
+		return fmt.Errorf("cannot assign to empty chain")
+	}
+	last := len(children) - 1
+
+	// foo.values[2] = v 优先使用索引属性的 setter，否则先读取 values 再写下标
+	if idx, ok := children[last].(*ast.IndexExpression); ok && idx.Object == nil && last > 0 {
+		if id, ok := children[last-1].(*ast.Identifier); ok {
+			owner, err := e.evalPrefix(children[:last-1], source)
+			if err != nil {
+				return err
+			}
+			if !isDynamicSubscript(idx) && IndexedPropertyKind(owner, id.Value) != NotIndexed {
+				index, err := e.evalIndex(idx)
+				if err != nil {
+					return err
+				}
+				if handled, err := setIndexedProperty(owner, id.Value, index, value); handled {
+					return wrapError(idx, err)
+				}
+			}
+			obj, err := e.eval(id, owner)
+			if err != nil {
+				return err
+			}
+			return e.assign(idx, obj, value)
+		}
+	}
+
+	owner, err := e.evalPrefix(children[:last], source)
+	if err != nil {
+		return err
+	}
+	return wrapError(children[last], e.assign(children[last], owner, value))
+}
+
+// evalPrefix 对链的前缀求值，空前缀的结果是当前对象
+func (e *evaluator) evalPrefix(children []ast.Expression, source any) (any, error) {
+	if len(children) == 0 {
+		return source, nil
+	}
+	return e.evalChain(&ast.ChainExpression{Children: children}, source)
+}
+
+// =============================================================================
+// 字面量
+// =============================================================================
+
+// LiteralValue 把字面量转换为与 Java 一致的运行时值
+// 整数默认是 int32 (Java int)，超出范围时为 int64；后缀 L 为 int64，H 为 *big.Int；
+// 浮点数默认是 float64，后缀 F 为 float32，B 为 *big.Float；单引号单字符为 Char
+func LiteralValue(l *ast.Literal) any {
+	raw := l.Raw
+	suffix := byte(0)
+	if raw != "" {
+		suffix = raw[len(raw)-1]
+	}
+	switch v := l.Value.(type) {
+	case int64:
+		switch suffix {
+		case 'l', 'L':
+			return v
+		case 'h', 'H':
+			if b, ok := new(big.Int).SetString(raw[:len(raw)-1], 0); ok {
+				return b
+			}
+			return big.NewInt(v)
+		}
+		if v >= -1<<31 && v < 1<<31 {
+			return int32(v)
+		}
+		return v
+	case float64:
+		switch suffix {
+		case 'f', 'F':
+			return float32(v)
+		case 'b', 'B':
+			digits := strings.TrimSuffix(raw[:len(raw)-1], ".")
+			if f, ok := new(big.Float).SetPrec(bigDecPrec).SetString(digits); ok {
+				return f
+			}
+			return new(big.Float).SetPrec(bigDecPrec).SetFloat64(v)
+		}
+		return v
+	case int32:
+		if strings.HasPrefix(raw, "'") {
+			return Char(v)
+		}
+		return v
+	}
+	return l.Value
+}
@@ -0,0 +1,192 @@
+package eval
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// parse 解析表达式，失败时终止测试
+func parse(t testing.TB, input string) ast.Expression {
+	t.Helper()
+	p := ast.New(ast.NewLexer(input))
+	expr, err := p.ParseTopLevelExpression()
+	if err != nil {
+		t.Fatalf("parse %q: %v", input, err)
+	}
+	return expr
+}
+
+// getValue 解析并求值
+func getValue(t *testing.T, input string, ctx *Context) (any, error) {
+	t.Helper()
+	return GetValue(parse(t, input), ctx)
+}
+
+func TestLiteralsAndOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"1 + 2", int32(3)},
+		{"1L + 2", int64(3)},
+		{"2 * 3.0", 6.0},
+		{"1.5f + 1", 2.5},
+		{"1.5f + 1.5f", float32(3)},
+		{"7 / 2", int32(3)},
+		{"7 % 4", int32(3)},
+		{"-5", int32(-5)},
+		{"~5", int32(-6)},
+		{"!true", false},
+		{"'a'", Char('a')},
+		{"'abc'", "abc"},
+		{"\"x\" + 1", "x1"},
+		{"'a' + 1", "a1"},
+		{"null + \"x\"", "nullx"},
+		{"1 << 3", int32(8)},
+		{"-16 >> 2", int32(-4)},
+		{"-1 >>> 28", int32(15)},
+		{"5 & 3", int32(1)},
+		{"5 | 3", int32(7)},
+		{"5 ^ 3", int32(6)},
+		{"1 == 1L", true},
+		{"1 == 1.0", true},
+		{"\"a\" < \"b\"", true},
+		{"3 gte 3", true},
+		{"2 in {1, 2, 3}", true},
+		{"4 not in {1, 2, 3}", true},
+		{"true ? 1 : 2", int32(1)},
+		{"0 ? 1 : 2", int32(2)},
+		{"null && true", nil},
+		{"0 || \"b\"", "b"},
+		{"1, 2, 3", int32(3)},
+		{"{1, 2}.length", 2},
+		{"1.0 + 2", 3.0},
+		{"\"\" + 1.0", "1.0"},
+		{"\"\" + 1e10", "1.0E10"},
+		{"\"5\" * 2", 10.0},
+		{"\"foo\" instanceof String", true},
+		{"1 instanceof java.lang.Number", true},
+		{"1L instanceof Integer", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := getValue(t, tt.input, NewContext(nil))
+			if err != nil {
+				t.Fatalf("GetValue(%q) error: %v", tt.input, err)
+			}
+			if v != tt.expected {
+				t.Errorf("GetValue(%q) = %#v, want %#v", tt.input, v, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBigNumbers(t *testing.T) {
+	v, err := getValue(t, "10h * 3", NewContext(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := v.(*big.Int); !ok || b.Int64() != 30 {
+		t.Errorf("10h * 3 = %#v, want BigInteger 30", v)
+	}
+
+	v, err = getValue(t, "1.5b + 1", NewContext(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := v.(*big.Float); !ok || StringValue(f) != "2.5" {
+		t.Errorf("1.5b + 1 = %#v, want BigDecimal 2.5", v)
+	}
+}
+
+func TestDivideByZero(t *testing.T) {
+	_, err := getValue(t, "1 / 0", NewContext(nil))
+	if !errors.Is(err, ErrDivideByZero) {
+		t.Fatalf("expected ErrDivideByZero, got %v", err)
+	}
+	var evalErr *EvalError
+	if !errors.As(err, &evalErr) || evalErr.Node.Type() != "ASTDivide" {
+		t.Errorf("error should point at the ASTDivide node, got %v", err)
+	}
+}
+
+func TestVariablesAndAssignment(t *testing.T) {
+	ctx := NewContext(nil)
+	ctx.Set("x", 10)
+
+	v, err := getValue(t, "#a = #x + 1, #b = #a * 2, #b", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != int64(22) {
+		t.Errorf("got %#v, want 22", v)
+	}
+	if a, _ := ctx.Get("a"); a != int64(11) {
+		t.Errorf("#a = %#v, want 11", a)
+	}
+
+	v, err = getValue(t, "#undefined", ctx)
+	if err != nil || v != nil {
+		t.Errorf("undefined variable should be null, got %#v, %v", v, err)
+	}
+
+	if _, err := getValue(t, "#context['y'] = \"z\"", ctx); err != nil {
+		t.Fatal(err)
+	}
+	if y, _ := ctx.Get("y"); y != "z" {
+		t.Errorf("#context['y'] should write the variable, got %#v", y)
+	}
+}
+
+func TestCollectionsAndMaps(t *testing.T) {
+	ctx := NewContext(map[string]any{
+		"list": []int{1, 2, 3},
+		"map":  map[string]int{"a": 1},
+	})
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"list[1]", 2},
+		{"list.size", 3},
+		{"list.isEmpty", false},
+		{"map.a", 1},
+		{"map['a']", 1},
+		{"map.size", 1},
+		{"map.missing", nil},
+		{"#{\"k\" : \"v\"}[\"k\"]", "v"},
+		{"{1, 2, 3}[2]", int32(3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := getValue(t, tt.input, ctx)
+			if err != nil {
+				t.Fatalf("GetValue(%q) error: %v", tt.input, err)
+			}
+			if v != tt.expected {
+				t.Errorf("GetValue(%q) = %#v, want %#v", tt.input, v, tt.expected)
+			}
+		})
+	}
+
+	if _, err := getValue(t, "list[5]", ctx); err == nil {
+		t.Error("expected out of bounds error")
+	}
+	if err := SetValue(parse(t, "list[0]"), ctx, "42"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := getValue(t, "list[0]", ctx); v != 42 {
+		t.Errorf("list[0] = %#v after SetValue, want 42", v)
+	}
+}
+
+func TestNullSource(t *testing.T) {
+	_, err := getValue(t, "foo.bar", NewContext(map[string]any{"foo": nil}))
+	var nullErr *NullSourceError
+	if !errors.As(err, &nullErr) || nullErr.Name != "bar" {
+		t.Fatalf("expected NullSourceError for bar, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// DefaultMaxCallDepth 默认的最大 lambda 调用深度
+const DefaultMaxCallDepth = 256
+
+// Lambda lambda 表达式 :[body] 的值
+// 调用时参数同时成为 #this 和 #root，lambda 体可以读写上下文变量，
+// 因此可以通过保存自身的变量递归调用，例如 #fact = :[... #fact(#this - 1) ...]
+type Lambda struct {
+	Body ast.Expression
+	run  compiled  // 编译后的程序中创建的 lambda 带有编译好的 lambda 体
+	code *Function // 字节码中创建的 lambda 带有 lambda 体的字节码
+}
+
+func (l *Lambda) String() string { return ":[" + l.Body.String() + "]" }
+
+// Call 以 arg 为参数在上下文中调用 lambda
+func (l *Lambda) Call(ctx *Context, arg any) (any, error) {
+	return newEvaluator(context.Background(), ctx).call(l, arg)
+}
+
+// CallDepthError lambda 调用深度超过上限，通常是没有终止条件的递归
+// 求值返回的是包装了 CallDepthError 的 BudgetError，两者都可以用 errors.As 取得
+type CallDepthError struct {
+	Max int
+}
+
+func (e *CallDepthError) Error() string {
+	return fmt.Sprintf("maximum call depth %d exceeded", e.Max)
+}
+
+// evalEval 对 (target)(argument) 求值 (对应 ASTEval)，参数在当前对象上求值
+func (e *evaluator) evalEval(target any, argument ast.Expression, source any) (any, error) {
+	var arg any
+	if argument != nil {
+		v, err := e.eval(argument, source)
+		if err != nil {
+			return nil, err
+		}
+		arg = v
+	}
+	return e.call(target, arg)
+}
+
+// call 以 arg 为 #this 和 #root 执行 target
+// target 是 lambda 时执行 lambda 体；否则与 Java OGNL 一致，把 target 的字符串形式当作表达式解析后执行
+func (e *evaluator) call(target any, arg any) (any, error) {
+	var (
+		body ast.Expression
+		run  compiled
+		code *Function
+	)
+	switch t := target.(type) {
+	case *Lambda:
+		body, run, code = t.Body, t.run, t.code
+	case nil:
+		return nil, fmt.Errorf("cannot evaluate null")
+	default:
+		expr, err := parseExpression(StringValue(target))
+		if err != nil {
+			return nil, err
+		}
+		body = expr
+	}
+
+	max := e.maxCallDepth()
+	if e.depth >= max {
+		return nil, &BudgetError{Limit: LimitCallDepth, Max: max, Err: &CallDepthError{Max: max}}
+	}
+	e.depth++
+	prevRoot := e.ctx.Root()
+	e.ctx.SetRoot(arg)
+	defer func() {
+		e.depth--
+		e.ctx.SetRoot(prevRoot)
+	}()
+	switch {
+	case code != nil:
+		return e.exec(code, arg)
+	case run != nil:
+		return run(e, arg)
+	}
+	return e.eval(body, arg)
+}
+
+// parseExpression 解析字符串形式的表达式
+func parseExpression(input string) (ast.Expression, error) {
+	p := ast.New(ast.NewLexer(input))
+	expr, err := p.ParseTopLevelExpression()
+	if err != nil {
+		return nil, err
+	}
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, fmt.Errorf("parse %q: %s", input, errs[0])
+	}
+	if expr == nil {
+		return nil, fmt.Errorf("parse %q: empty expression", input)
+	}
+	return expr, nil
+}
@@ -0,0 +1,77 @@
+package eval
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLambda(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{":[#this * 2](5)", int32(10)},
+		{"#fact = :[#this <= 1 ? 1 : #fact(#this - 1) * #this], #fact(10)", int32(3628800)},
+		{"#fact = :[#this <= 1 ? 1 : #fact(#this - 1) * #this], #fact(20L)", int64(2432902008176640000)},
+		{"#base = 10, #add = :[#this + #base], #add(5)", int32(15)}, // 读取外层的上下文变量
+		{"#add = :[#this + #base], #base = 1, #add(5)", int32(6)},   // 调用时读取变量的当前值
+		{"#set = :[#counter = #this], #set(3), #counter", int32(3)}, // lambda 体写入上下文变量
+		{"#double = :[#this * 2], {1, 2}.{#double(#this)}", []any{int32(2), int32(4)}},
+		{":[#root](7)", int32(7)},                      // 参数同时是 #root
+		{"#f = :[#this], #f(1), #root", "root"},        // 调用结束后恢复 #root
+		{"#expr = \"#this * 3\", #expr(4)", int32(12)}, // 字符串被解析为表达式
+		{"(\"1 + 2\")(0)", int32(3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := getValue(t, tt.input, NewContext("root"))
+			if err != nil {
+				t.Fatalf("GetValue(%q) error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(v, tt.expected) {
+				t.Errorf("GetValue(%q) = %#v, want %#v", tt.input, v, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLambdaCallDepth(t *testing.T) {
+	ctx := NewContext(nil)
+	ctx.SetMaxCallDepth(10)
+	_, err := getValue(t, "#f = :[#f(#this)], #f(1)", ctx)
+	var depthErr *CallDepthError
+	if !errors.As(err, &depthErr) || depthErr.Max != 10 {
+		t.Fatalf("expected CallDepthError, got %v", err)
+	}
+
+	// 深度限制以内的递归正常执行
+	v, err := getValue(t, "#count = :[#this <= 0 ? 0 : #count(#this - 1) + 1], #count(9)", ctx)
+	if err != nil || v != int32(9) {
+		t.Errorf("#count(9) = %#v, %v", v, err)
+	}
+
+	// 默认深度限制同样能拦截无限递归
+	_, err = getValue(t, "#f = :[#f(#this)], #f(1)", NewContext(nil))
+	if !errors.As(err, &depthErr) || depthErr.Max != DefaultMaxCallDepth {
+		t.Errorf("expected CallDepthError with the default limit, got %v", err)
+	}
+}
+
+func TestLambdaCall(t *testing.T) {
+	ctx := NewContext(nil)
+	v, err := getValue(t, ":[#this + 1]", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, ok := v.(*Lambda)
+	if !ok {
+		t.Fatalf("lambda literal should evaluate to *Lambda, got %T", v)
+	}
+	if got, err := l.Call(ctx, 41); err != nil || got != int64(42) {
+		t.Errorf("Call(41) = %#v, %v", got, err)
+	}
+	if _, err := getValue(t, "#missing(1)", ctx); err == nil {
+		t.Error("expected error when evaluating null")
+	}
+}
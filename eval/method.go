@@ -0,0 +1,523 @@
+package eval
+
+// 方法调用 - 对应 Java OGNL 的 OgnlRuntime.callMethod / callStaticMethod / callConstructor
+//
+// 候选方法的来源 (按优先级分层，前一层有可用的候选时不再查找后面的层)：
+//   1. 接收者的 Go 方法，Java 方法名首字母大写后匹配，例如 getName() -> GetName()
+//   2. 注册表中为接收者类型注册的扩展方法
+//   3. 为接收者种类 (字符串、切片、map……) 注册的扩展方法
+//   4. 为所有数值注册的方法 (java.lang.Number)
+//   5. 为所有对象注册的方法 (java.lang.Object)
+// 都找不到时，无参的 getX()/isX() 和单参数的 setX(v) 退化为属性读写。
+//
+// 同一层中的候选按参数的转换代价打分，代价最小的胜出；
+// 代价相同的多个候选返回 AmbiguousMethodError。
+// 可变参数的候选只有在没有固定参数个数的候选可用时才会被选中 (与 Java 的第三阶段一致)。
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// NoSuchMethodError 没有可用的方法 (对应 Java 的 NoSuchMethodException)
+type NoSuchMethodError struct {
+	Target string // 接收者类型或类名
+	Name   string
+	Args   []any
+}
+
+func (e *NoSuchMethodError) Error() string {
+	return fmt.Sprintf("no applicable method %s(%s) on %s", e.Name, argTypeNames(e.Args), e.Target)
+}
+
+// AmbiguousMethodError 多个候选方法的转换代价相同，无法确定调用哪一个
+type AmbiguousMethodError struct {
+	Target     string
+	Name       string
+	Args       []any
+	Candidates []string // 代价相同的候选方法签名
+}
+
+func (e *AmbiguousMethodError) Error() string {
+	return fmt.Sprintf("ambiguous call to %s(%s) on %s: %s", e.Name, argTypeNames(e.Args), e.Target,
+		strings.Join(e.Candidates, " and "))
+}
+
+func argTypeNames(args []any) string {
+	names := make([]string, len(args))
+	for i, arg := range args {
+		names[i] = typeName(reflect.TypeOf(arg))
+	}
+	return strings.Join(names, ", ")
+}
+
+// =============================================================================
+// 转换代价
+// =============================================================================
+
+// 参数转换代价，数值越小越匹配
+const (
+	costExact     = 0    // 类型完全相同
+	costAssign    = 1    // 可以直接赋值 (例如具体类型赋给同名的底层类型)
+	costWiden     = 1    // 数值拓宽，另加类型等级差
+	costInterface = 10   // 传给接口参数，空接口 any 最宽泛
+	costNarrow    = 30   // 数值收窄，另加类型等级差
+	costConvert   = 50   // 需要经过 ConvertValue 转换 (例如字符串解析为数值)
+	costVarArgs   = 1000 // 使用可变参数
+)
+
+// argCost 返回把 arg 传给 t 类型参数的代价，-1 表示无法传递
+func argCost(arg any, t reflect.Type) int {
+	if arg == nil {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return costAssign
+		}
+		return costConvert
+	}
+	at := reflect.TypeOf(arg)
+	if at == t {
+		return costExact
+	}
+	if t.Kind() == reflect.Interface {
+		if !at.Implements(t) {
+			return -1
+		}
+		if t.NumMethod() == 0 {
+			return costInterface
+		}
+		return costInterface / 2
+	}
+	if at.AssignableTo(t) {
+		return costAssign
+	}
+	from, to := numericType(arg), numericType(reflect.Zero(t).Interface())
+	if from != numNonNumeric && to != numNonNumeric && from != numBool && to != numBool {
+		if to >= from {
+			return costWiden + to - from
+		}
+		return costNarrow + from - to
+	}
+	if _, err := ConvertValue(arg, t); err == nil {
+		return costConvert
+	}
+	return -1
+}
+
+// callCost 返回用 args 调用 fn 的总代价，-1 表示参数不匹配
+func callCost(ft reflect.Type, args []any) int {
+	n := ft.NumIn()
+	if !ft.IsVariadic() {
+		if len(args) != n {
+			return -1
+		}
+		return sumCost(args, func(i int) reflect.Type { return ft.In(i) })
+	}
+	fixed := n - 1
+	if len(args) < fixed {
+		return -1
+	}
+	if spreadArray(ft, args) {
+		return sumCost(args, func(i int) reflect.Type { return ft.In(i) })
+	}
+	elem := ft.In(fixed).Elem()
+	cost := sumCost(args, func(i int) reflect.Type {
+		if i < fixed {
+			return ft.In(i)
+		}
+		return elem
+	})
+	if cost < 0 {
+		return -1
+	}
+	return cost + costVarArgs
+}
+
+func sumCost(args []any, param func(i int) reflect.Type) int {
+	total := 0
+	for i, arg := range args {
+		c := argCost(arg, param(i))
+		if c < 0 {
+			return -1
+		}
+		total += c
+	}
+	return total
+}
+
+// spreadArray 判断最后一个实参是否直接作为可变参数的数组传入，例如 foo(new String[]{"a"})
+func spreadArray(ft reflect.Type, args []any) bool {
+	n := ft.NumIn()
+	if len(args) != n || args[n-1] == nil {
+		return false
+	}
+	return reflect.TypeOf(args[n-1]).AssignableTo(ft.In(n - 1))
+}
+
+// =============================================================================
+// 候选方法的选择与调用
+// =============================================================================
+
+// candidate 一个候选方法，Go 方法以方法表达式的形式保存，接收者是第一个参数
+type candidate struct {
+	fn   reflect.Value
+	name string // Java 方法名，用于错误信息
+}
+
+func (c candidate) signature() string {
+	ft := c.fn.Type()
+	params := make([]string, ft.NumIn())
+	for i := range params {
+		params[i] = typeName(ft.In(i))
+		if ft.IsVariadic() && i == len(params)-1 {
+			params[i] = "..." + typeName(ft.In(i).Elem())
+		}
+	}
+	return fmt.Sprintf("%s(%s)", c.name, strings.Join(params, ", "))
+}
+
+// selectCandidate 在一层候选中选出代价最小的方法，没有可用的候选时 ok 为 false
+func selectCandidate(target string, name string, cands []candidate, args []any, shown []any) (best candidate, ok bool, err error) {
+	bestCost := -1
+	var tied []candidate
+	for _, c := range cands {
+		cost := callCost(c.fn.Type(), args)
+		switch {
+		case cost < 0:
+		case bestCost < 0 || cost < bestCost:
+			best, bestCost, tied = c, cost, nil
+		case cost == bestCost:
+			tied = append(tied, c)
+		}
+	}
+	if bestCost < 0 {
+		return candidate{}, false, nil
+	}
+	if len(tied) > 0 {
+		sigs := []string{best.signature()}
+		for _, c := range tied {
+			sigs = append(sigs, c.signature())
+		}
+		return candidate{}, true, &AmbiguousMethodError{Target: target, Name: name, Args: shown, Candidates: sigs}
+	}
+	return best, true, nil
+}
+
+// invoke 转换参数并调用候选方法
+func invoke(c candidate, args []any) (any, error) {
+	ft := c.fn.Type()
+	n := ft.NumIn()
+	in := make([]reflect.Value, len(args))
+	spread := ft.IsVariadic() && spreadArray(ft, args)
+	for i, arg := range args {
+		var t reflect.Type
+		switch {
+		case !ft.IsVariadic() || i < n-1 || spread:
+			t = ft.In(i)
+		default:
+			t = ft.In(n - 1).Elem()
+		}
+		v, err := ConvertValue(arg, t)
+		if err != nil {
+			return nil, err
+		}
+		in[i] = v
+	}
+	out, err := callSafely(c.fn, in, spread)
+	if err != nil {
+		return nil, err
+	}
+	return callResult(ft, out)
+}
+
+// =============================================================================
+// 调用点缓存
+// =============================================================================
+
+// methodCache 调用点缓存，记录某个调用点上次为接收者类型和参数类型选中的方法
+type methodCache interface {
+	load(registry *Registry, recv reflect.Type, args []any) (candidate, bool)
+	store(registry *Registry, recv reflect.Type, args []any, c candidate)
+}
+
+// cachedCall 调用点上次选中的方法，注册表、接收者类型和参数类型都相同时直接复用
+type cachedCall struct {
+	registry *Registry
+	recv     reflect.Type
+	args     []reflect.Type
+	cand     candidate
+}
+
+func newCachedCall(registry *Registry, recv reflect.Type, args []any, c candidate) *cachedCall {
+	types := make([]reflect.Type, len(args))
+	for i, arg := range args {
+		types[i] = reflect.TypeOf(arg)
+	}
+	return &cachedCall{registry: registry, recv: recv, args: types, cand: c}
+}
+
+func (c *cachedCall) matches(registry *Registry, recv reflect.Type, args []any) bool {
+	if c == nil || c.registry != registry || c.recv != recv || len(c.args) != len(args) {
+		return false
+	}
+	for i, arg := range args {
+		if reflect.TypeOf(arg) != c.args[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// siteCache 解释执行时使用的调用点缓存，以 AST 节点为调用点，保存在全局的 callCache 中
+type siteCache struct {
+	node ast.Expression
+}
+
+// callSite 全局缓存的键
+type callSite struct {
+	node     ast.Expression
+	recv     reflect.Type
+	registry *Registry
+}
+
+// maxCachedCalls 全局缓存的调用点上限，超过后清空，避免反复解析新表达式时无限增长
+const maxCachedCalls = 4096
+
+// callCache 各调用点选中的方法，可以被多个 goroutine 共享
+var callCache = struct {
+	sync.RWMutex
+	calls map[callSite]*cachedCall
+}{calls: map[callSite]*cachedCall{}}
+
+func (s siteCache) load(registry *Registry, recv reflect.Type, args []any) (candidate, bool) {
+	callCache.RLock()
+	entry := callCache.calls[callSite{node: s.node, recv: recv, registry: registry}]
+	callCache.RUnlock()
+	if !entry.matches(registry, recv, args) {
+		return candidate{}, false
+	}
+	return entry.cand, true
+}
+
+func (s siteCache) store(registry *Registry, recv reflect.Type, args []any, c candidate) {
+	entry := newCachedCall(registry, recv, args, c)
+	callCache.Lock()
+	if len(callCache.calls) >= maxCachedCalls {
+		callCache.calls = map[callSite]*cachedCall{}
+	}
+	callCache.calls[callSite{node: s.node, recv: recv, registry: registry}] = entry
+	callCache.Unlock()
+}
+
+// inlineCache 编译后的调用点上的单态内联缓存，只保存最近一次选中的方法，无锁读取
+type inlineCache struct {
+	entry atomic.Pointer[cachedCall]
+}
+
+func (ic *inlineCache) load(registry *Registry, recv reflect.Type, args []any) (candidate, bool) {
+	entry := ic.entry.Load()
+	if !entry.matches(registry, recv, args) {
+		return candidate{}, false
+	}
+	return entry.cand, true
+}
+
+func (ic *inlineCache) store(registry *Registry, recv reflect.Type, args []any, c candidate) {
+	ic.entry.Store(newCachedCall(registry, recv, args, c))
+}
+
+// =============================================================================
+// 实例方法、静态方法和构造器
+// =============================================================================
+
+// CallMethod 在 source 上调用方法 (对应 OgnlRuntime.callMethod)
+func CallMethod(registry *Registry, source any, name string, args []any) (any, error) {
+	return callMethod(registry, nil, source, name, args)
+}
+
+// callMethod cache 为 nil 时不使用调用点缓存
+func callMethod(registry *Registry, cache methodCache, source any, name string, args []any) (any, error) {
+	if isNil(source) {
+		return nil, &NullSourceError{Op: "callMethod", Name: name}
+	}
+	recv := receiver(reflect.ValueOf(source))
+	// Go 方法和扩展方法的接收者都作为第一个参数传入
+	full := append([]any{recv.Interface()}, args...)
+	if cache != nil {
+		if c, ok := cache.load(registry, recv.Type(), full); ok {
+			return invoke(c, full)
+		}
+	}
+
+	target := typeName(recv.Type())
+	for _, tier := range methodTiers(registry, recv, name) {
+		c, ok, err := selectCandidate(target, name, tier, full, args)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if cache != nil {
+				cache.store(registry, recv.Type(), full, c)
+			}
+			return invoke(c, full)
+		}
+	}
+
+	// JavaBean 风格的访问器退化为属性读写，Go 的模型不必为每个属性写 getter
+	if prop, ok := accessorProperty(name, "get", "is"); ok && len(args) == 0 {
+		return GetProperty(source, prop)
+	}
+	if prop, ok := accessorProperty(name, "set"); ok && len(args) == 1 {
+		return nil, SetProperty(source, prop, args[0])
+	}
+	return nil, &NoSuchMethodError{Target: target, Name: name, Args: args}
+}
+
+// methodTiers 按优先级列出接收者的候选方法
+func methodTiers(registry *Registry, recv reflect.Value, name string) [][]candidate {
+	var tiers [][]candidate
+	if m, ok := recv.Type().MethodByName(capitalize(name)); ok {
+		tiers = append(tiers, []candidate{{fn: m.Func, name: name}})
+	}
+	for _, fns := range registry.extensionTiers(recv, name) {
+		tiers = append(tiers, candidates(name, fns))
+	}
+	return tiers
+}
+
+func candidates(name string, fns []reflect.Value) []candidate {
+	cands := make([]candidate, len(fns))
+	for i, fn := range fns {
+		cands[i] = candidate{fn: fn, name: name}
+	}
+	return cands
+}
+
+// accessorProperty 从 getFoo / isFoo / setFoo 中取出属性名 foo
+func accessorProperty(name string, prefixes ...string) (string, bool) {
+	for _, prefix := range prefixes {
+		if len(name) > len(prefix) && strings.HasPrefix(name, prefix) {
+			rest := name[len(prefix):]
+			if first := rest[0]; first >= 'A' && first <= 'Z' {
+				return strings.ToLower(rest[:1]) + rest[1:], true
+			}
+		}
+	}
+	return "", false
+}
+
+// CallStaticMethod 调用类的静态方法 (对应 OgnlRuntime.callStaticMethod)
+func CallStaticMethod(registry *Registry, className, name string, args []any) (any, error) {
+	return callStatic(registry, nil, className, name, args)
+}
+
+func callStatic(registry *Registry, cache methodCache, className, name string, args []any) (any, error) {
+	class, err := registry.Class(className)
+	if err != nil {
+		return nil, err
+	}
+	return callOverloaded(registry, cache, class.Name, name, candidates(name, class.methods[name]), args)
+}
+
+// NewInstance 调用类的构造器 (对应 OgnlRuntime.callConstructor)
+func NewInstance(registry *Registry, className string, args []any) (any, error) {
+	return construct(registry, nil, className, args)
+}
+
+func construct(registry *Registry, cache methodCache, className string, args []any) (any, error) {
+	class, err := registry.Class(className)
+	if err != nil {
+		return nil, err
+	}
+	return callOverloaded(registry, cache, class.Name, "<init>", candidates("<init>", class.ctors), args)
+}
+
+// callOverloaded 在一组重载中选择并调用，用于静态方法和构造器
+func callOverloaded(registry *Registry, cache methodCache, target, name string, cands []candidate, args []any) (any, error) {
+	if cache != nil {
+		if c, ok := cache.load(registry, nil, args); ok {
+			return invoke(c, args)
+		}
+	}
+	c, ok, err := selectCandidate(target, name, cands, args, args)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &NoSuchMethodError{Target: target, Name: name, Args: args}
+	}
+	if cache != nil {
+		cache.store(registry, nil, args, c)
+	}
+	return invoke(c, args)
+}
+
+// GetStaticField 读取类的静态字段，@Foo@class 返回类本身
+func GetStaticField(registry *Registry, className, name string) (any, error) {
+	class, err := registry.Class(className)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := class.Field(name); ok {
+		return v, nil
+	}
+	if name == "class" {
+		return class, nil
+	}
+	return nil, fmt.Errorf("no static field %s on class %s", name, class.Name)
+}
+
+// primitiveTypes Java 基本类型对应的 Go 类型，用于创建数组
+var primitiveTypes = map[string]reflect.Type{
+	"boolean": reflect.TypeOf(false),
+	"byte":    reflect.TypeOf(int8(0)),
+	"char":    charType,
+	"short":   reflect.TypeOf(int16(0)),
+	"int":     reflect.TypeOf(int32(0)),
+	"long":    reflect.TypeOf(int64(0)),
+	"float":   reflect.TypeOf(float32(0)),
+	"double":  reflect.TypeOf(float64(0)),
+}
+
+// arrayElemType 返回 Java 数组元素类型对应的 Go 类型，未指定 Go 类型的类使用 any
+func arrayElemType(registry *Registry, className string) (reflect.Type, error) {
+	if t, ok := primitiveTypes[className]; ok {
+		return t, nil
+	}
+	class, err := registry.Class(className)
+	if err != nil {
+		return nil, err
+	}
+	if class.Type == nil {
+		return anyType, nil
+	}
+	return class.Type, nil
+}
+
+// NewArray 创建 Java 数组：new int[n] 传入长度，new String[]{...} 传入元素
+func NewArray(registry *Registry, className string, length int, elems []any) (any, error) {
+	t, err := arrayElemType(registry, className)
+	if err != nil {
+		return nil, err
+	}
+	if elems == nil {
+		if length < 0 {
+			return nil, fmt.Errorf("negative array size: %d", length)
+		}
+		return reflect.MakeSlice(reflect.SliceOf(t), length, length).Interface(), nil
+	}
+	out := reflect.MakeSlice(reflect.SliceOf(t), len(elems), len(elems))
+	for i, elem := range elems {
+		v, err := ConvertValue(elem, t)
+		if err != nil {
+			return nil, err
+		}
+		out.Index(i).Set(v)
+	}
+	return out.Interface(), nil
+}
@@ -0,0 +1,224 @@
+package eval
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Joiner 可变参数方法的测试模型 (对应 Java VarArgsMethodTest 中的 VarArgsMethods)
+type Joiner struct{}
+
+func (Joiner) Join(sep string, parts ...string) string { return strings.Join(parts, sep) }
+func (Joiner) Count(values ...int) int                 { return len(values) }
+
+// printerClass 带重载静态方法的测试类
+func printerClass() *Class {
+	return NewClass("demo.Printer", nil).
+		AddMethod("print", func(v int64) string { return "long" }).
+		AddMethod("print", func(v float64) string { return "double" }).
+		AddMethod("print", func(v string) string { return "string" }).
+		AddMethod("print", func(v any) string { return "object" }).
+		AddMethod("pair", func(a int64, b float64) string { return "long,double" }).
+		AddMethod("pair", func(a float64, b int64) string { return "double,long" }).
+		AddMethod("format", func(pattern string, args ...any) string { return pattern + ":" + StringValue(args) }).
+		AddMethod("format", func(pattern string, arg string) string { return pattern + "=" + arg })
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"getTitle()", "Mr. Ada"},                  // Go 方法 GetTitle
+		{"child.getTitle()", "Mr. Byron"},          // 链中的方法调用
+		{"getName()", "Ada"},                       // 没有 GetName 方法，退化为属性读取
+		{"isReady()", true},                        // 同上，isX 形式
+		{"name.toUpperCase()", "ADA"},              // 字符串扩展方法
+		{"name.length()", int32(3)},                // 同上
+		{"name.substring(1)", "da"},                // 重载：一个参数
+		{"name.substring(0, 2)", "Ad"},             // 重载：两个参数
+		{"name.charAt(0)", Char('A')},              //
+		{"name.equals(\"Ada\")", true},             //
+		{"count.toString()", "30"},                 // Object 方法
+		{"count.doubleValue()", 30.0},              // Number 方法
+		{"tags.get(\"lang\")", "go"},               // Map 方法
+		{"tags.containsKey(\"lang\")", true},       //
+		{"{1, 2, 3}.size()", int32(3)},             // List 方法
+		{"{1, 2, 3}.contains(2)", true},            //
+		{"@java.lang.Math@max(1, 2)", int32(2)},    // 静态方法重载：int 精确匹配
+		{"@java.lang.Math@max(1, 2L)", int64(2)},   // int 拓宽为 long
+		{"@java.lang.Math@max(1, 2.5)", 2.5},       // int 拓宽为 double
+		{"@Math@abs(-3)", int32(3)},                // 省略 java.lang
+		{"@@abs(-3L)", int64(3)},                   // @@ 即 java.lang.Math
+		{"@Integer@parseInt(\"12\")", int32(12)},   //
+		{"@Integer@valueOf(\"12\")", int32(12)},    // 字符串参数优先匹配 valueOf(String)
+		{"@Character@toString(65)", "A"},           // int 优先匹配 toString(int)
+		{"@Integer@MAX_VALUE", int32(2147483647)},  // 静态字段
+		{"new String(\"x\")", "x"},                 // 构造器
+		{"new java.lang.Integer(\"7\")", int32(7)}, //
+		{"new String(new byte[]{104, 105})", "hi"}, // 数组构造器
+		{"new int[3].length", 3},                   //
+		{"new String[]{\"a\", \"b\"}[1]", "b"},     //
+	}
+	ctx := NewContext(newBean())
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := getValue(t, tt.input, ctx)
+			if err != nil {
+				t.Fatalf("GetValue(%q) error: %v", tt.input, err)
+			}
+			if v != tt.expected {
+				t.Errorf("GetValue(%q) = %#v, want %#v", tt.input, v, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVarArgsMethod(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"join(\",\")", ""},
+		{"join(\",\", \"a\")", "a"},
+		{"join(\",\", \"a\", \"b\", 3)", "a,b,3"},
+		{"join(\"-\", new String[]{\"x\", \"y\"})", "x-y"}, // 数组直接作为可变参数传入
+		{"count()", 0},
+		{"count(1, 2L, \"3\")", 3},
+	}
+	ctx := NewContext(Joiner{})
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := getValue(t, tt.input, ctx)
+			if err != nil {
+				t.Fatalf("GetValue(%q) error: %v", tt.input, err)
+			}
+			if v != tt.expected {
+				t.Errorf("GetValue(%q) = %#v, want %#v", tt.input, v, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOverloadResolution(t *testing.T) {
+	registry := NewRegistry().AddClass(printerClass())
+	ctx := NewContext(nil)
+	ctx.SetRegistry(registry)
+
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"@demo.Printer@print(1)", "long"}, // int 拓宽为 long 的代价低于 double
+		{"@demo.Printer@print(1.5f)", "double"},
+		{"@demo.Printer@print(\"s\")", "string"},
+		{"@demo.Printer@print({1})", "object"},
+		{"@demo.Printer@print(null)", "object"}, // null 不能传给基本类型而不转换
+		{"@demo.Printer@pair(1L, 1.0)", "long,double"},
+		{"@demo.Printer@format(\"p\", \"a\")", "p=a"},         // 固定参数个数的重载优先
+		{"@demo.Printer@format(\"p\", \"a\", 1)", "p:[a, 1]"}, // 只有可变参数的重载可用
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := getValue(t, tt.input, ctx)
+			if err != nil {
+				t.Fatalf("GetValue(%q) error: %v", tt.input, err)
+			}
+			if v != tt.expected {
+				t.Errorf("GetValue(%q) = %#v, want %#v", tt.input, v, tt.expected)
+			}
+		})
+	}
+
+	_, err := getValue(t, "@demo.Printer@pair(1, 1)", ctx)
+	var ambiguous *AmbiguousMethodError
+	if !errors.As(err, &ambiguous) || len(ambiguous.Candidates) != 2 {
+		t.Errorf("expected AmbiguousMethodError with two candidates, got %v", err)
+	}
+
+	// 默认注册表中没有 demo.Printer
+	_, err = getValue(t, "@demo.Printer@print(1)", NewContext(nil))
+	var notFound *ClassNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected ClassNotFoundError, got %v", err)
+	}
+}
+
+func TestMethodErrors(t *testing.T) {
+	ctx := NewContext(newBean())
+
+	_, err := getValue(t, "name.noSuchMethod()", ctx)
+	var noMethod *NoSuchMethodError
+	if !errors.As(err, &noMethod) || noMethod.Name != "noSuchMethod" {
+		t.Errorf("expected NoSuchMethodError, got %v", err)
+	}
+
+	_, err = getValue(t, "name.substring(\"x\")", ctx)
+	if !errors.As(err, &noMethod) {
+		t.Errorf("expected NoSuchMethodError for incompatible argument, got %v", err)
+	}
+
+	_, err = getValue(t, "child.child.getTitle()", ctx)
+	var nullErr *NullSourceError
+	if !errors.As(err, &nullErr) || nullErr.Op != "callMethod" {
+		t.Errorf("expected NullSourceError, got %v", err)
+	}
+
+	_, err = getValue(t, "getBroken()", ctx)
+	if err == nil || !strings.Contains(err.Error(), "broken getter") {
+		t.Errorf("method error should be returned, got %v", err)
+	}
+}
+
+func TestCallSiteCache(t *testing.T) {
+	registry := NewRegistry().AddClass(printerClass())
+	expr := parse(t, "@demo.Printer@print(#x)")
+	for _, tc := range []struct {
+		x    any
+		want string
+	}{{int64(1), "long"}, {"s", "string"}, {int64(2), "long"}, {2.5, "double"}} {
+		ctx := NewContext(nil)
+		ctx.SetRegistry(registry)
+		ctx.Set("x", tc.x)
+		v, err := GetValue(expr, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != tc.want {
+			t.Errorf("print(%#v) = %v, want %v", tc.x, v, tc.want)
+		}
+	}
+
+	// 同一调用点的接收者类型变化
+	expr = parse(t, "#x.toString()")
+	for _, x := range []any{"str", int32(5), &Bean{Name: "b"}, []int{1}} {
+		ctx := NewContext(nil)
+		ctx.Set("x", x)
+		v, err := GetValue(expr, ctx)
+		if err != nil {
+			t.Fatalf("toString() on %T: %v", x, err)
+		}
+		if v != StringValue(x) {
+			t.Errorf("toString() on %T = %#v", x, v)
+		}
+	}
+}
+
+func TestArgCost(t *testing.T) {
+	intType := reflect.TypeOf(int32(0))
+	longType := reflect.TypeOf(int64(0))
+	if argCost(int32(1), intType) != costExact {
+		t.Error("same type should cost nothing")
+	}
+	if argCost(int32(1), longType) >= argCost(int64(1), intType) {
+		t.Error("widening should be cheaper than narrowing")
+	}
+	if argCost("x", intType) != -1 {
+		t.Error("non-numeric string cannot be passed as int")
+	}
+	if argCost("12", intType) != costConvert {
+		t.Error("numeric string should need a conversion")
+	}
+}
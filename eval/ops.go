@@ -0,0 +1,922 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// Char 字符值 (对应 Java 的 char)
+// Go 的 rune 就是 int32，无法与 Java int 区分，所以字符字面量使用独立的类型
+type Char rune
+
+func (c Char) String() string { return string(rune(c)) }
+
+// 数值类型等级，与 Java OgnlOps 中的常量一致，数字越大类型越"宽"
+const (
+	numBool = iota
+	numByte
+	numChar
+	numShort
+	numInt
+	numLong
+	numBigInt
+	numFloat
+	numDouble
+	numBigDec
+	numNonNumeric
+
+	// numMinReal 最小的实数类型
+	numMinReal = numFloat
+)
+
+// ErrDivideByZero 整数除零 (对应 Java 的 ArithmeticException: / by zero)
+var ErrDivideByZero = errors.New("/ by zero")
+
+// bigDecPrec BigDecimal 使用 big.Float 近似时的精度
+const bigDecPrec = 128
+
+// numericType 返回值的数值类型等级 (对应 OgnlOps.getNumericType(Object))
+func numericType(v any) int {
+	switch v.(type) {
+	case nil:
+		return numNonNumeric
+	case bool:
+		return numBool
+	case int8:
+		return numByte
+	case Char:
+		return numChar
+	case int16, uint8:
+		return numShort
+	case int32, uint16:
+		return numInt
+	case int, int64, uint, uint32, uint64, uintptr:
+		return numLong
+	case *big.Int:
+		return numBigInt
+	case float32:
+		return numFloat
+	case float64:
+		return numDouble
+	case *big.Float:
+		return numBigDec
+	}
+	// 自定义类型 (例如 type Celsius float64) 按底层类型处理
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Bool:
+		return numBool
+	case reflect.Int8:
+		return numByte
+	case reflect.Int16, reflect.Uint8:
+		return numShort
+	case reflect.Int32, reflect.Uint16:
+		return numInt
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return numLong
+	case reflect.Float32:
+		return numFloat
+	case reflect.Float64:
+		return numDouble
+	}
+	return numNonNumeric
+}
+
+// combineNumericTypes 计算二元运算的结果类型 (对应 OgnlOps.getNumericType(int, int, boolean))
+// canBeNonNumeric 为 true 时 (只用于 +)，字符串和字符会使结果变为非数值 (字符串拼接)
+func combineNumericTypes(t1, t2 int, canBeNonNumeric bool) int {
+	if t1 == t2 {
+		return t1
+	}
+	if canBeNonNumeric && (t1 == numNonNumeric || t2 == numNonNumeric || t1 == numChar || t2 == numChar) {
+		return numNonNumeric
+	}
+	// 非数值尝试按 double 解释
+	if t1 == numNonNumeric {
+		t1 = numDouble
+	}
+	if t2 == numNonNumeric {
+		t2 = numDouble
+	}
+	if t1 >= numMinReal {
+		if t2 >= numMinReal {
+			return max(t1, t2)
+		}
+		if t2 < numInt {
+			return t1
+		}
+		if t2 == numBigInt {
+			return numBigDec
+		}
+		return max(numDouble, t1)
+	} else if t2 >= numMinReal {
+		if t1 < numInt {
+			return t2
+		}
+		if t1 == numBigInt {
+			return numBigDec
+		}
+		return max(numDouble, t2)
+	}
+	return max(t1, t2)
+}
+
+// valueNumericType 计算两个值参与运算时的结果类型
+func valueNumericType(v1, v2 any, canBeNonNumeric bool) int {
+	return combineNumericTypes(numericType(v1), numericType(v2), canBeNonNumeric)
+}
+
+// newInteger 按数值类型构造整数结果 (对应 OgnlOps.newInteger)
+func newInteger(t int, v int64) any {
+	switch t {
+	case numBool, numChar, numInt:
+		return int32(v)
+	case numFloat:
+		return float32(v)
+	case numDouble:
+		return float64(v)
+	case numLong:
+		return v
+	case numByte:
+		return int8(v)
+	case numShort:
+		return int16(v)
+	case numBigDec:
+		return new(big.Float).SetPrec(bigDecPrec).SetInt64(v)
+	default:
+		return big.NewInt(v)
+	}
+}
+
+// newReal 按数值类型构造实数结果 (对应 OgnlOps.newReal)
+func newReal(t int, v float64) any {
+	if t == numFloat {
+		return float32(v)
+	}
+	return v
+}
+
+// BooleanValue 按 OGNL 规则计算真值 (对应 OgnlOps.booleanValue)
+// null 为假；数值非零为真；字符串只有 "true" 为真；其他非 null 对象为真
+func BooleanValue(v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case string:
+		return strings.EqualFold(x, "true")
+	case Char:
+		return x != 0
+	case *big.Int:
+		return x.Sign() != 0
+	case *big.Float:
+		return x.Sign() != 0
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String:
+		return strings.EqualFold(rv.String(), "true")
+	}
+	if numericType(v) != numNonNumeric {
+		f, _ := doubleValue(v)
+		return f != 0
+	}
+	if (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface || rv.Kind() == reflect.Map ||
+		rv.Kind() == reflect.Slice || rv.Kind() == reflect.Func) && rv.IsNil() {
+		return false
+	}
+	return true
+}
+
+// longValue 把值转换为 int64 (对应 OgnlOps.longValue)
+func longValue(v any) (int64, error) {
+	switch x := v.(type) {
+	case nil:
+		return 0, nil
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	case Char:
+		return int64(x), nil
+	case *big.Int:
+		return x.Int64(), nil
+	case *big.Float:
+		i, _ := x.Int64()
+		return i, nil
+	case string:
+		s := strings.TrimSpace(x)
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("for input string: %q: %w", x, strconv.ErrSyntax)
+		}
+		return i, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return int64(rv.Float()), nil
+	case reflect.String:
+		return longValue(rv.String())
+	}
+	return 0, fmt.Errorf("cannot convert %s to a number", typeName(rv.Type()))
+}
+
+// doubleValue 把值转换为 float64 (对应 OgnlOps.doubleValue)
+func doubleValue(v any) (float64, error) {
+	switch x := v.(type) {
+	case nil:
+		return 0, nil
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(x).Float64()
+		return f, nil
+	case *big.Float:
+		f, _ := x.Float64()
+		return f, nil
+	case string:
+		s := strings.TrimSpace(x)
+		if s == "" {
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(strings.TrimRight(s, "dDfF"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("for input string: %q: %w", x, strconv.ErrSyntax)
+		}
+		return f, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return doubleValue(rv.String())
+	}
+	i, err := longValue(v)
+	return float64(i), err
+}
+
+// bigIntValue 把值转换为 *big.Int (对应 OgnlOps.bigIntValue)
+func bigIntValue(v any) (*big.Int, error) {
+	switch x := v.(type) {
+	case nil:
+		return new(big.Int), nil
+	case *big.Int:
+		return x, nil
+	case *big.Float:
+		i, _ := x.Int(nil)
+		return i, nil
+	case string:
+		i, ok := new(big.Int).SetString(strings.TrimSpace(x), 10)
+		if !ok {
+			return nil, fmt.Errorf("for input string: %q: %w", x, strconv.ErrSyntax)
+		}
+		return i, nil
+	}
+	if t := numericType(v); t == numFloat || t == numDouble {
+		f, _ := doubleValue(v)
+		i, _ := big.NewFloat(f).Int(nil)
+		return i, nil
+	}
+	i, err := longValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return big.NewInt(i), nil
+}
+
+// bigDecValue 把值转换为 *big.Float (对应 OgnlOps.bigDecValue)
+func bigDecValue(v any) (*big.Float, error) {
+	switch x := v.(type) {
+	case nil:
+		return new(big.Float).SetPrec(bigDecPrec), nil
+	case *big.Float:
+		return x, nil
+	case *big.Int:
+		return new(big.Float).SetPrec(bigDecPrec).SetInt(x), nil
+	case string:
+		f, ok := new(big.Float).SetPrec(bigDecPrec).SetString(strings.TrimSpace(x))
+		if !ok {
+			return nil, fmt.Errorf("for input string: %q: %w", x, strconv.ErrSyntax)
+		}
+		return f, nil
+	}
+	f, err := doubleValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Float).SetPrec(bigDecPrec).SetFloat64(f), nil
+}
+
+// StringValue 把值转换为字符串，格式尽量与 Java 的 toString 保持一致
+func StringValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return x
+	case Char:
+		return string(rune(x))
+	case bool:
+		return strconv.FormatBool(x)
+	case float64:
+		return javaDoubleString(x, 64)
+	case float32:
+		return javaDoubleString(float64(x), 32)
+	case *big.Int:
+		return x.String()
+	case *big.Float:
+		return x.Text('f', -1)
+	case fmt.Stringer:
+		return x.String()
+	case error:
+		return x.Error()
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 && rv.Kind() == reflect.Slice {
+			return fmt.Sprint(v)
+		}
+		parts := make([]string, rv.Len())
+		for i := range parts {
+			parts[i] = StringValue(rv.Index(i).Interface())
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case reflect.Map:
+		keys := sortedMapKeys(rv)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = StringValue(k.Interface()) + "=" + StringValue(rv.MapIndex(k).Interface())
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return "null"
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// javaDoubleString 按 Java Double.toString 的规则格式化浮点数
+func javaDoubleString(f float64, bits int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		if math.Signbit(f) {
+			return "-0.0"
+		}
+		return "0.0"
+	}
+	abs := math.Abs(f)
+	if abs >= 1e-3 && abs < 1e7 {
+		s := strconv.FormatFloat(f, 'f', -1, bits)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	}
+	// 科学计数法: 1.0E10, 1.5E-4
+	s := strconv.FormatFloat(f, 'e', -1, bits)
+	mantissa, exp, _ := strings.Cut(s, "e")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	e, _ := strconv.Atoi(exp)
+	return mantissa + "E" + strconv.Itoa(e)
+}
+
+// sortedMapKeys 返回按字符串形式排序的 map 键，保证遍历顺序稳定
+func sortedMapKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.SliceStable(keys, func(i, j int) bool {
+		return StringValue(keys[i].Interface()) < StringValue(keys[j].Interface())
+	})
+	return keys
+}
+
+// =============================================================================
+// 二元和一元运算 - 对应 Java OgnlOps
+// =============================================================================
+
+// Binary 按 OGNL 语义计算二元运算 (不包括短路的 && 和 ||，它们由求值器处理)
+func Binary(op ast.TokenType, v1, v2 any) (any, error) {
+	switch op {
+	case ast.PLUS:
+		return Add(v1, v2)
+	case ast.MINUS, ast.MULTIPLY, ast.DIVIDE, ast.MODULO:
+		return arithmetic(op, v1, v2)
+	case ast.EQ:
+		return Equal(v1, v2), nil
+	case ast.NOT_EQ:
+		return !Equal(v1, v2), nil
+	case ast.LT, ast.GT, ast.LT_EQ, ast.GT_EQ:
+		c, err := Compare(v1, v2)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case ast.LT:
+			return c < 0, nil
+		case ast.GT:
+			return c > 0, nil
+		case ast.LT_EQ:
+			return c <= 0, nil
+		default:
+			return c >= 0, nil
+		}
+	case ast.IN:
+		return In(v1, v2)
+	case ast.NOT_IN:
+		in, err := In(v1, v2)
+		return !in, err
+	case ast.BIT_AND, ast.BIT_OR, ast.XOR:
+		return bitwise(op, v1, v2)
+	case ast.SHL, ast.SHR, ast.USHR:
+		return shift(op, v1, v2)
+	case ast.AND:
+		if !BooleanValue(v1) {
+			return v1, nil
+		}
+		return v2, nil
+	case ast.OR:
+		if BooleanValue(v1) {
+			return v1, nil
+		}
+		return v2, nil
+	}
+	return nil, fmt.Errorf("unsupported binary operator %s", ast.TokenTypeNames[op])
+}
+
+// Add 加法或字符串拼接 (对应 OgnlOps.add)
+func Add(v1, v2 any) (any, error) {
+	t := valueNumericType(v1, v2, true)
+	switch t {
+	case numBigInt:
+		a, b, err := bigInts(v1, v2)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).Add(a, b), nil
+	case numBigDec:
+		a, b, err := bigDecs(v1, v2)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Float).SetPrec(bigDecPrec).Add(a, b), nil
+	case numFloat, numDouble:
+		a, b, err := doubles(v1, v2)
+		if err != nil {
+			return nil, err
+		}
+		return newReal(t, a+b), nil
+	case numNonNumeric:
+		t1, t2 := numericType(v1), numericType(v2)
+		if (t1 != numNonNumeric && v2 == nil) || (t2 != numNonNumeric && v1 == nil) {
+			return nil, fmt.Errorf("can't add values %s , %s", StringValue(v1), StringValue(v2))
+		}
+		return StringValue(v1) + StringValue(v2), nil
+	default:
+		a, b, err := longs(v1, v2)
+		if err != nil {
+			return nil, err
+		}
+		return newInteger(t, a+b), nil
+	}
+}
+
+// arithmetic 减、乘、除、取余 (对应 OgnlOps.subtract/multiply/divide/remainder)
+func arithmetic(op ast.TokenType, v1, v2 any) (any, error) {
+	t := valueNumericType(v1, v2, false)
+	switch t {
+	case numBigInt:
+		a, b, err := bigInts(v1, v2)
+		if err != nil {
+			return nil, err
+		}
+		r := new(big.Int)
+		switch op {
+		case ast.MINUS:
+			return r.Sub(a, b), nil
+		case ast.MULTIPLY:
+			return r.Mul(a, b), nil
+		}
+		if b.Sign() == 0 {
+			return nil, ErrDivideByZero
+		}
+		if op == ast.DIVIDE {
+			return r.Quo(a, b), nil
+		}
+		return r.Rem(a, b), nil
+	case numBigDec:
+		a, b, err := bigDecs(v1, v2)
+		if err != nil {
+			return nil, err
+		}
+		r := new(big.Float).SetPrec(bigDecPrec)
+		switch op {
+		case ast.MINUS:
+			return r.Sub(a, b), nil
+		case ast.MULTIPLY:
+			return r.Mul(a, b), nil
+		case ast.DIVIDE:
+			if b.Sign() == 0 {
+				return nil, ErrDivideByZero
+			}
+			return r.Quo(a, b), nil
+		}
+		// BigDecimal 取余按 BigInteger 处理，与 OgnlOps.remainder 一致
+		ai, _ := a.Int(nil)
+		bi, _ := b.Int(nil)
+		if bi.Sign() == 0 {
+			return nil, ErrDivideByZero
+		}
+		return new(big.Int).Rem(ai, bi), nil
+	case numFloat, numDouble:
+		a, b, err := doubles(v1, v2)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case ast.MINUS:
+			return newReal(t, a-b), nil
+		case ast.MULTIPLY:
+			return newReal(t, a*b), nil
+		case ast.DIVIDE:
+			return newReal(t, a/b), nil
+		}
+		return newReal(t, math.Mod(a, b)), nil
+	default:
+		a, b, err := longs(v1, v2)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case ast.MINUS:
+			return newInteger(t, a-b), nil
+		case ast.MULTIPLY:
+			return newInteger(t, a*b), nil
+		}
+		if b == 0 {
+			return nil, ErrDivideByZero
+		}
+		if op == ast.DIVIDE {
+			return newInteger(t, a/b), nil
+		}
+		return newInteger(t, a%b), nil
+	}
+}
+
+// bitwise 按位与、或、异或 (对应 OgnlOps.binaryAnd/binaryOr/binaryXor)
+func bitwise(op ast.TokenType, v1, v2 any) (any, error) {
+	t := valueNumericType(v1, v2, false)
+	if t == numBigInt || t == numBigDec {
+		a, b, err := bigInts(v1, v2)
+		if err != nil {
+			return nil, err
+		}
+		r := new(big.Int)
+		switch op {
+		case ast.BIT_AND:
+			return r.And(a, b), nil
+		case ast.BIT_OR:
+			return r.Or(a, b), nil
+		default:
+			return r.Xor(a, b), nil
+		}
+	}
+	a, b, err := longs(v1, v2)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case ast.BIT_AND:
+		return newInteger(t, a&b), nil
+	case ast.BIT_OR:
+		return newInteger(t, a|b), nil
+	default:
+		return newInteger(t, a^b), nil
+	}
+}
+
+// shift 位移运算 (对应 OgnlOps.shiftLeft/shiftRight/unsignedShiftRight)
+func shift(op ast.TokenType, v1, v2 any) (any, error) {
+	t := numericType(v1)
+	n, err := longValue(v2)
+	if err != nil {
+		return nil, err
+	}
+	if t == numBigInt || t == numBigDec {
+		a, err := bigIntValue(v1)
+		if err != nil {
+			return nil, err
+		}
+		if op == ast.SHL {
+			return new(big.Int).Lsh(a, uint(n)), nil
+		}
+		return new(big.Int).Rsh(a, uint(n)), nil
+	}
+	a, err := longValue(v1)
+	if err != nil {
+		return nil, err
+	}
+	// Java 对 long 的位移只取低 6 位
+	s := uint(n) & 63
+	switch op {
+	case ast.SHL:
+		return newInteger(t, a<<s), nil
+	case ast.SHR:
+		return newInteger(t, a>>s), nil
+	default:
+		if t <= numInt {
+			return newInteger(t, int64(uint32(int32(a))>>(s&31))), nil
+		}
+		return newInteger(t, int64(uint64(a)>>s)), nil
+	}
+}
+
+// Unary 一元运算 (对应 OgnlOps.negate/bitNegate 以及 ASTNot)
+func Unary(op ast.TokenType, v any) (any, error) {
+	switch op {
+	case ast.NOT:
+		return !BooleanValue(v), nil
+	case ast.MINUS:
+		switch t := numericType(v); t {
+		case numBigInt:
+			a, err := bigIntValue(v)
+			if err != nil {
+				return nil, err
+			}
+			return new(big.Int).Neg(a), nil
+		case numBigDec:
+			a, err := bigDecValue(v)
+			if err != nil {
+				return nil, err
+			}
+			return new(big.Float).SetPrec(bigDecPrec).Neg(a), nil
+		case numFloat, numDouble:
+			f, err := doubleValue(v)
+			if err != nil {
+				return nil, err
+			}
+			return newReal(t, -f), nil
+		default:
+			i, err := longValue(v)
+			if err != nil {
+				return nil, err
+			}
+			return newInteger(t, -i), nil
+		}
+	case ast.BIT_NOT:
+		switch t := numericType(v); t {
+		case numBigInt, numBigDec:
+			a, err := bigIntValue(v)
+			if err != nil {
+				return nil, err
+			}
+			return new(big.Int).Not(a), nil
+		default:
+			i, err := longValue(v)
+			if err != nil {
+				return nil, err
+			}
+			return newInteger(t, ^i), nil
+		}
+	case ast.PLUS:
+		return v, nil
+	}
+	return nil, fmt.Errorf("unsupported unary operator %s", ast.TokenTypeNames[op])
+}
+
+// Equal 相等比较 (对应 OgnlOps.equal)
+// 两个数值按数值比较，其他值使用 Go 的相等性
+func Equal(v1, v2 any) bool {
+	if v1 == nil || v2 == nil {
+		return isNil(v1) && isNil(v2)
+	}
+	t1, t2 := numericType(v1), numericType(v2)
+	if t1 != numNonNumeric && t2 != numNonNumeric {
+		c, err := Compare(v1, v2)
+		return err == nil && c == 0
+	}
+	if s1, ok := v1.(string); ok {
+		if c, ok := v2.(Char); ok {
+			return s1 == c.String()
+		}
+	}
+	r1, r2 := reflect.ValueOf(v1), reflect.ValueOf(v2)
+	if r1.Type().Comparable() && r2.Type().Comparable() {
+		return safeEqual(v1, v2)
+	}
+	return reflect.DeepEqual(v1, v2)
+}
+
+// safeEqual 比较可比较类型的值，接口内部包含不可比较值时退回 DeepEqual
+func safeEqual(v1, v2 any) (eq bool) {
+	defer func() {
+		if recover() != nil {
+			eq = reflect.DeepEqual(v1, v2)
+		}
+	}()
+	return v1 == v2
+}
+
+// isNil 判断值是否为 nil (包括带类型的 nil 指针)
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// Compare 大小比较 (对应 OgnlOps.compareWithConversion)
+// 返回负数、0、正数分别表示 v1 小于、等于、大于 v2
+func Compare(v1, v2 any) (int, error) {
+	t1, t2 := numericType(v1), numericType(v2)
+	t := combineNumericTypes(t1, t2, true)
+	switch t {
+	case numBigInt:
+		a, b, err := bigInts(v1, v2)
+		if err != nil {
+			return 0, err
+		}
+		return a.Cmp(b), nil
+	case numBigDec:
+		a, b, err := bigDecs(v1, v2)
+		if err != nil {
+			return 0, err
+		}
+		return a.Cmp(b), nil
+	case numNonNumeric:
+		if t1 == numNonNumeric && t2 == numNonNumeric {
+			return compareNonNumeric(v1, v2)
+		}
+		fallthrough
+	case numFloat, numDouble:
+		a, b, err := doubles(v1, v2)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case a < b:
+			return -1, nil
+		case a > b:
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		a, b, err := longs(v1, v2)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case a < b:
+			return -1, nil
+		case a > b:
+			return 1, nil
+		}
+		return 0, nil
+	}
+}
+
+// compareNonNumeric 比较两个非数值 (字符串按字典序)
+func compareNonNumeric(v1, v2 any) (int, error) {
+	if v1 == nil && v2 == nil {
+		return 0, nil
+	}
+	s1, ok1 := stringLike(v1)
+	s2, ok2 := stringLike(v2)
+	if ok1 && ok2 {
+		return strings.Compare(s1, s2), nil
+	}
+	if c, ok := v1.(interface{ CompareTo(any) int }); ok {
+		return c.CompareTo(v2), nil
+	}
+	return 0, fmt.Errorf("invalid comparison: %s and %s", typeName(reflect.TypeOf(v1)), typeName(reflect.TypeOf(v2)))
+}
+
+// stringLike 如果值是字符串类型 (包括自定义字符串类型) 返回其内容
+func stringLike(v any) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.String {
+		return rv.String(), true
+	}
+	return "", false
+}
+
+// In 判断 v1 是否为集合 v2 的元素 (对应 OgnlOps.in)
+func In(v1, v2 any) (bool, error) {
+	if v2 == nil {
+		return false, nil
+	}
+	found := false
+	err := iterate(v2, func(elem any) bool {
+		if Equal(v1, elem) {
+			found = true
+			return false
+		}
+		return true
+	})
+	return found, err
+}
+
+// iterate 遍历集合元素 (对应 Java OGNL 的 ElementsAccessor)
+// 切片和数组遍历元素，map 遍历值，字符串遍历字符，其他对象视为只有自身一个元素
+// fn 返回 false 时停止遍历
+func iterate(v any, fn func(elem any) bool) error {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if !fn(rv.Index(i).Interface()) {
+				return nil
+			}
+		}
+	case reflect.Map:
+		for _, k := range sortedMapKeys(rv) {
+			if !fn(rv.MapIndex(k).Interface()) {
+				return nil
+			}
+		}
+	case reflect.String:
+		for _, r := range rv.String() {
+			if !fn(Char(r)) {
+				return nil
+			}
+		}
+	default:
+		fn(v)
+	}
+	return nil
+}
+
+func longs(v1, v2 any) (int64, int64, error) {
+	a, err := longValue(v1)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := longValue(v2)
+	return a, b, err
+}
+
+func doubles(v1, v2 any) (float64, float64, error) {
+	a, err := doubleValue(v1)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := doubleValue(v2)
+	return a, b, err
+}
+
+func bigInts(v1, v2 any) (*big.Int, *big.Int, error) {
+	a, err := bigIntValue(v1)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := bigIntValue(v2)
+	return a, b, err
+}
+
+func bigDecs(v1, v2 any) (*big.Float, *big.Float, error) {
+	a, err := bigDecValue(v1)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := bigDecValue(v2)
+	return a, b, err
+}
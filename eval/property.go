@@ -0,0 +1,614 @@
+package eval
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// =============================================================================
+// JavaBean 风格的属性解析 - 对应 Java OGNL 的 OgnlRuntime / ObjectPropertyAccessor
+//
+// 读取 foo.bar 时按以下顺序查找 (找到即停止):
+//   1. 带 `ognl:"bar"` 标签的字段
+//   2. 方法 GetBar()
+//   3. 方法 Bar()
+//   4. 方法 IsBar()，要求返回 bool
+//   5. 导出字段 Bar
+//   6. 名称忽略大小写后与 bar 相同的导出字段
+//
+// 写入 foo.bar = v 时按以下顺序查找:
+//   1. 方法 SetBar(v)
+//   2. 带 `ognl:"bar"` 标签的字段
+//   3. 导出字段 Bar，以及忽略大小写匹配的导出字段
+//
+// 标签写作 `ognl:"-"` 的字段对 OGNL 不可见。
+// getter 和 setter 方法可以额外返回一个 error，非 nil 时作为求值错误返回。
+//
+// 索引属性 foo.values[2] 对应 Java 的 getValues(int) / setValues(int, v)，
+// 在 Go 中查找 GetValues(i int) 或 Values(i int) 以及 SetValues(i int, v)；
+// 对象索引属性 foo.attribute["x"] 对应 Java 的 getAttribute(String)，
+// 查找参数为字符串 (或其他非整数类型) 的 GetAttribute(key) / Attribute(key) / SetAttribute(key, v)。
+// =============================================================================
+
+// TagName 结构体标签名
+const TagName = "ognl"
+
+// accessKind 属性访问方式
+type accessKind int
+
+const (
+	accessNone   accessKind = iota
+	accessField             // 通过字段访问
+	accessMethod            // 通过方法访问
+)
+
+// accessor 描述对某个属性的一种访问方式
+type accessor struct {
+	kind   accessKind
+	field  []int        // 字段索引路径 (支持嵌入结构体的提升字段)
+	method int          // 方法在接收者类型方法集中的下标
+	typ    reflect.Type // 字段类型、getter 的返回类型或 setter 的参数类型
+}
+
+func (a accessor) ok() bool { return a.kind != accessNone }
+
+// IndexKind 索引属性的类型
+type IndexKind int
+
+const (
+	NotIndexed    IndexKind = iota // 不是索引属性
+	IntIndexed                     // 整数索引属性，如 getValues(int)
+	ObjectIndexed                  // 对象索引属性，如 getAttribute(String)
+)
+
+// propertyInfo 某个类型上某个属性的全部访问方式，按 (类型, 属性名) 缓存
+type propertyInfo struct {
+	get        accessor
+	set        accessor
+	indexKind  IndexKind
+	indexedGet accessor
+	indexedSet accessor
+	keyType    reflect.Type // 索引参数类型
+}
+
+type propertyKey struct {
+	t    reflect.Type
+	name string
+}
+
+// propertyCache 属性解析结果缓存，类型和方法集在运行期不会变化，所以可以全局共享
+var propertyCache sync.Map // map[propertyKey]*propertyInfo
+
+// lookupProperty 解析 (并缓存) 接收者类型上的属性
+func lookupProperty(recvType reflect.Type, name string) *propertyInfo {
+	key := propertyKey{t: recvType, name: name}
+	if info, ok := propertyCache.Load(key); ok {
+		return info.(*propertyInfo)
+	}
+	info := resolveProperty(recvType, name)
+	actual, _ := propertyCache.LoadOrStore(key, info)
+	return actual.(*propertyInfo)
+}
+
+// resolveProperty 按文件开头描述的顺序解析属性
+func resolveProperty(recvType reflect.Type, name string) *propertyInfo {
+	info := &propertyInfo{}
+	upper := capitalize(name)
+	structType := recvType
+	if structType.Kind() == reflect.Pointer {
+		structType = structType.Elem()
+	}
+
+	tagged, hidden := taggedField(structType, name)
+	named := accessor{}
+	if !hidden {
+		named = namedField(structType, upper, name)
+	}
+
+	// 读取
+	switch {
+	case tagged.ok():
+		info.get = tagged
+	default:
+		if m := getterMethod(recvType, "Get"+upper); m.ok() {
+			info.get = m
+		} else if m := getterMethod(recvType, upper); m.ok() {
+			info.get = m
+		} else if m := getterMethod(recvType, "Is"+upper); m.ok() && m.typ.Kind() == reflect.Bool {
+			info.get = m
+		} else {
+			info.get = named
+		}
+	}
+
+	// 写入
+	if m := setterMethod(recvType, "Set"+upper, 1); m.ok() {
+		info.set = m
+	} else if tagged.ok() {
+		info.set = tagged
+	} else {
+		info.set = named
+	}
+
+	// 索引属性
+	for _, getter := range []string{"Get" + upper, upper} {
+		if m, keyType := indexedGetter(recvType, getter); m.ok() {
+			info.indexedGet = m
+			info.keyType = keyType
+			info.indexKind = ObjectIndexed
+			if isIntegerKind(keyType.Kind()) {
+				info.indexKind = IntIndexed
+			}
+			break
+		}
+	}
+	if info.indexKind != NotIndexed {
+		if m := setterMethod(recvType, "Set"+upper, 2); m.ok() {
+			info.indexedSet = m
+		}
+	}
+	return info
+}
+
+// taggedField 查找带 ognl 标签的字段，hidden 表示同名字段被标记为 `ognl:"-"`
+func taggedField(structType reflect.Type, name string) (a accessor, hidden bool) {
+	if structType.Kind() != reflect.Struct {
+		return accessor{}, false
+	}
+	for _, f := range reflect.VisibleFields(structType) {
+		if !f.IsExported() {
+			continue
+		}
+		tag, ok := f.Tag.Lookup(TagName)
+		if !ok {
+			continue
+		}
+		tagName, _, _ := strings.Cut(tag, ",")
+		if tagName == "-" {
+			if strings.EqualFold(f.Name, name) {
+				hidden = true
+			}
+			continue
+		}
+		if tagName == name {
+			return accessor{kind: accessField, field: f.Index, typ: f.Type}, false
+		}
+	}
+	return accessor{}, hidden
+}
+
+// namedField 按名称查找导出字段，找不到时忽略大小写再找一次
+func namedField(structType reflect.Type, upper, name string) accessor {
+	if structType.Kind() != reflect.Struct {
+		return accessor{}
+	}
+	if f, ok := structType.FieldByName(upper); ok && f.IsExported() {
+		return accessor{kind: accessField, field: f.Index, typ: f.Type}
+	}
+	for _, f := range reflect.VisibleFields(structType) {
+		if f.IsExported() && !f.Anonymous && strings.EqualFold(f.Name, name) {
+			return accessor{kind: accessField, field: f.Index, typ: f.Type}
+		}
+	}
+	return accessor{}
+}
+
+// getterMethod 查找无参数、返回一个值 (可以额外返回 error) 的方法
+func getterMethod(recvType reflect.Type, name string) accessor {
+	m, ok := recvType.MethodByName(name)
+	if !ok {
+		return accessor{}
+	}
+	// m.Type 的第一个参数是接收者
+	if m.Type.NumIn() != 1 || !validResults(m.Type, 1) {
+		return accessor{}
+	}
+	return accessor{kind: accessMethod, method: m.Index, typ: m.Type.Out(0)}
+}
+
+// setterMethod 查找有 n 个参数、不返回值 (或只返回 error) 的方法
+func setterMethod(recvType reflect.Type, name string, n int) accessor {
+	m, ok := recvType.MethodByName(name)
+	if !ok || m.Type.NumIn() != n+1 || !validResults(m.Type, 0) {
+		return accessor{}
+	}
+	return accessor{kind: accessMethod, method: m.Index, typ: m.Type.In(n)}
+}
+
+// indexedGetter 查找只有一个参数的 getter，返回方法和参数类型
+func indexedGetter(recvType reflect.Type, name string) (accessor, reflect.Type) {
+	m, ok := recvType.MethodByName(name)
+	if !ok || m.Type.NumIn() != 2 || m.Type.IsVariadic() || !validResults(m.Type, 1) {
+		return accessor{}, nil
+	}
+	return accessor{kind: accessMethod, method: m.Index, typ: m.Type.Out(0)}, m.Type.In(1)
+}
+
+// validResults 检查方法返回 n 个值，并且可以额外返回一个 error
+func validResults(t reflect.Type, n int) bool {
+	switch t.NumOut() {
+	case n:
+		return n == 0 || t.Out(n-1) != errorType
+	case n + 1:
+		return t.Out(n) == errorType
+	}
+	return false
+}
+
+// capitalize 把属性名首字母大写，得到 Go 的导出名称
+func capitalize(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	if r == utf8.RuneError {
+		return name
+	}
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+func isIntegerKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Uintptr
+}
+
+// =============================================================================
+// 属性读写
+// =============================================================================
+
+// receiver 返回用于查找方法的接收者：解开接口，可寻址的值取地址以便调用指针方法
+// 不可寻址的结构体会被复制一份，这样读取时也能调用指针方法，但对副本的写入不会生效
+func receiver(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return v
+	}
+	if v.CanAddr() {
+		return v.Addr()
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p
+}
+
+// addressable 判断写入结构体时能否作用到原对象
+func addressable(v reflect.Value) bool {
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v.Kind() != reflect.Struct || v.CanAddr()
+}
+
+// GetProperty 读取对象的属性 (对应 OgnlRuntime.getProperty)
+// map 按键读取，切片和数组支持 length/size/isEmpty，其他对象按 JavaBean 规则解析
+func GetProperty(source any, name string) (any, error) {
+	if isNil(source) {
+		return nil, &NullSourceError{Op: "getProperty", Name: name}
+	}
+	return getProperty(reflect.ValueOf(source), name)
+}
+
+func getProperty(v reflect.Value, name string) (any, error) {
+	recv := receiver(v)
+	if v, ok, err := collectionProperty(recv, name); ok {
+		return v, err
+	}
+	return readProperty(recv, lookupProperty(recv.Type(), name), name)
+}
+
+// collectionProperty 读取 map 的键以及切片、数组的伪属性，ok 为 false 表示 recv 不是集合
+func collectionProperty(recv reflect.Value, name string) (v any, ok bool, err error) {
+	switch recv.Kind() {
+	case reflect.Map:
+		v, err := mapProperty(recv, name)
+		return v, true, err
+	case reflect.Slice, reflect.Array:
+		switch name {
+		case "length", "size":
+			return recv.Len(), true, nil
+		case "isEmpty":
+			return recv.Len() == 0, true, nil
+		}
+	case reflect.Pointer:
+		if recv.Elem().Kind() == reflect.Array {
+			if name == "length" || name == "size" {
+				return recv.Elem().Len(), true, nil
+			}
+		}
+	}
+	return nil, false, nil
+}
+
+// readProperty 按解析好的访问方式读取属性
+func readProperty(recv reflect.Value, info *propertyInfo, name string) (any, error) {
+	switch info.get.kind {
+	case accessMethod:
+		return callAccessor(recv.Method(info.get.method), nil)
+	case accessField:
+		f, err := structField(recv, info.get.field)
+		if err != nil {
+			return nil, err
+		}
+		return f.Interface(), nil
+	}
+	return nil, &NoSuchPropertyError{Target: recv.Type(), Name: name}
+}
+
+// mapProperty 读取 map 的键，不存在时支持 size/isEmpty/keys/values 伪属性 (对应 MapPropertyAccessor)
+func mapProperty(m reflect.Value, name string) (any, error) {
+	key, err := ConvertValue(name, m.Type().Key())
+	if err == nil {
+		if v := m.MapIndex(key); v.IsValid() {
+			return v.Interface(), nil
+		}
+	}
+	switch name {
+	case "size":
+		return m.Len(), nil
+	case "isEmpty":
+		return m.Len() == 0, nil
+	case "keys":
+		keys := sortedMapKeys(m)
+		out := make([]any, len(keys))
+		for i, k := range keys {
+			out[i] = k.Interface()
+		}
+		return out, nil
+	case "values":
+		keys := sortedMapKeys(m)
+		out := make([]any, len(keys))
+		for i, k := range keys {
+			out[i] = m.MapIndex(k).Interface()
+		}
+		return out, nil
+	}
+	return nil, nil
+}
+
+// SetProperty 写入对象的属性 (对应 OgnlRuntime.setProperty)
+// 结构体字段只有在对象可寻址 (通常是传入指针) 时才能写入
+func SetProperty(target any, name string, value any) error {
+	if isNil(target) {
+		return &NullSourceError{Op: "setProperty", Name: name}
+	}
+	return setProperty(reflect.ValueOf(target), name, value)
+}
+
+func setProperty(v reflect.Value, name string, value any) error {
+	if !addressable(v) {
+		return fmt.Errorf("cannot set property %q on non-addressable %s", name, typeName(v.Type()))
+	}
+	recv := receiver(v)
+	if recv.Kind() == reflect.Map {
+		return setMapIndex(recv, name, value)
+	}
+
+	info := lookupProperty(recv.Type(), name)
+	switch info.set.kind {
+	case accessMethod:
+		arg, err := ConvertValue(value, info.set.typ)
+		if err != nil {
+			return err
+		}
+		_, err = callAccessor(recv.Method(info.set.method), []reflect.Value{arg})
+		return err
+	case accessField:
+		f, err := structField(recv, info.set.field)
+		if err != nil {
+			return err
+		}
+		val, err := ConvertValue(value, f.Type())
+		if err != nil {
+			return err
+		}
+		f.Set(val)
+		return nil
+	}
+	return &NoSuchPropertyError{Target: recv.Type(), Name: name}
+}
+
+// structField 按索引路径取结构体字段，经过 nil 嵌入指针时返回错误而不是 panic
+func structField(recv reflect.Value, index []int) (reflect.Value, error) {
+	s := recv
+	if s.Kind() == reflect.Pointer {
+		if s.IsNil() {
+			return reflect.Value{}, fmt.Errorf("nil pointer of type %s", typeName(s.Type()))
+		}
+		s = s.Elem()
+	}
+	f, err := s.FieldByIndexErr(index)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return f, nil
+}
+
+// setMapIndex 写入 map 的键值
+func setMapIndex(m reflect.Value, key, value any) error {
+	if m.IsNil() {
+		return fmt.Errorf("assignment to entry in nil map")
+	}
+	k, err := ConvertValue(key, m.Type().Key())
+	if err != nil {
+		return err
+	}
+	val, err := ConvertValue(value, m.Type().Elem())
+	if err != nil {
+		return err
+	}
+	m.SetMapIndex(k, val)
+	return nil
+}
+
+// IndexedPropertyKind 返回对象上某个属性的索引类型 (对应 OgnlRuntime.getIndexedPropertyType)
+func IndexedPropertyKind(source any, name string) IndexKind {
+	if isNil(source) {
+		return NotIndexed
+	}
+	recv := receiver(reflect.ValueOf(source))
+	return lookupProperty(recv.Type(), name).indexKind
+}
+
+// getIndexedProperty 通过 GetValues(i) / GetAttribute(key) 读取索引属性
+// ok 为 false 表示对象没有这个索引属性，调用者应退回到先取属性再取下标
+func getIndexedProperty(source any, name string, index any) (value any, ok bool, err error) {
+	if isNil(source) {
+		return nil, false, nil
+	}
+	recv := receiver(reflect.ValueOf(source))
+	info := lookupProperty(recv.Type(), name)
+	if info.indexKind == NotIndexed {
+		return nil, false, nil
+	}
+	key, err := ConvertValue(index, info.keyType)
+	if err != nil {
+		return nil, true, err
+	}
+	value, err = callAccessor(recv.Method(info.indexedGet.method), []reflect.Value{key})
+	return value, true, err
+}
+
+// setIndexedProperty 通过 SetValues(i, v) / SetAttribute(key, v) 写入索引属性
+func setIndexedProperty(target any, name string, index, value any) (ok bool, err error) {
+	if isNil(target) {
+		return false, nil
+	}
+	recv := receiver(reflect.ValueOf(target))
+	info := lookupProperty(recv.Type(), name)
+	if !info.indexedSet.ok() {
+		return false, nil
+	}
+	key, err := ConvertValue(index, info.keyType)
+	if err != nil {
+		return true, err
+	}
+	val, err := ConvertValue(value, info.indexedSet.typ)
+	if err != nil {
+		return true, err
+	}
+	_, err = callAccessor(recv.Method(info.indexedSet.method), []reflect.Value{key, val})
+	return true, err
+}
+
+// callAccessor 调用 getter/setter 方法，处理额外返回的 error
+func callAccessor(fn reflect.Value, args []reflect.Value) (any, error) {
+	out, err := callSafely(fn, args, false)
+	if err != nil {
+		return nil, err
+	}
+	return callResult(fn.Type(), out)
+}
+
+// callResult 取出函数调用的结果，最后一个返回值是 error 时作为错误返回
+func callResult(ft reflect.Type, out []reflect.Value) (any, error) {
+	if n := len(out); n > 0 && ft.Out(n-1) == errorType {
+		if err, _ := out[n-1].Interface().(error); err != nil {
+			return nil, err
+		}
+		out = out[:n-1]
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out[0].Interface(), nil
+}
+
+// =============================================================================
+// 下标访问 - 对应 Java OGNL 中带索引的 ASTProperty
+// =============================================================================
+
+// GetIndex 读取 source[index]
+// 切片和数组按整数下标读取，map 按键读取，其他对象把字符串下标当作属性名
+func GetIndex(source any, index any) (any, error) {
+	if isNil(source) {
+		return nil, &NullSourceError{Op: "getProperty", Name: StringValue(index)}
+	}
+	recv := receiver(reflect.ValueOf(source))
+	seq := recv
+	if seq.Kind() == reflect.Pointer && seq.Elem().Kind() == reflect.Array {
+		seq = seq.Elem()
+	}
+	switch seq.Kind() {
+	case reflect.Slice, reflect.Array:
+		if numericType(index) == numNonNumeric {
+			if name, ok := index.(string); ok {
+				return getProperty(recv, name)
+			}
+			return nil, fmt.Errorf("invalid index %s for %s", StringValue(index), typeName(seq.Type()))
+		}
+		i, err := sequenceIndex(seq, index)
+		if err != nil {
+			return nil, err
+		}
+		return seq.Index(i).Interface(), nil
+	case reflect.Map:
+		if recv.IsNil() {
+			return nil, nil
+		}
+		k, err := ConvertValue(index, recv.Type().Key())
+		if err != nil {
+			return nil, err
+		}
+		if v := recv.MapIndex(k); v.IsValid() {
+			return v.Interface(), nil
+		}
+		return nil, nil
+	}
+	if name, ok := stringLike(index); ok {
+		return getProperty(recv, name)
+	}
+	return nil, fmt.Errorf("%s is not indexable", typeName(recv.Type()))
+}
+
+// SetIndex 写入 target[index] = value
+func SetIndex(target any, index any, value any) error {
+	if isNil(target) {
+		return &NullSourceError{Op: "setProperty", Name: StringValue(index)}
+	}
+	recv := receiver(reflect.ValueOf(target))
+	seq := recv
+	if seq.Kind() == reflect.Pointer && seq.Elem().Kind() == reflect.Array {
+		seq = seq.Elem()
+	}
+	switch seq.Kind() {
+	case reflect.Slice, reflect.Array:
+		if name, ok := index.(string); ok {
+			return setProperty(recv, name, value)
+		}
+		i, err := sequenceIndex(seq, index)
+		if err != nil {
+			return err
+		}
+		elem := seq.Index(i)
+		if !elem.CanSet() {
+			return fmt.Errorf("cannot set element of non-addressable %s", typeName(seq.Type()))
+		}
+		val, err := ConvertValue(value, elem.Type())
+		if err != nil {
+			return err
+		}
+		elem.Set(val)
+		return nil
+	case reflect.Map:
+		return setMapIndex(recv, index, value)
+	}
+	if name, ok := stringLike(index); ok {
+		return setProperty(recv, name, value)
+	}
+	return fmt.Errorf("%s is not indexable", typeName(recv.Type()))
+}
+
+// sequenceIndex 把下标转换为 int 并检查越界
+func sequenceIndex(seq reflect.Value, index any) (int, error) {
+	i64, err := longValue(index)
+	if err != nil {
+		return 0, err
+	}
+	i := int(i64)
+	if i < 0 || i >= seq.Len() {
+		return 0, fmt.Errorf("index %d out of bounds for length %d", i, seq.Len())
+	}
+	return i, nil
+}
@@ -0,0 +1,172 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Bean 覆盖各种属性解析方式的测试模型
+type Bean struct {
+	Name      string
+	Nick      string `ognl:"alias"`
+	Secret    string `ognl:"-"`
+	Count     int
+	Ready     bool
+	Child     *Bean
+	Tags      map[string]string
+	values    []string
+	attrs     map[string]any
+	setCalled bool
+}
+
+func (b *Bean) GetTitle() string        { return "Mr. " + b.Name }
+func (b *Bean) Status() string          { return "active" }
+func (b *Bean) IsEnabled() bool         { return b.Ready }
+func (b *Bean) GetCount() int           { return b.Count * 10 }
+func (b *Bean) SetTitle(v string)       { b.Name = v; b.setCalled = true }
+func (b *Bean) GetBroken() (int, error) { return 0, errors.New("broken getter") }
+
+// 整数索引属性，对应 Java 的 getValues(int) / setValues(int, String)
+func (b *Bean) GetValues(i int) string    { return b.values[i] }
+func (b *Bean) SetValues(i int, v string) { b.values[i] = v }
+
+// 对象索引属性，对应 Java 的 getAttribute(String) / setAttribute(String, Object)
+func (b *Bean) GetAttribute(key string) any { return b.attrs[key] }
+func (b *Bean) SetAttribute(key string, v any) {
+	if b.attrs == nil {
+		b.attrs = map[string]any{}
+	}
+	b.attrs[key] = v
+}
+
+func newBean() *Bean {
+	return &Bean{
+		Name:   "Ada",
+		Nick:   "countess",
+		Secret: "hidden",
+		Count:  3,
+		Ready:  true,
+		Child:  &Bean{Name: "Byron", values: []string{"c0"}},
+		Tags:   map[string]string{"lang": "go"},
+		values: []string{"v0", "v1", "v2"},
+		attrs:  map[string]any{"foo": "bar", "other": &Bean{attrs: map[string]any{"bar": "nested"}}},
+	}
+}
+
+func TestPropertyResolutionOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"name", "Ada"},               // 字段
+		{"alias", "countess"},         // ognl 标签
+		{"title", "Mr. Ada"},          // GetTitle()
+		{"status", "active"},          // Status()
+		{"enabled", true},             // IsEnabled()
+		{"count", 30},                 // GetCount() 优先于字段 Count
+		{"child.name", "Byron"},       // 链式访问
+		{"tags.lang", "go"},           // map 字段
+		{"NAME", "Ada"},               // 忽略大小写的字段匹配
+		{"[\"name\"]", "Ada"},         // 字符串下标按属性名读取
+		{"values[1]", "v1"},           // GetValues(int)
+		{"child.values[0]", "c0"},     // 链中间的索引属性
+		{"attribute[\"foo\"]", "bar"}, // GetAttribute(String)
+		{"attribute[\"other\"].attribute[\"bar\"]", "nested"},
+	}
+	ctx := NewContext(newBean())
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := getValue(t, tt.input, ctx)
+			if err != nil {
+				t.Fatalf("GetValue(%q) error: %v", tt.input, err)
+			}
+			if v != tt.expected {
+				t.Errorf("GetValue(%q) = %#v, want %#v", tt.input, v, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPropertyErrors(t *testing.T) {
+	ctx := NewContext(newBean())
+
+	_, err := getValue(t, "secret", ctx)
+	var noProp *NoSuchPropertyError
+	if !errors.As(err, &noProp) || noProp.Name != "secret" {
+		t.Errorf("ognl:\"-\" field should be hidden, got %v", err)
+	}
+
+	_, err = getValue(t, "missing", ctx)
+	if !errors.As(err, &noProp) {
+		t.Errorf("expected NoSuchPropertyError, got %v", err)
+	}
+
+	_, err = getValue(t, "broken", ctx)
+	if err == nil || !strings.Contains(err.Error(), "broken getter") {
+		t.Errorf("getter error should be returned, got %v", err)
+	}
+}
+
+func TestSetProperty(t *testing.T) {
+	bean := newBean()
+	ctx := NewContext(bean)
+	tests := []struct {
+		input string
+		value any
+		check func() any
+		want  any
+	}{
+		{"title", "Grace", func() any { return bean.setCalled }, true},
+		{"alias", "admiral", func() any { return bean.Nick }, "admiral"},
+		{"count", "42", func() any { return bean.Count }, 42},
+		{"ready", 0, func() any { return bean.Ready }, false},
+		{"child.name", "Lovelace", func() any { return bean.Child.Name }, "Lovelace"},
+		{"tags['lang']", "ognl", func() any { return bean.Tags["lang"] }, "ognl"},
+		{"values[2]", "x", func() any { return bean.values[2] }, "x"},
+		{"attribute['new']", 7, func() any { return bean.attrs["new"] }, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if err := SetValue(parse(t, tt.input), ctx, tt.value); err != nil {
+				t.Fatalf("SetValue(%q) error: %v", tt.input, err)
+			}
+			if got := tt.check(); got != tt.want {
+				t.Errorf("after SetValue(%q): got %#v, want %#v", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	// 非指针的结构体不能写入
+	err := SetValue(parse(t, "name"), NewContext(Bean{}), "x")
+	if err == nil {
+		t.Error("expected error when setting a property on a non-addressable struct")
+	}
+
+	// 数值转换失败
+	err = SetValue(parse(t, "count"), ctx, "  ")
+	if err == nil {
+		t.Error("expected number format error for blank string")
+	}
+}
+
+func TestPropertyCacheConcurrent(t *testing.T) {
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			b := newBean()
+			b.Name = fmt.Sprint(i)
+			v, err := GetProperty(b, "title")
+			if err == nil && v != "Mr. "+b.Name {
+				err = fmt.Errorf("got %v", v)
+			}
+			done <- err
+		}(i)
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
+}
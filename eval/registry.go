@@ -0,0 +1,178 @@
+package eval
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Class 求值器中的 Java 类：静态方法、静态字段和构造器
+// 静态方法和构造器可以重载，调用时按参数类型选择最合适的一个
+type Class struct {
+	Name    string
+	Type    reflect.Type // 实例的 Go 类型，用于 instanceof 和数组元素类型，可以为 nil
+	methods map[string][]reflect.Value
+	fields  map[string]any
+	ctors   []reflect.Value
+}
+
+// NewClass 创建类，typ 是实例的 Go 类型 (可以为 nil)
+func NewClass(name string, typ reflect.Type) *Class {
+	return &Class{
+		Name:    name,
+		Type:    typ,
+		methods: map[string][]reflect.Value{},
+		fields:  map[string]any{},
+	}
+}
+
+// AddMethod 添加静态方法，同名方法多次添加即为重载
+func (c *Class) AddMethod(name string, fn any) *Class {
+	c.methods[name] = append(c.methods[name], mustFunc(fn))
+	return c
+}
+
+// AddField 添加静态字段
+func (c *Class) AddField(name string, value any) *Class {
+	c.fields[name] = value
+	return c
+}
+
+// AddConstructor 添加构造器，多次添加即为重载
+func (c *Class) AddConstructor(fn any) *Class {
+	c.ctors = append(c.ctors, mustFunc(fn))
+	return c
+}
+
+// Field 读取静态字段
+func (c *Class) Field(name string) (any, bool) {
+	v, ok := c.fields[name]
+	return v, ok
+}
+
+func (c *Class) String() string { return "class " + c.Name }
+
+// mustFunc 检查注册的值是函数，注册错误属于编程错误，直接 panic
+func mustFunc(fn any) reflect.Value {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		panic(fmt.Sprintf("eval: %T is not a function", fn))
+	}
+	return v
+}
+
+// Registry 类和扩展方法注册表 (对应 Java OGNL 的 ClassResolver 与 MethodAccessor)
+//
+// 扩展方法为已有的 Go 类型补充 Java 风格的方法，例如让 Go 字符串支持 "abc".length()，
+// 注册的函数第一个参数是接收者。
+// Registry 应在求值前配置完成，求值期间只读，可以被多个 goroutine 共享
+type Registry struct {
+	classes     map[string]*Class
+	typeMethods map[reflect.Type]map[string][]reflect.Value
+	kindMethods map[reflect.Kind]map[string][]reflect.Value
+}
+
+// NewRegistry 创建注册表，包含内置的 java.lang 类和 Java 风格的字符串、数值、集合方法
+func NewRegistry() *Registry {
+	r := newEmptyRegistry()
+	for name, c := range builtinRegistry.classes {
+		r.classes[name] = c
+	}
+	for t, methods := range builtinRegistry.typeMethods {
+		r.typeMethods[t] = copyMethods(methods)
+	}
+	for k, methods := range builtinRegistry.kindMethods {
+		r.kindMethods[k] = copyMethods(methods)
+	}
+	return r
+}
+
+func newEmptyRegistry() *Registry {
+	return &Registry{
+		classes:     map[string]*Class{},
+		typeMethods: map[reflect.Type]map[string][]reflect.Value{},
+		kindMethods: map[reflect.Kind]map[string][]reflect.Value{},
+	}
+}
+
+func copyMethods(m map[string][]reflect.Value) map[string][]reflect.Value {
+	out := make(map[string][]reflect.Value, len(m))
+	for name, fns := range m {
+		out[name] = append([]reflect.Value(nil), fns...)
+	}
+	return out
+}
+
+// AddClass 注册类，同名类会被替换
+func (r *Registry) AddClass(c *Class) *Registry {
+	r.classes[c.Name] = c
+	return r
+}
+
+// AddMethod 为 Go 类型 t 添加扩展方法，fn 的第一个参数是接收者
+func (r *Registry) AddMethod(t reflect.Type, name string, fn any) *Registry {
+	if r.typeMethods[t] == nil {
+		r.typeMethods[t] = map[string][]reflect.Value{}
+	}
+	r.typeMethods[t][name] = append(r.typeMethods[t][name], mustFunc(fn))
+	return r
+}
+
+// AddKindMethod 为某一类 Go 值 (所有字符串、所有切片……) 添加扩展方法
+// kind 为 reflect.Interface 时对所有非 null 对象生效，对应 java.lang.Object 的方法
+func (r *Registry) AddKindMethod(kind reflect.Kind, name string, fn any) *Registry {
+	if r.kindMethods[kind] == nil {
+		r.kindMethods[kind] = map[string][]reflect.Value{}
+	}
+	r.kindMethods[kind][name] = append(r.kindMethods[kind][name], mustFunc(fn))
+	return r
+}
+
+// Class 按名称查找类，找不到时尝试 java.lang 包 (与 DefaultClassResolver 一致)
+func (r *Registry) Class(name string) (*Class, error) {
+	if c, ok := r.classes[name]; ok {
+		return c, nil
+	}
+	if !strings.Contains(name, ".") {
+		if c, ok := r.classes["java.lang."+name]; ok {
+			return c, nil
+		}
+	}
+	return nil, &ClassNotFoundError{Name: name}
+}
+
+// ClassNotFoundError 类未注册 (对应 Java 的 ClassNotFoundException)
+type ClassNotFoundError struct {
+	Name string
+}
+
+func (e *ClassNotFoundError) Error() string {
+	return fmt.Sprintf("class %s not found", e.Name)
+}
+
+// extensionTiers 返回接收者可用的扩展方法，按类型、种类、Object 的优先级排列
+func (r *Registry) extensionTiers(recv reflect.Value, name string) [][]reflect.Value {
+	var tiers [][]reflect.Value
+	if fns := r.typeMethods[recv.Type()][name]; len(fns) > 0 {
+		tiers = append(tiers, fns)
+	}
+	kind := recv.Kind()
+	if kind == reflect.Pointer && recv.Elem().Kind() == reflect.Array {
+		kind = reflect.Array
+	}
+	if fns := r.kindMethods[kind][name]; len(fns) > 0 {
+		tiers = append(tiers, fns)
+	}
+	if isIntegerKind(kind) || kind == reflect.Float32 || kind == reflect.Float64 {
+		if fns := r.kindMethods[numberKind][name]; len(fns) > 0 {
+			tiers = append(tiers, fns)
+		}
+	}
+	if fns := r.kindMethods[reflect.Interface][name]; len(fns) > 0 {
+		tiers = append(tiers, fns)
+	}
+	return tiers
+}
+
+// numberKind 内部使用的伪种类，注册对所有数值生效的方法 (java.lang.Number)
+const numberKind = reflect.UnsafePointer + 100
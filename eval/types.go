@@ -0,0 +1,60 @@
+package eval
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// javaTypes 常用 Java 类型到 Go 值的判断，用于 instanceof
+var javaTypes = map[string]func(v any) bool{
+	"java.lang.Object":     func(v any) bool { return !isNil(v) },
+	"java.lang.String":     func(v any) bool { _, ok := stringLike(v); return ok },
+	"java.lang.Boolean":    func(v any) bool { return numericType(v) == numBool },
+	"java.lang.Character":  func(v any) bool { _, ok := v.(Char); return ok },
+	"java.lang.Byte":       func(v any) bool { return numericType(v) == numByte },
+	"java.lang.Short":      func(v any) bool { return numericType(v) == numShort },
+	"java.lang.Integer":    func(v any) bool { return numericType(v) == numInt },
+	"java.lang.Long":       func(v any) bool { return numericType(v) == numLong },
+	"java.lang.Float":      func(v any) bool { return numericType(v) == numFloat },
+	"java.lang.Double":     func(v any) bool { return numericType(v) == numDouble },
+	"java.math.BigInteger": func(v any) bool { _, ok := v.(*big.Int); return ok },
+	"java.math.BigDecimal": func(v any) bool { _, ok := v.(*big.Float); return ok },
+	"java.lang.Number": func(v any) bool {
+		t := numericType(v)
+		return t != numNonNumeric && t != numBool && t != numChar
+	},
+	"java.lang.Iterable":   isSequence,
+	"java.util.Collection": isSequence,
+	"java.util.List":       isSequence,
+	"java.util.Map":        func(v any) bool { return kindOf(v) == reflect.Map },
+}
+
+// InstanceOf 判断值是否为指定 Java 类型的实例
+// 类名可以省略 java.lang. 前缀；未知类名返回错误
+func InstanceOf(v any, className string) (bool, error) {
+	check, ok := javaTypes[className]
+	if !ok && !strings.Contains(className, ".") {
+		check, ok = javaTypes["java.lang."+className]
+	}
+	if !ok {
+		return false, fmt.Errorf("class %s not found", className)
+	}
+	if isNil(v) {
+		return false, nil
+	}
+	return check(v), nil
+}
+
+func isSequence(v any) bool {
+	k := kindOf(v)
+	return k == reflect.Slice || k == reflect.Array
+}
+
+func kindOf(v any) reflect.Kind {
+	if v == nil {
+		return reflect.Invalid
+	}
+	return reflect.ValueOf(v).Kind()
+}
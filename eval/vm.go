@@ -0,0 +1,350 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// =============================================================================
+// 虚拟机 - 执行 bytecode.go 中的指令
+// =============================================================================
+//
+// 执行字节码时预算的 MaxSteps 按执行的指令数计数，其他预算与解释执行相同。
+
+// Run 在上下文中执行字节码，等同于 GetValue
+func (b *Bytecode) Run(ctx *Context) (any, error) {
+	return b.RunProfile(context.Background(), ctx, nil)
+}
+
+// RunContext 与 Run 相同，goCtx 结束时返回 LimitDeadline 的 BudgetError
+func (b *Bytecode) RunContext(goCtx context.Context, ctx *Context) (any, error) {
+	return b.RunProfile(goCtx, ctx, nil)
+}
+
+// RunProfile 执行字节码并把每条指令的执行次数和耗时累加到 prof (可以为 nil)
+func (b *Bytecode) RunProfile(goCtx context.Context, ctx *Context, prof *Profile) (result any, err error) {
+	defer recoverPanic(&err)
+	e := newEvaluator(goCtx, ctx)
+	e.profile = prof
+	if err := e.checkDeadline(); err != nil {
+		return nil, err
+	}
+	return e.exec(b.Functions[0], ctx.Root())
+}
+
+// BytecodeError 字节码执行出错的位置
+type BytecodeError struct {
+	Op   Opcode
+	PC   int
+	Expr string // 出错指令对应的表达式
+	Err  error
+}
+
+func (e *BytecodeError) Error() string {
+	return fmt.Sprintf("%s at %04d [%s]: %v", e.Op, e.PC, e.Expr, e.Err)
+}
+
+func (e *BytecodeError) Unwrap() error { return e.Err }
+
+// instrError 为错误附加指令信息，与 wrapError 一样保留最内层的位置
+func instrError(fn *Function, pc int, err error) error {
+	switch err.(type) {
+	case *BytecodeError, *EvalError:
+		return err
+	}
+	return &BytecodeError{Op: fn.Code[pc].Op, PC: pc, Expr: fn.prog.Names[fn.Sources[pc]], Err: err}
+}
+
+// Profile 按操作码统计的执行次数和耗时
+// 耗时包含指令内部的方法调用，以及投影、选择和 lambda 中嵌套执行的指令
+// Profile 不是并发安全的，每个 goroutine 应使用自己的 Profile
+type Profile struct {
+	Counts    [numOpcodes]int64
+	Durations [numOpcodes]time.Duration
+}
+
+// String 按执行次数从多到少列出执行过的操作码
+func (p *Profile) String() string {
+	var ops []Opcode
+	for op := Opcode(0); op < numOpcodes; op++ {
+		if p.Counts[op] > 0 {
+			ops = append(ops, op)
+		}
+	}
+	sort.SliceStable(ops, func(i, j int) bool { return p.Counts[ops[i]] > p.Counts[ops[j]] })
+	var sb strings.Builder
+	for _, op := range ops {
+		fmt.Fprintf(&sb, "%-20s %10d %12s\n", op, p.Counts[op], p.Durations[op])
+	}
+	return sb.String()
+}
+
+// instrLink 链接时为指令准备的内联缓存和解析好的运算符
+type instrLink struct {
+	site  *propertySite
+	cache *inlineCache
+	op    ast.TokenType
+}
+
+// operatorTokens 运算符名称到 TokenType 的映射，字节码中按名称保存运算符，不依赖 TokenType 的数值
+var operatorTokens = sync.OnceValue(func() map[string]ast.TokenType {
+	m := make(map[string]ast.TokenType, len(ast.TokenTypeNames))
+	for t, name := range ast.TokenTypeNames {
+		m[name] = t
+	}
+	return m
+})
+
+// link 为每条指令创建内联缓存并解析运算符
+func (b *Bytecode) link() error {
+	for _, fn := range b.Functions {
+		fn.prog = b
+		fn.links = make([]instrLink, len(fn.Code))
+		for pc, in := range fn.Code {
+			l := &fn.links[pc]
+			switch in.Op {
+			case OpGetProp, OpGetIndexed:
+				l.site = &propertySite{name: b.Names[in.A]}
+			case OpCall, OpCallStatic, OpNew:
+				l.cache = &inlineCache{}
+			case OpBinary, OpUnary:
+				op, ok := operatorTokens()[b.Names[in.A]]
+				if !ok {
+					return fmt.Errorf("unknown operator %q at %04d", b.Names[in.A], pc)
+				}
+				l.op = op
+			}
+		}
+	}
+	return nil
+}
+
+// exec 以 this 为当前对象执行函数，返回栈上唯一的值
+func (e *evaluator) exec(fn *Function, this any) (any, error) {
+	prog, code, links := fn.prog, fn.Code, fn.links
+	stack := make([]any, 0, 8)
+	var saved []any // OpEnter 保存的当前对象
+	prof := e.profile
+
+	for pc := 0; pc < len(code); pc++ {
+		in := code[pc]
+		if err := e.step(); err != nil {
+			return nil, instrError(fn, pc, err)
+		}
+		var start time.Time
+		if prof != nil {
+			prof.Counts[in.Op]++
+			start = time.Now()
+		}
+
+		var (
+			v   any
+			err error
+			n   = len(stack)
+		)
+		switch in.Op {
+		case OpConst:
+			stack = append(stack, prog.Consts[in.A])
+		case OpPop:
+			stack = stack[:n-1]
+		case OpThis:
+			stack = append(stack, this)
+		case OpRoot:
+			stack = append(stack, e.ctx.Root())
+		case OpEnter:
+			saved = append(saved, this)
+			this = stack[n-1]
+			stack = stack[:n-1]
+		case OpEnterRoot:
+			saved = append(saved, this)
+			this = e.ctx.Root()
+		case OpLeave:
+			this = saved[len(saved)-1]
+			saved = saved[:len(saved)-1]
+		case OpLoadVar:
+			stack = append(stack, e.ctx.variable(prog.Names[in.A]))
+		case OpStoreVar:
+			e.ctx.Set(prog.Names[in.A], stack[n-1])
+		case OpStoreRoot:
+			e.ctx.SetRoot(stack[n-1])
+
+		case OpGetProp:
+			v, err = links[pc].site.get(stack[n-1])
+			stack[n-1] = v
+		case OpSetProp:
+			value, obj := stack[n-2], stack[n-1]
+			err = SetProperty(obj, prog.Names[in.A], value)
+			stack = stack[:n-1]
+		case OpGetIndex:
+			v, err = GetIndex(stack[n-2], stack[n-1])
+			stack = append(stack[:n-2], v)
+		case OpSetIndex:
+			value, obj, index := stack[n-3], stack[n-2], stack[n-1]
+			err = SetIndex(obj, index, value)
+			stack = stack[:n-2]
+		case OpGetIndexed:
+			v, err = getIndexed(links[pc].site, stack[n-2], stack[n-1])
+			stack = append(stack[:n-2], v)
+		case OpSetIndexed:
+			value, owner, index := stack[n-3], stack[n-2], stack[n-1]
+			err = setIndexed(owner, prog.Names[in.A], index, value)
+			stack = stack[:n-2]
+		case OpDynIndex:
+			v, err = dynamicIndex(stack[n-1], ast.DynamicSubscriptType(in.A), e.ctx.budget.MaxCollectionSize)
+			stack[n-1] = v
+		case OpSetDynIndex:
+			value, obj := stack[n-2], stack[n-1]
+			err = SetDynamicIndex(obj, ast.DynamicSubscriptType(in.A), value)
+			stack = stack[:n-1]
+
+		case OpCall:
+			argc := int(in.B)
+			args := append([]any(nil), stack[n-argc:]...)
+			recv := stack[n-argc-1]
+			v, err = e.result(callMethod(e.ctx.Registry(), links[pc].cache, recv, prog.Names[in.A], args))
+			stack = append(stack[:n-argc-1], v)
+		case OpCallStatic:
+			argc := int(in.C)
+			args := append([]any(nil), stack[n-argc:]...)
+			v, err = e.result(callStatic(e.ctx.Registry(), links[pc].cache, prog.Names[in.A], prog.Names[in.B], args))
+			stack = append(stack[:n-argc], v)
+		case OpNew:
+			argc := int(in.B)
+			args := append([]any(nil), stack[n-argc:]...)
+			v, err = e.result(construct(e.ctx.Registry(), links[pc].cache, prog.Names[in.A], args))
+			stack = append(stack[:n-argc], v)
+		case OpNewArray:
+			v, err = e.newSizedArray(e.ctx.Registry(), prog.Names[in.A], stack[n-1])
+			stack[n-1] = v
+		case OpNewArrayInit:
+			count := int(in.B)
+			if err = e.checkCollection(count); err == nil {
+				v, err = NewArray(e.ctx.Registry(), prog.Names[in.A], 0, append([]any{}, stack[n-count:]...))
+			}
+			stack = append(stack[:n-count], v)
+		case OpStaticField:
+			v, err = GetStaticField(e.ctx.Registry(), prog.Names[in.A], prog.Names[in.B])
+			stack = append(stack, v)
+
+		case OpBinary:
+			v, err = e.binary(links[pc].op, stack[n-2], stack[n-1])
+			stack = append(stack[:n-2], v)
+		case OpUnary:
+			v, err = Unary(links[pc].op, stack[n-1])
+			stack[n-1] = v
+		case OpInstanceof:
+			v, err = InstanceOf(stack[n-1], prog.Names[in.A])
+			stack[n-1] = v
+
+		case OpJump:
+			pc = int(in.A) - 1
+		case OpJumpIfFalse:
+			cond := stack[n-1]
+			stack = stack[:n-1]
+			if !BooleanValue(cond) {
+				pc = int(in.A) - 1
+			}
+		case OpJumpIfFalseOrPop:
+			if !BooleanValue(stack[n-1]) {
+				pc = int(in.A) - 1
+			} else {
+				stack = stack[:n-1]
+			}
+		case OpJumpIfTrueOrPop:
+			if BooleanValue(stack[n-1]) {
+				pc = int(in.A) - 1
+			} else {
+				stack = stack[:n-1]
+			}
+
+		case OpList:
+			count := int(in.A)
+			if err = e.checkCollection(count); err == nil {
+				v = append([]any{}, stack[n-count:]...)
+			}
+			stack = append(stack[:n-count], v)
+		case OpMap:
+			count := int(in.A)
+			v, err = e.newMap(stack[n-2*count:])
+			stack = append(stack[:n-2*count], v)
+		case OpLambda:
+			sub := prog.Functions[in.A]
+			stack = append(stack, &Lambda{Body: sub.body, code: sub})
+		case OpEval:
+			v, err = e.call(stack[n-2], stack[n-1])
+			stack = append(stack[:n-2], v)
+		case OpProject:
+			sub := prog.Functions[in.A]
+			v, err = e.project(stack[n-1], func(elem any) (any, error) { return e.exec(sub, elem) })
+			stack[n-1] = v
+		case OpSelect:
+			sub := prog.Functions[in.A]
+			v, err = e.selectFrom(stack[n-1], prog.Names[in.B], func(elem any) (any, error) { return e.exec(sub, elem) })
+			stack[n-1] = v
+		default:
+			err = fmt.Errorf("unknown opcode %s", in.Op)
+		}
+
+		if prof != nil {
+			prof.Durations[in.Op] += time.Since(start)
+		}
+		if err != nil {
+			return nil, instrError(fn, pc, err)
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("malformed bytecode: %d values on the stack at return", len(stack))
+	}
+	return stack[0], nil
+}
+
+// getIndexed 链中的 name[index]：对象有索引属性时调用 getValues(int) / getAttribute(String)，
+// 否则先取属性再取下标
+func getIndexed(site *propertySite, obj, index any) (any, error) {
+	if !isNil(obj) && site.lookup(receiver(reflect.ValueOf(obj)).Type()).indexKind != NotIndexed {
+		v, _, err := getIndexedProperty(obj, site.name, index)
+		return v, err
+	}
+	v, err := site.get(obj)
+	if err != nil {
+		return nil, err
+	}
+	return GetIndex(v, index)
+}
+
+// setIndexed foo.name[index] = value，优先使用索引属性的 setter
+func setIndexed(owner any, name string, index, value any) error {
+	if IndexedPropertyKind(owner, name) != NotIndexed {
+		if handled, err := setIndexedProperty(owner, name, index, value); handled {
+			return err
+		}
+	}
+	obj, err := GetProperty(owner, name)
+	if err != nil {
+		return err
+	}
+	return SetIndex(obj, index, value)
+}
+
+// newMap 由交替排列的键和值构造 Map 字面量
+func (e *evaluator) newMap(pairs []any) (any, error) {
+	if err := e.checkCollection(len(pairs) / 2); err != nil {
+		return nil, err
+	}
+	m := make(map[any]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key := pairs[i]
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, fmt.Errorf("%s cannot be used as a map key", typeName(reflect.TypeOf(key)))
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
@@ -0,0 +1,208 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// compileBytecode 解析并编译为字节码，失败时终止测试
+func compileBytecode(t testing.TB, input string) *Bytecode {
+	t.Helper()
+	b, err := CompileBytecode(parse(t, input))
+	if err != nil {
+		t.Fatalf("compile %q: %v", input, err)
+	}
+	return b
+}
+
+// cause 去掉求值位置信息后的错误原因，用于比较解释执行和字节码的错误
+func cause(err error) string {
+	for {
+		switch e := err.(type) {
+		case *EvalError:
+			err = e.Err
+		case *BytecodeError:
+			err = e.Err
+		default:
+			return fmt.Sprint(err)
+		}
+	}
+}
+
+var bytecodeCases = append([]struct {
+	input string
+	ctx   func() *Context
+}{
+	{"values[1] = \"z\", values[1]", func() *Context { return NewContext(newBean()) }},
+	{"child.name = \"Z\", child.title", func() *Context { return NewContext(newBean()) }},
+	{"tags['os'] = \"mac\", tags.os", func() *Context { return NewContext(newBean()) }},
+	{"#root = 5, #root + 1", func() *Context { return NewContext(newBean()) }},
+	{"list[^] = 1, list[$] = 2, list", collectionsContext},
+	{"tags[*]", collectionsContext},
+	{"people.{$ count < 5}.{name}", collectionsContext},
+	{"#s = \"1 + 2\", #s(0)", collectionsContext},
+	{"people[0].(name + count)", collectionsContext},
+	{"new String[]{\"a\", name}", collectionsContext},
+	{"!(list.size > 2) || name.startsWith(\"o\")", collectionsContext},
+	{"1H + 2.5B", collectionsContext},
+}, compiledCases...)
+
+func TestBytecodeMatchesInterpreter(t *testing.T) {
+	for _, tc := range bytecodeCases {
+		t.Run(tc.input, func(t *testing.T) {
+			want, wantErr := getValue(t, tc.input, tc.ctx())
+			b := compileBytecode(t, tc.input)
+			data, err := b.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded Bytecode
+			if err := loaded.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			for name, prog := range map[string]*Bytecode{"compiled": b, "loaded": &loaded} {
+				got, err := prog.Run(tc.ctx())
+				if cause(err) != cause(wantErr) {
+					t.Fatalf("%s: error = %v, interpreter error = %v", name, err, wantErr)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: Run = %#v, interpreter = %#v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBytecodeErrors(t *testing.T) {
+	_, err := compileBytecode(t, "child.child.name").Run(NewContext(newBean()))
+	var bcErr *BytecodeError
+	if !errors.As(err, &bcErr) || bcErr.Op != OpGetProp || bcErr.Expr != "name" {
+		t.Errorf("expected BytecodeError at GET_PROP name, got %v", err)
+	}
+	var nullErr *NullSourceError
+	if !errors.As(err, &nullErr) {
+		t.Errorf("BytecodeError should wrap NullSourceError, got %v", err)
+	}
+
+	for _, input := range []string{"1 = 2", "list[*] = 1"} {
+		if _, err := CompileBytecode(parse(t, input)); err == nil {
+			t.Errorf("%s: expected compile error", input)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	got := Disassemble(compileBytecode(t, "people.{? count > 2}.{name}"))
+	for _, want := range []string{
+		"function 0 (main): people.{? (count > 2)}.{name}",
+		"GET_PROP             people",
+		"SELECT               function 1 all",
+		"PROJECT              function 2",
+		"function 1 (selection): count > 2",
+		"BINARY               GT",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("disassembly missing %q:\n%s", want, got)
+		}
+	}
+
+	got = Disassemble(compileBytecode(t, "a && b ? 1L : 'c'"))
+	for _, want := range []string{"JUMP_IF_FALSE_OR_POP -> 0005", "CONST                1L", "CONST                'c'"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("disassembly missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestBytecodeEncoding(t *testing.T) {
+	b := compileBytecode(t, "#f = :[#this * 2.5B + 10H], #f(-0.0) + 'x' + 1.5f")
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded Bytecode
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if Disassemble(&loaded) != Disassemble(b) {
+		t.Errorf("round trip changed the program:\n%s\nvs\n%s", Disassemble(&loaded), Disassemble(b))
+	}
+	for i, c := range b.Consts {
+		if bi, ok := c.(*big.Int); ok && bi.Cmp(loaded.Consts[i].(*big.Int)) != 0 {
+			t.Errorf("big integer constant changed: %v", loaded.Consts[i])
+		}
+	}
+
+	// 截断、篡改的数据都应被拒绝，不能 panic
+	for n := 0; n < len(data); n++ {
+		if err := new(Bytecode).UnmarshalBinary(data[:n]); !errors.Is(err, ErrInvalidBytecode) {
+			t.Fatalf("truncated at %d: expected ErrInvalidBytecode, got %v", n, err)
+		}
+	}
+	for _, corrupt := range []func(p *Bytecode){
+		func(p *Bytecode) { p.Functions[0].Code[0].A = 1000 },
+		func(p *Bytecode) { p.Functions[0].Code[0].Op = numOpcodes },
+		func(p *Bytecode) { p.Functions[0].Sources[0] = -1 },
+		func(p *Bytecode) { p.Functions[1].Kind = FuncProjection },
+		func(p *Bytecode) { p.Names[p.Functions[1].Code[len(p.Functions[1].Code)-1].A] = "NO_SUCH_OP" },
+	} {
+		p := compileBytecode(t, "#f = :[#this * 2], #f(1)")
+		corrupt(p)
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := new(Bytecode).UnmarshalBinary(data); !errors.Is(err, ErrInvalidBytecode) {
+			t.Errorf("expected ErrInvalidBytecode, got %v", err)
+		}
+	}
+}
+
+func TestBytecodeBudgetAndProfile(t *testing.T) {
+	for _, tc := range []struct {
+		input  string
+		budget EvalBudget
+		limit  BudgetLimit
+	}{
+		{"#f = :[#this <= 0 ? 0 : #f(#this - 1)], #f(100)", EvalBudget{MaxSteps: 50}, LimitSteps},
+		{"#f = :[#f(#this)], #f(1)", EvalBudget{MaxCallDepth: 5}, LimitCallDepth},
+		{"naturals().{#this}", EvalBudget{MaxCollectionSize: 10}, LimitCollectionSize},
+		{"\"ab\".concat(\"cd\")", EvalBudget{MaxStringLength: 3}, LimitStringLength},
+	} {
+		_, err := compileBytecode(t, tc.input).Run(budgetContext(tc.budget))
+		expectBudgetError(t, err, tc.limit)
+	}
+
+	var prof Profile
+	ctx := collectionsContext()
+	v, err := compileBytecode(t, "people.{? count > 2}.{name}").RunProfile(t.Context(), ctx, &prof)
+	if err != nil || !reflect.DeepEqual(v, []any{"Ada", "Byron", "Grace"}) {
+		t.Fatalf("Run = %#v, %v", v, err)
+	}
+	// 选择对 3 个元素各执行一次 count > 2，投影对 3 个结果各执行一次 name
+	if prof.Counts[OpBinary] != 3 || prof.Counts[OpGetProp] != 1+3+3 || prof.Counts[OpSelect] != 1 {
+		t.Errorf("unexpected profile:\n%s", prof.String())
+	}
+	if !strings.Contains(prof.String(), "GET_PROP") {
+		t.Errorf("profile report missing GET_PROP:\n%s", prof.String())
+	}
+}
+
+func BenchmarkBytecode(b *testing.B) {
+	for _, bm := range benchmarkInputs {
+		b.Run(bm.name, func(b *testing.B) {
+			prog := compileBytecode(b, bm.input)
+			ctx := benchmarkContext()
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := prog.Run(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package extract
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// =============================================================================
+// 编码层
+// =============================================================================
+
+// decodeLayers 反复剥去 URL 编码和 HTML 实体，直到文本不再变化或达到 max 层
+// form 为 true 时第一层 URL 解码把 '+' 当作空格，之后的层只解码 %XX
+// 无效的 %XX (如 S2-045 载荷中的 "%{") 原样保留
+func decodeLayers(s string, form bool, max int) (string, []string) {
+	var layers []string
+	for len(layers) < max {
+		if d := percentDecode(s, form && len(layers) == 0); d != s {
+			s = d
+			layers = append(layers, LayerURL)
+			continue
+		}
+		if strings.Contains(s, "&") {
+			if d := html.UnescapeString(s); d != s {
+				s = d
+				layers = append(layers, LayerHTML)
+				continue
+			}
+		}
+		break
+	}
+	return s, layers
+}
+
+// decodeForm 解码一层表单编码，用于参数名
+func decodeForm(s string) string {
+	return percentDecode(s, true)
+}
+
+// percentDecode 解码有效的 %XX，plus 为 true 时把 '+' 解码为空格
+func percentDecode(s string, plus bool) string {
+	if !strings.Contains(s, "%") && !(plus && strings.Contains(s, "+")) {
+		return s
+	}
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			sb.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		case c == '+' && plus:
+			sb.WriteByte(' ')
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// prefixes Struts 在参数名和值中识别的导航前缀，前缀之后的内容会被当作 OGNL 求值
+var prefixes = []string{"redirectAction:", "redirect:", "action:", "method:"}
+
+// cutPrefix 去掉开头的导航前缀，返回剩余的文本和去掉的前缀
+func cutPrefix(s string) (string, string) {
+	for _, p := range prefixes {
+		if rest, ok := strings.CutPrefix(s, p); ok {
+			return rest, p
+		}
+	}
+	return s, ""
+}
+
+// fragment %{} / ${} 包装中的一段 OGNL
+type fragment struct {
+	source  string
+	wrapper string // LayerPercent 或 LayerDollar
+}
+
+// unwrap 找出文本中所有 %{...} 和 ${...} 包装的片段，包装内部的引号和嵌套的花括号被正确跳过
+// 没有闭合的包装取到文本末尾
+func unwrap(s string) []fragment {
+	var out []fragment
+	for i := 0; i+1 < len(s); i++ {
+		if (s[i] != '%' && s[i] != '$') || s[i+1] != '{' {
+			continue
+		}
+		wrapper := LayerPercent
+		if s[i] == '$' {
+			wrapper = LayerDollar
+		}
+		end := closingBrace(s, i+2)
+		out = append(out, fragment{source: s[i+2 : end], wrapper: wrapper})
+		i = end
+	}
+	return out
+}
+
+// closingBrace 返回从 start 开始与已打开的 '{' 匹配的 '}' 的下标，找不到时返回 len(s)
+func closingBrace(s string, start int) int {
+	depth := 1
+	var quote byte
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// rawPart multipart 请求体中的一个部分
+type rawPart struct {
+	headers []string // "Name: value" 形式的头部行
+	body    []byte
+}
+
+// header 返回第一个名为 name 的头部的值，名字不区分大小写
+func (p rawPart) header(name string) string {
+	for _, line := range p.headers {
+		if k, v, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(k), name) {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// splitMultipart 按分隔行切分 multipart 请求体
+// 不使用 mime/multipart：它拒绝头部中的 NUL 等字符，而 S2-046 载荷正依赖 Commons FileUpload 接受它们
+func splitMultipart(body []byte, boundary string) []rawPart {
+	delim := []byte("--" + boundary)
+	var parts []rawPart
+	chunks := bytes.Split(body, delim)
+	// 第一个分隔行之前是前言，最后一个分隔行 "--boundary--" 之后是结语
+	for _, chunk := range chunks[1:] {
+		if bytes.HasPrefix(chunk, []byte("--")) {
+			break
+		}
+		chunk = bytes.TrimPrefix(bytes.TrimPrefix(chunk, []byte("\r")), []byte("\n"))
+		head, data, ok := bytes.Cut(chunk, []byte("\r\n\r\n"))
+		if !ok {
+			head, data, _ = bytes.Cut(chunk, []byte("\n\n"))
+		}
+		data = bytes.TrimSuffix(bytes.TrimSuffix(data, []byte("\n")), []byte("\r"))
+		var headers []string
+		for _, line := range strings.Split(string(head), "\n") {
+			if line = strings.TrimSuffix(line, "\r"); line != "" {
+				headers = append(headers, line)
+			}
+		}
+		parts = append(parts, rawPart{headers: headers, body: data})
+	}
+	return parts
+}
+
+// dispositionParams 解析 Content-Disposition 的参数
+// 不使用 mime.ParseMediaType：它会拒绝载荷中常见的非法字符，multipart.Part.FileName 还会去掉路径
+func dispositionParams(header string) map[string]string {
+	params := map[string]string{}
+	_, rest, _ := strings.Cut(header, ";")
+	for rest != "" {
+		var param string
+		param, rest = cutParam(rest)
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '"' {
+			value = unquote(value)
+		}
+		params[key] = value
+	}
+	return params
+}
+
+// cutParam 在引号外的第一个 ';' 处切分
+func cutParam(s string) (string, string) {
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		case ';':
+			if !inQuote {
+				return s[:i], s[i+1:]
+			}
+		}
+	}
+	return s, ""
+}
+
+// unquote 去掉引号，只处理 \" 和 \\ 转义，Windows 路径中的其他反斜杠保持原样
+func unquote(s string) string {
+	s = strings.TrimPrefix(s, "\"")
+	s = strings.TrimSuffix(s, "\"")
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(s)
+}
+
+// =============================================================================
+// 没有包装的文本是否作为候选
+// =============================================================================
+
+var (
+	// acceptedName Struts 默认接受的参数名：a.b、a[0]、a['b']、a(0)、a('b')
+	acceptedName = regexp.MustCompile(`^\w+(\.\w+|\[\d+\]|\(\d+\)|\['\w+'\]|\('\w+'\))*$`)
+	// ognlMarker 参数值中的 OGNL 特征：变量引用 #x 或静态引用 @a.B@
+	ognlMarker = regexp.MustCompile(`#[\p{L}_]|@[\w.$]+@`)
+)
+
+// wrappedOnly 路径和请求头只检查 %{} / ${} 包装的片段
+func wrappedOnly(string) bool { return false }
+
+// paramName 参数名不符合 Struts 的普通参数名格式时作为候选
+func paramName(s string) bool { return s != "" && !acceptedName.MatchString(s) }
+
+// paramValue 参数值中出现 OGNL 特征时作为候选
+func paramValue(s string) bool { return ognlMarker.MatchString(s) }
@@ -0,0 +1,364 @@
+// Package extract 从 HTTP 请求中找出可能被 Struts 当作 OGNL 求值的片段
+//
+// OGNL 注入出现在请求的多个位置：
+//   - 参数名和参数值，包括 redirect:、action:、method: 前缀 (S2-016、S2-032)
+//   - Content-Type 请求头 (S2-045) 和其他请求头中的 %{} / ${}
+//   - multipart 的 filename 字段 (S2-046)
+//   - URL 路径和命名空间中的 ${} (S2-057)
+//
+// 每个片段先剥去 URL 编码 (可能多层)、HTML 实体、上述前缀和 %{} / ${} 包装，
+// 再用 ast 包解析。剥去的每一层按顺序记录在 Candidate.Layers 中。
+package extract
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// Location 片段在请求中的位置
+type Location int
+
+const (
+	Path Location = iota
+	QueryName
+	QueryValue
+	FormName
+	FormValue
+	MultipartName
+	MultipartValue
+	MultipartFilename
+	Header
+)
+
+var locationNames = [...]string{
+	Path:              "path",
+	QueryName:         "query-name",
+	QueryValue:        "query-value",
+	FormName:          "form-name",
+	FormValue:         "form-value",
+	MultipartName:     "multipart-name",
+	MultipartValue:    "multipart-value",
+	MultipartFilename: "multipart-filename",
+	Header:            "header",
+}
+
+func (l Location) String() string {
+	if l >= 0 && int(l) < len(locationNames) {
+		return locationNames[l]
+	}
+	return fmt.Sprintf("Location(%d)", int(l))
+}
+
+// 剥去的编码层，前缀层记录前缀本身 (如 "redirect:")
+const (
+	LayerURL     = "url"
+	LayerHTML    = "html"
+	LayerPercent = "%{}"
+	LayerDollar  = "${}"
+)
+
+// Candidate 一个可能被求值的 OGNL 片段
+type Candidate struct {
+	Location Location
+	// Name 参数名、请求头名或 multipart 字段名，路径为段的序号 (从 0 开始)
+	Name string
+	// Raw 片段所在的原始文本，未做任何解码
+	Raw string
+	// Source 剥去所有编码层后的 OGNL 源码
+	Source string
+	// Layers 按剥去的顺序排列的编码层
+	Layers []string
+	// Expr 解析得到的语法树，解析失败时为 nil
+	Expr ast.Expression
+	// Err 解析错误，或片段超出长度上限 (ErrCandidateTooLong)
+	Err error
+	// Heuristic 片段没有 %{} / ${} 包装和 redirect: 等前缀，只是参数名或参数值看起来像 OGNL；
+	// 这样的片段解析失败时通常只是普通文本，如 items[] 或 "I love #golang!!"
+	Heuristic bool
+}
+
+func (c Candidate) String() string {
+	return fmt.Sprintf("%s %s: %s", c.Location, c.Name, c.Source)
+}
+
+// ErrTooManyCandidates 请求中的候选片段超过上限，已返回的片段之后的内容没有检查
+var ErrTooManyCandidates = errors.New("too many OGNL candidates")
+
+// ErrBodyTooLarge 请求体超过 MaxBodySize (multipart 请求体为 MaxUploadSize)，超出的部分没有检查
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// ErrCandidateTooLong 片段超过 MaxLength，没有解析
+var ErrCandidateTooLong = errors.New("candidate too long")
+
+// Limits 提取的资源上限，字段为 0 时使用默认值
+type Limits struct {
+	MaxBodySize     int64 // 检查的请求体字节数，更大的请求体返回 ErrBodyTooLarge；multipart 中的文件内容不计入
+	MaxUploadSize   int64 // 读取的 multipart 请求体 (包括文件内容) 的最大字节数，小于 MaxBodySize 时按 MaxBodySize
+	MaxCandidates   int   // 返回的候选片段数
+	MaxLength       int   // 解析的单个片段的最大长度，更长的片段不解析，Err 说明原因
+	MaxDecodeLayers int   // 剥去的 URL 编码和 HTML 实体的最大层数
+}
+
+// DefaultLimits 默认的资源上限
+var DefaultLimits = Limits{
+	MaxBodySize:     1 << 20,
+	MaxUploadSize:   32 << 20,
+	MaxCandidates:   256,
+	MaxLength:       16 << 10,
+	MaxDecodeLayers: 4,
+}
+
+// Extractor 按给定上限从请求中提取候选片段，可以被多个 goroutine 同时使用
+type Extractor struct {
+	limits Limits
+}
+
+// New 创建提取器，limits 中为 0 的字段使用 DefaultLimits
+func New(limits Limits) *Extractor {
+	if limits.MaxBodySize == 0 {
+		limits.MaxBodySize = DefaultLimits.MaxBodySize
+	}
+	if limits.MaxUploadSize == 0 {
+		limits.MaxUploadSize = DefaultLimits.MaxUploadSize
+	}
+	if limits.MaxCandidates == 0 {
+		limits.MaxCandidates = DefaultLimits.MaxCandidates
+	}
+	if limits.MaxLength == 0 {
+		limits.MaxLength = DefaultLimits.MaxLength
+	}
+	if limits.MaxDecodeLayers == 0 {
+		limits.MaxDecodeLayers = DefaultLimits.MaxDecodeLayers
+	}
+	return &Extractor{limits: limits}
+}
+
+// Limits 返回提取器使用的上限
+func (e *Extractor) Limits() Limits {
+	return e.limits
+}
+
+var defaultExtractor = New(Limits{})
+
+// Request 使用默认上限从请求中提取候选片段
+func Request(r *http.Request) ([]Candidate, error) {
+	return defaultExtractor.Request(r)
+}
+
+// Raw 使用默认上限从原始 HTTP/1.1 请求中提取候选片段
+func Raw(raw []byte) ([]Candidate, error) {
+	return defaultExtractor.Raw(raw)
+}
+
+// Raw 解析原始 HTTP/1.1 请求并提取候选片段
+func (e *Extractor) Raw(raw []byte) ([]Candidate, error) {
+	r, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		return nil, err
+	}
+	return e.Request(r)
+}
+
+// Request 按路径、查询参数、请求头、请求体的顺序提取候选片段
+//
+// 请求体最多检查 MaxBodySize 字节；读取的部分会放回 r.Body，之后的处理程序仍能读到完整的请求体。
+// multipart 请求体中的文件内容不检查，也不计入 MaxBodySize，整个请求体最多读取 MaxUploadSize 字节，
+// 上传文件不会因为 MaxBodySize 被拒绝。
+// 候选片段超过 MaxCandidates 时返回已提取的片段和 ErrTooManyCandidates；
+// 请求体超过上限时返回从读取的部分中提取的片段和 ErrBodyTooLarge。
+func (e *Extractor) Request(r *http.Request) ([]Candidate, error) {
+	c := &collector{limits: e.limits}
+
+	path, query := requestTarget(r)
+	for i, segment := range strings.Split(path, "/") {
+		c.text(Path, fmt.Sprint(i-1), segment, false, wrappedOnly)
+	}
+	c.params(query, QueryName, QueryValue)
+
+	names := make([]string, 0, len(r.Header))
+	for name := range r.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range r.Header[name] {
+			c.text(Header, name, v, false, wrappedOnly)
+		}
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	limit := e.limits.MaxBodySize
+	boundary := multipartBoundary(contentType)
+	if boundary != "" && e.limits.MaxUploadSize > limit {
+		limit = e.limits.MaxUploadSize
+	}
+	body, err := readBody(r, limit)
+	if err != nil && err != ErrBodyTooLarge {
+		return nil, err
+	}
+	if err == nil && boundary != "" && int64(len(body)) > e.limits.MaxBodySize &&
+		int64(len(body)-fileBytes(body, boundary)) > e.limits.MaxBodySize {
+		err = ErrBodyTooLarge
+	}
+	if len(body) > 0 {
+		c.body(contentType, body)
+	}
+
+	if c.full {
+		return c.out, ErrTooManyCandidates
+	}
+	return c.out, err
+}
+
+// requestTarget 返回请求行中未解码的路径和查询字符串
+func requestTarget(r *http.Request) (path, query string) {
+	if strings.HasPrefix(r.RequestURI, "/") {
+		path, query, _ = strings.Cut(r.RequestURI, "?")
+		return path, query
+	}
+	if r.URL == nil {
+		return "", ""
+	}
+	return r.URL.EscapedPath(), r.URL.RawQuery
+}
+
+// multipartBoundary 返回 multipart 请求体的分隔符，不是 multipart 时返回空字符串
+func multipartBoundary(contentType string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return ""
+	}
+	return params["boundary"]
+}
+
+// fileBytes 返回 multipart 请求体中文件内容的总字节数
+func fileBytes(body []byte, boundary string) int {
+	n := 0
+	for _, part := range splitMultipart(body, boundary) {
+		if _, ok := dispositionParams(part.header("Content-Disposition"))["filename"]; ok {
+			n += len(part.body)
+		}
+	}
+	return n
+}
+
+// readBody 读取至多 max 字节的请求体，并把读到的内容放回 r.Body
+// 请求体超过 max 字节时返回前 max 字节和 ErrBodyTooLarge
+func readBody(r *http.Request, max int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(buf), r.Body), Closer: r.Body}
+	if int64(len(buf)) > max {
+		return buf[:max], ErrBodyTooLarge
+	}
+	return buf, nil
+}
+
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// collector 收集候选片段
+type collector struct {
+	limits Limits
+	out    []Candidate
+	full   bool // 已达到 MaxCandidates
+}
+
+// params 提取 a=1&b=2 形式的参数，名字和值分别检查
+func (c *collector) params(raw string, nameLoc, valueLoc Location) {
+	for _, pair := range strings.Split(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		rawName, rawValue, _ := strings.Cut(pair, "=")
+		name := decodeForm(rawName)
+		c.text(nameLoc, name, rawName, true, paramName)
+		c.text(valueLoc, name, rawValue, true, paramValue)
+	}
+}
+
+// body 按 Content-Type 提取表单和 multipart 请求体中的参数
+func (c *collector) body(contentType string, body []byte) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return
+	}
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		c.params(string(body), FormName, FormValue)
+	case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "":
+		c.multipart(body, params["boundary"])
+	}
+}
+
+// multipart 提取 multipart 请求体中的字段名、普通字段的值和文件名
+// 请求体可能因为上限被截断，截断之前的部分照常检查；文件内容不检查
+func (c *collector) multipart(body []byte, boundary string) {
+	for _, part := range splitMultipart(body, boundary) {
+		disposition := dispositionParams(part.header("Content-Disposition"))
+		name := disposition["name"]
+		c.text(MultipartName, name, name, false, paramName)
+		if filename, ok := disposition["filename"]; ok {
+			c.text(MultipartFilename, name, filename, false, paramValue)
+			continue
+		}
+		c.text(MultipartValue, name, string(part.body), false, paramValue)
+	}
+}
+
+// text 剥去 raw 的编码层，把其中的 OGNL 片段加入结果
+// form 表示 raw 是 URL 编码的表单文本 ('+' 表示空格)，suspicious 判断没有 %{} / ${} 包装的文本是否作为候选
+func (c *collector) text(loc Location, name, raw string, form bool, suspicious func(string) bool) {
+	if raw == "" || c.full {
+		return
+	}
+	decoded, layers := decodeLayers(raw, form, c.limits.MaxDecodeLayers)
+	decoded, prefix := cutPrefix(decoded)
+	if prefix != "" {
+		layers = append(layers, prefix)
+	}
+	fragments := unwrap(decoded)
+	if len(fragments) == 0 {
+		if prefix == "" && !suspicious(decoded) {
+			return
+		}
+		fragments = []fragment{{source: decoded}}
+	}
+	heuristic := prefix == "" && fragments[0].wrapper == ""
+	for _, f := range fragments {
+		if len(c.out) == c.limits.MaxCandidates {
+			c.full = true
+			return
+		}
+		cand := Candidate{Location: loc, Name: name, Raw: raw, Source: f.source, Layers: layers, Heuristic: heuristic}
+		if f.wrapper != "" {
+			cand.Layers = append(append([]string(nil), layers...), f.wrapper)
+		}
+		c.parse(&cand)
+		c.out = append(c.out, cand)
+	}
+}
+
+func (c *collector) parse(cand *Candidate) {
+	if len(cand.Source) > c.limits.MaxLength {
+		cand.Err = fmt.Errorf("%w: %d bytes exceeds the %d byte limit", ErrCandidateTooLong, len(cand.Source), c.limits.MaxLength)
+		return
+	}
+	cand.Expr, cand.Err = ast.New(ast.NewLexer(cand.Source)).ParseTopLevelExpression()
+}
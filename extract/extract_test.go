@@ -0,0 +1,186 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// summarize 把候选片段格式化为 "位置 名字 [编码层] 源码"，便于比较
+func summarize(cands []Candidate) string {
+	var lines []string
+	for _, c := range cands {
+		lines = append(lines, fmt.Sprintf("%s %s %v %s", c.Location, c.Name, c.Layers, c.Source))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rawRequest 拼出原始请求，有请求体时补上 Content-Length
+func rawRequest(requestLine string, headers []string, body string) []byte {
+	lines := append([]string{requestLine, "Host: example.com"}, headers...)
+	if body != "" {
+		lines = append(lines, fmt.Sprintf("Content-Length: %d", len(body)))
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n\r\n" + body)
+}
+
+func TestRaw(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      []byte
+		expected []string
+	}{
+		{"S2-045 content type", rawRequest("POST /upload.action HTTP/1.1",
+			[]string{"Content-Type: %{(#nike='multipart/form-data').(#cmd='id')}"}, ""), []string{
+			"header Content-Type [%{}] (#nike='multipart/form-data').(#cmd='id')",
+		}},
+		{"S2-046 filename", rawRequest("POST /upload.action HTTP/1.1",
+			[]string{"Content-Type: multipart/form-data; boundary=XX"},
+			"--XX\r\n"+
+				"Content-Disposition: form-data; name=\"upload\"; filename=\"%{#context['com.opensymphony.xwork2.dispatcher.HttpServletResponse']}\x00b\"\r\n"+
+				"\r\ndata\r\n"+
+				"--XX\r\n"+
+				"Content-Disposition: form-data; name=\"desc\"\r\n"+
+				"\r\n@java.lang.Runtime@getRuntime()\r\n"+
+				"--XX--\r\n"), []string{
+			"multipart-filename upload [%{}] #context['com.opensymphony.xwork2.dispatcher.HttpServletResponse']",
+			"multipart-value desc [] @java.lang.Runtime@getRuntime()",
+		}},
+		{"S2-057 namespace", rawRequest("GET /struts2/%24%7B(111+111)%7D/actionChain1.action HTTP/1.1", nil, ""), []string{
+			"path 1 [url ${}] (111+111)",
+		}},
+		{"S2-016 redirect prefix", rawRequest(
+			"GET /index.action?redirect:%24%7B%23context%5B%27xwork.MethodAccessor.denyMethodExecution%27%5D%3Dfalse%7D HTTP/1.1", nil, ""), []string{
+			"query-name redirect:${#context['xwork.MethodAccessor.denyMethodExecution']=false} [url redirect: ${}] #context['xwork.MethodAccessor.denyMethodExecution']=false",
+		}},
+		{"S2-032 method prefix and double encoding", rawRequest(
+			"GET /index.action?method:%2523_memberAccess%253d%2540ognl.OgnlContext%2540DEFAULT_MEMBER_ACCESS=x&user.name=bob HTTP/1.1", nil, ""), []string{
+			"query-name method:%23_memberAccess%3d%40ognl.OgnlContext%40DEFAULT_MEMBER_ACCESS [url url method:] #_memberAccess=@ognl.OgnlContext@DEFAULT_MEMBER_ACCESS",
+		}},
+		{"form values and html entities", rawRequest("POST /save.action HTTP/1.1",
+			[]string{"Content-Type: application/x-www-form-urlencoded"},
+			"name=%28%23a%3D%40java.lang.Runtime%40getRuntime%28%29%29&note=%26%2335%3Bx&email=a%40b.com"), []string{
+			"form-value name [url] (#a=@java.lang.Runtime@getRuntime())",
+			"form-value note [url html] #x",
+		}},
+		{"benign request", rawRequest("GET /list.action?page=2&sort=name&user.address['city']=x HTTP/1.1",
+			[]string{"User-Agent: Mozilla/5.0 (X11; Linux x86_64)", "Cookie: JSESSIONID=abc"}, ""), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cands, err := Raw(tt.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := summarize(cands), strings.Join(tt.expected, "\n"); got != want {
+				t.Errorf("candidates:\n%s\nwant:\n%s", got, want)
+			}
+			for _, c := range cands {
+				if c.Err != nil || c.Expr == nil {
+					t.Errorf("%s: parse error %v", c, c.Err)
+				}
+			}
+		})
+	}
+}
+
+// TestRequestBodyReplay 提取之后处理程序仍能读到完整的请求体
+func TestRequestBodyReplay(t *testing.T) {
+	body := "a=%23x&b=" + strings.Repeat("y", 100)
+	r := httptest.NewRequest("POST", "/save.action", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	cands, err := New(Limits{MaxBodySize: 16}).Request(r)
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("Request error = %v, want ErrBodyTooLarge", err)
+	}
+	if got := summarize(cands); got != "form-value a [url] #x" {
+		t.Errorf("candidates = %s", got)
+	}
+	rest, err := io.ReadAll(r.Body)
+	if err != nil || string(rest) != body {
+		t.Errorf("body after extraction = %q, %v", rest, err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?a=%23a&b=%23b&c=%23c", nil)
+	cands, err := New(Limits{MaxCandidates: 2}).Request(r)
+	if !errors.Is(err, ErrTooManyCandidates) || len(cands) != 2 {
+		t.Errorf("Request = %d candidates, %v", len(cands), err)
+	}
+
+	// 恰好 MaxBodySize 字节的请求体不是错误
+	r = httptest.NewRequest("POST", "/", strings.NewReader("a=%23x"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cands, err = New(Limits{MaxBodySize: 6}).Request(r); err != nil || len(cands) != 1 {
+		t.Errorf("Request = %v, %v", cands, err)
+	}
+	r = httptest.NewRequest("POST", "/", strings.NewReader("a=%23x&"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cands, err = New(Limits{MaxBodySize: 6}).Request(r); !errors.Is(err, ErrBodyTooLarge) || len(cands) != 1 {
+		t.Errorf("Request = %v, %v", cands, err)
+	}
+
+	r = httptest.NewRequest("GET", "/?a=%23"+strings.Repeat("a", 64), nil)
+	cands, err = New(Limits{MaxLength: 32}).Request(r)
+	if err != nil || len(cands) != 1 || !errors.Is(cands[0].Err, ErrCandidateTooLong) || cands[0].Expr != nil {
+		t.Errorf("Request = %v, %v", cands, err)
+	}
+
+	// multipart 中的文件内容不计入 MaxBodySize，其余部分仍然计入
+	upload := func(file, desc string) *http.Request {
+		body := "--XX\r\nContent-Disposition: form-data; name=\"f\"; filename=\"a.bin\"\r\n\r\n" + file +
+			"\r\n--XX\r\nContent-Disposition: form-data; name=\"desc\"\r\n\r\n" + desc + "\r\n--XX--\r\n"
+		r := httptest.NewRequest("POST", "/upload.action", strings.NewReader(body))
+		r.Header.Set("Content-Type", "multipart/form-data; boundary=XX")
+		return r
+	}
+	limits := Limits{MaxBodySize: 256, MaxUploadSize: 4 << 10}
+	if cands, err = New(limits).Request(upload(strings.Repeat("x", 1<<10), "#a")); err != nil || len(cands) != 1 {
+		t.Errorf("upload: %v, %v", cands, err)
+	}
+	if _, err = New(limits).Request(upload("x", strings.Repeat("y", 512))); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("large field: %v", err)
+	}
+	if _, err = New(limits).Request(upload(strings.Repeat("x", 8<<10), "")); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("large upload: %v", err)
+	}
+}
+
+// TestHeuristic 没有包装和前缀的片段标记为 Heuristic
+func TestHeuristic(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?items[]=1&comment=I+love+%23golang!!&redirect:%23a&x=%25%7B%23b%7D", nil)
+	cands, err := Request(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range cands {
+		got = append(got, fmt.Sprintf("%s %s %v %v", c.Location, c.Source, c.Heuristic, c.Err != nil))
+	}
+	expected := []string{
+		"query-name items[] true true",
+		"query-value I love #golang!! true true",
+		"query-name #a false false",
+		"query-value #b false false",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("candidates:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	got := unwrap("a%{1 + {'}': 2}['}']}b${x}c${unclosed")
+	var parts []string
+	for _, f := range got {
+		parts = append(parts, f.wrapper+" "+f.source)
+	}
+	expected := "%{} 1 + {'}': 2}['}']|${} x|${} unclosed"
+	if strings.Join(parts, "|") != expected {
+		t.Errorf("unwrap = %q", parts)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/weaweawe01/ParserOgnl/analyze"
 	"github.com/weaweawe01/ParserOgnl/ast"
 )
 
@@ -34,4 +35,11 @@ func main() {
 	fmt.Println("AST 结构:")
 	ast.PrintASTStructure(expr, 0)
 
+	// 输出安全检查结果
+	fmt.Println("安全检查:")
+	for _, f := range analyze.Analyze(expr) {
+		line, col := f.Span.Position(input)
+		fmt.Printf("  %d:%d [%s] %s: %s\n", line, col, f.Severity, f.Rule, f.Message)
+	}
+
 }
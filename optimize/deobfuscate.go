@@ -0,0 +1,269 @@
+package optimize
+
+import (
+	"context"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/dataflow"
+	"github.com/weaweawe01/ParserOgnl/eval"
+)
+
+// =============================================================================
+// 反混淆 - 计算载荷中拼出类名和命令的纯运算，还原它们的字面写法
+// =============================================================================
+//
+// 反混淆在常量折叠的基础上还计算一小组没有副作用的运算：
+//   - 字符串拼接和字符运算 ("java.l" + "ang.Run" + "time")，由常量折叠完成
+//   - java.lang.String、Character、Integer 上的固定几个静态方法 (@java.lang.Character@toString(99))
+//   - 以常量数组构造字符串 (new java.lang.String(new byte[]{106, 97, 118, 97}))
+//   - 字符串字面量上的 concat、substring、replace 等方法 ("java.".concat("lang"))
+//   - 值确定为常量的变量引用，包括顺序执行的重新赋值 (#a = "Run", #a = #a + "time", ... #a)
+//
+// 这些运算通过求值器在不带根对象的上下文中执行，结果能表示为字面量时替换原节点。
+// 每一轮改写之后重新折叠，直到不再变化或达到轮数上限。
+
+// maxDeobfuscatePasses 反混淆的最大轮数
+const maxDeobfuscatePasses = 16
+
+var (
+	// revealHelpers 可以在反混淆时计算的静态方法
+	revealHelpers = map[string]map[string]bool{
+		"java.lang.String": {"valueOf": true},
+		"java.lang.Character": {
+			"toString": true, "valueOf": true, "toChars": true,
+			"toUpperCase": true, "toLowerCase": true,
+		},
+		"java.lang.Integer": {
+			"toString": true, "valueOf": true, "parseInt": true,
+			"toHexString": true, "toBinaryString": true,
+		},
+	}
+	// revealMethods 可以在字符串字面量上计算的实例方法
+	revealMethods = map[string]bool{
+		"concat":      true,
+		"substring":   true,
+		"replace":     true,
+		"toUpperCase": true,
+		"toLowerCase": true,
+		"trim":        true,
+		"toString":    true,
+		"intern":      true,
+		"charAt":      true,
+	}
+	// revealArrays 可以作为常量的数组元素类型
+	revealArrays = map[string]bool{
+		"byte": true, "char": true, "short": true, "int": true,
+		"String": true, "java.lang.String": true,
+	}
+)
+
+// Deobfuscate 返回还原后的新语法树和按发生顺序排列的改写记录，输入树保持不变
+// 还原产生的字面量使用被替换表达式的源码范围
+func Deobfuscate(expr ast.Expression) (ast.Expression, []Rewrite) {
+	expr, rewrites, _ := DeobfuscateContext(context.Background(), expr)
+	return expr, rewrites
+}
+
+// DeobfuscateContext 与 Deobfuscate 相同，ctx 结束时停止还原，返回已经还原的语法树、改写记录和 ctx.Err()
+func DeobfuscateContext(ctx context.Context, expr ast.Expression) (ast.Expression, []Rewrite, error) {
+	o := &optimizer{ctx: ctx}
+	for pass := 0; pass < maxDeobfuscatePasses; pass++ {
+		n := len(o.rewrites)
+		expr = o.expr(expr, true)
+		expr = ast.Transform(expr, o.reveal)
+		expr = o.propagate(expr)
+		if o.stopped {
+			return expr, o.rewrites, ctx.Err()
+		}
+		if len(o.rewrites) == n {
+			break
+		}
+	}
+	return expr, o.rewrites, nil
+}
+
+// reveal 计算参数都是常量的辅助方法、字符串构造器和字符串方法
+func (o *optimizer) reveal(node ast.Expression) ast.Expression {
+	if o.expired() {
+		return node
+	}
+	switch n := node.(type) {
+	case *ast.StaticMethodExpression, *ast.ConstructorExpression:
+		if isConstant(n) {
+			return o.evaluate(n, n)
+		}
+	case *ast.ChainExpression:
+		return o.revealChain(n)
+	}
+	return node
+}
+
+// revealChain 把链中 "字符串字面量.方法(常量...)" 的相邻两步合并为结果字面量
+func (o *optimizer) revealChain(n *ast.ChainExpression) ast.Expression {
+	children := n.Children
+	for i := 0; i+1 < len(children); i++ {
+		lit, ok := children[i].(*ast.Literal)
+		if !ok {
+			continue
+		}
+		if _, ok := lit.Value.(string); !ok {
+			continue
+		}
+		call, ok := children[i+1].(*ast.CallExpression)
+		if !ok || call.Object != nil || !revealMethods[call.Method] || !allConstant(call.Arguments) || !smallReplace(lit, call) {
+			continue
+		}
+		pair := &ast.ChainExpression{Children: []ast.Expression{lit, call}}
+		pair.SetSpan(ast.Span{Start: lit.Span().Start, End: call.Span().End})
+		result, ok := o.evaluate(pair, pair).(*ast.Literal)
+		if !ok {
+			continue
+		}
+		children = append(children[:i:i], append([]ast.Expression{result}, children[i+2:]...)...)
+		// 合并后的字面量可能还能与下一步合并
+		i--
+	}
+	if len(children) == 1 {
+		return children[0]
+	}
+	n.Children = children
+	return n
+}
+
+// smallReplace 报告 replace 的结果长度的上限是否不超过 maxStringLength：
+// 被替换的部分可以是单个字符或空串 ("ab".replace("", "x") 得到 "xaxbx")，
+// 结果在求值之后才能检查，因此先按最坏情况估计
+func smallReplace(lit *ast.Literal, call *ast.CallExpression) bool {
+	if call.Method != "replace" || len(call.Arguments) != 2 {
+		return true
+	}
+	repl, ok := call.Arguments[1].(*ast.Literal)
+	if !ok {
+		return false
+	}
+	n := len(lit.Value.(string))
+	return (n+1)*len(repl.Raw)+n <= maxStringLength
+}
+
+// evaluate 在空上下文中求值 node，结果能表示为字面量时替换 before，否则返回 node
+func (o *optimizer) evaluate(before, node ast.Expression) ast.Expression {
+	v, err := eval.GetValue(node, eval.NewContext(nil))
+	if err != nil {
+		return node
+	}
+	if !o.allowString(v) {
+		return node
+	}
+	lit, ok := newLiteral(v)
+	if !ok {
+		return node
+	}
+	lit.SetSpan(before.Span())
+	return o.record(RevealConstant, before, lit)
+}
+
+// isConstant 报告节点是否是反混淆可以计算的常量：字面量、常量数组、
+// 参数为常量的字符串构造器和允许的静态方法
+func isConstant(node ast.Expression) bool {
+	switch n := node.(type) {
+	case *ast.Literal:
+		return true
+	case *ast.ConstructorExpression:
+		if n.IsArray {
+			if !revealArrays[n.ClassName] || len(n.Arguments) != 1 {
+				return false
+			}
+			init, ok := n.Arguments[0].(*ast.ArrayExpression)
+			return ok && allConstant(init.Elements)
+		}
+		return javaLangName(n.ClassName) == "java.lang.String" && allConstant(n.Arguments)
+	case *ast.StaticMethodExpression:
+		return revealHelpers[javaLangName(n.ClassName)][n.Method] && allConstant(n.Arguments)
+	}
+	return false
+}
+
+func allConstant(nodes []ast.Expression) bool {
+	for _, n := range nodes {
+		if !isConstant(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// javaLangName 补全省略了 java.lang 包名的类名
+func javaLangName(name string) string {
+	if !strings.Contains(name, ".") {
+		return "java.lang." + name
+	}
+	return name
+}
+
+// =============================================================================
+// 常量变量传播
+// =============================================================================
+
+// propagate 把值确定为常量的变量引用代入常量：到达引用的赋值只有一个，每条执行路径都经过它，
+// 且赋的值是字面量 (dataflow.Graph.Value)。顺序执行的重新赋值 (#a = "Run", #a = #a + "time") 同样可以代入；
+// lambda 的调用时间未知，在 lambda 中赋值的变量不代入
+func (o *optimizer) propagate(expr ast.Expression) ast.Expression {
+	graph := dataflow.Analyze(expr)
+	unstable := lambdaAssigned(expr)
+	return ast.Substitute(expr, func(node ast.Expression) ast.Expression {
+		v, ok := node.(*ast.VariableExpression)
+		if !ok || unstable[v.Name] || o.expired() {
+			return nil
+		}
+		value, ok := graph.Value(v)
+		if !ok {
+			return nil
+		}
+		lit, ok := value.(*ast.Literal)
+		if !ok || !o.allowString(lit.Value) {
+			return nil
+		}
+		c := *lit
+		c.SetSpan(v.Span())
+		return o.record(PropagateConstant, v, &c)
+	})
+}
+
+// lambdaAssigned 返回在 lambda 函数体中赋值的变量
+func lambdaAssigned(expr ast.Expression) map[string]bool {
+	names := map[string]bool{}
+	var body func(node ast.Expression) bool
+	body = func(node ast.Expression) bool {
+		if a, ok := node.(*ast.AssignmentExpression); ok {
+			if name, ok := assignedVar(a.Left); ok {
+				names[name] = true
+			}
+		}
+		return true
+	}
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		switch n := node.(type) {
+		case *ast.LambdaExpression:
+			ast.Inspect(n.Body, body)
+			return false
+		case *ast.LambdaLiteral:
+			ast.Inspect(n.Body, body)
+			return false
+		}
+		return true
+	})
+	return names
+}
+
+// assignedVar 返回赋值目标修改的变量名，#a = ... 和 #a.b = ... 都修改 #a
+func assignedVar(target ast.Expression) (string, bool) {
+	if chain, ok := target.(*ast.ChainExpression); ok && len(chain.Children) > 0 {
+		target = chain.Children[0]
+	}
+	v, ok := target.(*ast.VariableExpression)
+	if !ok {
+		return "", false
+	}
+	return v.Name, true
+}
@@ -0,0 +1,114 @@
+package optimize
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+func TestDeobfuscate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"@java.lang.Class@forName(\"java.l\" + \"ang.Run\" + \"time\")", "@java.lang.Class@forName(\"java.lang.Runtime\")"},
+		{"new java.lang.String(new byte[]{106, 97, 118, 97})", "\"java\""},
+		{"new String(new char[]{'i', 'd'})", "\"id\""},
+		{"@java.lang.Character@toString(99) + @Character@toString(97 + 1)", "\"cb\""},
+		{"new String(@java.lang.Character@toChars(105))", "\"i\""},
+		{"@java.lang.String@valueOf(7) + @java.lang.Integer@toHexString(255)", "\"7ff\""},
+		{"'java.'.concat('lang').concat('.Run').toString().length()", "\"java.lang.Run\".length()"},
+		{"'RUNTIME'.toLowerCase().substring(0, 3).replace('r', 'R')", "\"Run\""},
+		{"#a = 'java.lang.', #b = #a.concat('Runtime'), @java.lang.Class@forName(#b)",
+			"#a = \"java.lang.\", #b = \"java.lang.Runtime\", @java.lang.Class@forName(\"java.lang.Runtime\")"},
+		// 顺序执行的重新赋值代入到达引用的那次赋值
+		{"#a = 'x', #a = 'y', #a", "#a = 'x', #a = 'y', 'y'"},
+		{`#a="java.lang.Run",#a=#a+"time",@java.lang.Class@forName(#a)`,
+			`#a = "java.lang.Run", #a = "java.lang.Runtime", @java.lang.Class@forName("java.lang.Runtime")`},
+		// 有条件的赋值、赋值之前的引用以及在 lambda 中赋值的变量都不代入
+		{"#a = 'x', #f = :[#a = 'y'], #f(1), #a", "#a = 'x', #f = :[#a = 'y'], (#f)(1), #a"},
+		{"flag ? (#a = 'x') : 1, #a", "(flag ? #a = 'x' : 1), #a"},
+		{"#a, #a = 'x'", "#a, #a = 'x'"},
+		// 不在允许列表中的方法和非常量参数保持原样
+		{"@java.lang.System@getProperty('user' + '.dir')", "@java.lang.System@getProperty(\"user.dir\")"},
+		{"new String(#bytes)", "new String(#bytes)"},
+		{"'id'.getBytes()", "\"id\".getBytes()"},
+		{"@java.lang.Integer@parseInt('zz')", "@java.lang.Integer@parseInt(\"zz\")"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr := parse(t, tt.input)
+			before := expr.String()
+			got, _ := Deobfuscate(expr)
+			if got.String() != tt.expected {
+				t.Errorf("Deobfuscate(%q) = %s, want %s", tt.input, got, tt.expected)
+			}
+			if expr.String() != before {
+				t.Errorf("input tree was modified: %s -> %s", before, expr)
+			}
+		})
+	}
+}
+
+func TestDeobfuscateRewrites(t *testing.T) {
+	input := "(#p = 'java.lang.').(@java.lang.Class@forName(#p.concat(new String(new byte[]{82, 117, 110})) + 'time'))"
+	got, rewrites := Deobfuscate(parse(t, input))
+	if !strings.Contains(got.String(), "\"java.lang.Runtime\"") {
+		t.Fatalf("Deobfuscate = %s", got)
+	}
+	var lines []string
+	for _, r := range rewrites {
+		lines = append(lines, r.Kind.String()+" "+r.Origin.Text(input))
+	}
+	expected := []string{
+		"reveal-constant new String(new byte[]{82, 117, 110})",
+		"propagate-constant #p",
+		"reveal-constant #p.concat(new String(new byte[]{82, 117, 110}))",
+		"fold-constant #p.concat(new String(new byte[]{82, 117, 110})) + 'time'",
+	}
+	if g, w := strings.Join(lines, "\n"), strings.Join(expected, "\n"); g != w {
+		t.Errorf("rewrites:\n%s\nwant:\n%s", g, w)
+	}
+}
+
+// TestDeobfuscateBudget 逐层拼接的变量经过代入后结果指数增长，产生的字符串受总长度限制
+func TestDeobfuscateBudget(t *testing.T) {
+	for _, terms := range []int{2, 8} {
+		var b strings.Builder
+		b.WriteString("#a0 = 'AAAA'")
+		for i := 1; i <= 12; i++ {
+			ref := fmt.Sprintf("#a%d", i-1)
+			fmt.Fprintf(&b, ", #a%d = %s", i, ref)
+			for j := 1; j < terms; j++ {
+				b.WriteString(" + " + ref)
+			}
+		}
+		b.WriteString(", #a12")
+		got, rewrites := Deobfuscate(parse(t, b.String()))
+		total := 0
+		ast.Inspect(got, func(node ast.Expression) bool {
+			if lit, ok := node.(*ast.Literal); ok {
+				if s, ok := lit.Value.(string); ok {
+					total += len(s)
+				}
+			}
+			return true
+		})
+		if total > maxStringTotal*2 {
+			t.Errorf("%d terms: literals total %d bytes", terms, total)
+		}
+		for _, r := range rewrites {
+			if lit, ok := r.Node.(*ast.Literal); ok && len(lit.Raw) > maxStringLength+2 {
+				t.Errorf("%d terms: rewrite produced %d bytes", terms, len(lit.Raw))
+			}
+		}
+	}
+	// replace 的结果按最坏情况估计
+	input := "#s = '" + strings.Repeat("x", 1<<10) + "', #s.replace('', #s).replace('', #s)"
+	got, _ := Deobfuscate(parse(t, input))
+	if n := len(got.String()); n > maxStringLength*2 {
+		t.Errorf("replace produced %d bytes", n)
+	}
+}
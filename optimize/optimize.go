@@ -0,0 +1,425 @@
+// Package optimize 在语法树层面做与求值结果无关的化简
+//
+// 优化器返回一棵新的语法树，输入树保持不变：
+//   - 只由字面量组成的一元、二元和条件表达式按 Java OGNL 的运算规则折叠为字面量
+//     (1 + 2 * 3、1L + 2、"a" + 'b'、-5H ...)，求值出错的子树 (1 / 0) 原样保留，错误在运行时报告
+//   - 嵌套的逗号序列展开为一层，序列中间不产生副作用的字面量被删除
+//   - 条件为字面量的条件表达式只保留会执行的分支，&& 和 || 的左侧为字面量时同样如此
+//
+// 新树中的每个节点都保留来源节点的源码范围；改写产生的节点使用被替换节点的范围，
+// 每次改写还记录在 Rewrite 中，便于把优化后的树映射回原始输入。
+package optimize
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/eval"
+)
+
+// Kind 改写的种类
+type Kind int
+
+const (
+	// FoldConstant 常量子表达式折叠为字面量
+	FoldConstant Kind = iota
+	// FlattenSequence 嵌套序列展开、删除序列中无用的字面量
+	FlattenSequence
+	// RemoveDeadBranch 删除永远不会执行的分支
+	RemoveDeadBranch
+	// SubstituteKnown 部分求值时代入已知的变量或根对象路径
+	SubstituteKnown
+	// RevealConstant 反混淆时计算参数都是常量的字符串辅助方法和构造器
+	RevealConstant
+	// PropagateConstant 反混淆时把值确定为常量的变量引用代入常量
+	PropagateConstant
+)
+
+var kindNames = [...]string{
+	FoldConstant:      "fold-constant",
+	FlattenSequence:   "flatten-sequence",
+	RemoveDeadBranch:  "remove-dead-branch",
+	SubstituteKnown:   "substitute-known",
+	RevealConstant:    "reveal-constant",
+	PropagateConstant: "propagate-constant",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Rewrite 一次改写
+type Rewrite struct {
+	Kind Kind
+	// Origin 被替换节点在源码中的范围，手工构造的节点为零值
+	Origin ast.Span
+	// Before 被替换的节点，其子节点可能已经被改写；需要时再格式化，
+	// 每次折叠都格式化整个子树会使逐层拼接的表达式的优化时间随长度平方增长
+	Before ast.Expression
+	// Node 新树中替换它的节点
+	Node ast.Expression
+}
+
+func (r Rewrite) String() string {
+	return fmt.Sprintf("%s %s: %s => %s", r.Kind, r.Origin, r.Before, r.Node)
+}
+
+// maxShift 折叠大整数左移时允许的最大位数，更大的位移留到运行时在预算内执行
+const maxShift = 1 << 12
+
+// maxStringLength 折叠和反混淆产生的字符串的最大长度，更长的结果保留原表达式
+const maxStringLength = 1 << 16
+
+// maxStringTotal 一次优化产生的所有字符串的总长度上限，超过后不再产生字符串：
+// 逐层拼接的变量 (#a1=#a0+#a0, #a2=#a1+#a1 ...) 经过代入后结果随输入指数增长
+const maxStringTotal = 1 << 20
+
+// Optimize 返回化简后的新语法树和按发生顺序排列的改写记录
+func Optimize(expr ast.Expression) (ast.Expression, []Rewrite) {
+	o := &optimizer{}
+	return o.expr(expr, true), o.rewrites
+}
+
+type optimizer struct {
+	rewrites []Rewrite
+	known    *bindings // 部分求值时已知的变量和根对象路径
+	strings  int       // 已经产生的字符串的总长度
+
+	ctx     context.Context // 非 nil 时结束后停止改写
+	visited int             // 访问过的节点数，用于定期检查 ctx
+	stopped bool            // ctx 已经结束
+}
+
+// checkInterval 每访问多少个节点检查一次 ctx
+const checkInterval = 256
+
+// expired 报告 ctx 是否已经结束，每访问 checkInterval 个节点检查一次；结束之后不再改写
+func (o *optimizer) expired() bool {
+	if o.ctx == nil || o.stopped {
+		return o.stopped
+	}
+	if o.visited++; o.visited%checkInterval == 1 && o.ctx.Err() != nil {
+		o.stopped = true
+	}
+	return o.stopped
+}
+
+// allowString 报告能否产生值为 v 的字面量：字符串不能超过 maxStringLength，
+// 产生的字符串的总长度不能超过 maxStringTotal；允许时计入总长度
+func (o *optimizer) allowString(v any) bool {
+	s, ok := v.(string)
+	if !ok {
+		return true
+	}
+	if len(s) > maxStringLength || o.strings+len(s) > maxStringTotal {
+		return false
+	}
+	o.strings += len(s)
+	return true
+}
+
+// record 记录一次改写，返回替换后的节点
+func (o *optimizer) record(kind Kind, before, node ast.Expression) ast.Expression {
+	o.rewrites = append(o.rewrites, Rewrite{Kind: kind, Origin: before.Span(), Before: before, Node: node})
+	return node
+}
+
+// expr 复制节点并化简其子节点，自底向上进行改写
+// root 表示节点是否在根对象上求值 (#this 为根对象)，只有这样的位置才能代入已知的根对象路径
+func (o *optimizer) expr(node ast.Expression, root bool) ast.Expression {
+	if o.expired() {
+		return node
+	}
+	if o.known != nil {
+		if sub, ok := o.substitute(node, root); ok {
+			return sub
+		}
+	}
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *ast.SequenceExpression:
+		return o.sequence(n, root)
+	case *ast.BinaryExpression:
+		c := *n
+		c.Left, c.Right = o.expr(n.Left, root), o.expr(n.Right, root)
+		return o.binary(n, &c)
+	case *ast.UnaryExpression:
+		c := *n
+		c.Operand = o.expr(n.Operand, root)
+		if v, ok := literalValue(c.Operand); ok {
+			if r, err := eval.Unary(n.Operator, v); err == nil {
+				return o.fold(n, &c, r)
+			}
+		}
+		return &c
+	case *ast.ConditionalExpression:
+		c := *n
+		c.Test, c.Consequent, c.Alternative = o.expr(n.Test, root), o.expr(n.Consequent, root), o.expr(n.Alternative, root)
+		if v, ok := literalValue(c.Test); ok {
+			if eval.BooleanValue(v) {
+				return o.record(RemoveDeadBranch, n, c.Consequent)
+			}
+			return o.record(RemoveDeadBranch, n, c.Alternative)
+		}
+		return &c
+	case *ast.AssignmentExpression:
+		c := *n
+		c.Left, c.Right = o.expr(n.Left, root), o.expr(n.Right, root)
+		return &c
+	case *ast.InstanceofExpression:
+		c := *n
+		c.Operand, c.TypeNode = o.expr(n.Operand, root), o.expr(n.TypeNode, root)
+		return &c
+	case *ast.LambdaExpression:
+		c := *n
+		c.Body = o.expr(n.Body, false)
+		return &c
+	case *ast.LambdaLiteral:
+		c := *n
+		c.Body = o.expr(n.Body, false)
+		return &c
+	case *ast.ChainExpression:
+		c := *n
+		c.Object, c.Property, c.Children = o.expr(n.Object, root), o.expr(n.Property, false), o.chain(n.Children, root)
+		return &c
+	case *ast.IndexExpression:
+		c := *n
+		c.Object, c.Index = o.expr(n.Object, root), o.expr(n.Index, true)
+		return &c
+	case *ast.CallExpression:
+		c := *n
+		c.Object, c.Arguments = o.expr(n.Object, root), o.list(n.Arguments, true)
+		return &c
+	case *ast.StaticMethodExpression:
+		c := *n
+		c.Arguments = o.list(n.Arguments, true)
+		return &c
+	case *ast.StaticFieldExpression:
+		c := *n
+		return &c
+	case *ast.ConstructorExpression:
+		c := *n
+		c.Arguments = o.list(n.Arguments, true)
+		return &c
+	case *ast.ProjectionExpression:
+		c := *n
+		c.Object, c.Expression = o.expr(n.Object, root), o.expr(n.Expression, false)
+		return &c
+	case *ast.SelectionExpression:
+		c := *n
+		c.Object, c.Expression = o.expr(n.Object, root), o.expr(n.Expression, false)
+		return &c
+	case *ast.EvalExpression:
+		c := *n
+		c.Target, c.Argument = o.expr(n.Target, root), o.expr(n.Argument, root)
+		return &c
+	case *ast.Identifier:
+		c := *n
+		c.NameNode = o.expr(n.NameNode, false)
+		return &c
+	case *ast.Literal:
+		c := *n
+		return &c
+	case *ast.ThisExpression:
+		c := *n
+		return &c
+	case *ast.RootExpression:
+		c := *n
+		return &c
+	case *ast.VariableExpression:
+		c := *n
+		return &c
+	case *ast.ArrayExpression:
+		c := *n
+		c.Elements = o.list(n.Elements, root)
+		return &c
+	case *ast.MapExpression:
+		c := *n
+		c.Pairs = o.list(n.Pairs, root)
+		return &c
+	case *ast.KeyValueExpression:
+		c := *n
+		c.Key, c.Value = o.expr(n.Key, root), o.expr(n.Value, root)
+		return &c
+	case *ast.DynamicSubscriptExpression:
+		c := *n
+		c.Object = o.expr(n.Object, root)
+		return &c
+	}
+	// 未知的节点类型无法安全复制，原样共享
+	return node
+}
+
+func (o *optimizer) list(nodes []ast.Expression, root bool) []ast.Expression {
+	if nodes == nil {
+		return nil
+	}
+	out := make([]ast.Expression, len(nodes))
+	for i, n := range nodes {
+		out[i] = o.expr(n, root)
+	}
+	return out
+}
+
+// chain 复制链的子节点，第一个子节点之后的节点作用于前一个结果
+// 链中的下标和方法参数仍然在根对象上求值，由 IndexExpression 和 CallExpression 各自处理
+func (o *optimizer) chain(nodes []ast.Expression, root bool) []ast.Expression {
+	if nodes == nil {
+		return nil
+	}
+	out := make([]ast.Expression, len(nodes))
+	for i, n := range nodes {
+		out[i] = o.expr(n, root && i == 0)
+	}
+	return out
+}
+
+// binary 折叠两侧都是字面量的二元运算，左侧为字面量时删除 && 和 || 不会执行的一侧
+func (o *optimizer) binary(n, c *ast.BinaryExpression) ast.Expression {
+	left, ok := literalValue(c.Left)
+	if !ok {
+		return c
+	}
+	switch n.Operator {
+	case ast.AND, ast.OR:
+		// 与求值器一致：a && b 在 a 为假时得到 a，否则得到 b；|| 相反
+		if eval.BooleanValue(left) == (n.Operator == ast.OR) {
+			return o.record(RemoveDeadBranch, n, c.Left)
+		}
+		return o.record(RemoveDeadBranch, n, c.Right)
+	case ast.SHL:
+		if count, ok := literalValue(c.Right); ok && !smallShift(left, count) {
+			return c
+		}
+	}
+	right, ok := literalValue(c.Right)
+	if !ok {
+		return c
+	}
+	v, err := eval.Binary(n.Operator, left, right)
+	if err != nil {
+		return c
+	}
+	return o.fold(n, c, v)
+}
+
+// smallShift 报告大整数左移的结果大小是否可以在编译时安全计算
+func smallShift(v, count any) bool {
+	switch v.(type) {
+	case *big.Int, *big.Float:
+	default:
+		return true
+	}
+	n := reflect.ValueOf(count)
+	switch n.Kind() {
+	case reflect.Int32, reflect.Int64:
+		return n.Int() >= 0 && n.Int() <= maxShift
+	}
+	return false
+}
+
+// fold 用结果值替换常量子表达式，结果无法表示为字面量时保留复制后的节点
+func (o *optimizer) fold(n, c ast.Expression, v any) ast.Expression {
+	if !o.allowString(v) {
+		return c
+	}
+	lit, ok := newLiteral(v)
+	if !ok {
+		return c
+	}
+	lit.SetSpan(n.Span())
+	return o.record(FoldConstant, n, lit)
+}
+
+// sequence 展开嵌套序列，删除除最后一项外的字面量
+func (o *optimizer) sequence(n *ast.SequenceExpression, root bool) ast.Expression {
+	var items []ast.Expression
+	changed := false
+	for _, e := range n.Expressions {
+		e = o.expr(e, root)
+		if inner, ok := e.(*ast.SequenceExpression); ok {
+			items = append(items, inner.Expressions...)
+			changed = true
+		} else {
+			items = append(items, e)
+		}
+	}
+	kept := items[:0]
+	for i, e := range items {
+		if _, ok := e.(*ast.Literal); ok && i < len(items)-1 {
+			changed = true
+			continue
+		}
+		kept = append(kept, e)
+	}
+
+	c := *n
+	c.Expressions = kept
+	switch {
+	case len(kept) == 1:
+		return o.record(FlattenSequence, n, kept[0])
+	case changed:
+		return o.record(FlattenSequence, n, &c)
+	}
+	return &c
+}
+
+// literalValue 返回字面量节点的运行时值
+func literalValue(node ast.Expression) (any, bool) {
+	lit, ok := node.(*ast.Literal)
+	if !ok {
+		return nil, false
+	}
+	return eval.LiteralValue(lit), true
+}
+
+// newLiteral 构造求值结果与 v 相同的字面量，字面量的写法与解析器产生的一致
+func newLiteral(v any) (*ast.Literal, bool) {
+	var lit *ast.Literal
+	switch x := v.(type) {
+	case nil:
+		lit = &ast.Literal{Value: nil, Raw: "null"}
+	case bool:
+		lit = &ast.Literal{Value: x, Raw: strconv.FormatBool(x)}
+	case string:
+		lit = &ast.Literal{Value: x, Raw: fmt.Sprintf("\"%s\"", x)}
+	case eval.Char:
+		lit = &ast.Literal{Value: rune(x), Raw: strconv.QuoteRune(rune(x))}
+	case int32:
+		lit = &ast.Literal{Value: int64(x), Raw: strconv.FormatInt(int64(x), 10)}
+	case int64:
+		lit = &ast.Literal{Value: x, Raw: strconv.FormatInt(x, 10) + "L"}
+	case *big.Int:
+		lit = &ast.Literal{Value: x.Int64(), Raw: x.String() + "H"}
+	case float32:
+		if math.IsInf(float64(x), 0) || math.IsNaN(float64(x)) {
+			return nil, false
+		}
+		lit = &ast.Literal{Value: float64(x), Raw: strconv.FormatFloat(float64(x), 'g', -1, 32) + "F"}
+	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return nil, false
+		}
+		lit = &ast.Literal{Value: x, Raw: strconv.FormatFloat(x, 'g', -1, 64)}
+	case *big.Float:
+		f, _ := x.Float64()
+		lit = &ast.Literal{Value: f, Raw: x.Text('g', -1) + "B"}
+	default:
+		return nil, false
+	}
+	// 字面量重新求值必须得到同类型、同值的结果，否则放弃折叠
+	back := eval.LiteralValue(lit)
+	if reflect.TypeOf(back) != reflect.TypeOf(v) || !eval.Equal(back, v) {
+		return nil, false
+	}
+	return lit, true
+}
@@ -0,0 +1,164 @@
+package optimize
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/eval"
+)
+
+func parse(t *testing.T, input string) ast.Expression {
+	t.Helper()
+	expr, err := ast.New(ast.NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatalf("parse %q: %v", input, err)
+	}
+	return expr
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"1L + 2", "3L"},
+		{"10 / 4", "2"},
+		{"10 / 4.0", "2.5"},
+		{"1.5f * 2", "3.0"},
+		{"7 % 3 << 2", "4"},
+		{"-5H * 2", "-10H"},
+		{"2.5B + 1", "3.5B"},
+		{"\"a\" + 1 + 'b'", "\"a1b\""},
+		{"'a' + 1", "\"a1\""},
+		{"3 > 2 == true", "true"},
+		{"!(1 == 1)", "false"},
+		{"~7 & 0xff", "248"},
+		{"x + 1 + 2", "(x + 1) + 2"},
+		{"x * (1 + 2)", "x * 3"},
+		{"1 / 0", "1 / 0"},
+		{"true ? a : b", "a"},
+		{"0 ? a : b.c", "b.c"},
+		{"1 > 2 ? a : (3 < 4 ? b : c)", "b"},
+		{"x ? 1 + 1 : 2", "x ? 2 : 2"},
+		{"false && x", "false"},
+		{"1 && x", "x"},
+		{"null || x.y", "x.y"},
+		{"\"true\" || x", "\"true\""},
+		{"\"s\" || x", "x"},
+		{"x && false", "x && false"},
+		{"(a, (b, 1, c)), d", "a, b, c, d"},
+		{"(1, 2), x", "x"},
+		{"#x = 1 + 1, #x", "#x = 2, #x"},
+		{"list.{? #this > 2 * 3}", "list.{? (#this > 6)}"},
+		{":[#this * (2 + 3)]", ":[#this * 5]"},
+		{"foo(1 + 1, \"a\" + \"b\")[2 - 1]", "foo(2, \"ab\")[1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr := parse(t, tt.input)
+			before := expr.String()
+			got, _ := Optimize(expr)
+			if got.String() != tt.expected {
+				t.Errorf("Optimize(%q) = %s, want %s", tt.input, got, tt.expected)
+			}
+			if expr.String() != before {
+				t.Errorf("input tree was modified: %s -> %s", before, expr)
+			}
+		})
+	}
+}
+
+// 优化前后在同一上下文中求值应当得到相同的结果和错误
+func TestOptimizePreservesValue(t *testing.T) {
+	inputs := []string{
+		"1 + 2 * 3 - 4 / 3",
+		"1L << 40 | 3",
+		"100H << 70",
+		"1H << 100000",
+		"0.1 + 0.2",
+		"1.5f / 3",
+		"1.1B * 3",
+		"'x' + 'y' + \"z\"",
+		"-(-2147483648)",
+		"2147483647 + 1",
+		"\"a\" == 'a' ? 1 : 2",
+		"(#x = 5, 1, #x * 2)",
+		"false || 0 || null",
+		"1 / 0 + 2",
+		"5 in {1, 5}",
+		"3 > 2.5 && \"1\" < \"2\"",
+	}
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			expr := parse(t, input)
+			want, wantErr := eval.GetValue(expr, eval.NewContext(nil))
+			opt, _ := Optimize(expr)
+			got, err := eval.GetValue(opt, eval.NewContext(nil))
+			if fmt.Sprint(err) != fmt.Sprint(wantErr) {
+				t.Fatalf("error = %v, before optimization = %v", err, wantErr)
+			}
+			if reflect.TypeOf(got) != reflect.TypeOf(want) || !eval.Equal(got, want) {
+				t.Errorf("optimized %s = %#v, before optimization = %#v", opt, got, want)
+			}
+		})
+	}
+}
+
+func TestOptimizeSpans(t *testing.T) {
+	input := "a + (2 * 3 + 1), true ? b : c, (1, d)"
+	opt, rewrites := Optimize(parse(t, input))
+	if opt.String() != "(a + 7), b, d" {
+		t.Fatalf("Optimize = %s", opt)
+	}
+
+	var got []string
+	for _, r := range rewrites {
+		got = append(got, fmt.Sprintf("%s %q", r.Kind, r.Origin.Text(input)))
+	}
+	want := []string{
+		`fold-constant "2 * 3"`,
+		`fold-constant "2 * 3 + 1"`,
+		`remove-dead-branch "true ? b : c"`,
+		`flatten-sequence "1, d"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("rewrites:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// 折叠产生的字面量指向被替换的源码，保留下来的节点指向自己的源码
+	seq := opt.(*ast.SequenceExpression)
+	sum := seq.Expressions[0].(*ast.BinaryExpression)
+	if text := sum.Right.Span().Text(input); text != "2 * 3 + 1" {
+		t.Errorf("folded literal span = %q", text)
+	}
+	if text := seq.Expressions[1].Span().Text(input); text != "b" {
+		t.Errorf("kept branch span = %q", text)
+	}
+	if text := seq.Span().Text(input); text != input {
+		t.Errorf("sequence span = %q", text)
+	}
+}
+
+// TestOptimizeLinear 逐层拼接的长表达式的折叠时间随长度线性增长，改写记录不格式化被替换的子树
+func TestOptimizeLinear(t *testing.T) {
+	elapsed := func(terms int) time.Duration {
+		expr := parse(t, `"a"`+strings.Repeat(` + "a"`, terms-1))
+		start := time.Now()
+		opt, rewrites := Optimize(expr)
+		d := time.Since(start)
+		if lit, ok := opt.(*ast.Literal); !ok || lit.Value != strings.Repeat("a", terms) || len(rewrites) != terms-1 {
+			t.Fatalf("%d terms: Optimize = %.40s, %d rewrites", terms, opt, len(rewrites))
+		}
+		return d
+	}
+	short, long := elapsed(250), elapsed(1000)
+	// 平方增长时 long 约为 short 的 16 倍
+	if long > 50*time.Millisecond && long > 10*short {
+		t.Errorf("250 terms: %v, 1000 terms: %v", short, long)
+	}
+}
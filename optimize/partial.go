@@ -0,0 +1,248 @@
+package optimize
+
+import (
+	"math"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/eval"
+)
+
+// =============================================================================
+// 部分求值 - 代入已知的变量和根对象路径后化简，剩下只引用未知量的表达式
+// =============================================================================
+//
+// known 的键有两种写法：
+//   - "#name" 表示上下文变量 #name
+//   - "a.b.c" 表示根对象上的属性路径，同时匹配 a.b.c 和 #root.a.b.c
+//
+// 已知值可以表示为字面量 (null、布尔、数值、字符串、字符) 时直接代入；
+// 其他值 (map、切片、对象) 沿链中后续的属性读取和字面量下标继续取值，直到得到可以代入的值。
+// 在表达式中被赋值的变量和根对象属性不会被代入，方法调用、构造器和静态引用保持原样。
+
+// PartialEval 代入已知量并折叠常量，返回只引用未知量的剩余表达式，输入树保持不变
+func PartialEval(expr ast.Expression, known map[string]any) ast.Expression {
+	o := &optimizer{known: newBindings(expr, known)}
+	return o.expr(expr, true)
+}
+
+// bindings 部分求值使用的已知量
+type bindings struct {
+	vars  map[string]any // 变量名 (不含 #) 到值
+	paths map[string]any // 根对象属性路径到值
+	// 表达式中被赋值的变量和根对象属性，它们的值在求值过程中可能改变
+	assignedVars  map[string]bool
+	assignedRoots map[string]bool
+}
+
+func newBindings(expr ast.Expression, known map[string]any) *bindings {
+	b := &bindings{
+		vars:          map[string]any{},
+		paths:         map[string]any{},
+		assignedVars:  map[string]bool{},
+		assignedRoots: map[string]bool{},
+	}
+	for k, v := range known {
+		if name, ok := strings.CutPrefix(k, "#"); ok {
+			b.vars[name] = v
+		} else {
+			b.paths[k] = v
+		}
+	}
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		if assign, ok := node.(*ast.AssignmentExpression); ok {
+			b.assigned(assign.Left)
+		}
+		return true
+	})
+	return b
+}
+
+// assigned 记录赋值目标的变量名或根对象上的第一级属性
+func (b *bindings) assigned(target ast.Expression) {
+	if chain, ok := target.(*ast.ChainExpression); ok && len(chain.Children) > 0 {
+		target = chain.Children[0]
+		if _, ok := target.(*ast.RootExpression); ok && len(chain.Children) > 1 {
+			target = chain.Children[1]
+		}
+	}
+	switch t := target.(type) {
+	case *ast.VariableExpression:
+		b.assignedVars[t.Name] = true
+	case *ast.Identifier:
+		b.assignedRoots[t.Value] = true
+	}
+}
+
+// substitute 把已知量替换为字面量，node 不引用已知量或已知值无法表示时返回 false
+func (o *optimizer) substitute(node ast.Expression, root bool) (ast.Expression, bool) {
+	switch n := node.(type) {
+	case *ast.VariableExpression:
+		return o.substituteChain(n, []ast.Expression{n}, root)
+	case *ast.Identifier:
+		return o.substituteChain(n, []ast.Expression{n}, root)
+	case *ast.ChainExpression:
+		return o.substituteChain(n, n.Children, root)
+	}
+	return nil, false
+}
+
+// substituteChain 找出链中能由已知量确定的最长前缀，把它替换为字面量，剩余的子节点照常化简
+func (o *optimizer) substituteChain(node ast.Expression, children []ast.Expression, root bool) (ast.Expression, bool) {
+	value, used, ok := o.known.resolve(children, root)
+	if !ok {
+		return nil, false
+	}
+	lit, ok := knownLiteral(value)
+	if !ok {
+		return nil, false
+	}
+	if used == len(children) {
+		lit.SetSpan(node.Span())
+		return o.record(SubstituteKnown, node, lit), true
+	}
+	prefix := &ast.ChainExpression{Children: children[:used]}
+	prefix.SetSpan(ast.Span{Start: children[0].Span().Start, End: children[used-1].Span().End})
+	lit.SetSpan(prefix.Span())
+	o.record(SubstituteKnown, prefix, lit)
+
+	rest := make([]ast.Expression, 0, len(children)-used+1)
+	rest = append(rest, lit)
+	for _, child := range children[used:] {
+		rest = append(rest, o.expr(child, false))
+	}
+	c := &ast.ChainExpression{Children: rest}
+	c.SetSpan(node.Span())
+	return c, true
+}
+
+// resolve 从链首开始读取已知值，返回最后一个能表示为字面量的值和它用掉的子节点数
+func (b *bindings) resolve(children []ast.Expression, root bool) (any, int, bool) {
+	var (
+		cur   any
+		start int
+	)
+	switch head := children[0].(type) {
+	case *ast.VariableExpression:
+		v, ok := b.vars[head.Name]
+		if !ok || b.assignedVars[head.Name] {
+			return nil, 0, false
+		}
+		cur, start = v, 1
+	case *ast.RootExpression:
+		if !root || len(children) < 2 {
+			return nil, 0, false
+		}
+		v, n, ok := b.resolvePath(children[1:])
+		if !ok {
+			return nil, 0, false
+		}
+		cur, start = v, 1+n
+	case *ast.Identifier:
+		if !root {
+			return nil, 0, false
+		}
+		v, n, ok := b.resolvePath(children)
+		if !ok {
+			return nil, 0, false
+		}
+		cur, start = v, n
+	default:
+		return nil, 0, false
+	}
+
+	// 已知值继续沿属性读取和字面量下标取值，记录最后一个可以代入的位置
+	value, used, found := cur, start, false
+	if _, ok := knownLiteral(cur); ok {
+		found = true
+	}
+	for i := start; i < len(children); i++ {
+		next, ok := step(cur, children, i)
+		if !ok {
+			break
+		}
+		cur = next
+		if _, ok := knownLiteral(cur); ok {
+			value, used, found = cur, i+1, true
+		}
+	}
+	return value, used, found
+}
+
+// resolvePath 匹配根对象上最长的已知属性路径，返回值和路径用掉的子节点数
+func (b *bindings) resolvePath(children []ast.Expression) (any, int, bool) {
+	first, ok := children[0].(*ast.Identifier)
+	if !ok || b.assignedRoots[first.Value] {
+		return nil, 0, false
+	}
+	var (
+		value any
+		used  int
+		path  string
+	)
+	for i, child := range children {
+		id, ok := child.(*ast.Identifier)
+		if !ok {
+			break
+		}
+		if i > 0 {
+			path += "."
+		}
+		path += id.Value
+		if v, ok := b.paths[path]; ok {
+			value, used = v, i+1
+		}
+	}
+	return value, used, used > 0
+}
+
+// step 在已知值上执行链中的第 i 个子节点，只处理没有副作用的属性读取和字面量下标
+func step(cur any, children []ast.Expression, i int) (any, bool) {
+	switch n := children[i].(type) {
+	case *ast.Identifier:
+		// 属性后紧跟下标时求值器可能使用索引属性，交给运行时处理
+		if i+1 < len(children) {
+			if _, ok := children[i+1].(*ast.IndexExpression); ok && eval.IndexedPropertyKind(cur, n.Value) != eval.NotIndexed {
+				return nil, false
+			}
+		}
+		v, err := eval.GetProperty(cur, n.Value)
+		return v, err == nil
+	case *ast.IndexExpression:
+		lit, ok := n.Index.(*ast.Literal)
+		if !ok || n.Object != nil {
+			return nil, false
+		}
+		if _, dynamic := ast.DynamicSubscriptOf(n); dynamic {
+			return nil, false
+		}
+		v, err := eval.GetIndex(cur, eval.LiteralValue(lit))
+		return v, err == nil
+	}
+	return nil, false
+}
+
+// knownLiteral 把调用方提供的值转换为字面量
+// Go 的 int、uint 和 uint32 按 Java long 处理，更窄的整数按 Java int 处理
+func knownLiteral(v any) (*ast.Literal, bool) {
+	switch x := v.(type) {
+	case int:
+		v = int64(x)
+	case uint:
+		if x > math.MaxInt64 {
+			return nil, false
+		}
+		v = int64(x)
+	case uint32:
+		v = int64(x)
+	case int8:
+		v = int32(x)
+	case int16:
+		v = int32(x)
+	case uint8:
+		v = int32(x)
+	case uint16:
+		v = int32(x)
+	}
+	return newLiteral(v)
+}
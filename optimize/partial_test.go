@@ -0,0 +1,88 @@
+package optimize
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/eval"
+)
+
+// partialContext 与 partialKnown 一致的求值上下文
+func partialContext() *eval.Context {
+	ctx := eval.NewContext(map[string]any{
+		"user":   map[string]any{"role": "admin", "tags": []string{"a", "b"}},
+		"limits": map[string]any{"max": 10},
+		"name":   "root-name",
+		"count":  5,
+		"people": []map[string]any{{"name": "Ada"}, {"name": "acme"}},
+	})
+	ctx.Set("tenant", "acme")
+	ctx.Set("debug", false)
+	ctx.Set("other", 7)
+	return ctx
+}
+
+var partialKnown = map[string]any{
+	"#tenant":   "acme",
+	"#debug":    false,
+	"user.role": "admin",
+	"limits":    map[string]any{"max": 10},
+	"name":      "root-name",
+}
+
+func TestPartialEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#tenant == 'acme' && user.role == \"admin\"", "true"},
+		{"#debug ? count : #tenant + '-' + count", "\"acme-\" + count"},
+		{"limits.max * 2 > count", "20L > count"},
+		{"limits['max']", "10L"},
+		{"#root.user.role", "\"admin\""},
+		{"#tenant.length() + #other", "\"acme\".length() + #other"},
+		{"user.tags[0]", "user.tags[0]"},
+		{"name + people.{name}", "\"root-name\" + people.{name}"},
+		{"people.{? name == #tenant}", "people.{? (name == \"acme\")}"},
+		{"people.{? name == #tenant}[limits.max - 10]", "people.{? (name == \"acme\")}[0L]"},
+		{"count > 1 ? name : user.role", "(count > 1) ? \"root-name\" : \"admin\""},
+		{"#f = :[user.role + #this], #f(#tenant)", "#f = :[user.role + #this], (#f)(\"acme\")"},
+		{"#tenant = 'x', #tenant", "#tenant = 'x', #tenant"},
+		{"user.role = 'guest', user.role", "user.role = \"guest\", user.role"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr := parse(t, tt.input)
+			before := expr.String()
+			got := PartialEval(expr, partialKnown)
+			if got.String() != tt.expected {
+				t.Errorf("PartialEval(%q) = %s, want %s", tt.input, got, tt.expected)
+			}
+			if expr.String() != before {
+				t.Errorf("input tree was modified: %s -> %s", before, expr)
+			}
+
+			// 剩余表达式在与已知量一致的上下文中求值，结果应当与原表达式相同
+			want, wantErr := eval.GetValue(expr, partialContext())
+			v, err := eval.GetValue(got, partialContext())
+			if fmt.Sprint(err) != fmt.Sprint(wantErr) || !reflect.DeepEqual(fmt.Sprint(v), fmt.Sprint(want)) {
+				t.Errorf("residual = %#v, %v; original = %#v, %v", v, err, want, wantErr)
+			}
+		})
+	}
+}
+
+func TestPartialEvalSpans(t *testing.T) {
+	input := "#tenant.length() > limits.max"
+	got := PartialEval(parse(t, input), partialKnown)
+	bin := got.(*ast.BinaryExpression)
+	head := bin.Left.(*ast.ChainExpression).Children[0]
+	if text := head.Span().Text(input); text != "#tenant" {
+		t.Errorf("substituted variable span = %q", text)
+	}
+	if text := bin.Right.Span().Text(input); text != "limits.max" {
+		t.Errorf("substituted path span = %q", text)
+	}
+}
@@ -0,0 +1,286 @@
+// Package purity 判断 OGNL 表达式求值时是否会修改状态
+//
+// 每个节点和整个表达式被归为三类之一：
+//   - Pure：只读取状态
+//   - Local：只给上下文变量赋值 (#a = ...)，丢弃上下文后不留下影响
+//   - External：给属性或下标赋值、调用不在白名单中的方法或静态方法、调用构造函数，
+//     以及给 Struts 共享的上下文变量 (#context、#_memberAccess 等) 赋值
+//
+// 节点的类别是它本身和所有子节点中最严重的一个。lambda 在调用时才执行，创建 lambda 是纯的；
+// 通过变量调用 lambda (#f(x)) 时，使用 dataflow 包找到变量的值，调用的类别是函数体的类别，
+// 找不到时视为 External。结果中的 Path 从根节点一直走到决定类别的节点，说明表达式为什么不纯。
+package purity
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/dataflow"
+)
+
+// Effect 求值的影响
+type Effect int
+
+const (
+	Pure Effect = iota
+	Local
+	External
+)
+
+var effectNames = [...]string{
+	Pure:     "pure",
+	Local:    "local",
+	External: "external",
+}
+
+func (e Effect) String() string {
+	if e >= 0 && int(e) < len(effectNames) {
+		return effectNames[e]
+	}
+	return fmt.Sprintf("Effect(%d)", int(e))
+}
+
+// Step 说明路径中的一步
+type Step struct {
+	Node   ast.Expression
+	Effect Effect
+	// Reason 节点本身产生影响的原因，影响来自子节点时为空
+	Reason string
+}
+
+func (s Step) String() string {
+	if s.Reason == "" {
+		return fmt.Sprintf("%s [%s]", s.Node, s.Effect)
+	}
+	return fmt.Sprintf("%s [%s]: %s", s.Node, s.Effect, s.Reason)
+}
+
+// Result 分类结果
+type Result struct {
+	Effect Effect
+	// Path 从根节点到产生影响的节点，纯表达式为 nil
+	Path  []Step
+	nodes map[ast.Expression]*info
+}
+
+// info 一个节点的分类
+type info struct {
+	effect Effect
+	reason string
+	// next 说明路径的下一步：影响最大的子节点，或者被调用的 lambda 的函数体
+	next ast.Expression
+}
+
+// Of 返回节点的类别，node 不是所分类的语法树中的节点时返回 Pure
+func (r *Result) Of(node ast.Expression) Effect {
+	if i := r.nodes[node]; i != nil {
+		return i.effect
+	}
+	return Pure
+}
+
+// Justify 返回从 node 到产生影响的节点的路径，纯节点返回 nil
+func (r *Result) Justify(node ast.Expression) []Step {
+	var out []Step
+	seen := map[ast.Expression]bool{}
+	for i := r.nodes[node]; i != nil && i.effect > Pure && !seen[node]; i = r.nodes[node] {
+		seen[node] = true
+		out = append(out, Step{Node: node, Effect: i.effect, Reason: i.reason})
+		if i.next == nil {
+			break
+		}
+		node = i.next
+	}
+	return out
+}
+
+// Explain 把 Path 格式化为多行文本，纯表达式返回 "pure"
+func (r *Result) Explain() string {
+	if len(r.Path) == 0 {
+		return Pure.String()
+	}
+	lines := make([]string, len(r.Path))
+	for i, s := range r.Path {
+		lines[i] = strings.Repeat("  ", i) + s.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Classifier 按白名单分类表达式，可以被多个 goroutine 同时使用，使用期间不能修改字段
+type Classifier struct {
+	// Methods 视为纯的实例方法名
+	Methods map[string]bool
+	// Statics 视为纯的静态方法，键为 "类名@方法名"，java.lang 下的类可以省略包名
+	Statics map[string]bool
+	// Getters 把没有参数的 getX()、isX() 视为纯的
+	Getters bool
+}
+
+// NewClassifier 返回使用默认白名单的 Classifier：字符串、数值和集合的读取方法，
+// java.lang.Math 等类的静态方法，并把 getter 视为纯的
+func NewClassifier() *Classifier {
+	c := &Classifier{Methods: map[string]bool{}, Statics: map[string]bool{}, Getters: true}
+	for _, m := range defaultMethods {
+		c.Methods[m] = true
+	}
+	for class, methods := range defaultStatics {
+		for _, m := range methods {
+			c.Statics[class+"@"+m] = true
+		}
+	}
+	return c
+}
+
+var (
+	defaultMethods = []string{
+		"length", "size", "isEmpty", "charAt", "substring", "indexOf", "lastIndexOf",
+		"contains", "containsKey", "containsValue", "startsWith", "endsWith",
+		"equals", "equalsIgnoreCase", "compareTo", "hashCode", "toString",
+		"toUpperCase", "toLowerCase", "trim", "concat", "replace", "split", "matches",
+		"get", "keySet", "values", "entrySet",
+		"intValue", "longValue", "doubleValue", "floatValue", "booleanValue", "charValue",
+	}
+	defaultStatics = map[string][]string{
+		"java.lang.Math":      {"abs", "max", "min", "pow", "sqrt", "floor", "ceil", "round", "signum"},
+		"java.lang.String":    {"valueOf", "format", "join"},
+		"java.lang.Integer":   {"valueOf", "parseInt", "toString", "toHexString", "toBinaryString"},
+		"java.lang.Long":      {"valueOf", "parseLong", "toString"},
+		"java.lang.Double":    {"valueOf", "parseDouble", "toString"},
+		"java.lang.Boolean":   {"valueOf", "parseBoolean", "toString"},
+		"java.lang.Character": {"valueOf", "toString", "isDigit", "isLetter", "toUpperCase", "toLowerCase"},
+	}
+)
+
+var defaultClassifier = NewClassifier()
+
+// Classify 使用默认白名单分类表达式
+func Classify(expr ast.Expression) *Result {
+	return defaultClassifier.Classify(expr)
+}
+
+// Classify 分类表达式和其中的每个节点
+func (c *Classifier) Classify(expr ast.Expression) *Result {
+	w := &classifier{c: c, graph: dataflow.Analyze(expr), nodes: map[ast.Expression]*info{}, active: map[ast.Expression]bool{}}
+	w.classify(expr)
+	r := &Result{nodes: w.nodes}
+	r.Effect = r.Of(expr)
+	r.Path = r.Justify(expr)
+	return r
+}
+
+type classifier struct {
+	c     *Classifier
+	graph *dataflow.Graph
+	nodes map[ast.Expression]*info
+	// active 正在分类的 lambda 函数体，用于递归调用
+	active map[ast.Expression]bool
+}
+
+// classify 自底向上分类节点，返回节点的类别
+func (w *classifier) classify(node ast.Expression) Effect {
+	if node == nil {
+		return Pure
+	}
+	if i := w.nodes[node]; i != nil {
+		return i.effect
+	}
+	i := &info{}
+	// lambda 的函数体在调用时才执行，不影响 lambda 本身
+	body := lambdaBody(node)
+	lambda := body != nil
+	if lambda {
+		w.active[body] = true
+		defer delete(w.active, body)
+	}
+	for _, child := range ast.Children(node) {
+		if e := w.classify(child); !lambda && e > i.effect {
+			i.effect, i.next = e, child
+		}
+	}
+	if e, reason, next := w.own(node); e > i.effect {
+		i.effect, i.reason, i.next = e, reason, next
+	}
+	w.nodes[node] = i
+	return i.effect
+}
+
+// own 返回节点本身 (不计子节点) 的类别、原因和说明路径的下一步
+func (w *classifier) own(node ast.Expression) (Effect, string, ast.Expression) {
+	switch n := node.(type) {
+	case *ast.AssignmentExpression:
+		v, ok := n.Left.(*ast.VariableExpression)
+		switch {
+		case !ok:
+			return External, fmt.Sprintf("assignment to %s", n.Left), nil
+		case dataflow.Predefined[v.Name]:
+			return External, fmt.Sprintf("assignment to the shared context variable %s", v), nil
+		}
+		return Local, fmt.Sprintf("assignment to the context variable %s", v), nil
+	case *ast.CallExpression:
+		if w.c.Methods[n.Method] || w.c.Getters && len(n.Arguments) == 0 && isGetter(n.Method) {
+			return Pure, "", nil
+		}
+		return External, fmt.Sprintf("call to %s, which is not on the pure-method allowlist", n.Method), nil
+	case *ast.StaticMethodExpression:
+		class := ast.ClassOf(n)
+		if w.c.Statics[class+"@"+n.Method] || !strings.Contains(class, ".") && w.c.Statics["java.lang."+class+"@"+n.Method] {
+			return Pure, "", nil
+		}
+		return External, fmt.Sprintf("call to @%s@%s, which is not on the pure-method allowlist", n.ClassName, n.Method), nil
+	case *ast.ConstructorExpression:
+		// 创建数组不执行构造函数
+		if n.IsArray {
+			return Pure, "", nil
+		}
+		return External, fmt.Sprintf("construction of %s", n.ClassName), nil
+	case *ast.EvalExpression:
+		return w.invoke(n)
+	}
+	return Pure, "", nil
+}
+
+// invoke 通过变量调用 lambda 时取函数体的类别，其他动态求值视为 External
+func (w *classifier) invoke(n *ast.EvalExpression) (Effect, string, ast.Expression) {
+	v, ok := n.Target.(*ast.VariableExpression)
+	if !ok {
+		return External, fmt.Sprintf("dynamic evaluation of %s", n.Target), nil
+	}
+	value, _ := w.graph.Value(v)
+	body := lambdaBody(value)
+	if body == nil {
+		return External, fmt.Sprintf("call through %s, whose value is not a known lambda", v), nil
+	}
+	if w.active[body] {
+		// 递归调用：函数体的类别由外层的分类决定
+		return Pure, "", nil
+	}
+	w.active[body] = true
+	defer delete(w.active, body)
+	e := w.classify(body)
+	if e == Pure {
+		return Pure, "", nil
+	}
+	return e, fmt.Sprintf("call to the lambda in %s", v), body
+}
+
+// isGetter 报告方法名是否形如 getX 或 isX
+func isGetter(name string) bool {
+	for _, prefix := range []string{"get", "is"} {
+		if rest, ok := strings.CutPrefix(name, prefix); ok && rest != "" && rest[0] >= 'A' && rest[0] <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
+
+// lambdaBody 返回 lambda 的函数体，node 不是 lambda 时返回 nil
+func lambdaBody(node ast.Expression) ast.Expression {
+	switch l := node.(type) {
+	case *ast.LambdaExpression:
+		return l.Body
+	case *ast.LambdaLiteral:
+		return l.Body
+	}
+	return nil
+}
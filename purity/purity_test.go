@@ -0,0 +1,93 @@
+package purity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+func parse(t *testing.T, input string) ast.Expression {
+	t.Helper()
+	expr, err := ast.New(ast.NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expr
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		input  string
+		effect Effect
+		// cause 路径最后一步的原因
+		cause string
+	}{
+		{"user.name + ' ' + user.getAddress().city", Pure, ""},
+		{"name.trim().toUpperCase().length() > @Math@max(1, size)", Pure, ""},
+		{"new int[3]", Pure, ""},
+		{"#a = 1, #b = #a + 1", Local, "assignment to the context variable #a"},
+		{"#a = 1, user.name = 'x'", External, "assignment to user.name"},
+		{"items[0] = 1", External, "assignment to items[0]"},
+		{"#_memberAccess = @ognl.OgnlContext@DEFAULT_MEMBER_ACCESS", External, "assignment to the shared context variable #_memberAccess"},
+		{"#a = user.setName('x')", External, "call to setName, which is not on the pure-method allowlist"},
+		{"@java.lang.Runtime@getRuntime()", External, "call to @java.lang.Runtime@getRuntime, which is not on the pure-method allowlist"},
+		{"new java.util.ArrayList()", External, "construction of java.util.ArrayList"},
+		// 创建 lambda 是纯的，调用时取函数体的类别
+		{"#f = :[#this.clear()]", Local, "assignment to the context variable #f"},
+		{"#f = :[#this.clear()], #f(list)", External, "call to clear, which is not on the pure-method allowlist"},
+		{"#f = :[#this < 2 ? 1 : #this * #f(#this - 1)], #f(5)", Local, "assignment to the context variable #f"},
+		{"#g(1)", External, "call through #g, whose value is not a known lambda"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r := Classify(parse(t, tt.input))
+			if r.Effect != tt.effect {
+				t.Errorf("Effect = %s, want %s\n%s", r.Effect, tt.effect, r.Explain())
+			}
+			cause := ""
+			if len(r.Path) > 0 {
+				cause = r.Path[len(r.Path)-1].Reason
+			}
+			if cause != tt.cause {
+				t.Errorf("cause = %q, want %q\n%s", cause, tt.cause, r.Explain())
+			}
+		})
+	}
+}
+
+func TestJustify(t *testing.T) {
+	expr := parse(t, "#u = user, (#u.name.length() > 3 ? #u.reset() : 0)")
+	r := Classify(expr)
+	want := strings.Join([]string{
+		"#u = user, ((#u.name.length() > 3) ? #u.reset() : 0) [external]",
+		"  (#u.name.length() > 3) ? #u.reset() : 0 [external]",
+		"    #u.reset() [external]",
+		"      reset() [external]: call to reset, which is not on the pure-method allowlist",
+	}, "\n")
+	if got := r.Explain(); got != want {
+		t.Errorf("Explain:\n%s\nwant:\n%s", got, want)
+	}
+	// 各节点分别分类
+	seq := expr.(*ast.SequenceExpression)
+	if got := r.Of(seq.Expressions[0]); got != Local {
+		t.Errorf("Of(%s) = %s", seq.Expressions[0], got)
+	}
+	if got := r.Justify(seq.Expressions[0]); len(got) != 1 || got[0].Effect != Local {
+		t.Errorf("Justify(%s) = %v", seq.Expressions[0], got)
+	}
+}
+
+func TestClassifierAllowlist(t *testing.T) {
+	c := NewClassifier()
+	c.Methods["format"] = true
+	c.Statics["java.lang.System@currentTimeMillis"] = true
+	c.Getters = false
+	expr := parse(t, "date.format(@System@currentTimeMillis())")
+	if r := c.Classify(expr); r.Effect != Pure {
+		t.Errorf("Effect = %s\n%s", r.Effect, r.Explain())
+	}
+	if r := c.Classify(parse(t, "user.getName()")); r.Effect != External {
+		t.Errorf("getter with Getters = false: %s", r.Effect)
+	}
+}
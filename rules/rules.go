@@ -0,0 +1,537 @@
+// Package rules 加载以 JSON 描述的检测规则
+//
+// 规则的模式是 ast.Pattern：用 OGNL 写成，其中可以使用元变量，$NAME 匹配一个表达式或类名、方法名、
+// 变量名等名字，$...NAME (或匿名的 $...) 匹配零个或多个参数、元素或链中的步骤。
+// 规则匹配时忽略运算符的写法 (eq 与 ==)，类名按 ast.ClassResolver 解析后的规范名比较，
+// @Runtime@ 与 @java.lang.Runtime@ 相同，类名位置的元变量绑定规范名。例如
+//
+//	{
+//	  "rules": [{
+//	    "id": "static-exec",
+//	    "severity": "critical",
+//	    "message": "$CLASS.$M 可以执行命令",
+//	    "patterns": [
+//	      {"pattern": "@$CLASS@$M($...ARGS)"},
+//	      {"metavariable-regex": {"metavariable": "$CLASS", "regex": "java\\.lang\\.(Runtime|ProcessBuilder)"}},
+//	      {"pattern-not-inside": "#safe ? $X : $Y"}
+//	    ]
+//	  }]
+//	}
+//
+// 每条规则有且只有一个 pattern、patterns 或 pattern-either：
+//   - pattern：模式的所有匹配
+//   - patterns：同时满足的条件。pattern、patterns、pattern-either 给出候选，
+//     pattern-inside 要求候选位于某个匹配之内，pattern-not 排除同一节点上的匹配，
+//     pattern-not-inside 排除位于某个匹配之内的候选，metavariable-regex 要求元变量绑定的文本匹配正则，
+//     metavariable-type 要求元变量绑定的表达式的 Java 类型是给定的类或其子类型 (由 types 包推断)
+//   - pattern-either：任一分支的匹配
+//
+// 例如 {"pattern": "$R.exec($...ARGS)"} 与 {"metavariable-type": {"metavariable": "$R", "type": "java.lang.Runtime"}}
+// 一起匹配所有在 Runtime 对象上调用 exec 的写法，不论 Runtime 对象是直接取得的还是经过变量传递的。
+//
+// 同名元变量在各个条件中必须绑定相同的文本。message 中的元变量替换为绑定的文本。
+// Rule.Analyze 把规则转换为 analyze.Rule，与内置规则一起交给 analyze.New。
+package rules
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/analyze"
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/types"
+)
+
+// Rule 一条编译后的规则，可以被多个 goroutine 同时使用
+type Rule struct {
+	ID          string
+	Severity    analyze.Severity
+	Description string
+	// Message 结果说明的模板，其中的 $NAME 替换为元变量绑定的文本
+	Message string
+	// Model metavariable-type 使用的类型模型，nil 表示 types.Builtin()
+	Model   *types.Model
+	formula *formula
+}
+
+// ruleSpec 规则文件中的一条规则
+type ruleSpec struct {
+	ID          string `json:"id"`
+	Severity    string `json:"severity"`
+	Message     string `json:"message"`
+	Description string `json:"description"`
+	formulaSpec
+}
+
+// formulaSpec 规则或 patterns 中的一个条件，只能设置一个字段
+type formulaSpec struct {
+	Pattern           string        `json:"pattern"`
+	Patterns          []formulaSpec `json:"patterns"`
+	PatternEither     []formulaSpec `json:"pattern-either"`
+	PatternInside     string        `json:"pattern-inside"`
+	PatternNot        string        `json:"pattern-not"`
+	PatternNotInside  string        `json:"pattern-not-inside"`
+	MetavariableRegex *regexSpec    `json:"metavariable-regex"`
+	MetavariableType  *typeSpec     `json:"metavariable-type"`
+}
+
+type regexSpec struct {
+	Metavariable string `json:"metavariable"`
+	Regex        string `json:"regex"`
+}
+
+type typeSpec struct {
+	Metavariable string `json:"metavariable"`
+	Type         string `json:"type"`
+}
+
+// Parse 解析 {"rules": [...]} 形式的规则文件
+func Parse(data []byte) ([]*Rule, error) {
+	var file struct {
+		Rules []ruleSpec `json:"rules"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	out := make([]*Rule, 0, len(file.Rules))
+	for i, spec := range file.Rules {
+		if spec.ID == "" {
+			return nil, fmt.Errorf("rule #%d: missing id", i)
+		}
+		if seen[spec.ID] {
+			return nil, fmt.Errorf("rule %s: duplicate id", spec.ID)
+		}
+		seen[spec.ID] = true
+		r, err := compile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", spec.ID, err)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// ParseFile 读取并解析规则文件
+func ParseFile(name string) ([]*Rule, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return rules, nil
+}
+
+//go:embed builtin.json
+var builtinJSON []byte
+
+// Builtin 返回随包发布的规则，补充 analyze.DefaultRules 没有覆盖的载荷
+func Builtin() []*Rule {
+	rules, err := Parse(builtinJSON)
+	if err != nil {
+		panic("rules: builtin.json: " + err.Error())
+	}
+	return rules
+}
+
+// Analyze 把规则转换为 analyze.Rule
+func (r *Rule) Analyze() analyze.Rule {
+	return analyze.Rule{
+		ID:          r.ID,
+		Severity:    r.Severity,
+		Description: r.Description,
+		CheckTree: func(root ast.Expression, report func(ast.Expression, ast.Span, string)) {
+			for _, m := range r.Find(root) {
+				report(m.Node, m.Span, r.Format(m))
+			}
+		},
+	}
+}
+
+// Analyzers 把一组规则转换为 analyze.Rule
+func Analyzers(rules []*Rule) []analyze.Rule {
+	out := make([]analyze.Rule, len(rules))
+	for i, r := range rules {
+		out[i] = r.Analyze()
+	}
+	return out
+}
+
+// Find 返回规则在语法树中的所有匹配，同一范围只保留第一个，按源码位置排序
+func (r *Rule) Find(root ast.Expression) []ast.MatchResult {
+	var out []ast.MatchResult
+	model := r.Model
+	if model == nil {
+		model = types.Builtin()
+	}
+	for _, m := range r.formula.eval(&env{model: model, root: root}) {
+		dup := false
+		for _, o := range out {
+			if sameNode(m, o) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			out = append(out, m)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Span.Start < out[j].Span.Start })
+	return out
+}
+
+var metavarRef = regexp.MustCompile(`\$(\.\.\.)?[A-Z_][A-Z0-9_]*`)
+
+// Format 把规则的 Message 中的元变量替换为匹配中绑定的文本，没有绑定的保持原样
+func (r *Rule) Format(m ast.MatchResult) string {
+	return metavarRef.ReplaceAllStringFunc(r.Message, func(name string) string {
+		if b, ok := m.Bindings[name]; ok {
+			return b.Text
+		}
+		return name
+	})
+}
+
+// =============================================================================
+// 编译
+// =============================================================================
+
+// formula 编译后的条件
+type formula struct {
+	pattern *ast.Pattern
+	either  []*formula
+	// patterns 中的各项
+	all       []*formula
+	inside    []*ast.Pattern
+	not       []*ast.Pattern
+	notInside []*ast.Pattern
+	regex     []metavarRegex
+	types     []metavarType
+}
+
+type metavarRegex struct {
+	name string
+	re   *regexp.Regexp
+}
+
+type metavarType struct {
+	name  string
+	class string
+}
+
+func compile(spec ruleSpec) (*Rule, error) {
+	severity, err := analyze.ParseSeverity(strings.ToLower(spec.Severity))
+	if err != nil {
+		return nil, err
+	}
+	if spec.Message == "" {
+		return nil, errors.New("missing message")
+	}
+	f, err := compileFormula(spec.formulaSpec)
+	if err != nil {
+		return nil, err
+	}
+	if !f.positive() {
+		return nil, errors.New("pattern-inside, pattern-not, pattern-not-inside, metavariable-regex and metavariable-type must be items of patterns")
+	}
+	return &Rule{ID: spec.ID, Severity: severity, Description: spec.Description, Message: spec.Message, formula: f}, nil
+}
+
+// compileFormula 编译一个条件，返回的 formula 只设置与 spec 中的字段对应的一项
+func compileFormula(spec formulaSpec) (*formula, error) {
+	f := &formula{}
+	fields := 0
+	if spec.Pattern != "" {
+		fields++
+		p, err := compileSource(spec.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		f.pattern = p
+	}
+	if spec.Patterns != nil {
+		fields++
+		if err := f.compileAll(spec.Patterns); err != nil {
+			return nil, err
+		}
+	}
+	if spec.PatternEither != nil {
+		fields++
+		if len(spec.PatternEither) == 0 {
+			return nil, errors.New("empty pattern-either")
+		}
+		for _, s := range spec.PatternEither {
+			sub, err := compileFormula(s)
+			if err != nil {
+				return nil, err
+			}
+			if !sub.positive() {
+				return nil, errors.New("pattern-either branches must be pattern, patterns or pattern-either")
+			}
+			f.either = append(f.either, sub)
+		}
+	}
+	for _, c := range []struct {
+		source string
+		dst    *[]*ast.Pattern
+	}{
+		{spec.PatternInside, &f.inside},
+		{spec.PatternNot, &f.not},
+		{spec.PatternNotInside, &f.notInside},
+	} {
+		if c.source == "" {
+			continue
+		}
+		fields++
+		p, err := compileSource(c.source)
+		if err != nil {
+			return nil, err
+		}
+		*c.dst = append(*c.dst, p)
+	}
+	if spec.MetavariableRegex != nil {
+		fields++
+		r := spec.MetavariableRegex
+		if metavarRef.FindString(r.Metavariable) != r.Metavariable {
+			return nil, fmt.Errorf("metavariable-regex: invalid metavariable %q", r.Metavariable)
+		}
+		re, err := regexp.Compile("^(?:" + r.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("metavariable-regex: %w", err)
+		}
+		f.regex = append(f.regex, metavarRegex{name: r.Metavariable, re: re})
+	}
+	if spec.MetavariableType != nil {
+		fields++
+		t := spec.MetavariableType
+		if metavarRef.FindString(t.Metavariable) != t.Metavariable || strings.HasPrefix(t.Metavariable, "$...") {
+			return nil, fmt.Errorf("metavariable-type: invalid metavariable %q", t.Metavariable)
+		}
+		if t.Type == "" {
+			return nil, errors.New("metavariable-type: missing type")
+		}
+		f.types = append(f.types, metavarType{name: t.Metavariable, class: t.Type})
+	}
+	switch fields {
+	case 0:
+		return nil, errors.New("missing pattern, patterns or pattern-either")
+	case 1:
+		return f, nil
+	}
+	return nil, errors.New("a condition must have exactly one of pattern, patterns, pattern-either, pattern-inside, pattern-not, pattern-not-inside, metavariable-regex, metavariable-type")
+}
+
+// compileAll 把 patterns 的各项合并到 f 中
+func (f *formula) compileAll(specs []formulaSpec) error {
+	for _, s := range specs {
+		sub, err := compileFormula(s)
+		if err != nil {
+			return err
+		}
+		if sub.positive() {
+			f.all = append(f.all, sub)
+			continue
+		}
+		f.inside = append(f.inside, sub.inside...)
+		f.not = append(f.not, sub.not...)
+		f.notInside = append(f.notInside, sub.notInside...)
+		f.regex = append(f.regex, sub.regex...)
+		f.types = append(f.types, sub.types...)
+	}
+	if len(f.all) == 0 {
+		return errors.New("patterns needs at least one pattern, patterns or pattern-either")
+	}
+	bound := map[string]bool{}
+	for _, p := range f.patterns() {
+		for _, name := range p.Metavars() {
+			bound[name] = true
+		}
+	}
+	for _, r := range f.regex {
+		if !bound[r.name] {
+			return fmt.Errorf("metavariable-regex: %s is not bound by any pattern", r.name)
+		}
+	}
+	for _, t := range f.types {
+		if !bound[t.name] {
+			return fmt.Errorf("metavariable-type: %s is not bound by any pattern", t.name)
+		}
+	}
+	return nil
+}
+
+// positive 报告条件是否给出候选
+func (f *formula) positive() bool {
+	return f.pattern != nil || f.all != nil || f.either != nil
+}
+
+// patterns 返回能绑定元变量的模式：给出候选的模式和 pattern-inside
+func (f *formula) patterns() []*ast.Pattern {
+	var out []*ast.Pattern
+	if f.pattern != nil {
+		out = append(out, f.pattern)
+	}
+	for _, sub := range f.all {
+		out = append(out, sub.patterns()...)
+	}
+	for _, sub := range f.either {
+		out = append(out, sub.patterns()...)
+	}
+	return append(out, f.inside...)
+}
+
+// classes 规则比较类名时使用的解析器
+var classes = ast.NewClassResolver()
+
+// compileSource 解析模式，规则忽略运算符的写法，类名按规范名比较
+func compileSource(source string) (*ast.Pattern, error) {
+	p, err := ast.ParsePattern(source)
+	if err != nil {
+		return nil, fmt.Errorf("pattern %q: %w", source, err)
+	}
+	p.IgnoreSpelling = true
+	p.Classes = classes
+	return p, nil
+}
+
+// =============================================================================
+// 求值
+// =============================================================================
+
+// env 一次求值的语法树，类型在第一次用到时推断
+type env struct {
+	model *types.Model
+	root  ast.Expression
+	info  *types.Info
+}
+
+func (e *env) typeInfo() *types.Info {
+	if e.info == nil {
+		e.info = e.model.Infer(e.root)
+	}
+	return e.info
+}
+
+// eval 返回条件在语法树中的匹配
+func (f *formula) eval(e *env) []ast.MatchResult {
+	root := e.root
+	switch {
+	case f.pattern != nil:
+		return f.pattern.Find(root)
+	case f.either != nil:
+		var out []ast.MatchResult
+		for _, sub := range f.either {
+			out = append(out, sub.eval(e)...)
+		}
+		return out
+	}
+
+	candidates := f.all[0].eval(e)
+	for _, sub := range f.all[1:] {
+		candidates = filter(candidates, sub.eval(e), sameNode, true)
+	}
+	for _, p := range f.inside {
+		candidates = filter(candidates, p.Find(root), within, true)
+	}
+	for _, p := range f.not {
+		candidates = filter(candidates, p.Find(root), sameNode, false)
+	}
+	for _, p := range f.notInside {
+		candidates = filter(candidates, p.Find(root), within, false)
+	}
+	for _, r := range f.regex {
+		var kept []ast.MatchResult
+		for _, c := range candidates {
+			if b, ok := c.Bindings[r.name]; ok && r.re.MatchString(b.Text) {
+				kept = append(kept, c)
+			}
+		}
+		candidates = kept
+	}
+	for _, t := range f.types {
+		var kept []ast.MatchResult
+		for _, c := range candidates {
+			if b, ok := c.Bindings[t.name]; ok && b.Node != nil && e.typeInfo().Is(b.Node, t.class) {
+				kept = append(kept, c)
+			}
+		}
+		candidates = kept
+	}
+	return candidates
+}
+
+// filter 保留 (keep 为 true) 或排除 (keep 为 false) 与 others 中某个匹配相关且绑定一致的候选
+// 保留的候选合并该匹配的绑定
+func filter(candidates, others []ast.MatchResult, related func(c, o ast.MatchResult) bool, keep bool) []ast.MatchResult {
+	var out []ast.MatchResult
+	for _, c := range candidates {
+		merged, found := c, false
+		for _, o := range others {
+			if !related(c, o) {
+				continue
+			}
+			if b, ok := merge(c.Bindings, o.Bindings); ok {
+				merged.Bindings, found = b, true
+				break
+			}
+		}
+		if found == keep {
+			if keep {
+				c = merged
+			}
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// merge 合并两组绑定，同名元变量的文本不同时返回 false
+func merge(a, b map[string]ast.Binding) (map[string]ast.Binding, bool) {
+	out := make(map[string]ast.Binding, len(a)+len(b))
+	for n, v := range a {
+		out[n] = v
+	}
+	for n, v := range b {
+		if old, ok := out[n]; ok {
+			if old.Text != v.Text {
+				return nil, false
+			}
+			continue
+		}
+		out[n] = v
+	}
+	return out, true
+}
+
+// sameNode 报告两个匹配是否位于同一节点
+func sameNode(a, b ast.MatchResult) bool {
+	if a.Span.IsValid() && b.Span.IsValid() {
+		return a.Span == b.Span
+	}
+	return a.Node == b.Node
+}
+
+// within 报告匹配 a 是否位于 outer 之内 (包括同一节点)
+func within(a, outer ast.MatchResult) bool {
+	if a.Span.IsValid() && outer.Span.IsValid() {
+		return outer.Span.Start <= a.Span.Start && a.Span.End <= outer.Span.End
+	}
+	found := false
+	ast.Inspect(outer.Node, func(n ast.Expression) bool {
+		found = found || n == a.Node
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,171 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weaweawe01/ParserOgnl/analyze"
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+func parse(t *testing.T, input string) ast.Expression {
+	t.Helper()
+	expr, err := ast.New(ast.NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatalf("parse %q: %v", input, err)
+	}
+	return expr
+}
+
+// findAll 返回 "匹配的源码 | 说明" 列表
+func findAll(t *testing.T, rules []*Rule, input string) []string {
+	t.Helper()
+	var out []string
+	for _, r := range rules {
+		for _, m := range r.Find(parse(t, input)) {
+			out = append(out, r.ID+": "+m.Span.Text(input)+" | "+r.Format(m))
+		}
+	}
+	return out
+}
+
+func TestCombinators(t *testing.T) {
+	rules, err := Parse([]byte(`{"rules": [
+		{
+			"id": "exec-outside-guard",
+			"severity": "high",
+			"message": "$CMD executed",
+			"patterns": [
+				{"pattern": "$R.exec($CMD)"},
+				{"pattern-inside": "$A, $...REST"},
+				{"pattern-not-inside": "#debug ? $T : $F"},
+				{"pattern-not": "$R.exec('true')"}
+			]
+		},
+		{
+			"id": "same-var",
+			"severity": "LOW",
+			"message": "#$V read back",
+			"patterns": [
+				{"pattern": "#$V.toString()"},
+				{"pattern-inside": "#$V = $E, $...REST"}
+			]
+		},
+		{
+			"id": "either",
+			"severity": "medium",
+			"message": "$C loaded",
+			"pattern-either": [
+				{"pattern": "@java.lang.Class@forName($C)"},
+				{"patterns": [
+					{"pattern": "$L.loadClass($C)"},
+					{"metavariable-regex": {"metavariable": "$C", "regex": "\"javax?\\..*\""}}
+				]}
+			]
+		}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"r.exec('id'), 1", []string{`exec-outside-guard: r.exec('id') | "id" executed`}},
+		{"r.exec('id')", nil},
+		{"#debug ? r.exec('id') : 0, 1", nil},
+		{"r.exec('true'), r.exec('ls')", []string{`exec-outside-guard: r.exec('ls') | "ls" executed`}},
+		{"#a = 1, #a.toString(), #b.toString()", []string{"same-var: #a.toString() | #a read back"}},
+		{"@java.lang.Class@forName(#c), cl.loadClass('java.lang.Runtime'), cl.loadClass('com.x.Y')", []string{
+			`either: @java.lang.Class@forName(#c) | #c loaded`,
+			`either: cl.loadClass('java.lang.Runtime') | "java.lang.Runtime" loaded`,
+		}},
+	}
+	for _, tt := range tests {
+		got := findAll(t, rules, tt.input)
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s:\n%s\nwant:\n%s", tt.input, strings.Join(got, "\n"), strings.Join(tt.expected, "\n"))
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		rules, err string
+	}{
+		{`{"rules": [{"severity": "low", "message": "m", "pattern": "a"}]}`, "missing id"},
+		{`{"rules": [{"id": "x", "severity": "fatal", "message": "m", "pattern": "a"}]}`, `unknown severity "fatal"`},
+		{`{"rules": [{"id": "x", "severity": "low", "pattern": "a"}]}`, "missing message"},
+		{`{"rules": [{"id": "x", "severity": "low", "message": "m"}]}`, "missing pattern"},
+		{`{"rules": [{"id": "x", "severity": "low", "message": "m", "pattern": "a.("}]}`, `pattern "a.("`},
+		{`{"rules": [{"id": "x", "severity": "low", "message": "m", "pattern": "a", "pattern-not": "b"}]}`, "exactly one"},
+		{`{"rules": [{"id": "x", "severity": "low", "message": "m", "pattern-inside": "a"}]}`, "must be items of patterns"},
+		{`{"rules": [{"id": "x", "severity": "low", "message": "m", "patterns": [{"pattern-not": "a"}]}]}`, "at least one"},
+		{`{"rules": [{"id": "x", "severity": "low", "message": "m", "patterns": [{"pattern": "$A"}, {"metavariable-regex": {"metavariable": "$B", "regex": "."}}]}]}`, "$B is not bound"},
+		{`{"rules": [{"id": "x", "severity": "low", "message": "m", "patterns": [{"pattern": "$A"}, {"metavariable-regex": {"metavariable": "$A", "regex": "("}}]}]}`, "metavariable-regex"},
+		{`{"rules": [{"id": "x", "severity": "low", "message": "m", "patterns": [{"pattern": "$A"}, {"metavariable-type": {"metavariable": "$B", "type": "java.lang.Runtime"}}]}]}`, "$B is not bound"},
+		{`{"rules": [{"id": "x", "severity": "low", "message": "m", "patterns": [{"pattern": "$A"}, {"metavariable-type": {"metavariable": "$A"}}]}]}`, "missing type"},
+		{`{"rules": [{"id": "x", "severity": "low", "message": "m", "pattern": "a", "patern": "b"}]}`, `unknown field "patern"`},
+		{`{"rules": [{"id": "x", "severity": "low", "message": "m", "pattern": "a"}, {"id": "x", "severity": "low", "message": "m", "pattern": "b"}]}`, "duplicate id"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.rules))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.rules, err, tt.err)
+		}
+	}
+}
+
+func TestBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"@java.lang.Runtime@getRuntime().exec('id')", nil},
+		{"#rt = @java.lang.Runtime@getRuntime(), #rt.exec('id')", []string{
+			"runtime-exec-indirect: #rt.exec('id') | command execution through exec on #rt, a java.lang.Runtime",
+		}},
+		{"@Class@forName('java.lang.Runtime').getMethod('getRuntime').invoke(null).exec('id')", nil},
+		{"#r = @java.lang.Class@forName('java.lang.Runtime').newInstance(), #r.exec('id')", []string{
+			"runtime-exec-indirect: #r.exec('id') | command execution through exec on #r, a java.lang.Runtime",
+		}},
+		{"#x.exec('id')", nil},
+		{"@java.lang.ProcessBuilder@startPipeline(#a)", []string{"static-exec: @java.lang.ProcessBuilder@startPipeline(#a) | static call @java.lang.ProcessBuilder@startPipeline"}},
+		{"@ProcessBuilder@startPipeline(#a)", []string{"static-exec: @ProcessBuilder@startPipeline(#a) | static call @java.lang.ProcessBuilder@startPipeline"}},
+		{"new javax.script.ScriptEngineManager().getEngineByName('js').eval(#s)", []string{
+			`script-engine: new javax.script.ScriptEngineManager().getEngineByName('js').eval(#s) | evaluates #s with the "js" script engine`,
+		}},
+		{"#x = new javax.naming.InitialContext().lookup('ldap://h/a')", []string{
+			`jndi-lookup: new javax.naming.InitialContext().lookup('ldap://h/a') | JNDI lookup of "ldap://h/a"`,
+		}},
+		{"new java.io.FileOutputStream(#p).write(#b)", []string{"file-write: new java.io.FileOutputStream(#p) | writes a file with arguments (#p)"}},
+		{"#context['com.opensymphony.xwork2.dispatcher.HttpServletResponse'].getWriter()", []string{
+			"response-writer: #context['com.opensymphony.xwork2.dispatcher.HttpServletResponse'] | takes the servlet response out of #context",
+		}},
+	}
+	builtin := Builtin()
+	for _, tt := range tests {
+		got := findAll(t, builtin, tt.input)
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s:\n%s\nwant:\n%s", tt.input, strings.Join(got, "\n"), strings.Join(tt.expected, "\n"))
+		}
+	}
+}
+
+// TestAnalyze 规则通过 analyze 包运行，看到的是还原了混淆常量的语法树
+func TestAnalyze(t *testing.T) {
+	a := analyze.New(append(analyze.DefaultRules(), Analyzers(Builtin())...)...)
+	input := `new javax.naming.InitialContext().lookup("ldap:" + "//h/a")`
+	var got []string
+	for _, f := range a.Analyze(parse(t, input)) {
+		got = append(got, f.Rule+" "+f.Severity.String()+" "+f.Span.Text(input)+" | "+f.Message)
+	}
+	expected := []string{
+		`jndi-lookup critical ` + input + ` | JNDI lookup of "ldap://h/a"`,
+		`obfuscation low "ldap:" + "//h/a" | expression builds the constant "ldap://h/a" at runtime`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
@@ -0,0 +1,449 @@
+package sandbox
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/analyze"
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/types"
+)
+
+// =============================================================================
+// 检查
+// =============================================================================
+
+// Verdict 调用在策略下的结果
+type Verdict int
+
+const (
+	Allowed Verdict = iota
+	Blocked
+	// Unknown 无法确定调用的类，通常是接收者的类型推断不出来
+	Unknown
+)
+
+var verdictNames = [...]string{
+	Allowed: "allowed",
+	Blocked: "blocked",
+	Unknown: "unknown",
+}
+
+func (v Verdict) String() string {
+	if v >= 0 && int(v) < len(verdictNames) {
+		return verdictNames[v]
+	}
+	return fmt.Sprintf("Verdict(%d)", int(v))
+}
+
+// Weakening 削弱沙箱的方式
+type Weakening int
+
+const (
+	// ReplaceMemberAccess 把 SecurityMemberAccess 换成 DefaultMemberAccess，之后沙箱不再限制
+	ReplaceMemberAccess Weakening = iota
+	// AllowStaticMethods 打开 allowStaticMethodAccess
+	AllowStaticMethods
+	// ClearExcludedClasses 清空排除的类
+	ClearExcludedClasses
+	// ClearExcludedPackages 清空排除的包名和包名正则
+	ClearExcludedPackages
+)
+
+var weakeningNames = [...]string{
+	ReplaceMemberAccess:   "replace-member-access",
+	AllowStaticMethods:    "allow-static-methods",
+	ClearExcludedClasses:  "clear-excluded-classes",
+	ClearExcludedPackages: "clear-excluded-packages",
+}
+
+func (w Weakening) String() string {
+	if w >= 0 && int(w) < len(weakeningNames) {
+		return weakeningNames[w]
+	}
+	return fmt.Sprintf("Weakening(%d)", int(w))
+}
+
+// Step 载荷削弱沙箱的一步
+type Step struct {
+	Node ast.Expression
+	Kind Weakening
+	// Effective 这一步在策略下生效
+	Effective bool
+	// Reason 不生效的原因，生效时为空
+	Reason string
+}
+
+func (s Step) String() string {
+	if s.Effective {
+		return fmt.Sprintf("%s: %s", s.Kind, s.Node)
+	}
+	return fmt.Sprintf("%s: %s (no effect: %s)", s.Kind, s.Node, s.Reason)
+}
+
+// Decision 一个调用的结果
+type Decision struct {
+	// Node StaticMethodExpression、CallExpression 或 ConstructorExpression
+	Node ast.Expression
+	// Class 调用的类 (方法调用为接收者的类型)，未知时为空
+	Class   string
+	Verdict Verdict
+	// Reason 被拦截或无法确定的原因
+	Reason string
+	// Weakened 调用之前已经生效的削弱步骤，按求值顺序排列
+	Weakened []Step
+}
+
+func (d Decision) String() string {
+	if d.Reason == "" {
+		return fmt.Sprintf("%s [%s]", d.Node, d.Verdict)
+	}
+	return fmt.Sprintf("%s [%s]: %s", d.Node, d.Verdict, d.Reason)
+}
+
+// Report 一个表达式在策略下的检查结果
+type Report struct {
+	Profile *Profile
+	// Steps 载荷削弱沙箱的步骤，按求值顺序排列，包括不生效的步骤
+	Steps []Step
+	// Decisions 每个调用的结果，按求值顺序排列
+	Decisions []Decision
+}
+
+// Blocked 返回被拦截的调用
+func (r *Report) Blocked() []Decision {
+	var out []Decision
+	for _, d := range r.Decisions {
+		if d.Verdict == Blocked {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+var classes = ast.NewClassResolver()
+
+// memberAccessProperties 赋值后削弱沙箱的 _memberAccess 属性
+var memberAccessProperties = map[string]Weakening{
+	"allowStaticMethodAccess":     AllowStaticMethods,
+	"excludedClasses":             ClearExcludedClasses,
+	"excludedPackageNames":        ClearExcludedPackages,
+	"excludedPackageNamePatterns": ClearExcludedPackages,
+}
+
+// exclusionGetters 和 exclusionSetters OgnlUtil 上读写排除列表的方法
+var (
+	exclusionGetters = map[string]Weakening{
+		"getExcludedClasses":             ClearExcludedClasses,
+		"getExcludedPackageNames":        ClearExcludedPackages,
+		"getExcludedPackageNamePatterns": ClearExcludedPackages,
+	}
+	exclusionSetters = map[string]Weakening{
+		"setExcludedClasses":             ClearExcludedClasses,
+		"setExcludedPackageNames":        ClearExcludedPackages,
+		"setExcludedPackageNamePatterns": ClearExcludedPackages,
+	}
+)
+
+// declaringClasses 只有一个类声明的方法，调用它时接收者一定是这个类，
+// 即使推断出的类型是父类型 (#request['struts.valueStack'].context 是 Map，实际上是 OgnlContext)
+var declaringClasses = map[string]string{
+	"setMemberAccess":                "ognl.OgnlContext",
+	"getExcludedClasses":             "com.opensymphony.xwork2.ognl.OgnlUtil",
+	"getExcludedPackageNames":        "com.opensymphony.xwork2.ognl.OgnlUtil",
+	"getExcludedPackageNamePatterns": "com.opensymphony.xwork2.ognl.OgnlUtil",
+	"setExcludedClasses":             "com.opensymphony.xwork2.ognl.OgnlUtil",
+	"setExcludedPackageNames":        "com.opensymphony.xwork2.ognl.OgnlUtil",
+	"setExcludedPackageNamePatterns": "com.opensymphony.xwork2.ognl.OgnlUtil",
+}
+
+// Check 按求值顺序检查表达式中的调用和削弱沙箱的步骤
+//
+// 静态方法和构造函数的类由 ast.ClassResolver 解析，方法调用的类是 types 包推断的接收者类型
+// (setMemberAccess 等只有一个类声明的方法直接使用声明的类)，不检查声明方法的父类。每个求值顺序上的节点只计算一次，
+// 因此条件、投影和 lambda 中的调用也按出现的顺序处理。
+func (p *Profile) Check(expr ast.Expression) *Report {
+	c := &checker{
+		profile:   p,
+		info:      types.Builtin().Infer(expr),
+		receivers: map[ast.Expression]ast.Expression{},
+		decisions: map[ast.Expression]*Decision{},
+		report:    &Report{Profile: p},
+	}
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		if chain, ok := node.(*ast.ChainExpression); ok {
+			for i := 1; i < len(chain.Children); i++ {
+				c.receivers[chain.Children[i]] = chain.Children[i-1]
+			}
+		}
+		return true
+	})
+	c.walk(expr)
+	return c.report
+}
+
+type checker struct {
+	profile   *Profile
+	info      *types.Info
+	receivers map[ast.Expression]ast.Expression
+	decisions map[ast.Expression]*Decision
+	report    *Report
+	// 已经生效的削弱
+	replaced, staticMethods, classesCleared, packagesCleared bool
+}
+
+// walk 后序访问节点：子节点先于父节点求值，赋值先求右侧
+func (c *checker) walk(node ast.Expression) {
+	if a, ok := node.(*ast.AssignmentExpression); ok {
+		c.walk(a.Right)
+		for _, child := range ast.Children(a.Left) {
+			c.walk(child)
+		}
+	} else {
+		for _, child := range ast.Children(node) {
+			c.walk(child)
+		}
+	}
+	switch n := node.(type) {
+	case *ast.StaticMethodExpression, *ast.ConstructorExpression:
+		c.decide(n, c.classOf(n))
+	case *ast.CallExpression:
+		class, ok := declaringClasses[n.Method]
+		if !ok {
+			class = types.Erase(c.info.Of(c.receiver(n)))
+		}
+		c.decide(n, class)
+		c.callStep(n)
+	case *ast.AssignmentExpression:
+		c.assignStep(n)
+	}
+}
+
+func (c *checker) receiver(n *ast.CallExpression) ast.Expression {
+	if n.Object != nil {
+		return n.Object
+	}
+	return c.receivers[n]
+}
+
+// classOf 静态方法和构造函数的类，数组构造返回空字符串
+func (c *checker) classOf(node ast.Expression) string {
+	if n, ok := node.(*ast.ConstructorExpression); ok && n.IsArray {
+		return ""
+	}
+	class, _ := classes.Resolve(ast.ClassOf(node))
+	return class
+}
+
+// decide 按当前削弱的状态判断调用
+func (c *checker) decide(node ast.Expression, class string) {
+	d := &Decision{Node: node, Class: class}
+	for _, s := range c.report.Steps {
+		if s.Effective {
+			d.Weakened = append(d.Weakened, s)
+		}
+	}
+	d.Verdict, d.Reason = c.verdict(node, class)
+	c.decisions[node] = d
+	c.report.Decisions = append(c.report.Decisions, *d)
+}
+
+func (c *checker) verdict(node ast.Expression, class string) (Verdict, string) {
+	if n, ok := node.(*ast.ConstructorExpression); ok && n.IsArray {
+		return Allowed, ""
+	}
+	if c.replaced {
+		return Allowed, ""
+	}
+	if _, ok := node.(*ast.StaticMethodExpression); ok && !c.profile.AllowStaticMethodAccess && !c.staticMethods {
+		return Blocked, "static method access is disabled"
+	}
+	if class == "" || strings.HasSuffix(class, "[]") || !strings.Contains(class, ".") {
+		return Unknown, "the class of the receiver is unknown"
+	}
+	if !c.classesCleared {
+		if reason, ok := c.profile.ExcludesClass(class); ok {
+			return Blocked, reason
+		}
+	}
+	if !c.packagesCleared {
+		if reason, ok := c.profile.ExcludesPackage(class); ok {
+			return Blocked, reason
+		}
+	}
+	return Allowed, ""
+}
+
+// allowed 报告调用是否被判定为可以执行
+func (c *checker) allowed(node ast.Expression) bool {
+	d := c.decisions[node]
+	return d != nil && d.Verdict == Allowed
+}
+
+// callStep 识别通过方法调用削弱沙箱的步骤：
+// #context.setMemberAccess(...)、#ognlUtil.getExcludedClasses().clear() 和 #ognlUtil.setExcludedClasses(”)
+func (c *checker) callStep(n *ast.CallExpression) {
+	if kind, ok := exclusionSetters[n.Method]; ok {
+		c.step(n, kind, c.blockedReason(n))
+		return
+	}
+	switch {
+	case n.Method == "setMemberAccess" && len(n.Arguments) == 1:
+		c.step(n, ReplaceMemberAccess, c.blockedReason(n))
+	case n.Method == "clear" && len(n.Arguments) == 0:
+		get, ok := c.receiver(n).(*ast.CallExpression)
+		if !ok {
+			return
+		}
+		kind, ok := exclusionGetters[get.Method]
+		if !ok {
+			return
+		}
+		reason := c.blockedReason(get)
+		if reason == "" {
+			reason = c.blockedReason(n)
+		}
+		if reason == "" && !c.profile.MutableExclusions {
+			reason = "the exclusion lists are immutable"
+		}
+		c.step(n, kind, reason)
+	}
+}
+
+// assignStep 识别通过赋值削弱沙箱的步骤：#_memberAccess = ... 和 #_memberAccess['allowStaticMethodAccess'] = true
+func (c *checker) assignStep(n *ast.AssignmentExpression) {
+	kind, ok := memberAccessTarget(n.Left)
+	if !ok {
+		return
+	}
+	reason := ""
+	if !c.profile.MemberAccessWritable {
+		reason = fmt.Sprintf("#_memberAccess is not writable in OGNL %s", c.profile.OGNL)
+	}
+	c.step(n, kind, reason)
+}
+
+// memberAccessTarget 报告赋值目标是否是 #_memberAccess 或它的属性
+func memberAccessTarget(left ast.Expression) (Weakening, bool) {
+	if v, ok := left.(*ast.VariableExpression); ok {
+		return ReplaceMemberAccess, v.Name == "_memberAccess"
+	}
+	chain, ok := left.(*ast.ChainExpression)
+	if !ok || len(chain.Children) != 2 {
+		return 0, false
+	}
+	if v, ok := chain.Children[0].(*ast.VariableExpression); !ok || v.Name != "_memberAccess" {
+		return 0, false
+	}
+	var name string
+	switch n := chain.Children[1].(type) {
+	case *ast.Identifier:
+		name = n.Value
+	case *ast.IndexExpression:
+		lit, ok := n.Index.(*ast.Literal)
+		if !ok {
+			return 0, false
+		}
+		name, _ = lit.Value.(string)
+	}
+	kind, ok := memberAccessProperties[name]
+	return kind, ok
+}
+
+// blockedReason 调用没有被判定为可以执行时返回原因
+func (c *checker) blockedReason(node ast.Expression) string {
+	if c.allowed(node) {
+		return ""
+	}
+	d := c.decisions[node]
+	return fmt.Sprintf("%s is %s: %s", d.Node, d.Verdict, d.Reason)
+}
+
+// step 记录一步，reason 为空时生效
+func (c *checker) step(node ast.Expression, kind Weakening, reason string) {
+	s := Step{Node: node, Kind: kind, Effective: reason == "", Reason: reason}
+	c.report.Steps = append(c.report.Steps, s)
+	if !s.Effective {
+		return
+	}
+	switch kind {
+	case ReplaceMemberAccess:
+		c.replaced = true
+	case AllowStaticMethods:
+		c.staticMethods = true
+	case ClearExcludedClasses:
+		c.classesCleared = true
+	case ClearExcludedPackages:
+		c.packagesCleared = true
+	}
+}
+
+// =============================================================================
+// 分析器
+// =============================================================================
+
+// Analyzers 返回在策略下检查的两条规则：sandbox-weakening 报告每个削弱沙箱的步骤，
+// sandbox-policy 报告每个调用会被拦截、可以执行还是无法确定
+func (p *Profile) Analyzers() []analyze.Rule {
+	return []analyze.Rule{
+		{
+			ID:          "sandbox-weakening",
+			Severity:    analyze.Critical,
+			Description: fmt.Sprintf("在 %s 的沙箱下削弱沙箱的步骤", p),
+			CheckTree: func(root ast.Expression, report func(ast.Expression, ast.Span, string)) {
+				for i, s := range p.Check(root).Steps {
+					msg := fmt.Sprintf("step %d: %s, effective under %s", i+1, s.Kind, p)
+					if !s.Effective {
+						msg = fmt.Sprintf("step %d: %s, no effect under %s: %s", i+1, s.Kind, p, s.Reason)
+					}
+					report(s.Node, s.Node.Span(), msg)
+				}
+			},
+		},
+		{
+			ID:          "sandbox-policy",
+			Severity:    analyze.Info,
+			Description: fmt.Sprintf("在 %s 的沙箱下每个调用能否执行", p),
+			CheckTree: func(root ast.Expression, report func(ast.Expression, ast.Span, string)) {
+				for _, d := range p.Check(root).Decisions {
+					report(d.Node, d.Node.Span(), d.message(p))
+				}
+			},
+		},
+	}
+}
+
+// message 分析器结果的说明
+func (d Decision) message(p *Profile) string {
+	target := d.Class
+	if target == "" {
+		target = "unknown class"
+	}
+	switch d.Verdict {
+	case Blocked:
+		return fmt.Sprintf("%s on %s is blocked under %s: %s", callName(d.Node), target, p, d.Reason)
+	case Unknown:
+		return fmt.Sprintf("%s cannot be decided under %s: %s", callName(d.Node), p, d.Reason)
+	}
+	if len(d.Weakened) > 0 {
+		var kinds []string
+		for _, s := range d.Weakened {
+			kinds = append(kinds, s.Kind.String())
+		}
+		return fmt.Sprintf("%s on %s is allowed under %s after %s", callName(d.Node), target, p, strings.Join(kinds, ", "))
+	}
+	return fmt.Sprintf("%s on %s is allowed under %s", callName(d.Node), target, p)
+}
+
+// callName 调用的简短名字
+func callName(node ast.Expression) string {
+	switch n := node.(type) {
+	case *ast.StaticMethodExpression:
+		return "static call " + n.Method
+	case *ast.CallExpression:
+		return "call " + n.Method
+	case *ast.ConstructorExpression:
+		return "constructor"
+	}
+	return node.String()
+}
@@ -0,0 +1,184 @@
+// Package sandbox 按 Struts 版本的沙箱策略判断载荷中的调用能否执行
+//
+// 策略 (Profile) 描述一个 Struts 版本的 SecurityMemberAccess：排除的类、排除的包 (名字和正则)、
+// 是否允许调用静态方法，以及 OGNL 版本带来的差别：#_memberAccess 能否直接赋值 (OGNL 3.0)，
+// OgnlUtil 返回的排除列表能否被清空 (2.5.22 之前)。Builtin 返回随包发布的 2.3.x、2.5.x 和 6.x 策略，
+// 也可以从 JSON 加载自定义的策略：
+//
+//	{
+//	  "profiles": {
+//	    "2.5": {
+//	      "description": "Struts 2.5.x (before 2.5.22) with OGNL 3.1.x",
+//	      "ognl": "3.1",
+//	      "allowStaticMethodAccess": false,
+//	      "excludedClasses": ["java.lang.Runtime", "ognl.OgnlContext"],
+//	      "excludedPackageNames": ["ognl", "javax"],
+//	      "excludedPackageNamePatterns": ["^java\\.lang\\..+"],
+//	      "memberAccessWritable": false,
+//	      "mutableExclusions": true
+//	    }
+//	  }
+//	}
+//
+// Profile.Check 按求值顺序检查表达式中的每个静态方法调用、方法调用和构造函数调用，
+// 同时跟踪载荷削弱沙箱的步骤 (替换 _memberAccess、清空排除列表、打开静态方法访问)：
+// 只有在当前策略下能够执行的步骤才生效，生效之后的调用按削弱后的沙箱判断。
+// Profile.Analyzers 把检查转换为 analyze.Rule。
+package sandbox
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Profile 一个 Struts 版本的沙箱策略，加载后可以被多个 goroutine 同时使用
+type Profile struct {
+	// Name 策略名，如 2.5
+	Name        string `json:"-"`
+	Description string `json:"description"`
+	// OGNL 使用的 OGNL 版本
+	OGNL string `json:"ognl"`
+	// AllowStaticMethodAccess struts.ognl.allowStaticMethodAccess
+	AllowStaticMethodAccess bool `json:"allowStaticMethodAccess"`
+	// ExcludedClasses 不能访问的类，写作二进制名
+	ExcludedClasses []string `json:"excludedClasses"`
+	// ExcludedPackageNames 不能访问的包，包括其子包
+	ExcludedPackageNames []string `json:"excludedPackageNames"`
+	// ExcludedPackageNamePatterns 与包名完整匹配的正则
+	ExcludedPackageNamePatterns []string `json:"excludedPackageNamePatterns"`
+	// AllowedPackageNames 不受包排除影响的包，包括其子包
+	AllowedPackageNames []string `json:"allowedPackageNames"`
+	// MemberAccessWritable #_memberAccess 及其属性可以直接赋值
+	MemberAccessWritable bool `json:"memberAccessWritable"`
+	// MutableExclusions OgnlUtil 的 getExcludedClasses() 等返回可以修改的集合
+	MutableExclusions bool `json:"mutableExclusions"`
+
+	patterns []*regexp.Regexp
+}
+
+func (p *Profile) String() string {
+	return "Struts " + p.Name + ".x"
+}
+
+// Parse 解析 {"profiles": {...}} 形式的策略文件，结果按名字排序
+func Parse(data []byte) ([]*Profile, error) {
+	var file struct {
+		Profiles map[string]*Profile `json:"profiles"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, err
+	}
+	out := make([]*Profile, 0, len(file.Profiles))
+	for name, p := range file.Profiles {
+		if p == nil {
+			return nil, fmt.Errorf("profile %s: null definition", name)
+		}
+		p.Name = name
+		for _, pattern := range p.ExcludedPackageNamePatterns {
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: %w", name, err)
+			}
+			p.patterns = append(p.patterns, re)
+		}
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// ParseFile 读取并解析策略文件
+func ParseFile(name string) ([]*Profile, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return profiles, nil
+}
+
+//go:embed profiles.json
+var profilesJSON []byte
+
+var builtin = func() []*Profile {
+	profiles, err := Parse(profilesJSON)
+	if err != nil {
+		panic("sandbox: profiles.json: " + err.Error())
+	}
+	return profiles
+}()
+
+// Builtin 返回随包发布的策略：2.3、2.5 和 6，调用者不能修改它们
+func Builtin() []*Profile {
+	return builtin
+}
+
+// Lookup 按名字查找内置策略，名字可以带 .x 后缀 (2.5.x) 或写出完整版本 (2.5.16)
+func Lookup(name string) (*Profile, error) {
+	name = strings.TrimSuffix(name, ".x")
+	var best *Profile
+	for _, p := range builtin {
+		if (name == p.Name || strings.HasPrefix(name, p.Name+".")) && (best == nil || len(p.Name) > len(best.Name)) {
+			best = p
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	return best, nil
+}
+
+// ExcludesClass 报告策略是否排除类 class，返回原因；类名是二进制名
+func (p *Profile) ExcludesClass(class string) (string, bool) {
+	for _, c := range p.ExcludedClasses {
+		if c == class {
+			return fmt.Sprintf("class %s is excluded", class), true
+		}
+	}
+	return "", false
+}
+
+// ExcludesPackage 报告策略是否排除类 class 所在的包，返回原因
+func (p *Profile) ExcludesPackage(class string) (string, bool) {
+	pkg := packageOf(class)
+	for _, allowed := range p.AllowedPackageNames {
+		if inPackage(pkg, allowed) {
+			return "", false
+		}
+	}
+	for _, name := range p.ExcludedPackageNames {
+		if inPackage(pkg, name) {
+			return fmt.Sprintf("package %s is excluded", name), true
+		}
+	}
+	for i, re := range p.patterns {
+		if re.MatchString(pkg) {
+			return fmt.Sprintf("package %s matches the excluded pattern %s", pkg, p.ExcludedPackageNamePatterns[i]), true
+		}
+	}
+	return "", false
+}
+
+// packageOf 返回二进制名所在的包，默认包为空字符串
+func packageOf(class string) string {
+	if i := strings.LastIndexByte(class, '.'); i >= 0 {
+		return class[:i]
+	}
+	return ""
+}
+
+// inPackage 报告 pkg 是否是 name 或其子包
+func inPackage(pkg, name string) bool {
+	return pkg == name || strings.HasPrefix(pkg, name+".")
+}
@@ -0,0 +1,219 @@
+package sandbox
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weaweawe01/ParserOgnl/analyze"
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+func parse(t *testing.T, input string) ast.Expression {
+	t.Helper()
+	expr, err := ast.New(ast.NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatalf("%s: %v", input, err)
+	}
+	return expr
+}
+
+func lookup(t *testing.T, name string) *Profile {
+	t.Helper()
+	p, err := Lookup(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// describe 每个调用写作 "源码 [结果]"，每个步骤写作 "+类别" (生效) 或 "-类别" (不生效)，按求值顺序排列
+func describe(r *Report) []string {
+	var out []string
+	for _, s := range r.Steps {
+		sign := "+"
+		if !s.Effective {
+			sign = "-"
+		}
+		out = append(out, sign+s.Kind.String())
+	}
+	for _, d := range r.Decisions {
+		out = append(out, d.String())
+	}
+	return out
+}
+
+// TestLookup 测试策略名的各种写法
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name, expected string
+	}{
+		{"2.3", "Struts 2.3.x"},
+		{"2.3.x", "Struts 2.3.x"},
+		{"2.5.16", "Struts 2.5.x"},
+		{"6", "Struts 6.x"},
+		{"6.3.0.2", "Struts 6.x"},
+	}
+	for _, tt := range tests {
+		if got := lookup(t, tt.name).String(); got != tt.expected {
+			t.Errorf("Lookup(%q) = %s, want %s", tt.name, got, tt.expected)
+		}
+	}
+	for _, name := range []string{"2", "2.4", "7.x"} {
+		if _, err := Lookup(name); err == nil {
+			t.Errorf("Lookup(%q): expected an error", name)
+		}
+	}
+}
+
+// TestExcludes 测试排除的类、包名、包名正则和例外的包
+func TestExcludes(t *testing.T) {
+	tests := []struct {
+		profile, class string
+		excluded       bool
+	}{
+		{"2.3", "java.lang.Runtime", true},
+		{"2.3", "java.lang.String", false},
+		{"2.3", "java.lang.reflect.Method", true},
+		{"2.3", "javax.script.ScriptEngineManager", true},
+		{"2.3", "javax.servlet.http.HttpServletResponse", false},
+		{"2.3", "com.opensymphony.xwork2.ognl.OgnlUtil", false},
+		{"2.5", "javax.servlet.http.HttpServletResponse", true},
+		{"2.5", "ognl.OgnlRuntime", true},
+		{"2.5", "ognlx.Foo", false},
+		{"6", "com.opensymphony.xwork2.ognl.OgnlUtil", true},
+		{"6", "java.io.File", true},
+		{"6", "java.util.HashMap", false},
+	}
+	for _, tt := range tests {
+		p := lookup(t, tt.profile)
+		_, class := p.ExcludesClass(tt.class)
+		_, pkg := p.ExcludesPackage(tt.class)
+		if got := class || pkg; got != tt.excluded {
+			t.Errorf("%s excludes %s = %v, want %v", p, tt.class, got, tt.excluded)
+		}
+	}
+}
+
+// TestCheck 同一个载荷在不同版本下的结果：削弱步骤只有在当前沙箱下能执行时才生效
+func TestCheck(t *testing.T) {
+	// CVE-2018-11776 的载荷：清空 OgnlUtil 的排除列表后替换 _memberAccess
+	const clearAndReplace = "(#ct=#request['struts.valueStack'].context).(#cr=#ct['com.opensymphony.xwork2.ActionContext.container'])." +
+		"(#ou=#cr.getInstance(@com.opensymphony.xwork2.ognl.OgnlUtil@class)).(#ou.getExcludedPackageNames().clear())." +
+		"(#ou.getExcludedClasses().clear()).(#ct.setMemberAccess(@ognl.OgnlContext@DEFAULT_MEMBER_ACCESS))." +
+		"(@java.lang.Runtime@getRuntime().exec('id'))"
+	tests := []struct {
+		profile, input string
+		expected       []string
+	}{
+		{"2.3", "#_memberAccess = @ognl.OgnlContext@DEFAULT_MEMBER_ACCESS, @Runtime@getRuntime().exec('id')", []string{
+			"+replace-member-access",
+			"@Runtime@getRuntime() [allowed]",
+			`exec("id") [allowed]`,
+		}},
+		{"2.5", "#_memberAccess = @ognl.OgnlContext@DEFAULT_MEMBER_ACCESS, @Runtime@getRuntime().exec('id')", []string{
+			"-replace-member-access",
+			"@Runtime@getRuntime() [blocked]: static method access is disabled",
+			`exec("id") [blocked]: class java.lang.Runtime is excluded`,
+		}},
+		{"2.3", "#_memberAccess['allowStaticMethodAccess'] = true, @java.lang.Math@abs(-1), @Runtime@getRuntime()", []string{
+			"+allow-static-methods",
+			"@java.lang.Math@abs(-1) [allowed]",
+			"@Runtime@getRuntime() [blocked]: class java.lang.Runtime is excluded",
+		}},
+		{"2.5", clearAndReplace, []string{
+			"+clear-excluded-packages",
+			"+clear-excluded-classes",
+			"+replace-member-access",
+			"getInstance(@com.opensymphony.xwork2.ognl.OgnlUtil@class) [allowed]",
+			"getExcludedPackageNames() [allowed]",
+			"clear() [allowed]",
+			"getExcludedClasses() [allowed]",
+			"clear() [allowed]",
+			"setMemberAccess(@ognl.OgnlContext@DEFAULT_MEMBER_ACCESS) [allowed]",
+			"@java.lang.Runtime@getRuntime() [allowed]",
+			`exec("id") [allowed]`,
+		}},
+		{"6", clearAndReplace, []string{
+			"-clear-excluded-packages",
+			"-clear-excluded-classes",
+			"-replace-member-access",
+			"getInstance(@com.opensymphony.xwork2.ognl.OgnlUtil@class) [blocked]: package com.opensymphony.xwork2.inject is excluded",
+			"getExcludedPackageNames() [blocked]: package com.opensymphony.xwork2.ognl is excluded",
+			"clear() [allowed]",
+			"getExcludedClasses() [blocked]: package com.opensymphony.xwork2.ognl is excluded",
+			"clear() [allowed]",
+			"setMemberAccess(@ognl.OgnlContext@DEFAULT_MEMBER_ACCESS) [blocked]: class ognl.OgnlContext is excluded",
+			"@java.lang.Runtime@getRuntime() [blocked]: static method access is disabled",
+			`exec("id") [blocked]: class java.lang.Runtime is excluded`,
+		}},
+		{"6", "new java.io.File(#p).delete(), #x.foo(), new int[3]", []string{
+			"new java.io.File(#p) [blocked]: package java.io is excluded",
+			"delete() [blocked]: package java.io is excluded",
+			"foo() [unknown]: the class of the receiver is unknown",
+			"new int[3] [allowed]",
+		}},
+	}
+	for _, tt := range tests {
+		got := describe(lookup(t, tt.profile).Check(parse(t, tt.input)))
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s under %s:\n%s\nwant:\n%s", tt.input, tt.profile, strings.Join(got, "\n"), strings.Join(tt.expected, "\n"))
+		}
+	}
+}
+
+// TestStepReason 不生效的步骤说明原因，调用记录之前生效的步骤
+func TestStepReason(t *testing.T) {
+	// #ou 的类型未知：setExcludedClasses 只有 OgnlUtil 声明，仍然生效；
+	// getExcludedPackageNames() 的返回类型未知，无法确定 clear() 能否执行
+	input := "#ou.setExcludedClasses(''), #ou.getExcludedPackageNames().clear(), @java.lang.Runtime@getRuntime()"
+	r := lookup(t, "2.5").Check(parse(t, input))
+	if len(r.Steps) != 2 || !r.Steps[0].Effective || r.Steps[1].Effective {
+		t.Fatalf("steps = %v", r.Steps)
+	}
+	if want := "clear() is unknown: the class of the receiver is unknown"; r.Steps[1].Reason != want {
+		t.Errorf("reason = %q, want %q", r.Steps[1].Reason, want)
+	}
+	last := r.Decisions[len(r.Decisions)-1]
+	if len(last.Weakened) != 1 || last.Weakened[0].Kind != ClearExcludedClasses || last.Reason != "static method access is disabled" {
+		t.Errorf("last decision = %s, weakened by %v", last, last.Weakened)
+	}
+
+	r = lookup(t, "6").Check(parse(t, "#ou.getExcludedClasses().clear()"))
+	if want := "getExcludedClasses() is blocked: package com.opensymphony.xwork2.ognl is excluded"; r.Steps[0].Reason != want {
+		t.Errorf("reason = %q, want %q", r.Steps[0].Reason, want)
+	}
+}
+
+// TestAnalyzers 策略的两条规则通过 analyze 包运行
+func TestAnalyzers(t *testing.T) {
+	a := analyze.New(lookup(t, "2.5").Analyzers()...)
+	input := "#_memberAccess = @ognl.OgnlContext@DEFAULT_MEMBER_ACCESS, @Runtime@getRuntime()"
+	var got []string
+	for _, f := range a.Analyze(parse(t, input)) {
+		got = append(got, f.Rule+": "+f.Message)
+	}
+	expected := []string{
+		"sandbox-weakening: step 1: replace-member-access, no effect under Struts 2.5.x: #_memberAccess is not writable in OGNL 3.1",
+		"sandbox-policy: static call getRuntime on java.lang.Runtime is blocked under Struts 2.5.x: static method access is disabled",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+// TestParseErrors 测试策略文件中的错误
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`{"profiles": {"x": null}}`, "profile x: null definition"},
+		{`{"profiles": {"x": {"excludedPackageNamePatterns": ["("]}}}`, "profile x: error parsing regexp"},
+		{`{"profiles": {"x": {"allowStatic": true}}}`, "unknown field"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: error %v, want %q", tt.input, err, tt.expected)
+		}
+	}
+}
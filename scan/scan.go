@@ -0,0 +1,299 @@
+// Package scan 在源码目录中查找并检查 OGNL 表达式
+//
+// 支持的文件：
+//   - JSP (.jsp .jspf .jspx .tag .tagx)：Struts 标签 <s:xxx> 的属性 (value="%{...}"、<s:property value="...">)
+//   - FreeMarker (.ftl)：Struts 标签 <@s.xxx> 的属性和 ${...} 插值
+//   - struts.xml (含 <struts> 根元素的 .xml)：<param> 和 <result> 中的 %{} / ${}
+//   - 校验文件 (*-validation.xml)：expression 和 fieldexpression 校验器的 expression 参数
+//   - Java (.java)：传给 Ognl.getValue、Ognl.parseExpression 等方法的字符串字面量
+//
+// 每个表达式用 ast 包解析，解析成功的再用 analyze 包检查。语法错误和检查结果
+// 都换算为文件中的行号和列号 (从 1 开始，列按字节计)。
+package scan
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/analyze"
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+// Context 表达式在文件中的出处
+type Context int
+
+const (
+	TagAttribute Context = iota
+	FreeMarker
+	StrutsParam
+	StrutsResult
+	ValidationExpression
+	JavaString
+)
+
+var contextNames = [...]string{
+	TagAttribute:         "tag-attribute",
+	FreeMarker:           "freemarker",
+	StrutsParam:          "struts-param",
+	StrutsResult:         "struts-result",
+	ValidationExpression: "validation-expression",
+	JavaString:           "java-string",
+}
+
+func (c Context) String() string {
+	if c >= 0 && int(c) < len(contextNames) {
+		return contextNames[c]
+	}
+	return fmt.Sprintf("Context(%d)", int(c))
+}
+
+// Position 文件中的位置
+type Position struct {
+	File   string
+	Offset int // 字节偏移
+	Line   int
+	Col    int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+// Occurrence 文件中的一个 OGNL 表达式
+type Occurrence struct {
+	Pos     Position
+	Context Context
+	// Source 表达式源码，已去掉 %{} 包装、XML 实体和 Java 转义
+	Source string
+	Expr   ast.Expression
+	// Err 语法错误
+	Err error
+	// Findings 安全检查结果，Span 仍是相对 Source 的范围
+	Findings []Finding
+}
+
+// Finding 一条换算了文件位置的检查结果
+type Finding struct {
+	Pos Position
+	analyze.Finding
+}
+
+// Issue 报告中的一条问题：语法错误或检查结果
+type Issue struct {
+	Pos      Position
+	Severity analyze.Severity
+	// Rule 检查规则 ID，语法错误为 "syntax-error"
+	Rule    string
+	Message string
+	Context Context
+	Source  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s [%s] %s: %s", i.Pos, i.Severity, i.Rule, i.Message)
+}
+
+// Scanner 扫描目录或文件，可以被多个 goroutine 同时使用
+type Scanner struct {
+	// Include 只扫描匹配的文件，为空时扫描所有支持的文件
+	// 模式相对于扫描的根目录，使用 / 分隔，支持 * ? [...] 和匹配任意层目录的 **；
+	// 不含 / 的模式匹配文件名
+	Include []string
+	// Exclude 跳过匹配的文件和目录，语法同 Include
+	Exclude []string
+	// Analyzer 检查使用的分析器，nil 表示默认规则
+	Analyzer *analyze.Analyzer
+}
+
+// Dir 扫描目录下所有支持的文件，结果按文件路径和位置排序，路径相对于 root
+func (s *Scanner) Dir(root string) ([]Occurrence, error) {
+	var out []Occurrence
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." && (d.Name() == ".git" || matchAny(s.Exclude, rel)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if kindOf(rel) == unsupported || matchAny(s.Exclude, rel) || len(s.Include) > 0 && !matchAny(s.Include, rel) {
+			return nil
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		out = append(out, s.File(rel, content)...)
+		return nil
+	})
+	return out, err
+}
+
+// File 扫描一个文件的内容，name 决定文件的种类，不支持的文件返回 nil
+func (s *Scanner) File(name string, content []byte) []Occurrence {
+	text := string(content)
+	var raw []rawOccurrence
+	switch kindOf(name) {
+	case jspFile:
+		raw = tagAttributes(text, "<s:")
+	case freemarkerFile:
+		raw = append(tagAttributes(text, "<@s."), interpolations(text)...)
+	case xmlFile:
+		if strings.HasSuffix(path.Base(name), "-validation.xml") {
+			raw = validationExpressions(text)
+		} else if strings.Contains(text, "<struts") {
+			raw = strutsElements(text)
+		}
+	case javaFile:
+		raw = javaStrings(text)
+	}
+
+	analyzer := s.Analyzer
+	if analyzer == nil {
+		analyzer = analyze.New()
+	}
+	lines := newLineIndex(name, text)
+	var out []Occurrence
+	seen := map[int]bool{} // 标签属性中的 ${} 也会作为 FreeMarker 插值找到一次
+	for _, r := range raw {
+		o := Occurrence{Pos: lines.position(r.offsets[0]), Context: r.context, Source: r.source}
+		if r.err != nil {
+			o.Err = r.err
+		} else {
+			o.Expr, o.Err = ast.New(ast.NewLexer(r.source)).ParseTopLevelExpression()
+		}
+		if o.Err != nil && r.optional || seen[o.Pos.Offset] {
+			continue
+		}
+		seen[o.Pos.Offset] = true
+		if o.Expr != nil {
+			for _, f := range analyzer.Analyze(o.Expr) {
+				o.Findings = append(o.Findings, Finding{Pos: lines.position(r.offset(f.Span.Start)), Finding: f})
+			}
+		}
+		out = append(out, o)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Pos.Offset < out[j].Pos.Offset })
+	return out
+}
+
+// Issues 把语法错误和检查结果整理为按位置排序的问题列表
+func Issues(occurrences []Occurrence) []Issue {
+	var out []Issue
+	for _, o := range occurrences {
+		if o.Err != nil {
+			out = append(out, Issue{Pos: o.Pos, Severity: analyze.Info, Rule: "syntax-error", Message: o.Err.Error(), Context: o.Context, Source: o.Source})
+		}
+		for _, f := range o.Findings {
+			out = append(out, Issue{Pos: f.Pos, Severity: f.Severity, Rule: f.Rule, Message: f.Message, Context: o.Context, Source: o.Source})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Pos.File != out[j].Pos.File {
+			return out[i].Pos.File < out[j].Pos.File
+		}
+		return out[i].Pos.Offset < out[j].Pos.Offset
+	})
+	return out
+}
+
+// =============================================================================
+// 文件种类和路径模式
+// =============================================================================
+
+type fileKind int
+
+const (
+	unsupported fileKind = iota
+	jspFile
+	freemarkerFile
+	xmlFile
+	javaFile
+)
+
+func kindOf(name string) fileKind {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jsp", ".jspf", ".jspx", ".tag", ".tagx":
+		return jspFile
+	case ".ftl":
+		return freemarkerFile
+	case ".xml":
+		return xmlFile
+	case ".java":
+		return javaFile
+	}
+	return unsupported
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if matchGlob(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob 报告相对路径是否匹配模式，不含 / 的模式匹配文件名
+func matchGlob(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments 逐段匹配，** 匹配零个或多个目录
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// lineIndex 把字节偏移换算为行号和列号
+type lineIndex struct {
+	file   string
+	starts []int // 每行的起始偏移
+}
+
+func newLineIndex(file, text string) *lineIndex {
+	starts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return &lineIndex{file: file, starts: starts}
+}
+
+func (l *lineIndex) position(offset int) Position {
+	line := sort.Search(len(l.starts), func(i int) bool { return l.starts[i] > offset })
+	return Position{File: l.file, Offset: offset, Line: line, Col: offset - l.starts[line-1] + 1}
+}
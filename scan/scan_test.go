@@ -0,0 +1,108 @@
+package scan
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestDir 扫描 testdata/app 下的 Struts 应用
+func TestDir(t *testing.T) {
+	s := &Scanner{Exclude: []string{"legacy/**"}}
+	occurrences, err := s.Dir("testdata/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []string
+	for _, o := range occurrences {
+		found = append(found, o.Pos.String()+" "+o.Context.String()+" "+o.Source)
+	}
+	expected := []string{
+		"User-validation.xml:5:40 validation-expression password == confirm && age > 0",
+		"User-validation.xml:9:30 validation-expression age >= 18 && #context['x'] != null",
+		"WEB-INF/ftl/list.ftl:3:21 tag-attribute users",
+		"WEB-INF/ftl/list.ftl:4:9 freemarker name",
+		"WEB-INF/ftl/list.ftl:6:23 tag-attribute @java.lang.Runtime@getRuntime().exec('id')",
+		"WEB-INF/jsp/user.jsp:4:22 tag-attribute user.name",
+		"WEB-INF/jsp/user.jsp:5:15 tag-attribute user.age > 18",
+		"WEB-INF/jsp/user.jsp:6:38 tag-attribute #parameters.email[0]",
+		"WEB-INF/jsp/user.jsp:8:16 tag-attribute #request['x'].getClass().getClassLoader()",
+		"WEB-INF/jsp/user.jsp:9:22 tag-attribute user.(name",
+		"src/com/example/LegacyAction.java:7:38 java-string user.name",
+		"src/com/example/LegacyAction.java:8:45 java-string @java.lang.Class@forName(\"java.lang.Runtime\")",
+		"src/com/example/LegacyAction.java:9:37 java-string user.(",
+		"src/com/example/LegacyAction.java:10:39 java-string #request.id",
+		"struts.xml:8:64 struts-param fileName",
+		"struts.xml:11:61 struts-result id",
+		"struts.xml:11:75 struts-result #_memberAccess",
+	}
+	if got, want := strings.Join(found, "\n"), strings.Join(expected, "\n"); got != want {
+		t.Errorf("occurrences:\n%s\nwant:\n%s", got, want)
+	}
+
+	var issues []string
+	for _, i := range Issues(occurrences) {
+		issues = append(issues, i.Pos.String()+" "+i.Rule)
+	}
+	expected = []string{
+		"User-validation.xml:9:54 context-access",
+		"WEB-INF/ftl/list.ftl:6:23 dangerous-class",
+		"WEB-INF/ftl/list.ftl:6:23 runtime-exec",
+		"WEB-INF/jsp/user.jsp:8:30 classloader",
+		"WEB-INF/jsp/user.jsp:9:22 syntax-error",
+		"src/com/example/LegacyAction.java:8:45 reflection",
+		"src/com/example/LegacyAction.java:8:70 dangerous-class",
+		"src/com/example/LegacyAction.java:9:37 syntax-error",
+		"struts.xml:11:75 member-access",
+	}
+	if got, want := strings.Join(issues, "\n"), strings.Join(expected, "\n"); got != want {
+		t.Errorf("issues:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	s := &Scanner{Include: []string{"**/*.jsp"}}
+	occurrences, err := s.Dir("testdata/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]bool{}
+	for _, o := range occurrences {
+		files[o.Pos.File] = true
+	}
+	if len(files) != 2 || !files["WEB-INF/jsp/user.jsp"] || !files["legacy/old.jsp"] {
+		t.Errorf("files = %v", files)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"*.jsp", "WEB-INF/jsp/user.jsp", true},
+		{"**/*.jsp", "user.jsp", true},
+		{"WEB-INF/**/*.ftl", "WEB-INF/ftl/a/list.ftl", true},
+		{"WEB-INF/*.ftl", "WEB-INF/ftl/list.ftl", false},
+		{"legacy/**", "legacy/old.jsp", true},
+		{"src/**/Test*.java", "src/com/example/LegacyAction.java", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.path); got != tt.match {
+			t.Errorf("matchGlob(%q, %q) = %v", tt.pattern, tt.path, got)
+		}
+	}
+}
+
+// TestDecodeOffsets 解码 XML 实体和 Java 转义后，表达式中的位置仍然指向文件中的原文
+func TestDecodeOffsets(t *testing.T) {
+	raw := `a &lt; <![CDATA[b]]>`
+	s, offsets := decodeXML(raw, 10)
+	if s != "a < b" || offsets[2] != 12 || offsets[4] != 26 {
+		t.Errorf("decodeXML = %q, %v", s, offsets)
+	}
+	s, offsets = decodeJava(`x\"A\101y`, 0)
+	if s != `x"AAy` || offsets[2] != 3 || offsets[3] != 4 || offsets[4] != 8 {
+		t.Errorf("decodeJava = %q, %v", s, offsets)
+	}
+}
@@ -0,0 +1,370 @@
+package scan
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/template"
+)
+
+// =============================================================================
+// 按文件格式找出表达式
+// =============================================================================
+
+// rawOccurrence 找到的表达式源码，尚未解析
+type rawOccurrence struct {
+	context Context
+	source  string
+	// offsets[i] 是 source[i] 在文件中的偏移，最后一项是源码末尾的偏移
+	offsets []int
+	// optional 解析失败时不报告 (FreeMarker 插值可能是 FreeMarker 自己的表达式)
+	optional bool
+	// err 找到时已经确定的错误，如没有闭合的 %{
+	err error
+}
+
+// offset 返回 source 中第 i 个字节在文件中的偏移
+func (r rawOccurrence) offset(i int) int {
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(r.offsets) {
+		i = len(r.offsets) - 1
+	}
+	return r.offsets[i]
+}
+
+// identity 从文件偏移 start 开始、与文件内容一一对应的偏移表
+func identity(s string, start int) []int {
+	offsets := make([]int, len(s)+1)
+	for i := range offsets {
+		offsets[i] = start + i
+	}
+	return offsets
+}
+
+// wrapped 找出 value 中 %{} / ${} 包装的表达式
+func wrapped(ctx Context, value string, offsets []int) []rawOccurrence {
+	var out []rawOccurrence
+	for _, seg := range template.Parse(value).Expressions() {
+		r := rawOccurrence{context: ctx, source: seg.Text, offsets: offsets[seg.Offset : seg.Offset+len(seg.Text)+1]}
+		if seg.Expr == nil {
+			r.err = seg.Err
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// hasWrapper 报告文本中是否有 %{ 或 ${
+func hasWrapper(s string) bool {
+	return strings.Contains(s, "%{") || strings.Contains(s, "${")
+}
+
+// =============================================================================
+// JSP 和 FreeMarker 标签
+// =============================================================================
+
+// ognlAttributes 不带 %{} 时也按 OGNL 求值的 Struts 标签属性
+var ognlAttributes = map[string]map[string]bool{
+	"property":             {"value": true},
+	"set":                  {"value": true},
+	"push":                 {"value": true},
+	"iterator":             {"value": true},
+	"param":                {"value": true},
+	"if":                   {"test": true},
+	"elseif":               {"test": true},
+	"select":               {"list": true},
+	"checkboxlist":         {"list": true},
+	"radio":                {"list": true},
+	"combobox":             {"list": true},
+	"doubleselect":         {"list": true, "doubleList": true},
+	"optiontransferselect": {"list": true, "doubleList": true},
+	"subset":               {"source": true},
+	"sort":                 {"source": true},
+}
+
+var tagName = regexp.MustCompile(`^[\w-]+`)
+
+// tagAttributes 找出以 prefix (<s: 或 <@s.) 开头的标签中的表达式
+func tagAttributes(text, prefix string) []rawOccurrence {
+	var out []rawOccurrence
+	for i := 0; ; {
+		j := strings.Index(text[i:], prefix)
+		if j < 0 {
+			return out
+		}
+		i += j + len(prefix)
+		name := tagName.FindString(text[i:])
+		if name == "" {
+			continue
+		}
+		i += len(name)
+		i = attributes(text, i, func(attr, value string, start int) {
+			offsets := identity(value, start)
+			switch {
+			case hasWrapper(value):
+				out = append(out, wrapped(TagAttribute, value, offsets)...)
+			case ognlAttributes[name][attr]:
+				out = append(out, rawOccurrence{context: TagAttribute, source: value, offsets: offsets})
+			}
+		})
+	}
+}
+
+// attributes 从 i 开始读取带引号的属性，直到引号外的 '>'，返回 '>' 之后的位置
+func attributes(text string, i int, fn func(name, value string, start int)) int {
+	for i < len(text) {
+		c := text[i]
+		switch {
+		case c == '>':
+			return i + 1
+		case c == '"' || c == '\'':
+			// 没有名字的引号内容，整体跳过
+			end := strings.IndexByte(text[i+1:], c)
+			if end < 0 {
+				return len(text)
+			}
+			i += end + 2
+		case isNameByte(c):
+			start := i
+			for i < len(text) && isNameByte(text[i]) {
+				i++
+			}
+			name := text[start:i]
+			k := skipSpace(text, i)
+			if k >= len(text) || text[k] != '=' {
+				continue
+			}
+			k = skipSpace(text, k+1)
+			if k >= len(text) || text[k] != '"' && text[k] != '\'' {
+				i = k
+				continue
+			}
+			end := strings.IndexByte(text[k+1:], text[k])
+			if end < 0 {
+				return len(text)
+			}
+			fn(name, text[k+1:k+1+end], k+1)
+			i = k + end + 2
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c == '-' || c == ':' || c == '.' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func skipSpace(text string, i int) int {
+	for i < len(text) && (text[i] == ' ' || text[i] == '\t' || text[i] == '\r' || text[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// interpolations 找出 FreeMarker 模板中的 ${...} 插值
+func interpolations(text string) []rawOccurrence {
+	var out []rawOccurrence
+	for _, r := range wrapped(FreeMarker, text, identity(text, 0)) {
+		if text[r.offsets[0]-2] == '$' {
+			r.optional = true
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// =============================================================================
+// struts.xml 和校验文件
+// =============================================================================
+
+var (
+	paramElement  = regexp.MustCompile(`(?s)<param\b[^>]*>(.*?)</param>`)
+	resultElement = regexp.MustCompile(`(?s)<result(?:\s[^>]*[^/])?>(.*?)</result>`)
+	validator     = regexp.MustCompile(`(?s)<(?:field-validator|validator)\b([^>]*)>(.*?)</(?:field-validator|validator)>`)
+	expressionTyp = regexp.MustCompile(`\btype\s*=\s*["'](?:expression|fieldexpression)["']`)
+	expressionArg = regexp.MustCompile(`(?s)<param\s+name\s*=\s*["']expression["']\s*>(.*?)</param>`)
+)
+
+// strutsElements 找出 <param> 和 <result> 内容中的 %{} / ${}
+// 含有子元素的 <result> 由其中的 <param> 处理
+func strutsElements(text string) []rawOccurrence {
+	var out []rawOccurrence
+	for _, m := range paramElement.FindAllStringSubmatchIndex(text, -1) {
+		value, offsets := decodeXML(text[m[2]:m[3]], m[2])
+		out = append(out, wrapped(StrutsParam, value, offsets)...)
+	}
+	for _, m := range resultElement.FindAllStringSubmatchIndex(text, -1) {
+		if body := text[m[2]:m[3]]; !strings.Contains(strings.ReplaceAll(body, "<![CDATA[", ""), "<") {
+			value, offsets := decodeXML(body, m[2])
+			out = append(out, wrapped(StrutsResult, value, offsets)...)
+		}
+	}
+	return out
+}
+
+// validationExpressions 找出 expression 和 fieldexpression 校验器的 expression 参数
+func validationExpressions(text string) []rawOccurrence {
+	var out []rawOccurrence
+	for _, m := range validator.FindAllStringSubmatchIndex(text, -1) {
+		if !expressionTyp.MatchString(text[m[2]:m[3]]) {
+			continue
+		}
+		body := text[m[4]:m[5]]
+		for _, p := range expressionArg.FindAllStringSubmatchIndex(body, -1) {
+			value, offsets := decodeXML(body[p[2]:p[3]], m[4]+p[2])
+			value, offsets = trimSpace(value, offsets)
+			out = append(out, rawOccurrence{context: ValidationExpression, source: value, offsets: offsets})
+		}
+	}
+	return out
+}
+
+// trimSpace 去掉首尾空白，同时调整偏移表
+func trimSpace(s string, offsets []int) (string, []int) {
+	start := len(s) - len(strings.TrimLeft(s, " \t\r\n"))
+	end := len(strings.TrimRight(s, " \t\r\n"))
+	if start > end {
+		start = end
+	}
+	return s[start:end], offsets[start : end+1]
+}
+
+var xmlEntities = map[string]string{"lt": "<", "gt": ">", "amp": "&", "quot": "\"", "apos": "'"}
+
+// decodeXML 展开 CDATA 和实体引用，返回文本和偏移表，raw 从文件偏移 start 开始
+func decodeXML(raw string, start int) (string, []int) {
+	var sb strings.Builder
+	var offsets []int
+	emit := func(s string, at int) {
+		for i := 0; i < len(s); i++ {
+			offsets = append(offsets, at)
+		}
+		sb.WriteString(s)
+	}
+	for i := 0; i < len(raw); {
+		if strings.HasPrefix(raw[i:], "<![CDATA[") {
+			body := raw[i+len("<![CDATA["):]
+			end := strings.Index(body, "]]>")
+			if end < 0 {
+				end = len(body)
+			}
+			base := i + len("<![CDATA[")
+			for k := 0; k < end; k++ {
+				emit(body[k:k+1], start+base+k)
+			}
+			i = base + end + len("]]>")
+			continue
+		}
+		if raw[i] == '&' {
+			if semi := strings.IndexByte(raw[i:], ';'); semi > 0 {
+				if s, ok := entity(raw[i+1 : i+semi]); ok {
+					emit(s, start+i)
+					i += semi + 1
+					continue
+				}
+			}
+		}
+		emit(raw[i:i+1], start+i)
+		i++
+	}
+	offsets = append(offsets, start+len(raw))
+	return sb.String(), offsets
+}
+
+// entity 展开实体名 (不含 & 和 ;)
+func entity(name string) (string, bool) {
+	if s, ok := xmlEntities[name]; ok {
+		return s, true
+	}
+	if num, ok := strings.CutPrefix(name, "#"); ok {
+		base := 10
+		if hex, ok := strings.CutPrefix(strings.ToLower(num), "x"); ok {
+			num, base = hex, 16
+		}
+		if n, err := strconv.ParseInt(num, base, 32); err == nil {
+			return string(rune(n)), true
+		}
+	}
+	return "", false
+}
+
+// =============================================================================
+// Java 源码
+// =============================================================================
+
+// javaCall 以字符串字面量作为第一个参数调用 OGNL 的方法
+var javaCall = regexp.MustCompile(`(?:\bOgnl\s*\.\s*(?:getValue|setValue|parseExpression)|\.\s*(?:findValue|findString))\s*\(\s*"((?:[^"\\\n]|\\.)*)"\s*[,)]`)
+
+// javaStrings 找出传给 Ognl.getValue、Ognl.parseExpression、ValueStack.findValue 等方法的字符串字面量
+func javaStrings(text string) []rawOccurrence {
+	var out []rawOccurrence
+	for _, m := range javaCall.FindAllStringSubmatchIndex(text, -1) {
+		value, offsets := decodeJava(text[m[2]:m[3]], m[2])
+		out = append(out, rawOccurrence{context: JavaString, source: value, offsets: offsets})
+	}
+	return out
+}
+
+// decodeJava 展开 Java 字符串字面量中的转义，返回文本和偏移表
+func decodeJava(raw string, start int) (string, []int) {
+	var sb strings.Builder
+	var offsets []int
+	emit := func(s string, at int) {
+		for i := 0; i < len(s); i++ {
+			offsets = append(offsets, start+at)
+		}
+		sb.WriteString(s)
+	}
+	for i := 0; i < len(raw); {
+		if raw[i] != '\\' || i+1 == len(raw) {
+			emit(raw[i:i+1], i)
+			i++
+			continue
+		}
+		at := i
+		c := raw[i+1]
+		i += 2
+		switch c {
+		case 'b':
+			emit("\b", at)
+		case 't':
+			emit("\t", at)
+		case 'n':
+			emit("\n", at)
+		case 'f':
+			emit("\f", at)
+		case 'r':
+			emit("\r", at)
+		case 'u':
+			for i < len(raw) && raw[i] == 'u' {
+				i++
+			}
+			if i+4 <= len(raw) {
+				if n, err := strconv.ParseUint(raw[i:i+4], 16, 16); err == nil {
+					emit(string(rune(n)), at)
+					i += 4
+					continue
+				}
+			}
+			emit(raw[at:i], at)
+		default:
+			if '0' <= c && c <= '7' {
+				n := int(c - '0')
+				for k := 0; k < 2 && i < len(raw) && '0' <= raw[i] && raw[i] <= '7' && n*8+int(raw[i]-'0') <= 0377; k++ {
+					n = n*8 + int(raw[i]-'0')
+					i++
+				}
+				emit(string(rune(n)), at)
+			} else {
+				emit(string(c), at)
+			}
+		}
+	}
+	offsets = append(offsets, start+len(raw))
+	return sb.String(), offsets
+}
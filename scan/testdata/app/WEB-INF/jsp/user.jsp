@@ -0,0 +1,11 @@
+<%@ taglib prefix="s" uri="/struts-tags" %>
+<html>
+<body>
+  <s:property value="user.name"/>
+  <s:if test="user.age > 18">adult</s:if>
+  <s:textfield name="email" value="%{#parameters.email[0]}" label="Email"/>
+  <s:url value="/list.action"/>
+  <s:a href="%{#request['x'].getClass().getClassLoader()}">link</s:a>
+  <s:property value="user.(name"/>
+</body>
+</html>
@@ -0,0 +1 @@
+<s:property value="#_memberAccess"/>
@@ -0,0 +1,13 @@
+package com.example;
+
+import ognl.Ognl;
+
+public class LegacyAction {
+    public Object run(Object root, java.util.Map ctx) throws Exception {
+        Object name = Ognl.getValue("user.name", ctx, root);
+        Object tree = Ognl.parseExpression("@java.lang.Class@forName(\"java.lang.Runtime\")");
+        Object bad = Ognl.getValue("user.(", ctx, root);
+        String id = stack.findString("#request.id");
+        return Ognl.getValue(dynamicExpression, ctx, root);
+    }
+}
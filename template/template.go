@@ -0,0 +1,229 @@
+// Package template 拆分和渲染嵌入了 OGNL 的文本
+//
+// Struts 的标签属性、TextParseUtil.translateVariables 处理的消息和 struts.xml 中的参数
+// 以 %{expr} 或 ${expr} 的形式嵌入 OGNL。Parse 把这样的文本拆分为文本段和表达式段：
+//   - 表达式内部的花括号 (map 字面量等) 和字符串字面量中的 '}' 不会提前结束表达式
+//   - \%{ 和 \${ 是转义，表示字面的 %{ 和 ${
+//   - 每个表达式段用 ast 包解析，段中记录它在输入中的位置，用于把语法树的范围映射回输入
+//
+// Render 通过求值回调渲染整个模板，Eval 返回使用 eval 包求值的回调。
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/eval"
+)
+
+// Kind 段的种类
+type Kind int
+
+const (
+	// Text 字面文本
+	Text Kind = iota
+	// Expression %{...} 或 ${...} 包装的表达式
+	Expression
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Text:
+		return "text"
+	case Expression:
+		return "expression"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Segment 模板中的一段
+type Segment struct {
+	Kind Kind
+	// Open 表达式的起始字符 '%' 或 '$'，文本段为 0
+	Open byte
+	// Text 文本段为去掉转义后的文本，表达式段为花括号内的源码
+	Text string
+	// Start、End 段在输入中的字节范围，表达式段包括 %{ 和 }
+	Start, End int
+	// Offset 表达式源码在输入中的起始位置，文本段与 Start 相同
+	Offset int
+	// Expr 表达式段解析得到的语法树，解析失败时为 nil
+	Expr ast.Expression
+	// Err 表达式段的解析错误，或表达式没有闭合
+	Err error
+}
+
+// Absolute 把表达式语法树中的范围换算为在模板输入中的范围
+func (s Segment) Absolute(span ast.Span) ast.Span {
+	return ast.Span{Start: span.Start + s.Offset, End: span.End + s.Offset}
+}
+
+func (s Segment) String() string {
+	if s.Kind == Expression {
+		return fmt.Sprintf("%c{%s}", s.Open, s.Text)
+	}
+	return s.Text
+}
+
+// Template 拆分后的模板
+type Template struct {
+	Input    string
+	Segments []Segment
+}
+
+// Parse 拆分模板并解析其中的表达式，语法错误记录在各个表达式段的 Err 中
+func Parse(input string) *Template {
+	t := &Template{Input: input}
+	var text strings.Builder
+	textStart := 0
+	flush := func(end int) {
+		if end > textStart {
+			t.Segments = append(t.Segments, Segment{Kind: Text, Text: text.String(), Start: textStart, End: end, Offset: textStart})
+		}
+		text.Reset()
+	}
+	for i := 0; i < len(input); i++ {
+		if input[i] == '\\' && isOpen(input, i+1) {
+			text.WriteString(input[i+1 : i+3])
+			i += 2
+			continue
+		}
+		if !isOpen(input, i) {
+			text.WriteByte(input[i])
+			continue
+		}
+		flush(i)
+		seg := Segment{Kind: Expression, Open: input[i], Start: i, Offset: i + 2}
+		end, closed := closingBrace(input, i+2)
+		seg.Text = input[i+2 : end]
+		if closed {
+			seg.End = end + 1
+			seg.Expr, seg.Err = ast.New(ast.NewLexer(seg.Text)).ParseTopLevelExpression()
+		} else {
+			seg.End = end
+			seg.Err = fmt.Errorf("unterminated expression starting at offset %d", i)
+		}
+		t.Segments = append(t.Segments, seg)
+		i = seg.End - 1
+		textStart = seg.End
+	}
+	flush(len(input))
+	return t
+}
+
+// isOpen 报告 s[i:] 是否以 %{ 或 ${ 开头
+func isOpen(s string, i int) bool {
+	return i+1 < len(s) && (s[i] == '%' || s[i] == '$') && s[i+1] == '{'
+}
+
+// closingBrace 从 start 开始找出与已打开的 '{' 匹配的 '}'，跳过嵌套的花括号和字符串字面量
+// 没有闭合时返回 len(s) 和 false
+func closingBrace(s string, start int) (int, bool) {
+	depth := 1
+	var quote byte
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i, true
+			}
+		}
+	}
+	return len(s), false
+}
+
+// Err 返回第一个表达式段的错误，错误中带有该段在输入中的位置
+func (t *Template) Err() error {
+	for _, s := range t.Segments {
+		if s.Err != nil {
+			return segmentError(s)
+		}
+	}
+	return nil
+}
+
+func segmentError(s Segment) error {
+	return fmt.Errorf("expression %s at offset %d: %w", s, s.Start, s.Err)
+}
+
+// Expressions 返回所有表达式段
+func (t *Template) Expressions() []Segment {
+	var out []Segment
+	for _, s := range t.Segments {
+		if s.Kind == Expression {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Single 模板恰好是一个表达式 (如 altSyntax 下的 "%{user.name}") 时返回该表达式段
+// 这样的模板在 Struts 中求值为表达式的值本身，而不是字符串
+func (t *Template) Single() (Segment, bool) {
+	if len(t.Segments) == 1 && t.Segments[0].Kind == Expression {
+		return t.Segments[0], true
+	}
+	return Segment{}, false
+}
+
+// Evaluator 求值一个表达式段
+type Evaluator func(seg Segment) (any, error)
+
+// Eval 返回在 ctx 中求值表达式段的 Evaluator
+func Eval(ctx *eval.Context) Evaluator {
+	return func(seg Segment) (any, error) {
+		return eval.GetValue(seg.Expr, ctx)
+	}
+}
+
+// Render 依次求值表达式段并与文本段拼接
+// 与 TextParseUtil.translateVariables 一致，值为 null 的表达式渲染为空字符串
+func (t *Template) Render(fn Evaluator) (string, error) {
+	var sb strings.Builder
+	for _, s := range t.Segments {
+		if s.Kind == Text {
+			sb.WriteString(s.Text)
+			continue
+		}
+		v, err := evaluate(s, fn)
+		if err != nil {
+			return "", err
+		}
+		if v != nil {
+			sb.WriteString(eval.StringValue(v))
+		}
+	}
+	return sb.String(), nil
+}
+
+// Value 模板只有一个表达式时返回表达式的值，否则返回 Render 的结果
+func (t *Template) Value(fn Evaluator) (any, error) {
+	if s, ok := t.Single(); ok {
+		return evaluate(s, fn)
+	}
+	return t.Render(fn)
+}
+
+func evaluate(s Segment, fn Evaluator) (any, error) {
+	if s.Err != nil {
+		return nil, segmentError(s)
+	}
+	v, err := fn(s)
+	if err != nil {
+		return nil, fmt.Errorf("expression %s at offset %d: %w", s, s.Start, err)
+	}
+	return v, nil
+}
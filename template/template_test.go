@@ -0,0 +1,92 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/weaweawe01/ParserOgnl/eval"
+)
+
+// describe 把段格式化为 "种类[起始,结束) 内容"，便于比较
+func describe(t *Template) string {
+	var parts []string
+	for _, s := range t.Segments {
+		parts = append(parts, fmt.Sprintf("%s[%d,%d) %s", s.Kind, s.Start, s.End, s))
+	}
+	return strings.Join(parts, " | ")
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Hello %{user.name}!", "text[0,6) Hello  | expression[6,18) %{user.name} | text[18,19) !"},
+		{"${a}${b}", "expression[0,4) ${a} | expression[4,8) ${b}"},
+		{"%{#{'k': '}'}['k']} done", "expression[0,19) %{#{'k': '}'}['k']} | text[19,24)  done"},
+		{"cost: \\${price} is %{price}", "text[0,19) cost: ${price} is  | expression[19,27) %{price}"},
+		{"100% {not} $ {x}", "text[0,16) 100% {not} $ {x}"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tmpl := Parse(tt.input)
+			if got := describe(tmpl); got != tt.expected {
+				t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.expected)
+			}
+			if err := tmpl.Err(); err != nil {
+				t.Errorf("Err() = %v", err)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tmpl := Parse("a %{1 +} b ${x")
+	exprs := tmpl.Expressions()
+	if len(exprs) != 2 || exprs[0].Err == nil || exprs[1].Err == nil || exprs[1].Text != "x" {
+		t.Fatalf("segments = %s", describe(tmpl))
+	}
+	if err := tmpl.Err(); err == nil || !strings.Contains(err.Error(), "offset 2") {
+		t.Errorf("Err() = %v", err)
+	}
+	if _, err := tmpl.Render(Eval(eval.NewContext(nil))); err == nil {
+		t.Error("expected render error")
+	}
+}
+
+// TestAbsolute 表达式中节点的范围换算为模板中的位置
+func TestAbsolute(t *testing.T) {
+	input := "<s:property value=\"%{user.name + #suffix}\"/>"
+	start := strings.Index(input, "%{")
+	end := strings.Index(input, "}\"") + 1
+	seg, ok := Parse(input[start:end]).Single()
+	if !ok {
+		t.Fatal("expected a single expression")
+	}
+	if got := seg.Absolute(seg.Expr.Span()); input[start+got.Start:start+got.End] != "user.name + #suffix" {
+		t.Errorf("Absolute(%s) = %s", seg.Expr.Span(), got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	ctx := eval.NewContext(map[string]any{"user": map[string]any{"name": "Ada"}, "count": 3, "none": nil})
+	ctx.Set("suffix", "!")
+
+	got, err := Parse("Hello %{user.name}${#suffix} you have %{count * 2} items%{none}").Render(Eval(ctx))
+	if err != nil || got != "Hello Ada! you have 6 items" {
+		t.Errorf("Render = %q, %v", got, err)
+	}
+
+	v, err := Parse("%{count + 1}").Value(Eval(ctx))
+	if err != nil || fmt.Sprint(v) != "4" {
+		t.Errorf("Value = %#v, %v", v, err)
+	}
+
+	// 自定义回调：只输出表达式源码
+	got, err = Parse("a=%{x}, b=${y}").Render(func(s Segment) (any, error) { return "<" + s.Text + ">", nil })
+	if err != nil || got != "a=<x>, b=<y>" {
+		t.Errorf("Render with hook = %q, %v", got, err)
+	}
+}
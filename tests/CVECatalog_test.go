@@ -0,0 +1,61 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/weaweawe01/ParserOgnl/cve"
+)
+
+// corpusEntry testdata 中的一个载荷，family 为空表示正常表达式
+type corpusEntry struct {
+	Family  string `json:"family"`
+	Source  string `json:"source"`
+	Payload string `json:"payload"`
+}
+
+// TestCVECatalog 用内置目录给公开载荷分类，结果必须是标注的家族 (或其别名)
+func TestCVECatalog(t *testing.T) {
+	data, err := os.ReadFile("../cve/testdata/corpus.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var corpus []corpusEntry
+	if err := json.Unmarshal(data, &corpus); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每个家族至少有一个载荷
+	for _, f := range cve.Builtin().Families {
+		found := false
+		for _, e := range corpus {
+			if f.Is(e.Family) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("家族 %s 没有载荷", f.ID)
+		}
+	}
+
+	for _, e := range corpus {
+		name := e.Family
+		if name == "" {
+			name = "benign"
+		}
+		t.Run(name+" "+e.Source, func(t *testing.T) {
+			expr := parseExpression(t, e.Payload)
+			r := cve.Classify(expr)
+			switch {
+			case e.Family == "" && r.Family != nil:
+				t.Errorf("正常表达式被分类为 %s (置信度 %.2f)", r.Family, r.Confidence)
+			case e.Family != "" && r.Family == nil:
+				t.Errorf("载荷没有被分类，应为 %s，候选 %d 个", e.Family, len(r.Candidates))
+			case e.Family != "" && !r.Family.Is(e.Family):
+				t.Errorf("载荷被分类为 %s，应为 %s", r.Family, e.Family)
+			}
+		})
+	}
+}
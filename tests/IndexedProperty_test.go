@@ -159,6 +159,30 @@ func TestIndexedProperty(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "Values star (all) - values[*]",
+			input: "values[*]",
+			expected: ExpectedNode{
+				Type:     "ASTChain",
+				Fragment: "values[*]",
+				Children: []ExpectedNode{
+					{
+						Type:     "ASTProperty",
+						Fragment: "values",
+						Children: []ExpectedNode{
+							{Type: "ASTConst", Fragment: "\"values\""},
+						},
+					},
+					{
+						Type:     "ASTProperty",
+						Fragment: "[*]",
+						Children: []ExpectedNode{
+							{Type: "ASTConst", Fragment: "*"},
+						},
+					},
+				},
+			},
+		},
 		{
 			name:  "Set values index 1 - values[1]",
 			input: "values[1]",
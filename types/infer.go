@@ -0,0 +1,286 @@
+package types
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/dataflow"
+)
+
+// =============================================================================
+// 推断
+// =============================================================================
+
+// Info 一棵语法树的类型推断结果
+type Info struct {
+	model *Model
+	types map[ast.Expression]string
+}
+
+// Of 返回节点的类型，未知时为空字符串
+// 链返回最后一步的类型，因此匹配结果中绑定链前几步的 ChainExpression 也能得到类型
+func (i *Info) Of(node ast.Expression) string {
+	if c, ok := node.(*ast.ChainExpression); ok && len(c.Children) > 0 {
+		return i.Of(c.Children[len(c.Children)-1])
+	}
+	return i.types[node]
+}
+
+// Is 报告节点的类型是否是 class 或其子类型
+func (i *Info) Is(node ast.Expression, class string) bool {
+	return i.model.IsA(i.Of(node), i.model.Resolve(class))
+}
+
+// Infer 推断语法树中每个节点的类型
+//
+// 链的每一步按前一步的类型查找属性和方法；变量的类型是 dataflow 包求出的赋值的类型，
+// 没有赋值的预定义变量使用模型中的 Variables；从上下文 Map 中按常量键取值时使用 ContextKeys。
+// 字面量、构造函数和静态成员的类型直接得到，比较和逻辑运算是 boolean。
+func (m *Model) Infer(expr ast.Expression) *Info {
+	in := &inferer{
+		model:  m,
+		graph:  dataflow.Analyze(expr),
+		info:   &Info{model: m, types: map[ast.Expression]string{}},
+		active: map[ast.Expression]bool{},
+	}
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		in.typeOf(node)
+		return true
+	})
+	return in.info
+}
+
+type inferer struct {
+	model *Model
+	graph *dataflow.Graph
+	info  *Info
+	// active 正在推断的节点，变量的值引用自身时 (#a = #a.next) 避免无限递归
+	active map[ast.Expression]bool
+}
+
+func (in *inferer) typeOf(node ast.Expression) string {
+	if node == nil {
+		return ""
+	}
+	if t, ok := in.info.types[node]; ok || in.active[node] {
+		return t
+	}
+	in.active[node] = true
+	t := in.infer(node)
+	delete(in.active, node)
+	in.info.types[node] = t
+	return t
+}
+
+func (in *inferer) infer(node ast.Expression) string {
+	m := in.model
+	switch n := node.(type) {
+	case *ast.Literal:
+		return literalType(n)
+	case *ast.VariableExpression:
+		if value, ok := in.graph.Value(n); ok {
+			return in.typeOf(value)
+		}
+		if u := in.graph.Use(n); u == nil || len(u.Defs) == 0 {
+			return m.Variables[n.Name]
+		}
+	case *ast.AssignmentExpression:
+		return in.typeOf(n.Right)
+	case *ast.SequenceExpression:
+		if len(n.Expressions) > 0 {
+			return in.typeOf(n.Expressions[len(n.Expressions)-1])
+		}
+	case *ast.ConditionalExpression:
+		if a, b := in.typeOf(n.Consequent), in.typeOf(n.Alternative); a == b {
+			return a
+		}
+	case *ast.BinaryExpression:
+		switch n.Operator {
+		case ast.EQ, ast.NOT_EQ, ast.LT, ast.GT, ast.LT_EQ, ast.GT_EQ, ast.IN, ast.NOT_IN, ast.AND, ast.OR:
+			return "boolean"
+		case ast.PLUS:
+			if in.typeOf(n.Left) == "java.lang.String" || in.typeOf(n.Right) == "java.lang.String" {
+				return "java.lang.String"
+			}
+		}
+	case *ast.UnaryExpression:
+		if n.Operator == ast.NOT {
+			return "boolean"
+		}
+	case *ast.InstanceofExpression:
+		return "boolean"
+	case *ast.StaticFieldExpression:
+		class := m.Resolve(ast.ClassOf(n))
+		if n.Field == "class" {
+			return "java.lang.Class<" + class + ">"
+		}
+		t, _ := m.Property(class, n.Field)
+		return t
+	case *ast.StaticMethodExpression:
+		class := m.Resolve(ast.ClassOf(n))
+		t, _ := m.Method(class, n.Method)
+		return in.substitute(t, "", n.Arguments)
+	case *ast.ConstructorExpression:
+		if n.IsArray {
+			return m.Resolve(ast.ClassOf(n)) + "[]"
+		}
+		return m.Resolve(ast.ClassOf(n))
+	case *ast.ChainExpression:
+		t := ""
+		for i, step := range n.Children {
+			if i == 0 {
+				t = in.first(step)
+			} else {
+				t = in.step(t, step)
+			}
+			in.info.types[step] = t
+		}
+		return t
+	case *ast.Identifier, *ast.CallExpression, *ast.IndexExpression:
+		// 不在链中的属性、方法和下标作用于类型未知的根对象
+		return in.step("", node)
+	case *ast.ArrayExpression, *ast.ProjectionExpression, *ast.SelectionExpression:
+		return "java.util.List"
+	case *ast.MapExpression:
+		if n.ClassName != "" {
+			return m.Resolve(ast.ClassOf(n))
+		}
+		return "java.util.Map"
+	}
+	return ""
+}
+
+// first 链的第一步
+func (in *inferer) first(step ast.Expression) string {
+	switch step.(type) {
+	case *ast.Identifier, *ast.CallExpression, *ast.IndexExpression:
+		return in.step("", step)
+	}
+	return in.typeOf(step)
+}
+
+// step 链中接收者类型为 recv 的一步
+func (in *inferer) step(recv string, step ast.Expression) string {
+	m := in.model
+	switch n := step.(type) {
+	case *ast.Identifier:
+		if n.Value == "class" {
+			return "java.lang.Class<" + recv + ">"
+		}
+		t, _ := m.Property(recv, n.Value)
+		return in.substitute(t, recv, nil)
+	case *ast.CallExpression:
+		for _, arg := range n.Arguments {
+			in.typeOf(arg)
+		}
+		if n.Method == "get" && len(n.Arguments) == 1 {
+			if t, ok := in.contextKey(recv, n.Arguments[0]); ok {
+				return t
+			}
+		}
+		t, _ := m.Method(recv, n.Method)
+		return in.substitute(t, recv, n.Arguments)
+	case *ast.IndexExpression:
+		in.typeOf(n.Index)
+		if t, ok := in.contextKey(recv, n.Index); ok {
+			return t
+		}
+		if elem, ok := strings.CutSuffix(recv, "[]"); ok {
+			return elem
+		}
+		return ""
+	case *ast.ProjectionExpression, *ast.SelectionExpression:
+		in.typeOf(step)
+		return "java.util.List"
+	}
+	return in.typeOf(step)
+}
+
+// contextKey 从 Map 中按常量键取值时返回模型中该键的类型
+func (in *inferer) contextKey(recv string, key ast.Expression) (string, bool) {
+	lit, ok := key.(*ast.Literal)
+	if !ok || !in.model.IsA(recv, "java.util.Map") {
+		return "", false
+	}
+	s, ok := lit.Value.(string)
+	if !ok {
+		return "", false
+	}
+	t, ok := in.model.ContextKeys[s]
+	return t, ok
+}
+
+// substitute 替换返回类型模板中的占位符，无法确定的占位符使整个类型参数或类型为空
+func (in *inferer) substitute(tmpl, recv string, args []ast.Expression) string {
+	if !strings.Contains(tmpl, "$") {
+		return tmpl
+	}
+	value := func(ph string) string {
+		switch ph {
+		case "$this":
+			return recv
+		case "$param":
+			return Param(recv)
+		}
+		n, err := strconv.Atoi(ph[1:])
+		if err != nil || n >= len(args) {
+			return ""
+		}
+		return in.classArg(args[n])
+	}
+	if i := strings.IndexByte(tmpl, '<'); i >= 0 && strings.HasSuffix(tmpl, ">") {
+		param := value(tmpl[i+1 : len(tmpl)-1])
+		if param == "" {
+			return tmpl[:i]
+		}
+		return tmpl[:i+1] + param + ">"
+	}
+	return value(tmpl)
+}
+
+// classArg 参数指定的类：Class<X> 类型的值或类名字符串
+func (in *inferer) classArg(arg ast.Expression) string {
+	if t := in.typeOf(arg); Erase(t) == "java.lang.Class" {
+		return Param(t)
+	}
+	if lit, ok := arg.(*ast.Literal); ok {
+		if s, ok := lit.Value.(string); ok {
+			return in.model.Resolve(s)
+		}
+	}
+	return ""
+}
+
+// literalType 字面量的类型，整数和浮点数按后缀区分
+func literalType(lit *ast.Literal) string {
+	suffix := ""
+	if lit.Raw != "" {
+		suffix = strings.ToLower(lit.Raw[len(lit.Raw)-1:])
+	}
+	switch lit.Value.(type) {
+	case string:
+		return "java.lang.String"
+	case rune:
+		return "char"
+	case bool:
+		return "boolean"
+	case int64:
+		switch suffix {
+		case "l":
+			return "long"
+		case "h":
+			return "java.math.BigInteger"
+		}
+		return "int"
+	case float64:
+		switch suffix {
+		case "f":
+			return "float"
+		case "b":
+			return "java.math.BigDecimal"
+		}
+		return "double"
+	}
+	return ""
+}
@@ -0,0 +1,246 @@
+// Package types 推断 OGNL 表达式中各个值的 Java 类型
+//
+// 类型模型 (Model) 是从 JSON 加载的签名库：类的父类和接口、方法名到返回类型、字段和属性的类型，
+// 以及 Struts 预先放入上下文的变量 (#context、#attr) 和上下文中的常见键
+// (#context['com.opensymphony.xwork2.ActionContext.container'] 是 Container)。
+// Builtin 返回随包发布的模型，覆盖 JDK 和 Struts 中载荷常用的类；Merge 可以叠加自定义的模型：
+//
+//	{
+//	  "classes": {
+//	    "com.opensymphony.xwork2.inject.Container": {
+//	      "methods": {"getInstance": "$0"}
+//	    },
+//	    "java.lang.Object": {
+//	      "methods": {"getClass": "java.lang.Class<$this>"}
+//	    }
+//	  },
+//	  "variables": {"context": "ognl.OgnlContext"},
+//	  "contextKeys": {"struts.valueStack": "com.opensymphony.xwork2.util.ValueStack"}
+//	}
+//
+// 返回类型中可以使用占位符：$0、$1 等是对应参数指定的类 (@X@class 或类名字符串)，
+// $this 是接收者的类型，$param 是接收者的类型参数 (Class<T> 中的 T)。
+// 类型写作全限定类名，可以带一个类型参数 (java.lang.Class<java.lang.Runtime>) 或数组后缀 (byte[])。
+//
+// Model.Infer 在语法树上推断类型，结果按节点记录，规则可以据此匹配
+// "接收者是 java.lang.Runtime 的 exec 调用"，而不论接收者是怎样得到的。
+package types
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Object 所有类的父类，模型中没有的类也可以调用它的方法
+const Object = "java.lang.Object"
+
+// Class 模型中的一个类或接口
+type Class struct {
+	Super      string   `json:"super"`
+	Interfaces []string `json:"interfaces"`
+	// Methods 方法名到返回类型，重载的方法共用一个返回类型
+	Methods map[string]string `json:"methods"`
+	// Fields 字段 (包括静态字段) 和属性到类型
+	Fields map[string]string `json:"fields"`
+}
+
+// Model 类型模型，加载后可以被多个 goroutine 同时使用
+type Model struct {
+	Classes map[string]*Class `json:"classes"`
+	// Variables 预先定义的上下文变量 (不含 #) 到类型
+	Variables map[string]string `json:"variables"`
+	// ContextKeys 从上下文 Map 中按键取出的值的类型
+	ContextKeys map[string]string `json:"contextKeys"`
+}
+
+// Parse 解析 JSON 形式的类型模型
+func Parse(data []byte) (*Model, error) {
+	m := &Model{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(m); err != nil {
+		return nil, err
+	}
+	for name, c := range m.Classes {
+		if c == nil {
+			return nil, fmt.Errorf("class %s: null definition", name)
+		}
+		if strings.ContainsAny(name, "<>[]") {
+			return nil, fmt.Errorf("class %s: class names cannot have type arguments or array suffixes", name)
+		}
+	}
+	return m, nil
+}
+
+// ParseFile 读取并解析类型模型文件
+func ParseFile(name string) (*Model, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return m, nil
+}
+
+//go:embed builtin.json
+var builtinJSON []byte
+
+var builtin = func() *Model {
+	m, err := Parse(builtinJSON)
+	if err != nil {
+		panic("types: builtin.json: " + err.Error())
+	}
+	return m
+}()
+
+// Builtin 返回随包发布的模型，调用者不能修改它，需要扩展时使用 Merge
+func Builtin() *Model {
+	return builtin
+}
+
+// Merge 返回叠加了 other 的新模型：other 中的类补充或覆盖同名类的方法和字段，
+// 变量和上下文键覆盖同名的项；两个输入都保持不变
+func (m *Model) Merge(other *Model) *Model {
+	out := &Model{Classes: map[string]*Class{}, Variables: map[string]string{}, ContextKeys: map[string]string{}}
+	for _, src := range []*Model{m, other} {
+		for name, c := range src.Classes {
+			dst := out.Classes[name]
+			if dst == nil {
+				dst = &Class{Methods: map[string]string{}, Fields: map[string]string{}}
+				out.Classes[name] = dst
+			}
+			if c.Super != "" {
+				dst.Super = c.Super
+			}
+			dst.Interfaces = append(dst.Interfaces, c.Interfaces...)
+			for k, v := range c.Methods {
+				dst.Methods[k] = v
+			}
+			for k, v := range c.Fields {
+				dst.Fields[k] = v
+			}
+		}
+		for k, v := range src.Variables {
+			out.Variables[k] = v
+		}
+		for k, v := range src.ContextKeys {
+			out.ContextKeys[k] = v
+		}
+	}
+	return out
+}
+
+// Resolve 把类名解析为模型中的全限定名：java.lang 下的类可以省略包名；模型中没有的类原样返回
+func (m *Model) Resolve(name string) string {
+	if _, ok := m.Classes[name]; ok || strings.Contains(name, ".") {
+		return name
+	}
+	if _, ok := m.Classes["java.lang."+name]; ok {
+		return "java.lang." + name
+	}
+	return name
+}
+
+// IsA 报告类型 t 是否是 target 或其子类型，类型参数不参与比较
+func (m *Model) IsA(t, target string) bool {
+	t, target = Erase(t), Erase(target)
+	if t == "" || target == "" {
+		return false
+	}
+	if target == Object {
+		return true
+	}
+	found := false
+	m.supertypes(t, func(name string) bool {
+		found = name == target
+		return !found
+	})
+	return found
+}
+
+// supertypes 从 t 本身开始按广度优先访问 t 的所有父类和接口，最后是 java.lang.Object；fn 返回 false 时停止
+func (m *Model) supertypes(t string, fn func(string) bool) {
+	seen := map[string]bool{}
+	queue := []string{t}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if !fn(name) {
+			return
+		}
+		if c := m.Classes[name]; c != nil {
+			if c.Super != "" {
+				queue = append(queue, c.Super)
+			}
+			queue = append(queue, c.Interfaces...)
+		}
+	}
+	if !seen[Object] {
+		fn(Object)
+	}
+}
+
+// Method 返回类型 t 上方法的返回类型模板，沿父类和接口查找
+func (m *Model) Method(t, method string) (string, bool) {
+	var out string
+	m.supertypes(Erase(t), func(name string) bool {
+		if c := m.Classes[name]; c != nil {
+			if r, ok := c.Methods[method]; ok {
+				out = r
+				return false
+			}
+		}
+		return true
+	})
+	return out, out != ""
+}
+
+// Property 返回类型 t 上字段或属性 name 的类型：先查字段，再查 getName()/isName() 方法
+func (m *Model) Property(t, name string) (string, bool) {
+	var out string
+	m.supertypes(Erase(t), func(class string) bool {
+		if c := m.Classes[class]; c != nil {
+			if r, ok := c.Fields[name]; ok {
+				out = r
+				return false
+			}
+		}
+		return true
+	})
+	if out != "" || name == "" {
+		return out, out != ""
+	}
+	upper := strings.ToUpper(name[:1]) + name[1:]
+	if r, ok := m.Method(t, "get"+upper); ok {
+		return r, true
+	}
+	return m.Method(t, "is"+upper)
+}
+
+// Erase 去掉类型参数：java.lang.Class<java.lang.Runtime> 得到 java.lang.Class
+func Erase(t string) string {
+	if i := strings.IndexByte(t, '<'); i >= 0 {
+		return t[:i]
+	}
+	return t
+}
+
+// Param 返回类型参数：java.lang.Class<java.lang.Runtime> 得到 java.lang.Runtime，没有时为空
+func Param(t string) string {
+	i := strings.IndexByte(t, '<')
+	if i < 0 || !strings.HasSuffix(t, ">") {
+		return ""
+	}
+	return t[i+1 : len(t)-1]
+}
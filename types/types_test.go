@@ -0,0 +1,141 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weaweawe01/ParserOgnl/ast"
+)
+
+func parse(t *testing.T, input string) ast.Expression {
+	t.Helper()
+	expr, err := ast.New(ast.NewLexer(input)).ParseTopLevelExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expr
+}
+
+// chainTypes 返回表达式中最后一条顶层链各步的类型
+func chainTypes(info *Info, expr ast.Expression) []string {
+	var chain *ast.ChainExpression
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		if c, ok := node.(*ast.ChainExpression); ok {
+			chain = c
+			return false
+		}
+		return true
+	})
+	var out []string
+	for _, step := range chain.Children {
+		out = append(out, step.String()+": "+info.Of(step))
+	}
+	return out
+}
+
+func TestInferChain(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"#attr[\"struts.valueStack\"].context[\"com.opensymphony.xwork2.ActionContext.container\"].getInstance(@com.opensymphony.xwork2.ognl.OgnlUtil@class)", []string{
+			"#attr: java.util.Map",
+			"[\"struts.valueStack\"]: com.opensymphony.xwork2.util.ValueStack",
+			"context: java.util.Map",
+			"[\"com.opensymphony.xwork2.ActionContext.container\"]: com.opensymphony.xwork2.inject.Container",
+			"getInstance(@com.opensymphony.xwork2.ognl.OgnlUtil@class): com.opensymphony.xwork2.ognl.OgnlUtil",
+		}},
+		{"#this.getClass().getClassLoader().loadClass(\"java.lang.Runtime\")", []string{
+			"#this: ",
+			"getClass(): java.lang.Class",
+			"getClassLoader(): java.lang.ClassLoader",
+			"loadClass(\"java.lang.Runtime\"): java.lang.Class<java.lang.Runtime>",
+		}},
+		{"@Class@forName(\"java.lang.ProcessBuilder\").newInstance().start()", []string{
+			"@Class@forName(\"java.lang.ProcessBuilder\"): java.lang.Class<java.lang.ProcessBuilder>",
+			"newInstance(): java.lang.ProcessBuilder",
+			"start(): java.lang.Process",
+		}},
+		{"\"id\".getBytes()[0]", []string{
+			"\"id\": java.lang.String",
+			"getBytes(): byte[]",
+			"[0]: byte",
+		}},
+		{"@java.lang.Thread@currentThread().contextClassLoader.class", []string{
+			"@java.lang.Thread@currentThread(): java.lang.Thread",
+			"contextClassLoader: java.lang.ClassLoader",
+			"class: java.lang.Class<java.lang.ClassLoader>",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr := parse(t, tt.input)
+			got := chainTypes(Builtin().Infer(expr), expr)
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("types:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.expected, "\n"))
+			}
+		})
+	}
+}
+
+// TestInferVariables 变量的类型来自到达的赋值，接收者无论怎样得到都能判断
+func TestInferVariables(t *testing.T) {
+	input := "(#context=#attr['struts.valueStack'].context).(#container=#context['com.opensymphony.xwork2.ActionContext.container'])." +
+		"(#ognlUtil=#container.getInstance(@com.opensymphony.xwork2.ognl.OgnlUtil@class)).(#ognlUtil.setExcludedClasses(''))," +
+		"#rt = @Runtime@getRuntime(), #rt.exec('id'), #context.size() > 1"
+	expr := parse(t, input)
+	info := Builtin().Infer(expr)
+	found := map[string]string{}
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		if v, ok := node.(*ast.VariableExpression); ok {
+			found[v.Name] = info.Of(v)
+		}
+		return true
+	})
+	want := map[string]string{
+		"attr":      "java.util.Map",
+		"context":   "java.util.Map",
+		"container": "com.opensymphony.xwork2.inject.Container",
+		"ognlUtil":  "com.opensymphony.xwork2.ognl.OgnlUtil",
+		"rt":        "java.lang.Runtime",
+	}
+	for name, typ := range want {
+		if found[name] != typ {
+			t.Errorf("#%s: %q, want %q", name, found[name], typ)
+		}
+	}
+	seq := expr.(*ast.SequenceExpression)
+	if got := info.Of(seq.Expressions[len(seq.Expressions)-1]); got != "boolean" {
+		t.Errorf("comparison: %q", got)
+	}
+	if !info.Is(seq.Expressions[1], "Runtime") || info.Is(seq.Expressions[1], "java.lang.Process") {
+		t.Errorf("Is(%s)", seq.Expressions[1])
+	}
+}
+
+func TestModel(t *testing.T) {
+	m := Builtin()
+	if !m.IsA("com.opensymphony.xwork2.util.CompoundRoot", "java.util.Collection") || !m.IsA("ognl.OgnlContext", "java.lang.Object") {
+		t.Error("IsA through interfaces")
+	}
+	if m.IsA("java.lang.String", "java.util.Map") {
+		t.Error("IsA(String, Map)")
+	}
+	custom, err := Parse([]byte(`{"classes": {"com.example.Service": {"methods": {"run": "java.lang.Process"}}}, "contextKeys": {"service": "com.example.Service"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := m.Merge(custom)
+	expr := parse(t, "#context['service'].run().getInputStream()")
+	if got := merged.Infer(expr).Of(expr); got != "java.io.InputStream" {
+		t.Errorf("merged model: %q", got)
+	}
+	if got := m.Infer(expr).Of(expr); got != "" {
+		t.Errorf("builtin model changed by Merge: %q", got)
+	}
+	for _, bad := range []string{`{"classes": {"a.B<T>": {}}}`, `{"types": {}}`, `{"classes": {"a.B": null}}`} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("Parse(%s): no error", bad)
+		}
+	}
+}
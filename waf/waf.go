@@ -0,0 +1,349 @@
+// Package waf 提供拦截 OGNL 注入的 net/http 中间件
+//
+// 中间件用 extract 包找出请求中的 OGNL 片段，用 analyze 包检查每个片段，
+// 再按 Policy 决定放行、标记或阻止请求。每个请求的处理成本有上限：
+// 读取的请求体大小、候选片段的数量和单个片段的长度都由 Policy.Limits 限制，
+// 单个片段的语法树大小由 Policy.MaxNodes 限制，检查一个请求的总时间由 Policy.Timeout 限制；
+// 超出任何一项上限都按 Policy.FailOpen 处理。
+//
+// 检查结果 (Verdict) 通过请求的 context 传给后续的处理程序，见 FromContext。
+package waf
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/weaweawe01/ParserOgnl/analyze"
+	"github.com/weaweawe01/ParserOgnl/ast"
+	"github.com/weaweawe01/ParserOgnl/extract"
+)
+
+// Action 对请求的处理
+type Action int
+
+const (
+	// Allow 没有发现问题，放行
+	Allow Action = iota
+	// Tag 发现问题但未达到阻止的程度 (或处于只监控模式)，记录日志并放行
+	Tag
+	// Block 阻止请求
+	Block
+)
+
+var actionNames = [...]string{
+	Allow: "allow",
+	Tag:   "tag",
+	Block: "block",
+}
+
+func (a Action) String() string {
+	if a >= 0 && int(a) < len(actionNames) {
+		return actionNames[a]
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// Finding 一个候选片段上的一条检查结果
+type Finding struct {
+	Candidate extract.Candidate
+	analyze.Finding
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s %s: %s", f.Candidate.Location, f.Candidate.Name, f.Finding)
+}
+
+// Verdict 一个请求的检查结果
+type Verdict struct {
+	RequestID string
+	Action    Action
+	// Monitored 只监控模式下本应阻止的请求
+	Monitored bool
+	// Severity 所有结果中最高的严重程度，没有结果时为 Info
+	Severity analyze.Severity
+	Findings []Finding
+	// Err 提取或检查候选片段时的第一个错误，如 extract.ErrTooManyCandidates、
+	// 超出长度上限或无法解析的片段、超出 ErrAnalysisBudget 的片段以及超时 (context.DeadlineExceeded)
+	Err error
+}
+
+// Rules 返回命中的规则 ID，按首次出现的顺序去重
+func (v *Verdict) Rules() []string {
+	var rules []string
+	seen := map[string]bool{}
+	for _, f := range v.Findings {
+		if !seen[f.Rule] {
+			seen[f.Rule] = true
+			rules = append(rules, f.Rule)
+		}
+	}
+	return rules
+}
+
+// header 响应头中的检查结果
+func (v *Verdict) header() string {
+	s := fmt.Sprintf("id=%s; action=%s; severity=%s", v.RequestID, v.Action, v.Severity)
+	if v.Monitored {
+		s += "; monitored"
+	}
+	if rules := v.Rules(); len(rules) > 0 {
+		s += "; rules=" + strings.Join(rules, ",")
+	}
+	return s
+}
+
+// Policy 中间件的策略
+type Policy struct {
+	// BlockThreshold 达到该严重程度的结果阻止请求，更低的只标记；零值 Info 表示任何结果都阻止
+	BlockThreshold analyze.Severity
+	// MonitorOnly 只记录和标记，从不阻止请求
+	MonitorOnly bool
+	// Exempt 不检查的路径，使用 path.Match 的模式；以 "/**" 结尾的模式匹配该目录下的所有路径
+	Exempt []string
+	// FailOpen 提取或检查失败 (请求体读取错误、请求体过大、候选片段过多、片段过长、
+	// 包装或带前缀的片段无法解析、超出检查预算或超时) 时放行，默认阻止
+	FailOpen bool
+	// Decide 自定义决定，参数中的 Verdict 已经带有按策略得出的 Action，返回值替换它
+	// 只监控模式在 Decide 之后生效
+	Decide func(r *http.Request, v *Verdict) Action
+	// VerdictHeader 非空时在响应头中以该名字写入检查结果
+	VerdictHeader string
+	// RequestIDHeader 非空时从该请求头读取请求 ID，缺少时生成一个
+	RequestIDHeader string
+	// BlockStatus 阻止请求时的状态码，0 表示 403
+	BlockStatus int
+	// Limits 提取候选片段的上限，限制每个请求的解析成本
+	Limits extract.Limits
+	// MaxNodes 检查的单个片段的语法树的最大节点数，限制每个片段的检查成本；0 表示不限制
+	MaxNodes int
+	// Timeout 检查一个请求的所有片段的最长时间，超时后剩余的部分不再检查，按 FailOpen 处理；0 表示不限制
+	Timeout time.Duration
+	// Analyzer 检查使用的分析器，nil 表示默认规则
+	Analyzer *analyze.Analyzer
+	// Logger 记录被标记和阻止的请求，nil 表示不记录
+	Logger *slog.Logger
+}
+
+// DefaultPolicy 阻止 High 及以上的结果，请求体最多检查 256KB (multipart 请求体连同文件最多 8MB)，
+// 最多 64 个片段，每个片段最长 8KB、最多 2048 个节点，每个请求最多检查 200ms
+func DefaultPolicy() Policy {
+	return Policy{
+		BlockThreshold: analyze.High,
+		VerdictHeader:  "X-OGNL-Verdict",
+		Limits: extract.Limits{
+			MaxBodySize:   256 << 10,
+			MaxUploadSize: 8 << 20,
+			MaxCandidates: 64,
+			MaxLength:     8 << 10,
+		},
+		MaxNodes: 2048,
+		Timeout:  200 * time.Millisecond,
+	}
+}
+
+// ErrAnalysisBudget 片段的语法树超过 Policy.MaxNodes，没有检查
+var ErrAnalysisBudget = errors.New("candidate exceeds the analysis budget")
+
+// WAF 按策略检查请求，可以被多个 goroutine 同时使用
+type WAF struct {
+	policy    Policy
+	extractor *extract.Extractor
+	analyzer  *analyze.Analyzer
+}
+
+// New 使用给定策略创建 WAF
+func New(policy Policy) *WAF {
+	analyzer := policy.Analyzer
+	if analyzer == nil {
+		analyzer = analyze.New()
+	}
+	if policy.BlockStatus == 0 {
+		policy.BlockStatus = http.StatusForbidden
+	}
+	return &WAF{policy: policy, extractor: extract.New(policy.Limits), analyzer: analyzer}
+}
+
+// Middleware 使用给定策略创建中间件
+func Middleware(policy Policy) func(http.Handler) http.Handler {
+	return New(policy).Handler
+}
+
+// Handler 返回检查请求后再交给 next 的处理程序
+func (w *WAF) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if w.Exempt(r.URL.Path) {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		v := w.Inspect(r)
+		w.log(r, v)
+		if w.policy.VerdictHeader != "" {
+			rw.Header().Set(w.policy.VerdictHeader, v.header())
+		}
+		if v.Action == Block {
+			http.Error(rw, "request blocked: "+v.RequestID, w.policy.BlockStatus)
+			return
+		}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), verdictKey{}, v)))
+	})
+}
+
+// Exempt 报告路径是否不需要检查
+// 路径先用 path.Clean 规范化；带有 ".." 段的路径 (包括 Tomcat 当作 ".." 的 "..;") 从不豁免，
+// 后续的处理程序可能按不同的方式解析它们
+func (w *WAF) Exempt(p string) bool {
+	for _, segment := range strings.Split(p, "/") {
+		if segment, _, _ = strings.Cut(segment, ";"); segment == ".." {
+			return false
+		}
+	}
+	p = path.Clean("/" + p)
+	for _, pattern := range w.policy.Exempt {
+		if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+			if p == dir || strings.HasPrefix(p, dir+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Inspect 检查请求并按策略做出决定，请求体读取后会放回 r.Body
+func (w *WAF) Inspect(r *http.Request) *Verdict {
+	v := &Verdict{RequestID: w.requestID(r)}
+	cands, err := w.extractor.Request(r)
+	v.Err = err
+	ctx := r.Context()
+	if w.policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.policy.Timeout)
+		defer cancel()
+	}
+	for _, c := range cands {
+		ok, err := w.check(c)
+		if err != nil {
+			// 没有检查的片段可能是攻击，和提取失败一样由 FailOpen 决定
+			if v.Err == nil {
+				v.Err = fmt.Errorf("%s %s: %w", c.Location, c.Name, err)
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+		findings, err := w.analyzer.AnalyzeContext(ctx, c.Expr)
+		for _, f := range findings {
+			v.Findings = append(v.Findings, Finding{Candidate: c, Finding: f})
+			if f.Severity > v.Severity {
+				v.Severity = f.Severity
+			}
+		}
+		if err != nil {
+			// 超时或请求已经取消，剩余的片段不再检查
+			if v.Err == nil {
+				v.Err = fmt.Errorf("%s %s: %w", c.Location, c.Name, err)
+			}
+			break
+		}
+	}
+
+	switch {
+	case v.Err != nil && !w.policy.FailOpen:
+		v.Action = Block
+	case len(v.Findings) == 0:
+		v.Action = Allow
+	case v.Severity >= w.policy.BlockThreshold:
+		v.Action = Block
+	default:
+		v.Action = Tag
+	}
+	if w.policy.Decide != nil {
+		v.Action = w.policy.Decide(r, v)
+	}
+	if w.policy.MonitorOnly && v.Action == Block {
+		v.Action, v.Monitored = Tag, true
+	}
+	return v
+}
+
+// check 报告是否检查片段，片段无法检查时返回错误：
+//   - %{} / ${} 包装或带有 redirect: 等前缀的片段会被 Struts 求值，解析失败是错误
+//   - 只是看起来像 OGNL 的参数名和参数值 (extract.Candidate.Heuristic) 解析失败时是普通文本，不检查
+//   - 超过 MaxLength 或 MaxNodes 的片段无论来源都是错误
+func (w *WAF) check(c extract.Candidate) (bool, error) {
+	if c.Err != nil {
+		if c.Heuristic && !errors.Is(c.Err, extract.ErrCandidateTooLong) {
+			return false, nil
+		}
+		return false, c.Err
+	}
+	if w.policy.MaxNodes <= 0 {
+		return true, nil
+	}
+	nodes := 0
+	ast.Inspect(c.Expr, func(ast.Expression) bool {
+		nodes++
+		return nodes <= w.policy.MaxNodes
+	})
+	if nodes > w.policy.MaxNodes {
+		return false, ErrAnalysisBudget
+	}
+	return true, nil
+}
+
+// requestID 从请求头读取请求 ID，缺少时生成 16 个十六进制字符
+func (w *WAF) requestID(r *http.Request) string {
+	if w.policy.RequestIDHeader != "" {
+		if id := r.Header.Get(w.policy.RequestIDHeader); id != "" {
+			return id
+		}
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func (w *WAF) log(r *http.Request, v *Verdict) {
+	if w.policy.Logger == nil || v.Action == Allow {
+		return
+	}
+	level := slog.LevelInfo
+	if v.Action == Block || v.Monitored {
+		level = slog.LevelWarn
+	}
+	attrs := []any{
+		"id", v.RequestID,
+		"action", v.Action.String(),
+		"severity", v.Severity.String(),
+		"method", r.Method,
+		"path", r.URL.Path,
+		"rules", strings.Join(v.Rules(), ","),
+	}
+	if v.Monitored {
+		attrs = append(attrs, "monitored", true)
+	}
+	if v.Err != nil {
+		attrs = append(attrs, "error", v.Err.Error())
+	}
+	w.policy.Logger.Log(r.Context(), level, "ognl inspection", attrs...)
+}
+
+type verdictKey struct{}
+
+// FromContext 返回中间件放入请求 context 的检查结果，豁免的请求没有结果
+func FromContext(ctx context.Context) (*Verdict, bool) {
+	v, ok := ctx.Value(verdictKey{}).(*Verdict)
+	return v, ok
+}
@@ -0,0 +1,267 @@
+package waf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/weaweawe01/ParserOgnl/analyze"
+	"github.com/weaweawe01/ParserOgnl/extract"
+)
+
+const s2045 = "%{(#_='multipart/form-data').(#dm=@ognl.OgnlContext@DEFAULT_MEMBER_ACCESS).(#_memberAccess=#dm)." +
+	"(#cmd='id').(#p=new java.lang.ProcessBuilder({'/bin/sh','-c',#cmd})).(#p.start())}"
+
+// echo 返回请求体，并在响应头中写出中间件放入 context 的检查结果
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if v, ok := FromContext(r.Context()); ok {
+		w.Header().Set("X-Seen-Action", v.Action.String())
+	}
+	io.Copy(w, r.Body)
+})
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	h := Middleware(DefaultPolicy())(echo)
+
+	r := httptest.NewRequest("POST", "/upload.action", nil)
+	r.Header.Set("Content-Type", s2045)
+	rec := serve(h, r)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("S2-045 status = %d", rec.Code)
+	}
+	verdict := rec.Header().Get("X-OGNL-Verdict")
+	if !strings.Contains(verdict, "action=block; severity=critical; rules=default-member-access,member-access,process-builder") {
+		t.Errorf("verdict header = %q", verdict)
+	}
+
+	body := "name=bob&note=" + url.QueryEscape("#context['attr']")
+	r = httptest.NewRequest("POST", "/save.action", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = serve(h, r)
+	if rec.Code != http.StatusOK || rec.Body.String() != body || rec.Header().Get("X-Seen-Action") != "tag" {
+		t.Errorf("medium finding: status %d, body %q, action %q", rec.Code, rec.Body, rec.Header().Get("X-Seen-Action"))
+	}
+
+	rec = serve(h, httptest.NewRequest("GET", "/list.action?page=2", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Seen-Action") != "allow" {
+		t.Errorf("benign request: status %d, action %q", rec.Code, rec.Header().Get("X-Seen-Action"))
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	attack := func() *http.Request {
+		r := httptest.NewRequest("GET", "/app/index.action?redirect:"+url.QueryEscape("${@java.lang.Runtime@getRuntime().exec('id')}"), nil)
+		r.Header.Set("X-Request-ID", "req-1")
+		return r
+	}
+
+	var logs bytes.Buffer
+	policy := DefaultPolicy()
+	policy.MonitorOnly = true
+	policy.RequestIDHeader = "X-Request-ID"
+	policy.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	rec := serve(Middleware(policy)(echo), attack())
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Seen-Action") != "tag" {
+		t.Errorf("monitor only: status %d, action %q", rec.Code, rec.Header().Get("X-Seen-Action"))
+	}
+	if got := rec.Header().Get("X-OGNL-Verdict"); got != "id=req-1; action=tag; severity=critical; monitored; rules=dangerous-class,runtime-exec" {
+		t.Errorf("verdict header = %q", got)
+	}
+	if !strings.Contains(logs.String(), "level=WARN") || !strings.Contains(logs.String(), "id=req-1") {
+		t.Errorf("log = %q", logs.String())
+	}
+
+	policy = DefaultPolicy()
+	policy.Exempt = []string{"/app/**", "/health"}
+	rec = serve(Middleware(policy)(echo), attack())
+	if rec.Code != http.StatusOK || rec.Header().Get("X-OGNL-Verdict") != "" || rec.Header().Get("X-Seen-Action") != "" {
+		t.Errorf("exempt: status %d, headers %v", rec.Code, rec.Header())
+	}
+
+	// 规范化之后再匹配，带有 ".." 段的路径不豁免
+	w := New(policy)
+	tests := []struct {
+		path   string
+		exempt bool
+	}{
+		{"/health", true},
+		{"/app", true},
+		{"//app/./x.action", true},
+		{"/health/", true},
+		{"/app/../x.action", false},
+		{"/app/..;/x.action", false},
+		{"/healthz", false},
+	}
+	for _, tt := range tests {
+		if got := w.Exempt(tt.path); got != tt.exempt {
+			t.Errorf("Exempt(%q) = %v", tt.path, got)
+		}
+	}
+	r := httptest.NewRequest("GET", "/app/%2e%2e/x.action?redirect:"+url.QueryEscape("${@java.lang.Runtime@getRuntime().exec('id')}"), nil)
+	if rec = serve(Middleware(policy)(echo), r); rec.Code != http.StatusForbidden {
+		t.Errorf("exempt with ..: status %d", rec.Code)
+	}
+
+	policy = DefaultPolicy()
+	policy.VerdictHeader = ""
+	policy.Decide = func(r *http.Request, v *Verdict) Action {
+		if r.Header.Get("X-Trusted") != "" {
+			return Tag
+		}
+		return v.Action
+	}
+	h := Middleware(policy)(echo)
+	if rec = serve(h, attack()); rec.Code != http.StatusForbidden || rec.Header().Get("X-OGNL-Verdict") != "" {
+		t.Errorf("decide: status %d, headers %v", rec.Code, rec.Header())
+	}
+	r = attack()
+	r.Header.Set("X-Trusted", "1")
+	if rec = serve(h, r); rec.Code != http.StatusOK {
+		t.Errorf("decide trusted: status %d", rec.Code)
+	}
+}
+
+// TestBoundedCost 候选片段过多或片段无法检查时默认阻止，FailOpen 时放行
+func TestBoundedCost(t *testing.T) {
+	q := url.Values{}
+	for i := 0; i < 10; i++ {
+		q.Set(strings.Repeat("p", i+1), "#x")
+	}
+	policy := DefaultPolicy()
+	policy.Limits = extract.Limits{MaxCandidates: 4}
+	w := New(policy)
+	v := w.Inspect(httptest.NewRequest("GET", "/?"+q.Encode(), nil))
+	if v.Action != Block || v.Err != extract.ErrTooManyCandidates || len(v.Findings) != 0 {
+		t.Errorf("overflow verdict = %+v", v)
+	}
+	policy.FailOpen = true
+	if v := New(policy).Inspect(httptest.NewRequest("GET", "/?"+q.Encode(), nil)); v.Action != Allow {
+		t.Errorf("fail open verdict = %+v", v)
+	}
+
+	// 过长、包装或带前缀却无法解析、超出节点预算的片段没有检查，同样由 FailOpen 决定
+	long := "#a" + strings.Repeat("+#a", 3000)
+	tests := []struct {
+		query, expected string
+	}{
+		{"x=" + url.QueryEscape(long), "query-value x: candidate too long: 9002 bytes exceeds the 8192 byte limit"},
+		{"x=" + url.QueryEscape("%{#a=(}"), "query-value x: "},
+		{"redirect:" + url.QueryEscape("#a=("), "query-name redirect:#a=(: "},
+		{"x=" + url.QueryEscape("#a"+strings.Repeat("+#a", 2500)), "query-value x: candidate exceeds the analysis budget"},
+	}
+	for _, tt := range tests {
+		policy := DefaultPolicy()
+		v := New(policy).Inspect(httptest.NewRequest("GET", "/?"+tt.query, nil))
+		if v.Action != Block || v.Err == nil || !strings.HasPrefix(v.Err.Error(), tt.expected) {
+			t.Errorf("%.40s: verdict = %v, %v", tt.query, v.Action, v.Err)
+		}
+		policy.FailOpen = true
+		if v := New(policy).Inspect(httptest.NewRequest("GET", "/?"+tt.query, nil)); v.Action != Allow || v.Err == nil {
+			t.Errorf("%.40s: fail open verdict = %v, %v", tt.query, v.Action, v.Err)
+		}
+	}
+}
+
+// TestTimeout 每个片段都在上限之内、但检查耗时的请求在 Timeout 内结束，超时按 FailOpen 处理
+func TestTimeout(t *testing.T) {
+	q := url.Values{"pad": {strings.Repeat("z", 60<<10)}}
+	for i := 0; i < 10; i++ {
+		q.Set(fmt.Sprint("v", i), `#x="a"`+strings.Repeat(`+"a"`, 999))
+	}
+	body := q.Encode()
+	post := func() *http.Request {
+		r := httptest.NewRequest("POST", "/save.action", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+
+	policy := DefaultPolicy()
+	start := time.Now()
+	rec := serve(Middleware(policy)(echo), post())
+	if elapsed := time.Since(start); elapsed > policy.Timeout+time.Second {
+		t.Errorf("default policy took %v", elapsed)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("default policy: status %d, verdict %q", rec.Code, rec.Header().Get("X-OGNL-Verdict"))
+	}
+
+	policy.Timeout = time.Nanosecond
+	v := New(policy).Inspect(post())
+	if v.Action != Block || !errors.Is(v.Err, context.DeadlineExceeded) {
+		t.Errorf("timeout verdict = %v, %v", v.Action, v.Err)
+	}
+	policy.FailOpen = true
+	if v := New(policy).Inspect(post()); v.Action == Block || !errors.Is(v.Err, context.DeadlineExceeded) {
+		t.Errorf("fail open timeout verdict = %v, %v", v.Action, v.Err)
+	}
+}
+
+// TestBenign 默认策略放行看起来像 OGNL 的普通参数和大文件上传
+func TestBenign(t *testing.T) {
+	h := Middleware(DefaultPolicy())(echo)
+	form := func(body string) *http.Request {
+		r := httptest.NewRequest("POST", "/save.action", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	var upload bytes.Buffer
+	upload.WriteString("--XX\r\nContent-Disposition: form-data; name=\"file\"; filename=\"photo.jpg\"\r\n" +
+		"Content-Type: image/jpeg\r\n\r\n")
+	upload.Write(bytes.Repeat([]byte{0xff, 0xd8, '#', '{'}, 300<<10/4))
+	upload.WriteString("\r\n--XX\r\nContent-Disposition: form-data; name=\"title\"\r\n\r\nholiday\r\n--XX--\r\n")
+	multipart := httptest.NewRequest("POST", "/upload.action", bytes.NewReader(upload.Bytes()))
+	multipart.Header.Set("Content-Type", "multipart/form-data; boundary=XX")
+
+	tests := []struct {
+		name string
+		r    *http.Request
+	}{
+		{"array parameter", form("items[]=1&items[]=2")},
+		{"hashtag", form("comment=I+love+%23golang!!")},
+		{"upload", multipart},
+	}
+	for _, tt := range tests {
+		if rec := serve(h, tt.r); rec.Code != http.StatusOK || rec.Header().Get("X-Seen-Action") != "allow" {
+			t.Errorf("%s: status %d, verdict %q", tt.name, rec.Code, rec.Header().Get("X-OGNL-Verdict"))
+		}
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.BlockThreshold = analyze.Critical
+	h := Middleware(policy)(echo)
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := httptest.NewRequest("GET", "/", nil)
+			want := http.StatusOK
+			if i%2 == 0 {
+				r.Header.Set("Content-Type", s2045)
+				want = http.StatusForbidden
+			}
+			if rec := serve(h, r); rec.Code != want {
+				t.Errorf("request %d: status %d, want %d", i, rec.Code, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}